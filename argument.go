@@ -0,0 +1,138 @@
+package readline
+
+import (
+	"strconv"
+)
+
+// maxArgument bounds the numeric argument, like in GNU readline.
+const maxArgument = 1000000
+
+// opArgument is the numeric argument being typed before a key, e.g.
+// M-1 M-2 or M--, or universal-argument which is 4 alone and multiplies
+// it by 4 each time it's pressed again. The digits and - typed after it
+// go on with it.
+type opArgument struct {
+	typing   bool
+	n        int
+	digits   bool
+	negative bool
+}
+
+// value returns the argument typed.
+func (a *opArgument) value() int {
+	if a.negative {
+		return -a.n
+	}
+	return a.n
+}
+
+// metaDigit returns the digit of the Meta digit keys, M-0 to M-9.
+func metaDigit(r rune) (int, bool) {
+	if r > MetaDigit0 || r < MetaDigit9 {
+		return 0, false
+	}
+	return int(MetaDigit0 - r), true
+}
+
+// argumentKey takes r for the numeric argument, and returns false then.
+// Otherwise it returns how many times r is performed, negative for the
+// other way.
+func (o *Operation) argumentKey(r rune) (count int, ok bool) {
+	a := &o.argument
+	start := func() {
+		if !a.typing {
+			*a = opArgument{typing: true, n: 1}
+		}
+	}
+	d, digit := metaDigit(r)
+	if a.typing && r >= '0' && r <= '9' {
+		d, digit = int(r-'0'), true
+	}
+	switch {
+	case r == MetaUniversalArgument:
+		start()
+		if !a.digits && a.n*4 <= maxArgument {
+			a.n *= 4
+		}
+	case r == MetaNegativeArgument || r == '-' && a.typing && !a.digits:
+		start()
+		a.negative = true
+	case digit:
+		start()
+		if !a.digits {
+			a.n, a.digits = 0, true
+		}
+		if a.n = a.n*10 + d; a.n > maxArgument {
+			a.n = maxArgument
+		}
+	case a.typing:
+		count = a.value()
+		*a = opArgument{}
+		o.buf.Refresh(nil)
+		return count, true
+	default:
+		return 1, true
+	}
+	o.w.Write(o.buf.BelowOutput([]byte("(arg: " + strconv.Itoa(a.value()) + ")")))
+	return 0, false
+}
+
+// repeatedKey returns the key performed count times for a numeric
+// argument, the key going the other way for a negative one. The keys which
+// don't repeat are performed once.
+func (o *Operation) repeatedKey(r rune, count int) (rune, int) {
+	if count == 1 || o.IsSearchMode() {
+		return r, 1
+	}
+	switch r {
+	case CharForward, CharBackward, MetaForward, MetaBackward,
+		CharDelete, CharBackspace, CharCtrlH, MetaDelete, MetaBackspace,
+		CharCtrlW, CharKill, CharCtrlU:
+	default:
+		if !IsPrintable(r) {
+			return r, 1
+		}
+	}
+	if count >= 0 {
+		return r, count
+	}
+	switch r {
+	case CharForward:
+		return CharBackward, -count
+	case CharBackward:
+		return CharForward, -count
+	case MetaForward:
+		return MetaBackward, -count
+	case MetaBackward:
+		return MetaForward, -count
+	case CharDelete:
+		return CharBackspace, -count
+	case CharBackspace, CharCtrlH:
+		if o.buf.Len() == 0 {
+			// rather than EOF
+			return r, 1
+		}
+		return CharDelete, -count
+	case MetaDelete:
+		return MetaBackspace, -count
+	case MetaBackspace, CharCtrlW:
+		return MetaDelete, -count
+	case CharKill:
+		return CharCtrlU, -count
+	case CharCtrlU:
+		return CharKill, -count
+	}
+	return r, 1
+}
+
+// repeat performs edit count times, the text they cut is joined in one
+// entry of the kill ring.
+func (o *Operation) repeat(count int, edit func()) {
+	kills := o.buf.kills
+	for i := 0; i < count; i++ {
+		if i > 0 && o.buf.kills != kills {
+			o.buf.SetAppendKill(true)
+		}
+		edit()
+	}
+}
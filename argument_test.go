@@ -0,0 +1,69 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgument(t *testing.T) {
+	for _, c := range []struct {
+		input  string
+		expect string
+	}{
+		{"\x1b3x\r", "xxx"},
+		{"abcd\x01\x1b2\x06X\r", "abXcd"},
+		// the digits go on with the argument
+		{"\x1b1" + "2x\r", strings.Repeat("x", 12)},
+		// 0 times
+		{"a\x1b0xb\r", "ab"},
+		// negative, the other way
+		{"abcd\x1b-2\x06X\r", "abXcd"},
+		{"abcd\x02\x02\x1b-\x0b\r", "cd"},
+		// the words cut are joined
+		{"a b c d\x01\x1b2\x1bd\x05\x19\r", " c da b"},
+		{"abcd\x01\x1b3\x04\r", "d"},
+		// universal-argument, bound to Ctrl-U
+		{"\x15x\r", "xxxx"},
+		{"\x15\x15x\r", strings.Repeat("x", 16)},
+		{"\x15" + "3x\r", "xxx"},
+		{"abcd\x15-\x06X\r", "Xabcd"},
+		// the keys which don't repeat are performed once
+		{"ab\x1b3\x01X\r", "Xab"},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			Keymaps: map[string]Keymap{KeymapEmacs: {CharCtrlU: MetaUniversalArgument}},
+		})
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Errorf("%q: result not expect %q %v", c.input, line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestArgumentIndicator(t *testing.T) {
+	d, err := NewDriver(&Config{Prompt: "> "}, 40, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := d.Readline()
+		lines <- line
+	}()
+
+	d.Type("\x1b-\x1b1" + "2")
+	if _, err := d.Expect(`^\(arg: -12\)$`); err != nil {
+		t.Fatal(err)
+	}
+	d.Type("a")
+	if _, err := d.Expect(`^> a\n\n`); err != nil {
+		t.Fatal(err)
+	}
+	d.Press("enter")
+	if line := <-lines; line != "a" {
+		t.Fatal("result not expect", line)
+	}
+}
@@ -0,0 +1,141 @@
+package readline
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// The completion menu and the search status are drawn on the rows below
+// the line. The cursor moves down to them and back up by as many rows as
+// were drawn, counted as the terminal wraps them, rather than being saved
+// and restored: once the rows reach the bottom of the screen it scrolls,
+// and the saved cell isn't the one of the cursor anymore. The rows which
+// don't fit on the screen below the cursor are cut, since it can't move
+// up beyond the top.
+
+// LineOrigin tells where the line is drawn, for the Painters which draw
+// around it. The rows are counted from the one where the prompt starts,
+// relative to the cursor rather than to the screen: they stay right when
+// the screen scrolls, e.g. as the rows below reach its bottom.
+type LineOrigin struct {
+	// the row and the column of the cursor
+	Row, Col int
+	// the rows the prompt and the line take
+	Rows int
+	// the rows drawn below the line, by the completion menu or the search
+	// status
+	Below int
+}
+
+// Origin returns where the line was drawn last. It doesn't wait for the
+// line, so that the Painter may call it.
+func (r *RuneBuffer) Origin() LineOrigin {
+	r.originLock.Lock()
+	defer r.originLock.Unlock()
+	return r.origin
+}
+
+// setOrigin records where the line is drawn, with the rows below it.
+func (r *RuneBuffer) setOrigin(below int) {
+	cur, end := r.cursorRowCol()
+	r.originLock.Lock()
+	r.origin = LineOrigin{Row: cur.row, Col: cur.col, Rows: end.row + 1, Below: below}
+	r.originLock.Unlock()
+}
+
+// BelowOutput returns the output which draws text on the rows below the
+// line and moves the cursor back to its place in the line.
+func (r *RuneBuffer) BelowOutput(text []byte) []byte {
+	r.Lock()
+	defer r.Unlock()
+	return r.belowOutput(text)
+}
+
+func (r *RuneBuffer) belowOutput(text []byte) []byte {
+	cur, end := r.cursorRowCol()
+	// to the start of the row below the line
+	down := end.row - cur.row + 1
+	maxRow := -1
+	if r.cfg.FuncGetHeight != nil {
+		if height := r.cfg.FuncGetHeight(); height > 0 {
+			if maxRow = height - 1 - down; maxRow < 0 {
+				r.setOrigin(0)
+				return nil
+			}
+		}
+	}
+	text, rows := clipRows(text, r.width, maxRow)
+	r.setOrigin(rows + 1)
+
+	buf := make([]byte, 0, down+len(text)+16)
+	for i := 0; i < down; i++ {
+		buf = append(buf, '\n')
+	}
+	buf = append(buf, "\r\033[J"...)
+	buf = append(buf, text...)
+	buf = append(buf, "\033["+strconv.Itoa(down+rows)+"A\r"...)
+	if cur.col > 0 {
+		buf = append(buf, "\033["+strconv.Itoa(cur.col)+"C"...)
+	}
+	return buf
+}
+
+// cursorRowCol returns where the cursor and the end of the line are drawn,
+// with the rows counted from the one of the prompt.
+func (r *RuneBuffer) cursorRowCol() (cur, end rowCol) {
+	if r.width <= 0 {
+		col := r.promptLen() + runes.WidthAll(r.buf[:r.idx])
+		return rowCol{0, col}, rowCol{0, col}
+	}
+	pos := r.layout()
+	return pos[r.idx], pos[len(r.buf)]
+}
+
+// clipRows returns the text up to the end of the row maxRow, as the
+// terminal wraps it at the width, and the row where the text ends. The
+// rows aren't wrapped if the width isn't known, nor cut if maxRow is -1.
+func clipRows(text []byte, width, maxRow int) ([]byte, int) {
+	row, col := 0, 0
+	for i := 0; i < len(text); {
+		c, size := utf8.DecodeRune(text[i:])
+		switch {
+		case c == '\033':
+			i += escapeLen(text[i:])
+			continue
+		case c == '\n':
+			row, col = row+1, 0
+		case c == '\r':
+			col = 0
+		default:
+			w := runes.Width(c)
+			// a row which fills the width wraps with the next rune
+			if width > 0 && col+w > width {
+				row, col = row+1, w
+			} else {
+				col += w
+			}
+		}
+		if maxRow >= 0 && row > maxRow {
+			return append(text[:i:i], "\033[0m"...), maxRow
+		}
+		i += size
+	}
+	return text, row
+}
+
+// escapeLen returns the length of the escape sequence at the start of b,
+// a CSI up to its final byte or else ESC and the next byte.
+func escapeLen(b []byte) int {
+	if len(b) < 2 {
+		return len(b)
+	}
+	if b[1] != '[' {
+		return 2
+	}
+	for i := 2; i < len(b); i++ {
+		if b[i] >= 0x40 && b[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,169 @@
+package readline
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// cursorScreen follows the cursor of a terminal through the output, it
+// wraps the rows and scrolls at the bottom like xterm does.
+type cursorScreen struct {
+	width, height int
+	row, col      int
+	scrolled      int
+}
+
+func (s *cursorScreen) lineFeed() {
+	if s.row == s.height-1 {
+		s.scrolled++
+	} else {
+		s.row++
+	}
+}
+
+func (s *cursorScreen) write(b []byte) {
+	for i := 0; i < len(b); {
+		c, size := utf8.DecodeRune(b[i:])
+		switch {
+		case c == '\033':
+			n := escapeLen(b[i:])
+			seq := string(b[i : i+n])
+			arg, _ := strconv.Atoi(strings.TrimLeft(seq[:len(seq)-1], "\033["))
+			if arg == 0 {
+				arg = 1
+			}
+			switch seq[len(seq)-1] {
+			case 'A':
+				if s.row -= arg; s.row < 0 {
+					s.row = 0
+				}
+				if s.col == s.width {
+					s.col--
+				}
+			case 'C':
+				if s.col += arg; s.col > s.width-1 {
+					s.col = s.width - 1
+				}
+			}
+			i += n
+			continue
+		case c == '\n':
+			s.lineFeed()
+			s.col = 0
+		case c == '\r':
+			s.col = 0
+		default:
+			w := runes.Width(c)
+			if s.col+w > s.width {
+				s.lineFeed()
+				s.col = 0
+			}
+			s.col += w
+		}
+		i += size
+	}
+}
+
+func TestBelowOutput(t *testing.T) {
+	const height = 6
+	texts := []string{
+		"bck-i-search: abc\033[4m \033[0m",
+		strings.Repeat("x", 35),
+		"a\nb\nc\nd\ne\nf\ng\n",
+		strings.Repeat("0123456789", 2) + "\n",
+	}
+	for _, width := range []int{10, 13, 20} {
+		cfg := &Config{
+			ContinuationPrompt: "..",
+			FuncIsTerminal:     func() bool { return false },
+			FuncGetHeight:      func() int { return height },
+		}
+		rb := NewRuneBuffer(nil, "> ", cfg, width)
+		for _, line := range []string{"", "abc", "abcdefghijklmnop", "中文中文中文中文", "ab\ncd"} {
+			for _, idx := range []int{0, 2, -1} {
+				rb.Set([]rune(line))
+				if idx >= 0 && idx <= len(rb.buf) {
+					rb.idx = idx
+				}
+				cur, end := rb.cursorRowCol()
+				for _, text := range texts {
+					for start := 0; start+end.row < height; start++ {
+						s := &cursorScreen{width: width, height: height, row: start + cur.row, col: cur.col}
+						s.write(rb.BelowOutput([]byte(text)))
+						if s.row != start+cur.row-s.scrolled || s.col != cur.col {
+							t.Fatalf("width %d, %q at %d from row %d, %q: cursor at %d,%d, expect %d,%d",
+								width, line, rb.idx, start, text, s.row, s.col, start+cur.row-s.scrolled, cur.col)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestClipRows(t *testing.T) {
+	for _, c := range []struct {
+		text   string
+		width  int
+		maxRow int
+		expect string
+		rows   int
+	}{
+		// a full row wraps with the next rune, not the newline
+		{"0123456789\nab", 10, -1, "0123456789\nab", 1},
+		{"0123456789ab", 10, -1, "0123456789ab", 1},
+		{"\033[30;47mabc\033[0m", 3, -1, "\033[30;47mabc\033[0m", 0},
+		{"中文中文中", 9, -1, "中文中文中", 1},
+		{"a\nb\nc", 10, 1, "a\nb\033[0m", 1},
+		{"0123456789ab", 10, 0, "0123456789\033[0m", 0},
+		{"a\nb", 0, -1, "a\nb", 1},
+	} {
+		text, rows := clipRows([]byte(c.text), c.width, c.maxRow)
+		if string(text) != c.expect || rows != c.rows {
+			t.Fatalf("%q: expect %q %d, got %q %d", c.text, c.expect, c.rows, text, rows)
+		}
+	}
+}
+
+type originPainter struct {
+	rb     *RuneBuffer
+	origin LineOrigin
+}
+
+func (p *originPainter) Paint(line []rune, _ int) []rune {
+	p.origin = p.rb.Origin()
+	return line
+}
+
+func TestLineOrigin(t *testing.T) {
+	painter := &originPainter{}
+	cfg := &Config{
+		ForceUseInteractive: true,
+		Painter:             painter,
+		FuncGetHeight:       func() int { return 24 },
+	}
+	rb := NewRuneBuffer(ioutil.Discard, "> ", cfg, 10)
+	painter.rb = rb
+	rb.Set([]rune("abcdefghijklmnop"))
+	expect := LineOrigin{Row: 1, Col: 8, Rows: 2}
+	if got := rb.Origin(); got != expect {
+		t.Fatalf("expect %+v, got %+v", expect, got)
+	}
+	rb.BelowOutput([]byte("a\nbcdefghijkl"))
+	expect.Below = 3
+	if got := rb.Origin(); got != expect {
+		t.Fatalf("expect %+v, got %+v", expect, got)
+	}
+
+	// the Painter sees the line as it was drawn last
+	rb.MoveToLineStart()
+	if painter.origin != expect {
+		t.Fatalf("expect %+v, got %+v", expect, painter.origin)
+	}
+	if got := rb.Origin(); got != (LineOrigin{Row: 0, Col: 2, Rows: 2}) {
+		t.Fatalf("result not expect %+v", got)
+	}
+}
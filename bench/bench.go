@@ -0,0 +1,281 @@
+// Package bench holds benchmark scenarios of the line editor, which the
+// applications can run with their own Config to measure how it performs
+// with their completers, painters, history and options:
+//
+//	func BenchmarkEditor(b *testing.B) {
+//		bench.Run(b, newConfig())
+//	}
+//
+// Measure and Compare run them outside of `go test -bench`, e.g. to fail
+// a CI step when a scenario gets slower than a saved baseline.
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/chzyer/readline"
+)
+
+// Scenario is a benchmark of the line editor.
+type Scenario struct {
+	Name string
+	// runs b.N times with an Instance of cfg, see Run
+	Run func(b *testing.B, cfg *readline.Config)
+}
+
+// Scenarios are the built-in scenarios.
+var Scenarios = []Scenario{
+	{"LongLine", LongLine},
+	{"HugeHistory", HugeHistory},
+	{"CompletionStorm", CompletionStorm},
+	{"PasteFlood", PasteFlood},
+}
+
+// Run runs the Scenarios as sub-benchmarks of b. The Instances are made
+// of clones of cfg, which mustn't have been used yet, with their input
+// and output replaced by pipes and an 80x24 terminal.
+func Run(b *testing.B, cfg *readline.Config) {
+	for _, s := range Scenarios {
+		s := s
+		b.Run(s.Name, func(b *testing.B) {
+			s.Run(b, cfg)
+		})
+	}
+}
+
+// editor is an Instance which reads the keys written to w.
+type editor struct {
+	*readline.Instance
+	w *io.PipeWriter
+}
+
+func newEditor(b *testing.B, cfg *readline.Config) *editor {
+	r, w := io.Pipe()
+	c := cfg.Clone()
+	c.Stdin = r
+	c.Stdout, c.Stderr, c.PromptWriter = ioutil.Discard, ioutil.Discard, nil
+	c.FuncIsTerminal = func() bool { return true }
+	c.FuncMakeRaw = func() error { return nil }
+	c.FuncExitRaw = func() error { return nil }
+	c.FuncGetWidth = func() int { return 80 }
+	c.FuncGetHeight = func() int { return 24 }
+	c.FuncOnWidthChanged = func(func()) {}
+	rl, err := readline.NewEx(c)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return &editor{rl, w}
+}
+
+// line types keys and reads the line they end.
+func (e *editor) line(b *testing.B, keys []byte) string {
+	go e.w.Write(keys)
+	line, err := e.Readline()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return line
+}
+
+func (e *editor) Close() {
+	e.w.Close()
+	e.Instance.Close()
+}
+
+// words returns n words of the given length, spread over the alphabet.
+func words(n, length int) []string {
+	ret := make([]string, n)
+	for i := range ret {
+		var w strings.Builder
+		for j, x := 0, i; j < length; j++ {
+			w.WriteByte(byte('a' + x%26))
+			x = x/26 + j
+		}
+		ret[i] = w.String()
+	}
+	return ret
+}
+
+// LongLine types a line of 1024 runes and edits it: it moves by words
+// over it, kills and yanks words, transposes and undoes.
+func LongLine(b *testing.B, cfg *readline.Config) {
+	text := strings.Join(words(128, 7), " ")
+	var keys bytes.Buffer
+	keys.WriteString(text)
+	keys.WriteString("\x01") // Ctrl-A
+	for i := 0; i < 64; i++ {
+		keys.WriteString("\033f\033f\x14") // M-f M-f Ctrl-T
+	}
+	for i := 0; i < 32; i++ {
+		keys.WriteString("\033d\033b\x19\x1f") // M-d M-b Ctrl-Y Ctrl-_
+	}
+	keys.WriteString("\x05\r") // Ctrl-E Enter
+
+	e := newEditor(b, cfg)
+	defer e.Close()
+	b.SetBytes(int64(keys.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.line(b, keys.Bytes())
+	}
+}
+
+// HugeHistory loads a history file of 100000 lines, searches it backward
+// and browses it.
+func HugeHistory(b *testing.B, cfg *readline.Config) {
+	dir, err := ioutil.TempDir("", "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var history bytes.Buffer
+	for i, w := range words(100000, 12) {
+		fmt.Fprintf(&history, "%s %d\n", w, i)
+	}
+	file := filepath.Join(dir, "history")
+	c := cfg.Clone()
+	c.HistoryFile = file
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		// the history is trimmed to the HistoryLimit of cfg when loaded
+		if err := ioutil.WriteFile(file, history.Bytes(), 0600); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		e := newEditor(b, c)
+		// Ctrl-R 99 Ctrl-G, Up x 100, Ctrl-U Enter
+		e.line(b, []byte("\x1299\x07"+strings.Repeat("\033[A", 100)+"\x15\r"))
+		e.Close()
+	}
+}
+
+// storm completes the words of a fixed list, like a command completing
+// files or hosts.
+type storm []string
+
+func (s storm) Do(line []rune, pos int) ([][]rune, int) {
+	typed := string(line[:pos])
+	if i := strings.LastIndexByte(typed, ' '); i >= 0 {
+		typed = typed[i+1:]
+	}
+	var ret [][]rune
+	for _, w := range s {
+		if strings.HasPrefix(w, typed) {
+			ret = append(ret, []rune(w[len(typed):]))
+		}
+	}
+	return ret, len([]rune(typed))
+}
+
+// CompletionStorm completes 100 words with Tab three times each, which
+// lists the candidates and selects them in the menu, and cancels. The
+// AutoComplete of cfg is used, or else 10000 candidates.
+func CompletionStorm(b *testing.B, cfg *readline.Config) {
+	c := cfg.Clone()
+	if c.AutoComplete == nil {
+		c.AutoComplete = storm(words(10000, 8))
+	}
+	var keys bytes.Buffer
+	for _, w := range words(100, 2) {
+		// Ctrl-G cancels the menu or the query of the many candidates,
+		// Ctrl-U kills what's left
+		keys.WriteString(w + "\t\t\t\x07\x07\x15")
+	}
+	keys.WriteString("\r")
+
+	e := newEditor(b, c)
+	defer e.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.line(b, keys.Bytes())
+	}
+}
+
+// PasteFlood pastes 64 KiB of text in a line in the bracketed paste mode
+// if cfg enables it, or else 4 KiB, since each key of them is drawn.
+func PasteFlood(b *testing.B, cfg *readline.Config) {
+	var keys bytes.Buffer
+	if cfg.EnableBracketedPaste {
+		text := strings.Join(words(8192, 7), " ")
+		keys.WriteString("\033[200~" + text + "\033[201~")
+	} else {
+		keys.WriteString(strings.Join(words(512, 7), " "))
+	}
+	keys.WriteString("\r")
+
+	e := newEditor(b, cfg)
+	defer e.Close()
+	b.SetBytes(int64(keys.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.line(b, keys.Bytes())
+	}
+}
+
+// Result is how a Scenario performed.
+type Result struct {
+	Name        string `json:"name"`
+	NsPerOp     int64  `json:"nsPerOp"`
+	AllocsPerOp int64  `json:"allocsPerOp"`
+	BytesPerOp  int64  `json:"bytesPerOp"`
+}
+
+// Measure runs the Scenarios with cfg, see Run, outside of `go test`.
+func Measure(cfg *readline.Config) []Result {
+	var results []Result
+	for _, s := range Scenarios {
+		s := s
+		r := testing.Benchmark(func(b *testing.B) {
+			s.Run(b, cfg)
+		})
+		results = append(results, Result{
+			Name:        s.Name,
+			NsPerOp:     r.NsPerOp(),
+			AllocsPerOp: r.AllocsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+		})
+	}
+	return results
+}
+
+// Compare returns an error listing the results which took longer than
+// the ones of the same name in baseline by more than tolerance, e.g. 0.2
+// for 20%, or allocated more. The results missing from baseline pass.
+func Compare(baseline, results []Result, tolerance float64) error {
+	base := make(map[string]Result, len(baseline))
+	for _, r := range baseline {
+		base[r.Name] = r
+	}
+	var slower []string
+	for _, r := range results {
+		old, ok := base[r.Name]
+		if !ok {
+			continue
+		}
+		if float64(r.NsPerOp) > float64(old.NsPerOp)*(1+tolerance) {
+			slower = append(slower, fmt.Sprintf("%s: %d ns/op, was %d", r.Name, r.NsPerOp, old.NsPerOp))
+		}
+		if float64(r.AllocsPerOp) > float64(old.AllocsPerOp)*(1+tolerance) {
+			slower = append(slower, fmt.Sprintf("%s: %d allocs/op, was %d", r.Name, r.AllocsPerOp, old.AllocsPerOp))
+		}
+	}
+	if len(slower) == 0 {
+		return nil
+	}
+	sort.Strings(slower)
+	return fmt.Errorf("bench: regressions:\n%s", strings.Join(slower, "\n"))
+}
@@ -0,0 +1,37 @@
+package bench
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chzyer/readline"
+)
+
+func BenchmarkDefault(b *testing.B) {
+	Run(b, &readline.Config{Prompt: "> "})
+}
+
+func BenchmarkBracketedPaste(b *testing.B) {
+	PasteFlood(b, &readline.Config{EnableBracketedPaste: true})
+}
+
+func TestCompare(t *testing.T) {
+	baseline := []Result{
+		{Name: "LongLine", NsPerOp: 1000, AllocsPerOp: 10},
+		{Name: "PasteFlood", NsPerOp: 1000, AllocsPerOp: 10},
+	}
+	results := []Result{
+		{Name: "LongLine", NsPerOp: 1100, AllocsPerOp: 10},
+		{Name: "PasteFlood", NsPerOp: 1300, AllocsPerOp: 20},
+		{Name: "New", NsPerOp: 5000},
+	}
+	if err := Compare(baseline, results[:1], 0.2); err != nil {
+		t.Fatal(err)
+	}
+	err := Compare(baseline, results, 0.2)
+	if err == nil || strings.Contains(err.Error(), "LongLine") ||
+		!strings.Contains(err.Error(), "PasteFlood: 1300 ns/op, was 1000") ||
+		!strings.Contains(err.Error(), "PasteFlood: 20 allocs/op, was 10") {
+		t.Fatal("error not expect", err)
+	}
+}
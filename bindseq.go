@@ -0,0 +1,227 @@
+package readline
+
+import "time"
+
+// KeyHandler is the action bound to a sequence of keys by BindKey.
+// It edits buf, and returns true to accept the line, like Enter; it can
+// abandon the line instead, like Ctrl-C, with buf.Abort.
+type KeyHandler func(buf *RuneBuffer) bool
+
+type keyBinding struct {
+	seq     []rune
+	handler KeyHandler
+}
+
+// opBindings holds the sequences bound by BindKey. They're matched, with
+// the Config.Chords of the active keymaps, on the keys as the Terminal
+// decodes them, e.g. {MetaBackward} or {CharBell, 'x'} for Ctrl-G x,
+// before the keymaps; the handlers only while editing the line. The keys
+// of a sequence being typed are held and shown below the line, and
+// performed as they are once the next key doesn't go on with any
+// sequence, or once Config.ChordTimeout passes. Ctrl-X always begins a
+// sequence, which doesn't time out: the ones which aren't bound are the
+// built-in ones, e.g. C-x C-u, or cancel like Ctrl-G.
+type opBindings struct {
+	// guarded by Operation.m
+	list []keyBinding
+	// the keys of the sequence being typed and how long they wait for the
+	// next one, and the keys to read again after the sequence which
+	// didn't match
+	typed   []rune
+	timeout time.Duration
+	replay  []rune
+	// how many keys the last key performed took, see handleMacro
+	size int
+	// how many of the keys read again were held and timed out, they
+	// aren't matched again
+	skip int
+}
+
+// BindKey makes the keys of seq run handler while editing the line, it
+// replaces the handler bound to the same keys. The Ctrl-X chords are
+// matched as their keys, e.g. {CharCtrlX, CharCtrlU} for C-x C-u.
+func (o *Operation) BindKey(seq []rune, handler KeyHandler) {
+	if len(seq) == 0 {
+		return
+	}
+	o.m.Lock()
+	defer o.m.Unlock()
+	for i, b := range o.bindings.list {
+		if runes.Equal(b.seq, seq) {
+			o.bindings.list[i].handler = handler
+			return
+		}
+	}
+	o.bindings.list = append(o.bindings.list, keyBinding{runes.Copy(seq), handler})
+}
+
+// Unbind removes the handler bound to seq.
+func (o *Operation) Unbind(seq []rune) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	for i, b := range o.bindings.list {
+		if runes.Equal(b.seq, seq) {
+			o.bindings.list = append(o.bindings.list[:i], o.bindings.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// nextKey reads the next key, or the next one to read again, which was
+// already recorded and filtered.
+func (o *Operation) nextKey() (r rune, replayed bool) {
+	if replay := o.bindings.replay; len(replay) > 0 {
+		o.bindings.replay = replay[1:]
+		return replay[0], true
+	}
+	if len(o.bindings.typed) > 0 && o.bindings.timeout > 0 {
+		return o.readSequenceKey()
+	}
+	return o.readKey(), false
+}
+
+// lookupSequence returns what typed is bound to, a handler or else the
+// action of a chord of the active keymaps, and whether typed begins a
+// longer sequence.
+func (o *Operation) lookupSequence(typed []rune) (handler KeyHandler, action rune, bound, prefix bool) {
+	editing := true
+	switch o.mode() {
+	case ModePager, ModeBrowser, ModeMenu, ModeSearch:
+		editing = false
+	}
+	stack := o.keymapStack()
+	o.m.Lock()
+	defer o.m.Unlock()
+	if editing {
+		for _, b := range o.bindings.list {
+			if runes.Equal(b.seq, typed) {
+				handler, bound = b.handler, true
+			} else if len(b.seq) > len(typed) && runes.Equal(b.seq[:len(typed)], typed) {
+				prefix = true
+			}
+		}
+	}
+	for _, name := range stack {
+		for _, c := range o.cfg.Chords[name] {
+			switch {
+			case runes.Equal(c.Keys, typed):
+				if !bound {
+					action, bound = c.Action, true
+				}
+			case len(c.Keys) > len(typed) && runes.Equal(c.Keys[:len(typed)], typed):
+				prefix = true
+			}
+		}
+	}
+	return
+}
+
+// sequenceKey matches r against the bound sequences. It returns the key
+// to perform and, if a chord was typed, the action bound to it. It
+// returns false if r was held or its handler was run.
+func (o *Operation) sequenceKey(r rune) (key, action rune, bound, ok bool) {
+	if o.bindings.skip > 0 {
+		o.bindings.skip--
+		o.bindings.size = 1
+		return r, 0, false, true
+	}
+	typed := append(o.bindings.typed, r)
+	handler, action, bound, prefix := o.lookupSequence(typed)
+	ctrlX := typed[0] == CharCtrlX
+	o.bindings.size = len(typed)
+	switch {
+	case r != 0 && (prefix || ctrlX && len(typed) == 1):
+		// a longer sequence wins, like in GNU readline
+		o.bindings.typed = typed
+		o.bindings.timeout = o.keyConfig().ChordTimeout
+		if ctrlX {
+			o.bindings.timeout = 0
+		}
+		if stopsReading(r) {
+			o.t.KickRead()
+		}
+		o.w.Write(o.buf.BelowOutput([]byte(chordName(typed) + "-")))
+		return 0, 0, false, false
+	case handler != nil:
+		o.endSequence()
+		key, ok = o.runKeyHandler(handler)
+		return key, 0, false, ok
+	case bound:
+		o.endSequence()
+		return r, action, true, true
+	case ctrlX:
+		o.endSequence()
+		if stopsReading(r) {
+			o.t.KickRead()
+		}
+		if r == 0 {
+			o.bindings.replay = append([]rune{0}, o.bindings.replay...)
+		}
+		if len(typed) == 2 {
+			return ctrlXKey(r), 0, false, true
+		}
+		return CharBell, 0, false, true
+	case len(typed) > 1:
+		o.endSequence()
+		o.bindings.size = 1
+		o.bindings.replay = append(runes.Copy(typed[1:]), o.bindings.replay...)
+		return typed[0], 0, false, true
+	}
+	return r, 0, false, true
+}
+
+// endSequence forgets the keys held, and clears their indicator.
+func (o *Operation) endSequence() {
+	if len(o.bindings.typed) == 0 {
+		return
+	}
+	o.bindings.typed = nil
+	o.buf.Refresh(nil)
+}
+
+// readSequenceKey reads the next key of the sequence being typed. Once
+// Config.ChordTimeout passes, it returns the first key held instead, and
+// the other ones are read next: they're all performed as they are.
+func (o *Operation) readSequenceKey() (r rune, replayed bool) {
+	timer := time.NewTimer(o.bindings.timeout)
+	r, ok := o.t.readRuneWithin(timer.C)
+	timer.Stop()
+	if ok {
+		o.buf.SetBurst(o.t.Burst())
+		return r, false
+	}
+	typed := o.bindings.typed
+	o.endSequence()
+	o.bindings.skip = len(typed)
+	o.bindings.replay = append(runes.Copy(typed[1:]), o.bindings.replay...)
+	return typed[0], true
+}
+
+// runKeyHandler runs the handler of a sequence, and returns the key which
+// ends the line if it does.
+func (o *Operation) runKeyHandler(handler KeyHandler) (rune, bool) {
+	accept := handler(o.buf)
+	switch {
+	case o.buf.takeAbort():
+		return CharInterrupt, true
+	case accept:
+		return CharEnter, true
+	}
+	o.endKey(false, false, true)
+	return 0, false
+}
+
+// Abort makes the KeyHandler which calls it abandon the line.
+func (r *RuneBuffer) Abort() {
+	r.Lock()
+	r.aborted = true
+	r.Unlock()
+}
+
+func (r *RuneBuffer) takeAbort() bool {
+	r.Lock()
+	defer r.Unlock()
+	aborted := r.aborted
+	r.aborted = false
+	return aborted
+}
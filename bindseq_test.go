@@ -0,0 +1,89 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBindKey(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+
+	// Ctrl-G u
+	rl.BindKey([]rune{CharBell, 'u'}, func(buf *RuneBuffer) bool {
+		buf.Set([]rune(strings.ToUpper(string(buf.Runes()))))
+		return false
+	})
+	rl.BindKey([]rune{'!'}, func(buf *RuneBuffer) bool {
+		buf.WriteString("?")
+		return true
+	})
+	rl.BindKey([]rune{'#'}, func(buf *RuneBuffer) bool {
+		buf.Abort()
+		return false
+	})
+
+	for _, c := range []struct {
+		input  string
+		expect string
+		err    error
+	}{
+		{"ab\x07u\r", "AB", nil},
+		// the keys which don't make a sequence keep their action
+		{"ab\x07c\x07\x02\x02u\r", "aubc", nil},
+		{"a!", "a?", nil},
+		{"a#", "a", ErrInterrupt},
+	} {
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != c.err || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+	}
+
+	rl.Unbind([]rune{'!'})
+	go w.Write([]byte("a!\r"))
+	if line, err := rl.Readline(); err != nil || line != "a!" {
+		t.Fatalf("result not expect %q %v", line, err)
+	}
+}
+
+func TestBindKeyWithChords(t *testing.T) {
+	d, err := NewDriver(&Config{
+		Prompt:       "> ",
+		ChordTimeout: 50 * time.Millisecond,
+		Chords: map[string][]Chord{
+			KeymapEmacs: {{[]rune{'q', 'w'}, CharLineStart}},
+		},
+	}, 40, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.BindKey([]rune{'q', 'q'}, func(buf *RuneBuffer) bool {
+		buf.Set([]rune(strings.ToUpper(string(buf.Runes()))))
+		return false
+	})
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := d.Readline()
+		lines <- line
+	}()
+
+	// the sequences and the chords share the keys held, and the timeout
+	d.Type("abq")
+	if _, err := d.Expect(`^q-$`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Expect(`^> abq\n\n`); err != nil {
+		t.Fatal(err)
+	}
+	d.Type("qq")
+	if _, err := d.Expect(`^> ABQ\n\n`); err != nil {
+		t.Fatal(err)
+	}
+	d.Type("qwx")
+	d.Press("enter")
+	if line := <-lines; line != "xABQ" {
+		t.Fatal("result not expect", line)
+	}
+}
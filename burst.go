@@ -0,0 +1,48 @@
+package readline
+
+import "time"
+
+// Without the bracketed paste, a paste reaches the ioloop as keys typed in
+// a row, and drawing the line with the Painter, FuncDiagnose and
+// FuncHighlight after each of them stalls a long paste. The Terminal flags the keys which are
+// already buffered, or which follow the previous one within
+// Config.PasteBurstGap: the line is drawn without the hooks for them, and
+// again with the hooks once no key follows within the gap.
+
+// SetBurst tells whether the keys being handled are part of a paste burst.
+func (r *RuneBuffer) SetBurst(on bool) {
+	r.Lock()
+	r.burst = on
+	r.Unlock()
+}
+
+// Stale tells whether the line was drawn without the hooks during a burst.
+func (r *RuneBuffer) Stale() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.stale
+}
+
+func (r *RuneBuffer) hasPaintHooks() bool {
+	_, ok := r.cfg.Painter.(*defaultPainter)
+	return !ok || r.cfg.FuncDiagnose != nil || r.cfg.FuncHighlight != nil
+}
+
+// readKey reads the next key and records whether it's part of a burst. The
+// line drawn without the hooks is drawn again when the burst ends.
+func (o *Operation) readKey() rune {
+	if o.buf.Stale() {
+		timer := time.NewTimer(o.GetConfig().PasteBurstGap)
+		r, ok := o.t.readRuneWithin(timer.C)
+		timer.Stop()
+		if ok {
+			o.buf.SetBurst(o.t.Burst())
+			return r
+		}
+		o.buf.SetBurst(false)
+		o.buf.Refresh(nil)
+	}
+	r := o.t.ReadRune()
+	o.buf.SetBurst(o.t.Burst())
+	return r
+}
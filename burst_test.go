@@ -0,0 +1,52 @@
+package readline
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPasteBurst(t *testing.T) {
+	for _, gap := range []time.Duration{0, -1} {
+		out := new(syncBuffer)
+		var m sync.Mutex
+		var painted []string
+		rl, w := newTestInstance(t, &Config{
+			Stdout:        out,
+			PasteBurstGap: gap,
+			Painter: funcPainter(func(line []rune, pos int) []rune {
+				m.Lock()
+				painted = append(painted, string(line))
+				m.Unlock()
+				return []rune(strings.ToUpper(string(line)))
+			}),
+		})
+
+		go func() {
+			w.Write([]byte("hello world"))
+			// painted once the burst ends
+			for !strings.Contains(out.String(), "HELLO WORLD") {
+				time.Sleep(time.Millisecond)
+			}
+			w.Write([]byte("\r"))
+		}()
+		if line, err := rl.Readline(); err != nil || line != "hello world" {
+			t.Fatalf("result not expect %q %v", line, err)
+		}
+		rl.Close()
+		w.Close()
+
+		m.Lock()
+		partial := false
+		for _, line := range painted {
+			if line != "" && !strings.HasPrefix(line, "hello world") {
+				partial = true
+			}
+		}
+		m.Unlock()
+		if partial != (gap < 0) {
+			t.Fatalf("gap %v: painted %q", gap, painted)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package readline
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Capabilities tells which text attributes the terminal is believed to
+// draw, so that highlighters can degrade gracefully instead of sending
+// sequences which show up as plain underlines or garbage.
+type Capabilities struct {
+	// the number of colors, 0, 16, 256 or 1<<24
+	Colors int
+	// the curly and colored underlines, SGR 4:3 and 58
+	Undercurl     bool
+	Strikethrough bool
+	Overline      bool
+}
+
+// DetectCapabilities guesses the Capabilities of the terminal from the
+// environment, since the terminals don't answer queries about them.
+func DetectCapabilities() Capabilities {
+	return detectCapabilities(os.Getenv)
+}
+
+func detectCapabilities(getenv func(string) string) Capabilities {
+	term := getenv("TERM")
+	colorterm := strings.ToLower(getenv("COLORTERM"))
+	program := getenv("TERM_PROGRAM")
+	vte, _ := strconv.Atoi(getenv("VTE_VERSION"))
+	if term == "dumb" {
+		return Capabilities{}
+	}
+
+	var c Capabilities
+	switch {
+	case colorterm == "truecolor" || colorterm == "24bit":
+		c.Colors = 1 << 24
+	case strings.Contains(term, "256color"):
+		c.Colors = 256
+	default:
+		c.Colors = 16
+	}
+
+	modern := vte >= 5000 || program == "WezTerm" || program == "mintty"
+	for _, name := range []string{"kitty", "wezterm", "foot", "contour"} {
+		if strings.Contains(term, name) {
+			modern = true
+		}
+	}
+	c.Undercurl = modern && (vte == 0 || vte >= 5102) ||
+		strings.Contains(term, "alacritty")
+	c.Overline = modern
+	c.Strikethrough = modern || strings.HasPrefix(term, "xterm") ||
+		strings.Contains(term, "alacritty") || program == "iTerm.app" ||
+		getenv("WT_SESSION") != ""
+	return c
+}
+
+// SGR drops the parameters of an SGR sequence (e.g. "1;4:3;58;5;1")
+// which the terminal lacks, the undercurl degrades to a plain underline.
+func (c Capabilities) SGR(params string) string {
+	var ret []string
+	fields := strings.Split(params, ";")
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case strings.HasPrefix(f, "4:") && f != "4:0" && !c.Undercurl:
+			f = "4"
+		case f == "9" && !c.Strikethrough, f == "53" && !c.Overline:
+			continue
+		case f == "38" || f == "48" || f == "58":
+			// 5;n or 2;r;g;b follow
+			n := 3
+			if i+1 < len(fields) && fields[i+1] == "2" {
+				n = 5
+			}
+			if i+n > len(fields) {
+				n = len(fields) - i
+			}
+			if f != "58" || c.Undercurl {
+				ret = append(ret, fields[i:i+n]...)
+			}
+			i += n - 1
+			continue
+		}
+		ret = append(ret, f)
+	}
+	return strings.Join(ret, ";")
+}
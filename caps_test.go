@@ -0,0 +1,45 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	cases := []struct {
+		env    map[string]string
+		expect Capabilities
+	}{
+		{map[string]string{"TERM": "dumb"}, Capabilities{}},
+		{map[string]string{"TERM": "linux"}, Capabilities{Colors: 16}},
+		{map[string]string{"TERM": "xterm-256color"}, Capabilities{Colors: 256, Strikethrough: true}},
+		{map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor", "VTE_VERSION": "5001"},
+			Capabilities{Colors: 1 << 24, Strikethrough: true, Overline: true}},
+		{map[string]string{"TERM": "xterm-kitty"},
+			Capabilities{Colors: 16, Undercurl: true, Strikethrough: true, Overline: true}},
+	}
+	for _, c := range cases {
+		got := detectCapabilities(func(name string) string { return c.env[name] })
+		if got != c.expect {
+			t.Fatalf("%v: expect %+v, got %+v", c.env, c.expect, got)
+		}
+	}
+}
+
+func TestCapabilitiesSGR(t *testing.T) {
+	plain := Capabilities{Colors: 256}
+	cases := []struct {
+		caps   Capabilities
+		params string
+		expect string
+	}{
+		{plain, "1;4:3;58;5;1", "1;4"},
+		{plain, "9;38;2;1;2;3;53", "38;2;1;2;3"},
+		{plain, "4:0", "4:0"},
+		{Capabilities{Undercurl: true, Strikethrough: true}, "4:3;58;5;1;9", "4:3;58;5;1;9"},
+	}
+	for _, c := range cases {
+		if got := c.caps.SGR(c.params); got != c.expect {
+			t.Fatalf("%q: expect %q, got %q", c.params, c.expect, got)
+		}
+	}
+}
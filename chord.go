@@ -0,0 +1,33 @@
+package readline
+
+import "strings"
+
+// Chord binds the keys typed one after the other, e.g. {CharCtrlX,
+// CharBckSearch} or {'g', 'g'}, to the key whose action they perform,
+// like a Keymap does for a single key. They're matched with the sequences
+// of BindKey, see opBindings.
+type Chord struct {
+	Keys   []rune
+	Action rune
+}
+
+// chordName names the keys of a chord, e.g. "C-x C-r".
+func chordName(keys []rune) string {
+	names := make([]string, len(keys))
+	for i, r := range keys {
+		names[i] = KeyName(r)
+	}
+	return strings.Join(names, " ")
+}
+
+// bindChord returns chords with c added, in place of the chord of the
+// same keys.
+func bindChord(chords []Chord, c Chord) []Chord {
+	for i, old := range chords {
+		if runes.Equal(old.Keys, c.Keys) {
+			chords = append(chords[:i:i], chords[i+1:]...)
+			break
+		}
+	}
+	return append(chords, c)
+}
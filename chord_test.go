@@ -0,0 +1,98 @@
+package readline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChord(t *testing.T) {
+	chords := map[string][]Chord{
+		KeymapEmacs:     {{[]rune{CharCtrlX, CharBckSearch}, CharLineStart}},
+		KeymapViInsert:  {{[]rune{'j', 'k'}, CharEsc}},
+		KeymapViCommand: {{[]rune{'g', 'g'}, CharLineStart}},
+	}
+	for _, c := range []struct {
+		vim    bool
+		input  string
+		expect string
+	}{
+		{false, "ab\x18\x12X\r", "Xab"},
+		// the Ctrl-X chords which aren't bound cancel like Ctrl-G
+		{false, "ab\x18zc\r", "abc"},
+		// the built-in ones still work
+		{false, "ab\x18\x15c\r", "c"},
+		{true, "abjk0x\r", "b"},
+		{true, "ajxjjk0x\r", "jxj"},
+		{true, "abc\x1bggx\r", "bc"},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			VimMode:      c.vim,
+			Chords:       chords,
+			ChordTimeout: -1,
+		})
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Errorf("%q: result not expect %q %v", c.input, line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestChordTimeout(t *testing.T) {
+	d, err := NewDriver(&Config{
+		Prompt:       "> ",
+		VimMode:      true,
+		ChordTimeout: 50 * time.Millisecond,
+		Chords: map[string][]Chord{
+			KeymapViInsert: {{[]rune{'j', 'k'}, CharEsc}},
+			KeymapEmacs:    {{[]rune{CharCtrlX, CharBckSearch}, CharLineStart}},
+		},
+	}, 40, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := d.Readline()
+		lines <- line
+	}()
+
+	d.Type("j")
+	if _, err := d.Expect(`^j-$`); err != nil {
+		t.Fatal(err)
+	}
+	// performed as it is once the chord times out
+	if _, err := d.Expect(`^> j\n\n`); err != nil {
+		t.Fatal(err)
+	}
+	// Ctrl-X waits for the next key
+	d.Type("\x18")
+	if _, err := d.Expect(`^C-x-$`); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	d.Type("\x12x")
+	if _, err := d.Expect(`^> xj\n\n`); err != nil {
+		t.Fatal(err)
+	}
+	d.Type("jk0x")
+	d.Press("enter")
+	if line := <-lines; line != "j" {
+		t.Fatal("result not expect", line)
+	}
+
+	cfg := d.Config.Clone()
+	cfg.Chords = nil
+	d.SetConfig(cfg)
+	go func() {
+		line, _ := d.Readline()
+		lines <- line
+	}()
+	d.Type("jk")
+	d.Press("enter")
+	if line := <-lines; line != "jk" {
+		t.Fatal("result not expect", line)
+	}
+}
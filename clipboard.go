@@ -0,0 +1,66 @@
+package readline
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+var ErrClipboardEmpty = errors.New("clipboard is empty")
+
+// Clipboard is the system clipboard, it backs the "+ and "* registers in
+// vi mode, and the kills and yanks if Config.BridgeClipboard is set.
+// Desktop applications may implement it by e.g. github.com/atotto/clipboard,
+// while servers would rather use the OSC52Clipboard or NoopClipboard.
+type Clipboard interface {
+	Read() (string, error)
+	Write(string) error
+}
+
+// NoopClipboard discards everything written and is always empty.
+type NoopClipboard struct{}
+
+func (NoopClipboard) Read() (string, error) {
+	return "", ErrClipboardEmpty
+}
+
+func (NoopClipboard) Write(string) error {
+	return nil
+}
+
+// OSC52Clipboard copies to the clipboard of the terminal emulator by the
+// OSC 52 escape sequence, which works across ssh as well.
+// Most terminals refuse to report their clipboard, so Read only returns
+// what has been written through it.
+type OSC52Clipboard struct {
+	W io.Writer
+
+	m    sync.Mutex
+	last *string
+}
+
+func (c *OSC52Clipboard) Write(s string) error {
+	seq := "\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(s)) + "\a"
+	if os.Getenv("TMUX") != "" {
+		// let tmux pass it through to the outer terminal
+		seq = "\033Ptmux;\033" + seq + "\033\\"
+	}
+	if _, err := io.WriteString(c.W, seq); err != nil {
+		return err
+	}
+	c.m.Lock()
+	c.last = &s
+	c.m.Unlock()
+	return nil
+}
+
+func (c *OSC52Clipboard) Read() (string, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.last == nil {
+		return "", ErrClipboardEmpty
+	}
+	return *c.last, nil
+}
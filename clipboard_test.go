@@ -0,0 +1,28 @@
+package readline
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestBridgeClipboard(t *testing.T) {
+	cb := &OSC52Clipboard{W: ioutil.Discard}
+	rl, w := newTestInstance(t, &Config{
+		Clipboard:       cb,
+		BridgeClipboard: true,
+	})
+
+	go w.Write([]byte("hello world\x17\r"))
+	if line, err := rl.Readline(); err != nil || line != "hello " {
+		t.Fatal("result not expect", line, err)
+	}
+	if text, _ := cb.Read(); text != "world" {
+		t.Fatal("kill is not copied", text)
+	}
+
+	cb.Write("pasted")
+	go w.Write([]byte("\x19\r"))
+	if line, err := rl.Readline(); err != nil || line != "pasted" {
+		t.Fatal("result not expect", line, err)
+	}
+}
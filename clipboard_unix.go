@@ -0,0 +1,9 @@
+// +build aix darwin dragonfly freebsd linux,!appengine netbsd openbsd os400 solaris
+
+package readline
+
+import "io"
+
+func newDefaultClipboard(w io.Writer) Clipboard {
+	return &OSC52Clipboard{W: w}
+}
@@ -0,0 +1,94 @@
+// +build windows
+
+package readline
+
+import (
+	"io"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	user32           = syscall.NewLazyDLL("user32.dll")
+	openClipboard    = user32.NewProc("OpenClipboard")
+	closeClipboard   = user32.NewProc("CloseClipboard")
+	emptyClipboard   = user32.NewProc("EmptyClipboard")
+	getClipboardData = user32.NewProc("GetClipboardData")
+	setClipboardData = user32.NewProc("SetClipboardData")
+
+	globalAlloc  = kernel32.NewProc("GlobalAlloc")
+	globalFree   = kernel32.NewProc("GlobalFree")
+	globalLock   = kernel32.NewProc("GlobalLock")
+	globalUnlock = kernel32.NewProc("GlobalUnlock")
+	lstrlenW     = kernel32.NewProc("lstrlenW")
+	moveMemory   = kernel32.NewProc("RtlMoveMemory")
+)
+
+const (
+	cfUnicodeText = 13
+	gmemMoveable  = 0x0002
+)
+
+func newDefaultClipboard(io.Writer) Clipboard {
+	return WindowsClipboard{}
+}
+
+// WindowsClipboard is the clipboard of windows.
+type WindowsClipboard struct{}
+
+func (WindowsClipboard) Read() (string, error) {
+	if r, _, err := openClipboard.Call(0); r == 0 {
+		return "", err
+	}
+	defer closeClipboard.Call()
+
+	h, _, err := getClipboardData.Call(cfUnicodeText)
+	if h == 0 {
+		return "", ErrClipboardEmpty
+	}
+	p, _, err := globalLock.Call(h)
+	if p == 0 {
+		return "", err
+	}
+	defer globalUnlock.Call(h)
+
+	n, _, _ := lstrlenW.Call(p)
+	if n == 0 {
+		return "", nil
+	}
+	text := make([]uint16, n)
+	moveMemory.Call(uintptr(unsafe.Pointer(&text[0])), p, n*2)
+	return string(utf16.Decode(text)), nil
+}
+
+func (WindowsClipboard) Write(s string) error {
+	data, err := syscall.UTF16FromString(s)
+	if err != nil {
+		return err
+	}
+	if r, _, err := openClipboard.Call(0); r == 0 {
+		return err
+	}
+	defer closeClipboard.Call()
+	emptyClipboard.Call()
+
+	h, _, err := globalAlloc.Call(gmemMoveable, uintptr(len(data)*2))
+	if h == 0 {
+		return err
+	}
+	p, _, err := globalLock.Call(h)
+	if p == 0 {
+		globalFree.Call(h)
+		return err
+	}
+	moveMemory.Call(p, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)*2))
+	globalUnlock.Call(h)
+
+	// the system owns h once it's set
+	if r, _, err := setClipboardData.Call(cfUnicodeText, h); r == 0 {
+		globalFree.Call(h)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package readline
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// sortCandidates orders the completion candidates with FuncCollate, or
+// else with the collation of cfg.Locale, or else in byte order. The
+// descriptions, if not nil, are ordered along.
+func sortCandidates(cfg *Config, candidates [][]rune, descs []string) {
+	compare := cfg.FuncCollate
+	if compare == nil {
+		compare = localeCollate(cfg.Locale)
+	}
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return compare(string(candidates[order[i]]), string(candidates[order[j]])) < 0
+	})
+	sorted := make([][]rune, len(candidates))
+	for i, idx := range order {
+		sorted[i] = candidates[idx]
+	}
+	copy(candidates, sorted)
+	if descs != nil {
+		sortedDescs := make([]string, len(descs))
+		for i, idx := range order {
+			sortedDescs[i] = descs[idx]
+		}
+		copy(descs, sortedDescs)
+	}
+}
+
+// localeCollate returns the comparison of the collation of locale, a BCP
+// 47 tag like "sv-SE", or the byte order if it's empty. A Collator isn't
+// safe for concurrent use, so there's a new one for each sort.
+func localeCollate(locale string) func(a, b string) int {
+	if locale == "" {
+		return strings.Compare
+	}
+	return collate.New(language.Make(locale)).CompareString
+}
+
+var diacritics = map[rune]rune{}
+
+func init() {
+	for base, marked := range map[rune]string{
+		'A': "ÀÁÂÃÄÅĀĂĄ", 'a': "àáâãäåāăą",
+		'C': "ÇĆĈĊČ", 'c': "çćĉċč",
+		'D': "ĎĐ", 'd': "ďđ",
+		'E': "ÈÉÊËĒĔĖĘĚ", 'e': "èéêëēĕėęě",
+		'G': "ĜĞĠĢ", 'g': "ĝğġģ",
+		'I': "ÌÍÎÏĨĪĬĮİ", 'i': "ìíîïĩīĭįı",
+		'L': "ĹĻĽĿŁ", 'l': "ĺļľŀł",
+		'N': "ÑŃŅŇ", 'n': "ñńņň",
+		'O': "ÒÓÔÕÖØŌŎŐ", 'o': "òóôõöøōŏő",
+		'R': "ŔŖŘ", 'r': "ŕŗř",
+		'S': "ŚŜŞŠ", 's': "śŝşš",
+		'T': "ŢŤŦ", 't': "ţťŧ",
+		'U': "ÙÚÛÜŨŪŬŮŰŲ", 'u': "ùúûüũūŭůűų",
+		'Y': "ÝŸŶ", 'y': "ýÿŷ",
+		'Z': "ŹŻŽ", 'z': "źżž",
+	} {
+		for _, r := range marked {
+			diacritics[r] = base
+		}
+	}
+}
+
+// StripDiacritic maps an accented latin letter to its base letter.
+func StripDiacritic(r rune) rune {
+	if base, ok := diacritics[r]; ok {
+		return base
+	}
+	return r
+}
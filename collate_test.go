@@ -0,0 +1,35 @@
+package readline
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortCandidates(t *testing.T) {
+	cands := sr("zebra", "école", "Ecole", "apple", "Zürich")
+	sortCandidates(&Config{}, cands, nil)
+	if !reflect.DeepEqual(rs(cands), []string{"Ecole", "Zürich", "apple", "zebra", "école"}) {
+		t.Fatal("candidates should be in byte order", rs(cands))
+	}
+
+	sortCandidates(&Config{Locale: "fr"}, cands, nil)
+	if !reflect.DeepEqual(rs(cands), []string{"apple", "Ecole", "école", "zebra", "Zürich"}) {
+		t.Fatal("result not expect", rs(cands))
+	}
+
+	// Swedish sorts å, ä and ö after z
+	cands = sr("öl", "zebra", "ost", "ål")
+	descs := []string{"öl", "zebra", "ost", "ål"}
+	sortCandidates(&Config{Locale: "sv-SE"}, cands, descs)
+	if !reflect.DeepEqual(rs(cands), []string{"ost", "zebra", "ål", "öl"}) ||
+		!reflect.DeepEqual(descs, rs(cands)) {
+		t.Fatal("result not expect", rs(cands), descs)
+	}
+
+	reverse := func(a, b string) int { return strings.Compare(b, a) }
+	sortCandidates(&Config{Locale: "sv-SE", FuncCollate: reverse}, cands, nil)
+	if !reflect.DeepEqual(rs(cands), []string{"öl", "ål", "zebra", "ost"}) {
+		t.Fatal("result not expect", rs(cands))
+	}
+}
@@ -1,10 +1,11 @@
 package readline
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 )
 
 type AutoCompleter interface {
@@ -18,6 +19,33 @@ type AutoCompleter interface {
 	Do(line []rune, pos int) (newLine [][]rune, length int)
 }
 
+// ReplacingCompleter is an AutoCompleter whose candidates replace the
+// `length` runes before the cursor instead of being appended to them, so
+// they needn't start with what has been typed (e.g. glob matches).
+type ReplacingCompleter interface {
+	AutoCompleter
+	Replacing() bool
+}
+
+// Candidate is a completion candidate with a description.
+type Candidate struct {
+	// what's inserted, as in the result of AutoCompleter.Do
+	Text        []rune
+	Description string
+}
+
+// DescribedCompleter is an AutoCompleter whose candidates have a
+// description, which the menu draws next to them like zsh does:
+//
+//	commit   Record changes
+//	config   Get and set options
+//
+// DoDescribed is called instead of Do.
+type DescribedCompleter interface {
+	AutoCompleter
+	DoDescribed(line []rune, pos int) (candidates []Candidate, length int)
+}
+
 type TabCompleter struct{}
 
 func (t *TabCompleter) Do([]rune, int) ([][]rune, int) {
@@ -29,13 +57,37 @@ type opCompleter struct {
 	op    *Operation
 	width int
 
-	inCompleteMode  bool
-	inSelectMode    bool
-	candidate       [][]rune
-	candidateSource []rune
-	candidateOff    int
-	candidateChoise int
-	candidateColNum int
+	inCompleteMode   bool
+	inSelectMode     bool
+	candidate        [][]rune
+	candidateSource  []rune
+	candidateOff     int
+	candidateChoise  int
+	candidateColNum  int
+	candidateReplace bool
+	// the descriptions of the candidates of a DescribedCompleter
+	candidateDesc []string
+	banner        string
+	// the line and the cursor at the last Tab which didn't list the
+	// candidates, for CompleteListOnSecondTab
+	tabLine []rune
+	tabPos  int
+	// the line and the cursor before the completion, which are restored
+	// when it's cancelled
+	before    []rune
+	beforePos int
+	// asking whether to display the many candidates, and whether it was
+	// answered yes
+	inQuery bool
+	queried bool
+	// the candidates are inserted in turn, see Config.MenuComplete
+	menuComplete bool
+	// the completion of an AsyncCompleter under way, which the ioloop is
+	// waiting for, and what asks for it, see asyncComplete
+	asyncLock sync.Mutex
+	async     *asyncComplete
+	waiting   bool
+	asyncMenu int
 }
 
 func newOpCompleter(w io.Writer, op *Operation, width int) *opCompleter {
@@ -46,10 +98,37 @@ func newOpCompleter(w io.Writer, op *Operation, width int) *opCompleter {
 	}
 }
 
+// insertCandidate puts the candidate into the buffer, the offset is only
+// used for ReplacingCompleter candidates.
+func (o *opCompleter) insertCandidate(c []rune, offset int) {
+	if o.candidateReplace {
+		o.op.buf.ReplaceBefore(offset, c)
+		return
+	}
+	o.op.buf.WriteRunes(c)
+}
+
+// insertSingle inserts the only candidate and leaves the completion.
+func (o *opCompleter) insertSingle(c []rune, offset int) {
+	o.insertCandidate(c, offset)
+	if suffix := []rune(o.op.cfg.CompleteSuffix); len(suffix) > 0 && !runes.HasSuffix(c, suffix) {
+		o.op.buf.WriteRunes(suffix)
+	}
+	o.ExitCompleteMode(false)
+}
+
+// isExact tells whether the candidate is what's been typed.
+func (o *opCompleter) isExact(c, typed []rune) bool {
+	c = runes.TrimSpaceRight(c)
+	if o.candidateReplace {
+		return runes.Equal(c, runes.TrimSpaceRight(typed))
+	}
+	return len(c) == 0
+}
+
 func (o *opCompleter) doSelect() {
 	if len(o.candidate) == 1 {
-		o.op.buf.WriteRunes(o.candidate[0])
-		o.ExitCompleteMode(false)
+		o.insertSingle(o.candidate[0], o.candidateOff)
 		return
 	}
 	o.nextCandidate(1)
@@ -84,29 +163,242 @@ func (o *opCompleter) OnComplete() bool {
 
 	o.ExitCompleteSelectMode()
 	o.candidateSource = rs
-	newLines, offset := o.op.cfg.AutoComplete.Do(rs, buf.idx)
+	if !o.IsInCompleteMode() {
+		o.before, o.beforePos = rs, buf.Pos()
+	}
+	o.asyncMenu = 0
+	newLines, offset := o.complete()
+	if o.waiting {
+		// see ResumeAsync
+		o.candidateSource = nil
+		o.CompleteRefresh()
+		return true
+	}
 	if len(newLines) == 0 {
 		o.ExitCompleteMode(false)
 		return true
 	}
 
+	if len(newLines) == 1 && o.op.cfg.CompleteSingleImmediately {
+		o.insertSingle(newLines[0], offset)
+		return true
+	}
+
 	// only Aggregate candidates in non-complete mode
 	if !o.IsInCompleteMode() {
 		if len(newLines) == 1 {
-			buf.WriteRunes(newLines[0])
-			o.ExitCompleteMode(false)
+			o.insertSingle(newLines[0], offset)
 			return true
 		}
 
+		list := o.op.cfg.CompleteListMode
 		same, size := runes.Aggregate(newLines)
-		if size > 0 {
+		if size > 0 && !o.candidateReplace {
 			buf.WriteRunes(same)
+			if list != CompleteListAmbiguous {
+				o.ExitCompleteMode(false)
+				o.markTab()
+				return true
+			}
+			offset += size
+			o.candidateSource = buf.Runes()
+		} else if list == CompleteListOnSecondTab && !o.tabbedAgain() {
 			o.ExitCompleteMode(false)
+			o.op.t.Bell()
+			o.markTab()
 			return true
 		}
 	}
 
+	cfg := o.op.cfg
+	if cfg.FuncOnBeforeComplete != nil {
+		banner, show := cfg.FuncOnBeforeComplete(o.candidateWords(newLines, offset))
+		if !show {
+			o.ExitCompleteMode(false)
+			o.op.t.Bell()
+			return true
+		}
+		o.banner = banner
+	}
 	o.EnterCompleteMode(offset, newLines)
+	if cfg.FuncOnAfterComplete != nil {
+		cfg.FuncOnAfterComplete(o.candidateWords(newLines, offset))
+	}
+	return true
+}
+
+// OnMenuComplete inserts the first candidate, or the last one if dir is
+// negative, and marks it in the list of the candidates. The next ones are
+// inserted in turn by HandleCompleteSelect.
+func (o *opCompleter) OnMenuComplete(dir int) bool {
+	if o.width == 0 {
+		return false
+	}
+	buf := o.op.buf
+	o.ExitCompleteMode(false)
+	o.before, o.beforePos = buf.Runes(), buf.Pos()
+	o.asyncMenu = dir
+	newLines, offset := o.complete()
+	if o.waiting {
+		o.CompleteRefresh()
+		return true
+	}
+	switch len(newLines) {
+	case 0:
+		o.ExitCompleteMode(false)
+		return false
+	case 1:
+		o.insertSingle(newLines[0], offset)
+		return true
+	}
+
+	cfg := o.op.cfg
+	if cfg.FuncOnBeforeComplete != nil {
+		banner, show := cfg.FuncOnBeforeComplete(o.candidateWords(newLines, offset))
+		if !show {
+			o.ExitCompleteMode(false)
+			return false
+		}
+		o.banner = banner
+	}
+	o.inCompleteMode, o.inSelectMode, o.menuComplete = true, true, true
+	o.op.t.setPlainEsc(true)
+	o.candidate, o.candidateOff = newLines, offset
+	o.candidateChoise = -1
+	if dir < 0 {
+		o.candidateChoise = 0
+	}
+	o.cycle(dir)
+	o.CompleteRefresh()
+	if cfg.FuncOnAfterComplete != nil {
+		cfg.FuncOnAfterComplete(o.candidateWords(newLines, offset))
+	}
+	return true
+}
+
+// cycle inserts the next candidate in the menu-complete mode, or the
+// previous one if dir is negative, in place of the one inserted.
+func (o *opCompleter) cycle(dir int) {
+	n := len(o.candidate)
+	o.candidateChoise = ((o.candidateChoise+dir)%n + n) % n
+	o.op.buf.SetWithIdx(o.beforePos, runes.Copy(o.before))
+	o.insertCandidate(o.candidate[o.candidateChoise], o.candidateOff)
+	o.candidateSource = o.op.buf.Runes()
+}
+
+// handleMenuComplete handles the key in the menu-complete mode.
+func (o *opCompleter) handleMenuComplete(r rune) bool {
+	switch r {
+	case CharTab, MetaMenuComplete:
+		o.cycle(1)
+	case MetaMenuCompleteBackward:
+		o.cycle(-1)
+	case CharBell, CharInterrupt, CharEsc:
+		o.ExitCompleteMode(true)
+		return false
+	default:
+		// the candidate inserted is kept
+		o.ExitCompleteMode(false)
+		return false
+	}
+	o.CompleteRefresh()
+	return true
+}
+
+// typedWord returns what's been typed of the word being completed, the
+// line holds a candidate instead in the menu-complete mode.
+func (o *opCompleter) typedWord() []rune {
+	if o.menuComplete {
+		return runes.Copy(o.before[o.beforePos-o.candidateOff : o.beforePos])
+	}
+	return o.op.buf.RuneSlice(-o.candidateOff)
+}
+
+// markTab records the line at the Tab which didn't list the candidates.
+func (o *opCompleter) markTab() {
+	o.tabLine, o.tabPos = o.op.buf.Runes(), o.op.buf.Pos()
+}
+
+// tabbedAgain tells whether the line is still the one of the last Tab
+// which didn't list the candidates.
+func (o *opCompleter) tabbedAgain() bool {
+	return o.tabLine != nil && o.tabPos == o.op.buf.Pos() && runes.Equal(o.tabLine, o.op.buf.Runes())
+}
+
+// candidateWords returns the whole words of the candidates, for the
+// completion hooks.
+func (o *opCompleter) candidateWords(candidates [][]rune, offset int) []string {
+	var typed []rune
+	if !o.candidateReplace {
+		typed = o.op.buf.RuneSlice(-offset)
+	}
+	words := make([]string, len(candidates))
+	for i, c := range candidates {
+		words[i] = string(typed) + string(c)
+	}
+	return words
+}
+
+// complete asks the completer for the candidates of the current buffer,
+// matched by Config.CompletionMatcher.
+func (o *opCompleter) complete() (newLines [][]rune, offset int) {
+	buf := o.op.buf
+	var descs []string
+	matched := false
+	if m := o.op.cfg.CompletionMatcher; m != CompletionMatchPrefix {
+		newLines, descs, offset, matched = o.matchCandidates(m, buf.Runes(), buf.Pos())
+	}
+	if !matched {
+		newLines, descs, offset = o.candidates(buf.Runes(), buf.Pos())
+		sortCandidates(o.op.cfg, newLines, descs)
+	}
+	o.candidateDesc = descs
+	if len(newLines) == 0 {
+		return nil, 0
+	}
+	o.candidateReplace = false
+	if rc, ok := o.op.cfg.AutoComplete.(ReplacingCompleter); matched || ok && rc.Replacing() {
+		o.candidateReplace = !trimTyped(newLines, buf.RuneSlice(-offset))
+	}
+	return newLines, offset
+}
+
+// candidates returns the candidates of the completer, with their
+// descriptions for a DescribedCompleter.
+func (o *opCompleter) candidates(line []rune, pos int) (newLines [][]rune, descs []string, offset int) {
+	if ac, ok := o.op.cfg.AutoComplete.(AsyncCompleter); ok {
+		newLines, offset = o.candidatesAsync(ac, line, pos)
+		return newLines, nil, offset
+	}
+	dc, ok := o.op.cfg.AutoComplete.(DescribedCompleter)
+	if !ok {
+		newLines, offset = o.op.cfg.AutoComplete.Do(line, pos)
+		return newLines, nil, offset
+	}
+	candidates, offset := dc.DoDescribed(line, pos)
+	newLines = make([][]rune, len(candidates))
+	descs = make([]string, len(candidates))
+	for i, c := range candidates {
+		newLines[i], descs[i] = c.Text, c.Description
+	}
+	return newLines, descs, offset
+}
+
+// refilter narrows the menu to the candidates of the edited buffer while
+// staying in the select mode, false if there are none.
+func (o *opCompleter) refilter() bool {
+	if _, ok := o.op.cfg.AutoComplete.(AsyncCompleter); ok {
+		// the menu isn't kept waiting
+		return false
+	}
+	newLines, offset := o.complete()
+	if len(newLines) == 0 {
+		return false
+	}
+	o.candidate = newLines
+	o.candidateOff = offset
+	o.candidateChoise = 0
+	o.candidateSource = o.op.buf.Runes()
 	return true
 }
 
@@ -119,11 +411,14 @@ func (o *opCompleter) IsInCompleteMode() bool {
 }
 
 func (o *opCompleter) HandleCompleteSelect(r rune) bool {
+	if o.menuComplete {
+		return o.handleMenuComplete(r)
+	}
 	next := true
 	switch r {
 	case CharEnter, CharCtrlJ:
 		next = false
-		o.op.buf.WriteRunes(o.op.candidate[o.op.candidateChoise])
+		o.insertCandidate(o.op.candidate[o.op.candidateChoise], o.candidateOff)
 		o.ExitCompleteMode(false)
 	case CharLineStart:
 		num := o.candidateChoise % o.candidateColNum
@@ -135,13 +430,22 @@ func (o *opCompleter) HandleCompleteSelect(r rune) bool {
 			o.candidateChoise = len(o.candidate) - 1
 		}
 	case CharBackspace:
-		o.ExitCompleteSelectMode()
-		next = false
+		o.op.buf.Backspace()
+		if !o.refilter() {
+			// nothing matches the shorter word, the menu is closed
+			o.ExitCompleteMode(false)
+			o.op.buf.Refresh(nil)
+			return true
+		}
 	case CharTab, CharForward:
 		o.doSelect()
-	case CharBell, CharInterrupt:
+	case CharBell, CharInterrupt, CharEsc:
 		o.ExitCompleteMode(true)
 		next = false
+	case MetaPageUp:
+		o.pageCandidate(-1)
+	case MetaPageDown:
+		o.pageCandidate(1)
 	case CharNext:
 		tmpChoise := o.candidateChoise + o.candidateColNum
 		if tmpChoise >= o.getMatrixSize() {
@@ -153,6 +457,11 @@ func (o *opCompleter) HandleCompleteSelect(r rune) bool {
 		o.candidateChoise = tmpChoise
 	case CharBackward:
 		o.nextCandidate(-1)
+	case MetaMenuCompleteBackward:
+		if o.candidateChoise <= 0 {
+			o.candidateChoise = len(o.candidate)
+		}
+		o.candidateChoise--
 	case CharPrev:
 		tmpChoise := o.candidateChoise - o.candidateColNum
 		if tmpChoise < 0 {
@@ -163,8 +472,21 @@ func (o *opCompleter) HandleCompleteSelect(r rune) bool {
 		}
 		o.candidateChoise = tmpChoise
 	default:
+		// typing narrows the candidates instead of leaving the menu
+		if IsPrintable(r) {
+			o.op.buf.WriteRune(r)
+			if !o.refilter() {
+				o.op.buf.Backspace()
+				o.op.t.Bell()
+			} else if len(o.candidate) == 1 && o.op.cfg.CompleteSingleImmediately {
+				o.insertSingle(o.candidate[0], o.candidateOff)
+			}
+			break
+		}
 		next = false
-		o.ExitCompleteSelectMode()
+		// the key is performed on the line as it is, without the
+		// candidates of the word it was
+		o.ExitCompleteMode(false)
 	}
 	if next {
 		o.CompleteRefresh()
@@ -173,6 +495,22 @@ func (o *opCompleter) HandleCompleteSelect(r rune) bool {
 	return false
 }
 
+// pageCandidate moves the selection by the rows of a screen, backward if
+// dir is negative, up to the first or the last candidate.
+func (o *opCompleter) pageCandidate(dir int) {
+	rows := o.op.pagerRows()
+	if rows <= 0 {
+		rows = len(o.candidate)
+	}
+	choise := o.candidateChoise + dir*rows*o.candidateColNum
+	if choise < 0 {
+		choise = 0
+	} else if choise >= len(o.candidate) {
+		choise = len(o.candidate) - 1
+	}
+	o.candidateChoise = choise
+}
+
 func (o *opCompleter) getMatrixSize() int {
 	line := len(o.candidate) / o.candidateColNum
 	if len(o.candidate)%o.candidateColNum != 0 {
@@ -186,42 +524,85 @@ func (o *opCompleter) OnWidthChange(newWidth int) {
 }
 
 func (o *opCompleter) CompleteRefresh() {
+	if o.waiting {
+		o.w.Write(o.op.buf.BelowOutput([]byte("…")))
+		return
+	}
 	if !o.inCompleteMode {
 		return
 	}
 	lineCnt := o.op.buf.CursorLineCount()
-	colWidth := 0
-	for _, c := range o.candidate {
-		w := runes.WidthAll(c)
-		if w > colWidth {
-			colWidth = w
-		}
+	typed := o.typedWord()
+	var same []rune
+	if !o.candidateReplace {
+		same = typed
+	}
+	sameWidth := runes.WidthAll(runes.ColorFilter(same))
+	widths := make([]int, len(o.candidate))
+	for idx, c := range o.candidate {
+		widths[idx] = sameWidth + runes.WidthAll(runes.ColorFilter(c))
 	}
-	colWidth += o.candidateOff + 1
-	same := o.op.buf.RuneSlice(-o.candidateOff)
 
 	// -1 to avoid reach the end of line
-	width := o.width - 1
-	colNum := width / colWidth
-	if colNum != 0 {
-		colWidth += (width - (colWidth * colNum)) / colNum
+	var colWidths []int
+	var descs [][]rune
+	candWidth := 0
+	if o.candidateDesc != nil {
+		colWidths, candWidth, descs = describedLayout(widths, o.candidateDesc, o.width-1)
+	} else {
+		colWidths = completeLayout(widths, o.width-1)
 	}
+	colNum := len(colWidths)
 
 	o.candidateColNum = colNum
-	buf := bufio.NewWriter(o.w)
-	buf.Write(bytes.Repeat([]byte("\n"), lineCnt))
+	buf := bytes.NewBuffer(nil)
 
 	colIdx := 0
 	lines := 1
-	buf.WriteString("\033[J")
+	if o.banner != "" {
+		banner := []rune(o.banner)
+		if runes.WidthAll(runes.ColorFilter(banner)) > o.width-1 {
+			banner = truncateColored(banner, o.width-1)
+		}
+		buf.WriteString(string(banner))
+		buf.WriteString("\n")
+		lines++
+	}
 	for idx, c := range o.candidate {
 		inSelect := idx == o.candidateChoise && o.IsInCompleteSelectMode()
+		restore := ""
 		if inSelect {
-			buf.WriteString("\033[30;47m")
+			restore = "\033[30;47m"
+			buf.WriteString(restore)
+		}
+		exact := !inSelect && o.op.cfg.ExactMatchStyle != "" && o.isExact(c, typed)
+		if exact {
+			restore = "\033[" + o.op.cfg.ExactMatchStyle + "m"
+			buf.WriteString(restore)
+		}
+		if o.IsInCompleteSelectMode() {
+			cand := append(runes.Copy(same), c...)
+			buf.WriteString(string(highlightMatch(cand, typed, o.op.cfg.completionNormalizer(), o.op.cfg.MatchStyle, restore)))
+		} else {
+			buf.WriteString(string(same))
+			buf.WriteString(string(c))
+		}
+		if exact {
+			buf.WriteString("\033[0m")
+		}
+		width := widths[idx]
+		if descs != nil && len(descs[idx]) > 0 {
+			buf.Write(bytes.Repeat([]byte(" "), candWidth-width))
+			if style := o.op.cfg.DescriptionStyle; style != "" {
+				buf.WriteString("\033[" + style + "m" + string(descs[idx]) + "\033[0m" + restore)
+			} else {
+				buf.WriteString(string(descs[idx]))
+			}
+			width = candWidth + runes.WidthAll(runes.ColorFilter(descs[idx]))
+		}
+		if pad := colWidths[colIdx] - width; pad > 0 {
+			buf.Write(bytes.Repeat([]byte(" "), pad))
 		}
-		buf.WriteString(string(same))
-		buf.WriteString(string(c))
-		buf.Write(bytes.Repeat([]byte(" "), colWidth-runes.WidthAll(c)-runes.WidthAll(same)))
 
 		if inSelect {
 			buf.WriteString("\033[0m")
@@ -235,10 +616,187 @@ func (o *opCompleter) CompleteRefresh() {
 		}
 	}
 
-	// move back
-	fmt.Fprintf(buf, "\033[%dA\r", lineCnt-1+lines)
-	fmt.Fprintf(buf, "\033[%dC", o.op.buf.idx+o.op.buf.PromptLen())
-	buf.Flush()
+	if aux := o.op.cfg.AuxOutput; aux != nil {
+		if colIdx != 0 {
+			buf.WriteString("\n")
+		}
+		aux.Write(buf.Bytes())
+		return
+	}
+
+	// the listing which doesn't fit beneath the line goes to the pager,
+	// once confirmed like the many candidates
+	rows := o.op.pagerRows()
+	paged := rows > 0 && !o.IsInCompleteSelectMode() && lineCnt+lines > rows+1
+	if !o.queried && !o.IsInCompleteSelectMode() && o.needQuery(paged) {
+		o.inQuery = true
+		query := fmt.Sprintf("Display all %d possibilities? (y or n)", len(o.candidate))
+		o.w.Write(o.op.buf.BelowOutput([]byte(query)))
+		return
+	}
+	if paged {
+		o.ExitCompleteMode(false)
+		o.op.Page(buf.String())
+		return
+	}
+
+	o.w.Write(o.op.buf.BelowOutput(buf.Bytes()))
+}
+
+// needQuery tells whether to ask before listing the candidates, see
+// Config.CompletionQueryItems.
+func (o *opCompleter) needQuery(paged bool) bool {
+	items := o.op.cfg.CompletionQueryItems
+	if items < 0 {
+		return false
+	}
+	return paged || (items > 0 && len(o.candidate) >= items)
+}
+
+func (o *opCompleter) IsInCompleteQuery() bool {
+	return o.inQuery
+}
+
+// HandleCompleteQuery handles the answer to "Display all N
+// possibilities?": y or Space lists the candidates, n, q or Backspace
+// cancels the completion like Ctrl-G.
+func (o *opCompleter) HandleCompleteQuery(r rune) {
+	switch r {
+	case 'y', 'Y', ' ':
+		o.inQuery = false
+		o.queried = true
+		o.CompleteRefresh()
+		return
+	case CharInterrupt:
+		o.op.t.KickRead()
+		fallthrough
+	case 'n', 'N', 'q', 'Q', CharBackspace, CharCtrlH, CharBell, CharEsc:
+		o.ExitCompleteMode(false)
+		o.op.buf.Refresh(nil)
+	default:
+		o.op.t.Bell()
+	}
+}
+
+// matchSpan is a range of runes to be highlighted, with its own style
+// or the one given to applySpans.
+type matchSpan struct {
+	start, end int
+	style      string
+}
+
+// highlightMatch highlights the first occurrence of typed in candidate
+// with the SGR parameters of style, or else the runes of typed in order.
+// The runes are compared as normalized by norm.
+func highlightMatch(candidate, typed []rune, norm func(rune) rune, style, restore string) []rune {
+	if len(typed) == 0 {
+		return candidate
+	}
+	if idx := indexNorm(candidate, typed, norm); idx >= 0 {
+		return applySpans(candidate, []matchSpan{{idx, idx + len(typed), ""}}, style, restore)
+	}
+	// the runes of a fuzzy match, see CompletionMatchFuzzy
+	var spans []matchSpan
+	for _, mark := range matchMarks(fuzzyIndex(candidate, typed, norm), "") {
+		spans = append(spans, matchSpan{mark.Start, mark.End, ""})
+	}
+	return applySpans(candidate, spans, style, restore)
+}
+
+// applySpans wraps the spans of rs, which must be sorted and not overlap,
+// in their style or the given one. restore is written after each span to bring back the
+// attributes of the surrounding text, since the style is reset by SGR 0.
+func applySpans(rs []rune, spans []matchSpan, style, restore string) []rune {
+	ret := make([]rune, 0, len(rs)+len(spans)*(len(style)+len(restore)+7))
+	last := 0
+	for _, span := range spans {
+		s := span.style
+		if s == "" {
+			s = style
+		}
+		ret = append(ret, rs[last:span.start]...)
+		ret = append(ret, []rune("\033["+s+"m")...)
+		ret = append(ret, rs[span.start:span.end]...)
+		ret = append(ret, []rune("\033[0m"+restore)...)
+		last = span.end
+	}
+	return append(ret, rs[last:]...)
+}
+
+// completeLayout packs the candidates of the given display widths row by
+// row into as many columns as fit in width, each column being as wide as
+// its widest candidate plus a separating space, like `ls -x` does.
+func completeLayout(widths []int, width int) (colWidths []int) {
+	for colNum := len(widths); colNum > 1; colNum-- {
+		colWidths = make([]int, colNum)
+		total := 0
+		for idx, w := range widths {
+			col := idx % colNum
+			if w+1 > colWidths[col] {
+				total += w + 1 - colWidths[col]
+				colWidths[col] = w + 1
+				if total > width {
+					break
+				}
+			}
+		}
+		if total <= width {
+			return colWidths
+		}
+	}
+	colWidths = []int{0}
+	for _, w := range widths {
+		if w+1 > colWidths[0] {
+			colWidths[0] = w + 1
+		}
+	}
+	return colWidths
+}
+
+// describedLayout packs the candidates of the given display widths and
+// their descriptions into as many columns as fit in width, row by row.
+// The descriptions start candWidth after their candidate, they're cut to
+// fit if a single column doesn't.
+func describedLayout(widths []int, descs []string, width int) (colWidths []int, candWidth int, cut [][]rune) {
+	descWidth := 0
+	cut = make([][]rune, len(descs))
+	for idx, w := range widths {
+		if w+2 > candWidth {
+			candWidth = w + 2
+		}
+		cut[idx] = []rune(strings.Map(func(r rune) rune {
+			if r == '\n' || r == '\r' || r == '\t' {
+				return ' '
+			}
+			return r
+		}, descs[idx]))
+		if w := runes.WidthAll(runes.ColorFilter(cut[idx])); w > descWidth {
+			descWidth = w
+		}
+	}
+	// two spaces between the columns
+	entry := candWidth + descWidth + 2
+	colNum := width / entry
+	if colNum > len(widths) {
+		colNum = len(widths)
+	}
+	if colNum < 1 {
+		colNum, entry = 1, width
+		for idx, desc := range cut {
+			if room := width - candWidth; runes.WidthAll(runes.ColorFilter(desc)) > room {
+				if room <= 1 {
+					cut[idx] = nil
+				} else {
+					cut[idx] = truncateColored(desc, room)
+				}
+			}
+		}
+	}
+	colWidths = make([]int, colNum)
+	for i := range colWidths {
+		colWidths[i] = entry
+	}
+	return colWidths, candWidth, cut
 }
 
 func (o *opCompleter) aggCandidate(candidate [][]rune) int {
@@ -266,6 +824,7 @@ func (o *opCompleter) EnterCompleteSelectMode() {
 
 func (o *opCompleter) EnterCompleteMode(offset int, candidate [][]rune) {
 	o.inCompleteMode = true
+	o.op.t.setPlainEsc(true)
 	o.candidate = candidate
 	o.candidateOff = offset
 	o.CompleteRefresh()
@@ -273,13 +832,38 @@ func (o *opCompleter) EnterCompleteMode(offset int, candidate [][]rune) {
 
 func (o *opCompleter) ExitCompleteSelectMode() {
 	o.inSelectMode = false
+	o.menuComplete = false
 	o.candidate = nil
 	o.candidateChoise = -1
 	o.candidateOff = -1
 	o.candidateSource = nil
 }
 
-func (o *opCompleter) ExitCompleteMode(revent bool) {
+// ExitCompleteMode leaves the completion, revert restores the line as it
+// was before it, e.g. the common part of the candidates inserted and the
+// characters typed to narrow them are dropped.
+func (o *opCompleter) ExitCompleteMode(revert bool) {
+	if revert && o.inCompleteMode && o.before != nil {
+		o.op.buf.SetWithIdx(o.beforePos, o.before)
+	}
 	o.inCompleteMode = false
+	o.inQuery, o.queried = false, false
+	o.banner = ""
+	o.before = nil
+	o.op.t.setPlainEsc(false)
 	o.ExitCompleteSelectMode()
 }
+
+// trimTyped turns replacing candidates into appending ones if all of them
+// start with the typed text, so that they can be aggregated as usual.
+func trimTyped(candidates [][]rune, typed []rune) bool {
+	for _, c := range candidates {
+		if !runes.HasPrefix(c, typed) {
+			return false
+		}
+	}
+	for i, c := range candidates {
+		candidates[i] = c[len(typed):]
+	}
+	return true
+}
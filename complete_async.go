@@ -0,0 +1,130 @@
+package readline
+
+import (
+	"context"
+)
+
+// AsyncCompleter is an AutoCompleter whose candidates may take a while to
+// come, e.g. from the network or a database. DoAsync is called instead of
+// Do, on a goroutine of its own, and the input goes on meanwhile with "…"
+// drawn below the line: the candidates are shown once they come, unless a
+// key is pressed first, which cancels ctx and the completion. ctx is also
+// cancelled after Config.CompletionTimeout, and what DoAsync returns
+// afterwards is dropped.
+type AsyncCompleter interface {
+	AutoCompleter
+	DoAsync(ctx context.Context, line []rune, pos int) (newLine [][]rune, length int)
+}
+
+// asyncComplete is a completion of an AsyncCompleter under way.
+type asyncComplete struct {
+	cancel context.CancelFunc
+	line   []rune
+	pos    int
+	// what asked for it: 0 for OnComplete, or the direction of
+	// OnMenuComplete
+	menu int
+	// the candidates, once they came, or the panic of DoAsync
+	done     bool
+	newLines [][]rune
+	offset   int
+	panic    interface{}
+}
+
+// candidatesAsync returns the candidates of ac for the line if they came,
+// or else starts asking for them and sets waiting.
+func (o *opCompleter) candidatesAsync(ac AsyncCompleter, line []rune, pos int) ([][]rune, int) {
+	o.asyncLock.Lock()
+	defer o.asyncLock.Unlock()
+	if a := o.async; a != nil && a.done && a.pos == pos && runes.Equal(a.line, line) {
+		o.async, o.waiting = nil, false
+		if a.panic != nil {
+			panic(a.panic)
+		}
+		return a.newLines, a.offset
+	}
+	if o.async != nil {
+		o.async.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout := o.op.cfg.CompletionTimeout; timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	a := &asyncComplete{
+		cancel: cancel,
+		line:   runes.Copy(line),
+		pos:    pos,
+		menu:   o.asyncMenu,
+	}
+	o.async, o.waiting = a, true
+	go o.waitAsync(ctx, ac, a)
+	return nil, 0
+}
+
+// waitAsync runs DoAsync and wakes the ioloop with its candidates, unless
+// the completion was cancelled meanwhile.
+func (o *opCompleter) waitAsync(ctx context.Context, ac AsyncCompleter, a *asyncComplete) {
+	type result struct {
+		newLines [][]rune
+		offset   int
+		panic    interface{}
+	}
+	results := make(chan result, 1)
+	go func() {
+		var res result
+		defer func() {
+			res.panic = recover()
+			results <- res
+		}()
+		res.newLines, res.offset = ac.DoAsync(ctx, runes.Copy(a.line), a.pos)
+	}()
+	var res result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		// the completer which doesn't heed ctx is left behind
+	}
+	a.cancel()
+
+	o.asyncLock.Lock()
+	defer o.asyncLock.Unlock()
+	if o.async != a {
+		return
+	}
+	a.done, a.newLines, a.offset, a.panic = true, res.newLines, res.offset, res.panic
+	o.op.t.wake()
+}
+
+// ResumeAsync completes again with the candidates of the AsyncCompleter
+// which came, as asked by OnComplete or OnMenuComplete.
+func (o *opCompleter) ResumeAsync() bool {
+	o.asyncLock.Lock()
+	a := o.async
+	o.asyncLock.Unlock()
+	if a == nil || !a.done {
+		return true
+	}
+	if a.menu != 0 {
+		return o.OnMenuComplete(a.menu)
+	}
+	return o.OnComplete()
+}
+
+// CancelAsync cancels the completion of the AsyncCompleter under way, as
+// a key was pressed, and leaves the completion mode.
+func (o *opCompleter) CancelAsync() {
+	o.asyncLock.Lock()
+	if a := o.async; a != nil {
+		a.cancel()
+		o.async = nil
+		// the candidates may have come already
+		o.op.t.unwake()
+	}
+	o.asyncLock.Unlock()
+	if o.waiting {
+		o.waiting = false
+		o.ExitCompleteMode(false)
+		o.op.buf.Refresh(nil)
+	}
+}
@@ -0,0 +1,73 @@
+package readline
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// slowCompleter completes once released, or reports why it was cancelled.
+type slowCompleter struct {
+	staticCompleter
+	release   chan struct{}
+	cancelled chan error
+}
+
+func (s *slowCompleter) DoAsync(ctx context.Context, line []rune, pos int) ([][]rune, int) {
+	select {
+	case <-s.release:
+		return s.Do(line, pos)
+	case <-ctx.Done():
+		s.cancelled <- ctx.Err()
+		return nil, 0
+	}
+}
+
+func TestAsyncComplete(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		timeout time.Duration
+		// what's done while the completion is under way
+		wait   func(d *Driver, s *slowCompleter)
+		expect string
+		err    error
+	}{
+		{"release", 0, func(d *Driver, s *slowCompleter) { s.release <- struct{}{} }, `^> gi$`, nil},
+		{"key", 0, func(d *Driver, s *slowCompleter) { d.Type("x") }, `^> gx$`, context.Canceled},
+		{"timeout", 20 * time.Millisecond, func(d *Driver, s *slowCompleter) {}, `^> g$`, context.DeadlineExceeded},
+	} {
+		s := &slowCompleter{
+			staticCompleter: staticCompleter{"gist", "gitk"},
+			release:         make(chan struct{}),
+			cancelled:       make(chan error, 1),
+		}
+		d, err := NewDriver(&Config{
+			Prompt:            "> ",
+			AutoComplete:      s,
+			CompletionTimeout: c.timeout,
+		}, 20, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go d.Readline()
+
+		d.Type("g")
+		d.Press("tab")
+		if _, err := d.Expect(`^…$`); err != nil {
+			t.Fatal(c.name, err)
+		}
+		c.wait(d, s)
+		if c.err != nil {
+			if err := <-s.cancelled; err != c.err {
+				t.Fatal(c.name, "error not expect", err)
+			}
+		}
+		if _, err := d.Expect(c.expect); err != nil {
+			t.Fatal(c.name, err)
+		}
+		if _, err := d.Expect(`\A[^…]*\z`); err != nil {
+			t.Fatal(c.name, err)
+		}
+		d.Close()
+	}
+}
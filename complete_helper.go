@@ -8,6 +8,10 @@ import (
 // Caller type for dynamic completion
 type DynamicCompleteFunc func(string) []string
 
+// DynamicChildrenFunc generates the children of a node from the words of
+// the line which led to it, e.g. ["connect"] for `connect <host>`.
+type DynamicChildrenFunc func(args []string) []PrefixCompleterInterface
+
 type PrefixCompleterInterface interface {
 	Print(prefix string, level int, buf *bytes.Buffer)
 	Do(line []rune, pos int) (newLine [][]rune, length int)
@@ -22,11 +26,49 @@ type DynamicPrefixCompleterInterface interface {
 	GetDynamicNames(line []rune) [][]rune
 }
 
+// ArgPrefixCompleterInterface is implemented by nodes which provide a
+// fallback completer for argument positions.
+type ArgPrefixCompleterInterface interface {
+	PrefixCompleterInterface
+	GetArgCompleter() AutoCompleter
+}
+
+// DynamicChildrenPrefixCompleterInterface is implemented by nodes whose
+// children are generated while completing, in addition to GetChildren.
+type DynamicChildrenPrefixCompleterInterface interface {
+	PrefixCompleterInterface
+	GetDynamicChildren(args []string) []PrefixCompleterInterface
+}
+
+// DelimitedPrefixCompleterInterface is implemented by nodes whose
+// children are completed one sub-token at a time, see
+// PrefixCompleter.Delims.
+type DelimitedPrefixCompleterInterface interface {
+	PrefixCompleterInterface
+	GetDelims() []rune
+}
+
 type PrefixCompleter struct {
 	Name     []rune
 	Dynamic  bool
 	Callback DynamicCompleteFunc
 	Children []PrefixCompleterInterface
+
+	// ChildrenCallback generates more children each time the line is
+	// completed, e.g. from a live server list, see PcItemChildren.
+	ChildrenCallback DynamicChildrenFunc
+
+	// ArgCompleter completes argument positions (every word after the
+	// command) when none of the children match, just like bash's
+	// `complete -o default`. It's inherited by the descendants which
+	// don't specify their own, and never used for the command position.
+	ArgCompleter AutoCompleter
+
+	// Delims separates the values of a list, e.g. "," for `a,b,c`: only
+	// the part of the word after the last one is completed by the
+	// children, the same as after a name which doesn't end with a space,
+	// like `--color=`.
+	Delims string
 }
 
 func (p *PrefixCompleter) Tree(prefix string) string {
@@ -71,6 +113,14 @@ func (p *PrefixCompleter) GetDynamicNames(line []rune) [][]rune {
 	return names
 }
 
+func (p *PrefixCompleter) GetArgCompleter() AutoCompleter {
+	return p.ArgCompleter
+}
+
+func (p *PrefixCompleter) GetDelims() []rune {
+	return []rune(p.Delims)
+}
+
 func (p *PrefixCompleter) GetChildren() []PrefixCompleterInterface {
 	return p.Children
 }
@@ -79,6 +129,13 @@ func (p *PrefixCompleter) SetChildren(children []PrefixCompleterInterface) {
 	p.Children = children
 }
 
+func (p *PrefixCompleter) GetDynamicChildren(args []string) []PrefixCompleterInterface {
+	if p.ChildrenCallback == nil {
+		return nil
+	}
+	return p.ChildrenCallback(args)
+}
+
 func NewPrefixCompleter(pc ...PrefixCompleterInterface) *PrefixCompleter {
 	return PcItem("", pc...)
 }
@@ -92,6 +149,45 @@ func PcItem(name string, pc ...PrefixCompleterInterface) *PrefixCompleter {
 	}
 }
 
+// PcItemArgs is like PcItem, but completes its arguments by `args`
+// whenever none of the children match.
+func PcItemArgs(name string, args AutoCompleter, pc ...PrefixCompleterInterface) *PrefixCompleter {
+	p := PcItem(name, pc...)
+	p.ArgCompleter = args
+	return p
+}
+
+// PcItemValues completes the values right after name, e.g. `--color=`,
+// which is used as is. If delims isn't empty the values are a list, and
+// they don't end with a space so that the next delimiter can be typed.
+func PcItemValues(name, delims string, values ...string) *PrefixCompleter {
+	p := &PrefixCompleter{Name: []rune(name), Delims: delims}
+	for _, v := range values {
+		if delims != "" {
+			p.Children = append(p.Children, &PrefixCompleter{Name: []rune(v)})
+		} else {
+			p.Children = append(p.Children, PcItem(v))
+		}
+	}
+	return p
+}
+
+// PcItemChildren is like PcItem, but its children also come from callback,
+// which is given the words of the line up to name, e.g. ["connect"]:
+//
+//	PcItemChildren("connect", func(args []string) []PrefixCompleterInterface {
+//		var hosts []PrefixCompleterInterface
+//		for _, host := range liveHosts() {
+//			hosts = append(hosts, PcItem(host))
+//		}
+//		return hosts
+//	})
+func PcItemChildren(name string, callback DynamicChildrenFunc, pc ...PrefixCompleterInterface) *PrefixCompleter {
+	p := PcItem(name, pc...)
+	p.ChildrenCallback = callback
+	return p
+}
+
 func PcItemDynamic(callback DynamicCompleteFunc, pc ...PrefixCompleterInterface) *PrefixCompleter {
 	return &PrefixCompleter{
 		Callback: callback,
@@ -101,18 +197,40 @@ func PcItemDynamic(callback DynamicCompleteFunc, pc ...PrefixCompleterInterface)
 }
 
 func (p *PrefixCompleter) Do(line []rune, pos int) (newLine [][]rune, offset int) {
-	return doInternal(p, line, pos, line)
+	return doInternal(p, line, pos, line, nil, nil)
 }
 
 func Do(p PrefixCompleterInterface, line []rune, pos int) (newLine [][]rune, offset int) {
-	return doInternal(p, line, pos, line)
+	return doInternal(p, line, pos, line, nil, nil)
+}
+
+// IsCommandPosition reports whether the cursor is within the first word
+// of the line, which is the command rather than one of its arguments.
+func IsCommandPosition(line []rune, pos int) bool {
+	word := runes.TrimSpaceLeft(line[:pos])
+	return runes.Index(' ', word) < 0
 }
 
-func doInternal(p PrefixCompleterInterface, line []rune, pos int, origLine []rune) (newLine [][]rune, offset int) {
+// args are the names of the children matched so far, they're empty while
+// completing the command.
+func doInternal(p PrefixCompleterInterface, line []rune, pos int, origLine []rune, argc AutoCompleter, args []string) (newLine [][]rune, offset int) {
+	if ap, ok := p.(ArgPrefixCompleterInterface); ok && ap.GetArgCompleter() != nil {
+		argc = ap.GetArgCompleter()
+	}
 	line = runes.TrimSpaceLeft(line[:pos])
+	if dp, ok := p.(DelimitedPrefixCompleterInterface); ok {
+		line = lastSubToken(line, dp.GetDelims())
+	}
+	children := p.GetChildren()
+	if dp, ok := p.(DynamicChildrenPrefixCompleterInterface); ok {
+		if more := dp.GetDynamicChildren(args); len(more) > 0 {
+			children = append(children[:len(children):len(children)], more...)
+		}
+	}
 	goNext := false
 	var lineCompleter PrefixCompleterInterface
-	for _, child := range p.GetChildren() {
+	var lineName []rune
+	for _, child := range children {
 		childNames := make([][]rune, 1)
 
 		childDynamic, ok := child.(DynamicPrefixCompleterInterface)
@@ -131,23 +249,28 @@ func doInternal(p PrefixCompleterInterface, line []rune, pos int, origLine []run
 						newLine = append(newLine, childName)
 					}
 					offset = len(childName)
-					lineCompleter = child
+					lineCompleter, lineName = child, childName
 					goNext = true
 				}
 			} else {
 				if runes.HasPrefix(childName, line) {
 					newLine = append(newLine, childName[len(line):])
 					offset = len(line)
-					lineCompleter = child
+					lineCompleter, lineName = child, childName
 				}
 			}
 		}
 	}
 
+	if len(newLine) == 0 && len(args) > 0 && argc != nil {
+		return argc.Do(line, len(line))
+	}
+
 	if len(newLine) != 1 {
 		return
 	}
 
+	args = append(args[:len(args):len(args)], strings.TrimSpace(string(lineName)))
 	tmpLine := make([]rune, 0, len(line))
 	for i := offset; i < len(line); i++ {
 		if line[i] == ' ' {
@@ -155,11 +278,28 @@ func doInternal(p PrefixCompleterInterface, line []rune, pos int, origLine []run
 		}
 
 		tmpLine = append(tmpLine, line[i:]...)
-		return doInternal(lineCompleter, tmpLine, len(tmpLine), origLine)
+		return doInternal(lineCompleter, tmpLine, len(tmpLine), origLine, argc, args)
 	}
 
 	if goNext {
-		return doInternal(lineCompleter, nil, 0, origLine)
+		return doInternal(lineCompleter, nil, 0, origLine, argc, args)
 	}
 	return
 }
+
+// lastSubToken cuts the first word of line after its last delimiter.
+func lastSubToken(line []rune, delims []rune) []rune {
+	if len(delims) == 0 {
+		return line
+	}
+	last := -1
+	for i, r := range line {
+		if r == ' ' {
+			break
+		}
+		if runes.Index(r, delims) >= 0 {
+			last = i
+		}
+	}
+	return line[last+1:]
+}
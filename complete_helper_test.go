@@ -0,0 +1,319 @@
+package readline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type staticCompleter []string
+
+func (s staticCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	word := lastWord(line[:pos])
+	var ret [][]rune
+	for _, c := range s {
+		if runes.HasPrefix([]rune(c), word) {
+			ret = append(ret, []rune(c)[len(word):])
+		}
+	}
+	return ret, len(word)
+}
+
+// describedCompleter completes the words before the description after
+// the tab of each of its items.
+type describedCompleter []string
+
+func (d describedCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	candidates, length := d.DoDescribed(line, pos)
+	ret := make([][]rune, len(candidates))
+	for i, c := range candidates {
+		ret[i] = c.Text
+	}
+	return ret, length
+}
+
+func (d describedCompleter) DoDescribed(line []rune, pos int) ([]Candidate, int) {
+	word := lastWord(line[:pos])
+	var ret []Candidate
+	for _, item := range d {
+		i := strings.IndexByte(item, '\t')
+		if c := []rune(item[:i]); runes.HasPrefix(c, word) {
+			ret = append(ret, Candidate{c[len(word):], item[i+1:]})
+		}
+	}
+	return ret, len(word)
+}
+
+func TestPrefixCompleterArgs(t *testing.T) {
+	pc := NewPrefixCompleter(
+		PcItem("ls", PcItem("-l")),
+		PcItem("cd"),
+	)
+	pc.ArgCompleter = staticCompleter{"foo", "bar"}
+
+	cases := []struct {
+		line   string
+		expect []string
+		offset int
+	}{
+		// command position never falls back
+		{"x", nil, 0},
+		{"ls f", []string{"oo"}, 1},
+		{"ls -", []string{"l "}, 1},
+		{"cd ", []string{"foo", "bar"}, 0},
+		{"cd foo b", []string{"ar"}, 1},
+	}
+	for _, c := range cases {
+		newLine, offset := pc.Do([]rune(c.line), len(c.line))
+		if got := rs(newLine); len(got) != len(c.expect) || (len(got) > 0 && !reflect.DeepEqual(got, c.expect)) {
+			t.Fatalf("%q: expect %q, got %q", c.line, c.expect, got)
+		}
+		if offset != c.offset {
+			t.Fatalf("%q: expect offset %v, got %v", c.line, c.offset, offset)
+		}
+	}
+
+	if !IsCommandPosition([]rune(" ls"), 3) || IsCommandPosition([]rune("ls "), 3) {
+		t.Fatal("wrong command position")
+	}
+}
+
+func TestPcItemChildren(t *testing.T) {
+	hosts := []string{"db1"}
+	joined := func(args []string) []PrefixCompleterInterface {
+		return []PrefixCompleterInterface{PcItem(strings.Join(args, "-"))}
+	}
+	pc := NewPrefixCompleter(
+		PcItemChildren("connect", func(args []string) []PrefixCompleterInterface {
+			var items []PrefixCompleterInterface
+			for _, host := range hosts {
+				items = append(items, PcItemChildren(host, joined))
+			}
+			return items
+		}, PcItem("--verbose")),
+	)
+
+	cases := []struct {
+		line   string
+		expect []string
+		offset int
+	}{
+		{"connect ", []string{"--verbose ", "db1 ", "db2 "}, 0},
+		{"connect d", []string{"b1 ", "b2 "}, 1},
+		// the callbacks get the words before them
+		{"connect db2 ", []string{"connect-db2 "}, 0},
+	}
+	// the children are generated again each time
+	hosts = append(hosts, "db2")
+	for _, c := range cases {
+		newLine, offset := pc.Do([]rune(c.line), len(c.line))
+		if got := rs(newLine); !reflect.DeepEqual(got, c.expect) || offset != c.offset {
+			t.Fatalf("%q: expect %q %v, got %q %v", c.line, c.expect, c.offset, got, offset)
+		}
+	}
+}
+
+func TestFilePathCompleter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"abc", "abd", ".abe"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "abf"), 0755)
+
+	line := []rune("cat " + dir + "/ab")
+	newLine, offset := (&FilePathCompleter{}).Do(line, len(line))
+	got := rs(newLine)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"c ", "d ", "f/"}) || offset != 2 {
+		t.Fatal("result not expect", got, offset)
+	}
+
+	os.Mkdir(filepath.Join(dir, "my dir"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "my dir", "a b$c"), nil, 0644)
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+	os.Setenv("HOME", dir)
+	cases := []struct {
+		line   string
+		expect []string
+		offset int
+	}{
+		{"cd " + dir + "/m", []string{`y\ dir/`}, 1},
+		{"cat " + dir + `/my\ dir/a`, []string{`\ b\$c `}, 1},
+		{"cat " + dir + `/my\ d`, []string{"ir/"}, 5},
+		{`cat "` + dir + `/my dir/a`, []string{` b\$c" `}, 1},
+		{`cat '` + dir + `/my dir/a`, []string{` b$c' `}, 1},
+		{"cat ~", []string{"/"}, 0},
+		{"cat ~/ab", []string{"c ", "d ", "f/"}, 2},
+		{"cat ~/my\\ dir/", []string{`a\ b\$c `}, 0},
+	}
+	for _, c := range cases {
+		line := []rune(c.line)
+		newLine, offset := NewFilePathCompleter().Do(line, len(line))
+		got := rs(newLine)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.expect) || offset != c.offset {
+			t.Fatal("result not expect", c.line, got, offset)
+		}
+	}
+}
+
+func TestGlobCompleter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.go", "b.go", "c.txt"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	line := []rune("vi " + dir + "/*.go")
+	newLine, offset := (&GlobCompleter{}).Do(line, len(line))
+	expect := []string{dir + "/a.go ", dir + "/b.go "}
+	if !reflect.DeepEqual(rs(newLine), expect) || offset != len(line)-3 {
+		t.Fatal("result not expect", rs(newLine), offset)
+	}
+
+	newLine, _ = (&GlobCompleter{Expand: true}).Do(line, len(line))
+	if !reflect.DeepEqual(rs(newLine), []string{dir + "/a.go " + dir + "/b.go "}) {
+		t.Fatal("result not expect", rs(newLine))
+	}
+
+	line = []rune("vi " + dir + "/c")
+	newLine, offset = (&GlobCompleter{}).Do(line, len(line))
+	if !reflect.DeepEqual(rs(newLine), []string{"c.txt "}) || offset != 1 {
+		t.Fatal("result not expect", rs(newLine), offset)
+	}
+}
+
+func TestCompleteLayout(t *testing.T) {
+	cases := []struct {
+		widths []int
+		width  int
+		expect []int
+	}{
+		{[]int{3, 10, 3, 3}, 80, []int{4, 11, 4, 4}},
+		{[]int{3, 10, 3, 3}, 18, []int{4, 11}},
+		{[]int{3, 10, 3, 3, 3}, 15, []int{4, 11}},
+		{[]int{3, 10, 3, 3}, 8, []int{11}},
+		{[]int{30}, 8, []int{31}},
+	}
+	for _, c := range cases {
+		if got := completeLayout(c.widths, c.width); !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("%v in %v: expect %v, got %v", c.widths, c.width, c.expect, got)
+		}
+	}
+}
+
+func TestDescribedLayout(t *testing.T) {
+	cases := []struct {
+		widths []int
+		descs  []string
+		width  int
+		expect []int
+		cand   int
+		cut    []string
+	}{
+		{[]int{6, 4}, []string{"Record", "Get"}, 40, []int{16, 16}, 8, []string{"Record", "Get"}},
+		{[]int{6, 4}, []string{"Record", "Get"}, 20, []int{16}, 8, []string{"Record", "Get"}},
+		{[]int{6, 4}, []string{"Record changes", "Get"}, 14, []int{14}, 8, []string{"Recor…", "Get"}},
+		{[]int{6}, []string{"a\tb"}, 80, []int{13}, 8, []string{"a b"}},
+	}
+	for _, c := range cases {
+		colWidths, cand, cut := describedLayout(c.widths, c.descs, c.width)
+		if !reflect.DeepEqual(colWidths, c.expect) || cand != c.cand || !reflect.DeepEqual(rs(cut), c.cut) {
+			t.Fatalf("%v %q in %v: expect %v %v %q, got %v %v %q",
+				c.widths, c.descs, c.width, c.expect, c.cand, c.cut, colWidths, cand, rs(cut))
+		}
+	}
+}
+
+func TestCompletionMatcherMatch(t *testing.T) {
+	cases := []struct {
+		m      CompletionMatcher
+		cand   string
+		typed  string
+		rank   int
+		expect bool
+	}{
+		{CompletionMatchPrefix, "commit", "co", 0, true},
+		{CompletionMatchPrefix, "Commit", "co", 0, false},
+		{CompletionMatchFold, "Commit", "co", 0, true},
+		{CompletionMatchFold, "recommit", "co", 0, false},
+		{CompletionMatchSubstring, "recommit", "CO", 1<<16 + 2, true},
+		{CompletionMatchSubstring, "commit", "cmt", 0, false},
+		{CompletionMatchFuzzy, "commit", "cmt", 2<<16 + 3*256, true},
+		{CompletionMatchFuzzy, "checkout", "cmt", 0, false},
+	}
+	for _, c := range cases {
+		rank, ok := c.m.Match([]rune(c.cand), []rune(c.typed))
+		if ok != c.expect || rank != c.rank {
+			t.Fatalf("%v %q %q: expect %v %v, got %v %v", c.m, c.cand, c.typed, c.rank, c.expect, rank, ok)
+		}
+	}
+	// with Config.FuncNormalize
+	if _, ok := CompletionMatchFold.match([]rune("Émile"), []rune("emi"), FoldDiacritics); !ok {
+		t.Fatal("diacritic not stripped")
+	}
+	if _, ok := CompletionMatchFold.match([]rune("Émile"), []rune("emi"), FoldCase); ok {
+		t.Fatal("diacritic stripped")
+	}
+}
+
+func TestHighlightMatch(t *testing.T) {
+	got := string(highlightMatch([]rune("git commit"), []rune("COM"), FoldCase, "1;33", "\033[30;47m"))
+	if got != "git \033[1;33mcom\033[0m\033[30;47mmit" {
+		t.Fatalf("unexpected %q", got)
+	}
+	if got := string(highlightMatch([]rune("push"), []rune("x"), FoldCase, "4", "")); got != "push" {
+		t.Fatalf("unexpected %q", got)
+	}
+	if got := string(highlightMatch([]rune("commit"), []rune("cmt"), FoldCase, "4", "")); got != "\033[4mc\033[0mo\033[4mm\033[0mmi\033[4mt\033[0m" {
+		t.Fatalf("unexpected %q", got)
+	}
+
+	got = string(applySpans([]rune("abcdef"), []matchSpan{{0, 1, ""}, {3, 5, "1"}}, "4", ""))
+	if got != "\033[4ma\033[0mbc\033[1mde\033[0mf" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestPcItemValues(t *testing.T) {
+	pc := NewPrefixCompleter(
+		PcItem("ls",
+			PcItemValues("--color=", "", "auto", "always", "never"),
+			PcItemValues("--sort=", ",", "name", "size", "time"),
+		),
+	)
+
+	cases := []struct {
+		line   string
+		expect []string
+		offset int
+	}{
+		{"ls --col", []string{"or="}, 5},
+		{"ls --color=", []string{"auto ", "always ", "never "}, 0},
+		{"ls --color=al", []string{"ways "}, 2},
+		{"ls --sort=s", []string{"ize"}, 1},
+		{"ls --sort=name,", []string{"name", "size", "time"}, 0},
+		{"ls --sort=name,size,ti", []string{"me"}, 2},
+	}
+	for _, c := range cases {
+		newLine, offset := pc.Do([]rune(c.line), len(c.line))
+		if got := rs(newLine); !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("%q: expect %q, got %q", c.line, c.expect, got)
+		}
+		if offset != c.offset {
+			t.Fatalf("%q: expect offset %v, got %v", c.line, c.offset, offset)
+		}
+	}
+}
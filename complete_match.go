@@ -0,0 +1,95 @@
+package readline
+
+import "sort"
+
+// CompletionMatcher is how the candidates are matched with the word typed,
+// see Config.CompletionMatcher.
+type CompletionMatcher int
+
+const (
+	// the matching of the completer, the candidates start with the word
+	CompletionMatchPrefix CompletionMatcher = iota
+	// the candidates start with the word, ignoring the case
+	CompletionMatchFold
+	// the candidates hold the word, ignoring the case. The ones which
+	// start with it come first, then the earlier matches
+	CompletionMatchSubstring
+	// the candidates hold the runes of the word in order, ignoring the
+	// case, e.g. `cmt` matches `commit`. The substrings come first, then
+	// the runes closer together
+	CompletionMatchFuzzy
+)
+
+// Match tells whether the candidate matches the word typed, with its
+// rank: the lower ones are listed first.
+func (m CompletionMatcher) Match(candidate, typed []rune) (rank int, ok bool) {
+	return m.match(candidate, typed, FoldCase)
+}
+
+// match is Match ignoring what norm normalizes rather than the case, see
+// Config.FuncNormalize.
+func (m CompletionMatcher) match(candidate, typed []rune, norm func(rune) rune) (rank int, ok bool) {
+	const tier = 1 << 16
+	if m == CompletionMatchPrefix {
+		return 0, runes.HasPrefix(candidate, typed)
+	}
+	if hasPrefixNorm(candidate, typed, norm) {
+		return 0, true
+	}
+	if m == CompletionMatchFold {
+		return 0, false
+	}
+	if idx := indexNorm(candidate, typed, norm); idx >= 0 {
+		return tier + idx, true
+	}
+	if m == CompletionMatchSubstring {
+		return 0, false
+	}
+	pos := fuzzyIndex(candidate, typed, norm)
+	if pos == nil {
+		return 0, false
+	}
+	// the runes skipped between the first match and the last one
+	gaps := pos[len(pos)-1] - pos[0] + 1 - len(pos)
+	return 2*tier + gaps*256 + pos[0], true
+}
+
+// matchCandidates asks the completer for the candidates of the word
+// before the cursor as if it weren't typed, and keeps the ones which
+// match it, ranked. They replace the word. It returns false if the
+// completer doesn't complete the word alone, e.g. after `--color=`.
+func (o *opCompleter) matchCandidates(m CompletionMatcher, line []rune, pos int) (newLines [][]rune, descs []string, offset int, ok bool) {
+	word := lastWord(line[:pos])
+	if len(word) == 0 {
+		return nil, nil, 0, false
+	}
+	start := pos - len(word)
+	stripped := append(runes.Copy(line[:start]), line[pos:]...)
+	candidates, candDescs, offset := o.candidates(stripped, start)
+	if offset != 0 {
+		return nil, nil, 0, false
+	}
+	sortCandidates(o.op.cfg, candidates, candDescs)
+
+	type match struct{ idx, rank int }
+	var matches []match
+	norm := o.op.cfg.completionNormalizer()
+	for idx, c := range candidates {
+		if rank, ok := m.match(c, word, norm); ok {
+			matches = append(matches, match{idx, rank})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].rank < matches[j].rank
+	})
+	if candDescs != nil {
+		descs = make([]string, 0, len(matches))
+	}
+	for _, match := range matches {
+		newLines = append(newLines, candidates[match.idx])
+		if candDescs != nil {
+			descs = append(descs, candDescs[match.idx])
+		}
+	}
+	return newLines, descs, len(word), true
+}
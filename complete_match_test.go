@@ -0,0 +1,37 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestCompletionMatcher(t *testing.T) {
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Stdout: out,
+		AutoComplete: NewPrefixCompleter(
+			PcItem("git", PcItem("checkout"), PcItem("commit"), PcItem("recommit")),
+			PcItem("Gitk"),
+		),
+		CompletionMatcher: CompletionMatchFuzzy,
+	})
+
+	for _, c := range []struct {
+		input, line string
+	}{
+		// the only fuzzy match replaces the word
+		{"git ck\t\r", "git checkout "},
+		// the closer runes first
+		{"git cmt\t\t\r\r", "git commit "},
+		// appended as usual when they start with the word
+		{"git ch\t\r", "git checkout "},
+		// the prefix first, then the substring
+		{"git COM\t\t\r\r", "git commit "},
+		{"git COM\t\t\t\r\r", "git recommit "},
+		{"gitk\t\r", "Gitk "},
+	} {
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.line {
+			t.Fatalf("%q: expect %q, got %q %v", c.input, c.line, line, err)
+		}
+	}
+}
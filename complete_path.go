@@ -0,0 +1,186 @@
+package readline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FilePathCompleter completes the last word of the line as a path on the
+// local filesystem. Directories are completed with a trailing separator so
+// the user can keep descending, files with a trailing space.
+//
+// The word is read like a shell does: `~/` is the home directory, and the
+// spaces escaped by a backslash or within quotes are part of it. The
+// candidates are escaped the same way, or closed by the quote left open.
+// The hidden files are only offered once the dot is typed.
+//
+// It's suitable as the `ArgCompleter` of a PrefixCompleter.
+type FilePathCompleter struct{}
+
+// NewFilePathCompleter returns a FilePathCompleter.
+func NewFilePathCompleter() *FilePathCompleter {
+	return &FilePathCompleter{}
+}
+
+func (f *FilePathCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	base, word, quote := pathWord(line[:pos])
+	if word == "~" {
+		return [][]rune{{filepath.Separator}}, 0
+	}
+	dir, name := filepath.Split(word)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	} else if strings.HasPrefix(readDir, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, 0
+		}
+		readDir = home + readDir[1:]
+	}
+	files, err := ioutil.ReadDir(readDir)
+	if err != nil {
+		return nil, 0
+	}
+	for _, file := range files {
+		fileName := file.Name()
+		if !strings.HasPrefix(fileName, name) {
+			continue
+		}
+		// hidden files are only offered if asked for explicitly
+		if strings.HasPrefix(fileName, ".") && !strings.HasPrefix(name, ".") {
+			continue
+		}
+		suffix := quotePath(fileName[len(name):], quote)
+		if file.IsDir() {
+			suffix += string(filepath.Separator)
+		} else {
+			if quote != 0 {
+				suffix += string(quote)
+			}
+			suffix += " "
+		}
+		newLine = append(newLine, []rune(suffix))
+	}
+	return newLine, len(base)
+}
+
+// the backslash escapes the runes of the paths, except where it's the
+// separator
+var pathEscapes = filepath.Separator != '\\'
+
+// pathWord reads the last word of line like a shell: base is what's typed
+// of its last element, path is what it stands for, without the quotes and
+// the escaping backslashes, and quote is the quote left open, if any.
+func pathWord(line []rune) (base []rune, path string, quote rune) {
+	var word []rune
+	start := 0
+	for i := 0; i < len(line); i++ {
+		r := line[i]
+		switch {
+		case quote == '"' && r == '\\' && pathEscapes && i+1 < len(line) && strings.ContainsRune("\"\\$`", line[i+1]):
+			i++
+			r = line[i]
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+		case r == '\\' && pathEscapes && i+1 < len(line):
+			i++
+			r = line[i]
+		case r == '"' || r == '\'':
+			quote = r
+			continue
+		case r == ' ':
+			word, start = word[:0], i+1
+			continue
+		}
+		word = append(word, r)
+		if r == filepath.Separator {
+			start = i + 1
+		}
+	}
+	return line[start:], string(word), quote
+}
+
+// quotePath escapes the runes of s which the shell would take apart, or
+// the ones which end the quote left open.
+func quotePath(s string, quote rune) string {
+	if !pathEscapes || quote == '\'' {
+		return s
+	}
+	special := " \t!\"#$&'()*;<>?[\\]`{|}"
+	if quote == '"' {
+		special = "\"\\$`"
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lastWord returns the trailing space-separated word of line.
+func lastWord(line []rune) []rune {
+	for i := len(line) - 1; i >= 0; i-- {
+		if line[i] == ' ' {
+			return line[i+1:]
+		}
+	}
+	return line
+}
+
+// GlobCompleter completes paths like FilePathCompleter, but when the last
+// word is a glob pattern (e.g. `*.go`), the matching paths are offered as
+// candidates which replace the pattern.
+// If Expand is set, the pattern is replaced by all of its matches at once
+// instead, like bash's glob-expand-word.
+type GlobCompleter struct {
+	Expand bool
+}
+
+func (g *GlobCompleter) Replacing() bool {
+	return true
+}
+
+func (g *GlobCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	word := lastWord(line[:pos])
+	if !isGlob(word) {
+		// turn the suffixes into replacements of the typed base name
+		cands, offset := (&FilePathCompleter{}).Do(line, pos)
+		typed, _, _ := pathWord(line[:pos])
+		base := typed[len(typed)-offset:]
+		for _, c := range cands {
+			newLine = append(newLine, append(runes.Copy(base), c...))
+		}
+		return newLine, offset
+	}
+
+	matches, err := filepath.Glob(string(word))
+	if err != nil || len(matches) == 0 {
+		return nil, 0
+	}
+	if g.Expand {
+		return [][]rune{[]rune(strings.Join(matches, " ") + " ")}, len(word)
+	}
+	for _, m := range matches {
+		newLine = append(newLine, []rune(m+" "))
+	}
+	return newLine, len(word)
+}
+
+func isGlob(word []rune) bool {
+	for _, r := range word {
+		switch r {
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,313 @@
+package readline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// wordCompleter is a staticCompleter which doesn't complete the empty
+// words.
+type wordCompleter struct{ staticCompleter }
+
+func (c wordCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	if len(lastWord(line[:pos])) == 0 {
+		return nil, 0
+	}
+	return c.staticCompleter.Do(line, pos)
+}
+
+func TestCompleteSelect(t *testing.T) {
+	for _, c := range []struct {
+		input, expect string
+	}{
+		// the first Tab inserts the common part, the second one lists the
+		// candidates and the third one selects them. Tab, Right, Left and
+		// Shift-Tab move the selection, in turn
+		{"g\t\t\t\r\r", "gist"},
+		{"g\t\t\t\t\r\r", "gitk"},
+		{"g\t\t\t\x06\x06\r\r", "gitlab"},
+		{"g\t\t\t\x06\x06\x06\r\r", "gist"},
+		{"g\t\t\t\x02\r\r", "gitlab"},
+		{"g\t\t\t\033[Z\r\r", "gitlab"},
+		// End and Home go to the ends of the row
+		{"g\t\t\t\x05\r\r", "gitlab"},
+		{"g\t\t\t\x05\x01\r\r", "gist"},
+		// typing narrows the candidates, Backspace widens them again
+		{"g\t\t\tt\r\r", "gitk"},
+		{"g\t\t\tz\r\r", "gist"},
+		{"g\t\t\tt\x7f\r\r", "gist"},
+		// the menu is closed once nothing matches
+		{"g\t\t\t\x7f\x7f\r", ""},
+		// Ctrl-G and Esc leave the line as it was before the menu
+		{"g\t\t\t\x07\r", "gi"},
+		{"g\t\t\t\033\r", "gi"},
+		// the other keys are performed after the menu is closed
+		{"g\t\t\t\x0b\r", "gi"},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			AutoComplete: wordCompleter{staticCompleter{"gist", "gitk", "gitlab"}},
+		})
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Errorf("%q: expect %q, got %q %v", c.input, c.expect, line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestCompleteHooks(t *testing.T) {
+	out := new(syncBuffer)
+	shown := make(chan []string, 1)
+	veto := false
+	rl, w := newTestInstance(t, &Config{
+		Stdout:       out,
+		AutoComplete: staticCompleter{"get", "git", "secret"},
+		FuncOnBeforeComplete: func(candidates []string) (string, bool) {
+			return "-- commands --", !veto
+		},
+		FuncOnAfterComplete: func(candidates []string) { shown <- candidates },
+	})
+
+	go w.Write([]byte("g\t\r"))
+	if line, err := rl.Readline(); err != nil || line != "g" {
+		t.Fatal("result not expect", line, err)
+	}
+	if c := <-shown; len(c) != 2 || c[0] != "get" || c[1] != "git" {
+		t.Fatal("candidates not expect", c)
+	}
+	if !strings.Contains(out.String(), "-- commands --\nget git") {
+		t.Fatalf("no banner: %q", out.String())
+	}
+
+	veto = true
+	go w.Write([]byte("g\t\r"))
+	if line, err := rl.Readline(); err != nil || line != "g" {
+		t.Fatal("result not expect", line, err)
+	}
+	if len(shown) != 0 {
+		t.Fatal("the menu is shown")
+	}
+}
+
+func TestCompleteQuery(t *testing.T) {
+	cands := staticCompleter{"c1", "c2", "c3"}
+	for _, c := range []struct {
+		items  int
+		input  string
+		expect string
+		query  bool
+	}{
+		// n cancels the listing, the common part stays
+		{3, "c\tnx\r", "cx", true},
+		// other keys ring the bell until it's answered
+		{3, "c\tzy1\r", "c1", true},
+		{4, "c\t1\r", "c1", false},
+		// the listing which fits isn't asked about by default
+		{0, "c\t1\r", "c1", false},
+		{-1, "c\t1\r", "c1", false},
+	} {
+		out := new(syncBuffer)
+		rl, w := newTestInstance(t, &Config{
+			Stdout:               out,
+			AutoComplete:         cands,
+			CompletionQueryItems: c.items,
+			FuncGetWidth:         func() int { return 20 },
+			FuncGetHeight:        func() int { return 10 },
+		})
+
+		go w.Write([]byte(c.input))
+		line, err := rl.Readline()
+		if err != nil || line != c.expect {
+			t.Fatal("result not expect", c.input, line, err)
+		}
+		query := strings.Contains(out.String(), "Display all 3 possibilities? (y or n)")
+		if query != c.query {
+			t.Fatalf("%q: expect query %v, got %q", c.input, c.query, out.String())
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestCompleteSingleImmediately(t *testing.T) {
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Stdout:                    out,
+		AutoComplete:              staticCompleter{"get", "git", "gitk"},
+		CompleteSingleImmediately: true,
+		CompleteSuffix:            " ",
+		ExactMatchStyle:           "1",
+	})
+
+	// the listing is shown, then typing leaves a single candidate
+	go w.Write([]byte("g\te\r"))
+	if line, err := rl.Readline(); err != nil || line != "get " {
+		t.Fatal("result not expect", line, err)
+	}
+	// the same in the menu
+	go w.Write([]byte("g\t\te\r"))
+	if line, err := rl.Readline(); err != nil || line != "get " {
+		t.Fatal("result not expect", line, err)
+	}
+
+	go w.Write([]byte("git\t\r"))
+	if line, err := rl.Readline(); err != nil || line != "git" {
+		t.Fatal("result not expect", line, err)
+	}
+	if !strings.Contains(out.String(), "\033[1mgit\033[0m gitk") {
+		t.Fatalf("exact match not marked: %q", out.String())
+	}
+}
+
+func TestCompleteDescriptions(t *testing.T) {
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Stdout:           out,
+		AutoComplete:     describedCompleter{"config\tGet and set options", "commit\tRecord changes"},
+		Locale:           "en",
+		DescriptionStyle: "2",
+	})
+
+	go w.Write([]byte("co\t\t\r\r"))
+	if line, err := rl.Readline(); err != nil || line != "commit" {
+		t.Fatal("result not expect", line, err)
+	}
+	// sorted along with their candidates, in columns
+	menu := "commit  \033[2mRecord changes\033[0m" + strings.Repeat(" ", 7) +
+		"config  \033[2mGet and set options\033[0m"
+	if !strings.Contains(out.String(), menu) {
+		t.Fatalf("menu not expect: %q", out.String())
+	}
+}
+
+func TestCompleteListMode(t *testing.T) {
+	for _, c := range []struct {
+		mode   CompleteListMode
+		input  string
+		listed int
+	}{
+		{CompleteListUnmodified, "g\t\r", 0},
+		{CompleteListUnmodified, "gi\t\r", 1},
+		{CompleteListUnmodified, "g\t\t\r", 1},
+		{CompleteListAmbiguous, "g\t\r", 1},
+		{CompleteListAmbiguous, "gi\t\r", 1},
+		{CompleteListOnSecondTab, "g\t\r", 0},
+		{CompleteListOnSecondTab, "gi\t\r", 0},
+		{CompleteListOnSecondTab, "gi\t\t\r", 1},
+		{CompleteListOnSecondTab, "g\t\t\r", 1},
+	} {
+		var listed int32
+		rl, w := newTestInstance(t, &Config{
+			AutoComplete:     staticCompleter{"gitk", "gitlab", "gist"},
+			CompleteListMode: c.mode,
+			FuncOnAfterComplete: func([]string) {
+				atomic.AddInt32(&listed, 1)
+			},
+		})
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != "gi" {
+			t.Fatalf("%v %q: result not expect %q %v", c.mode, c.input, line, err)
+		}
+		if n := atomic.LoadInt32(&listed); int(n) != c.listed {
+			t.Fatalf("%v %q: listed %v times", c.mode, c.input, n)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestMenuComplete(t *testing.T) {
+	for _, c := range []struct {
+		input, expect string
+	}{
+		// Tab inserts the candidates in turn, Enter leaves the menu
+		{"g\t\r\r", "gist"},
+		{"g\t\t\r\r", "gitk"},
+		{"g\t\t\t\t\r\r", "gist"},
+		// Shift-Tab goes backward
+		{"g\t\033[Z\r\r", "gitlab"},
+		{"g\033[Z\033[Z\r\r", "gitk"},
+		// the other keys keep the candidate
+		{"g\t\tx\r", "gitkx"},
+		// Ctrl-G restores the line
+		{"g\t\t\x07\r", "g"},
+		{"x\t\r", "x"},
+	} {
+		out := new(syncBuffer)
+		rl, w := newTestInstance(t, &Config{
+			Stdout:       out,
+			AutoComplete: staticCompleter{"gist", "gitk", "gitlab"},
+			MenuComplete: true,
+			FuncGetWidth: func() int { return 40 },
+		})
+
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: expect %q, got %q %v", c.input, c.expect, line, err)
+		}
+		// the candidate inserted is marked in the list
+		if c.expect != "x" && !strings.Contains(out.String(), "\033[30;47m") {
+			t.Fatalf("%q: no candidate marked in %q", c.input, out.String())
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestCompleteCancel(t *testing.T) {
+	var cands staticCompleter
+	for i := 0; i < 10; i++ {
+		cands = append(cands, fmt.Sprintf("cand%02d%s", i, strings.Repeat("x", 40)))
+	}
+	rl, w := newTestInstance(t, &Config{
+		AuxOutput:        ioutil.Discard,
+		AutoComplete:     append(cands, "gitk", "gitlab", "gist"),
+		CompleteListMode: CompleteListAmbiguous,
+		FuncGetHeight:    func() int { return 4 },
+	})
+
+	// a lone Esc is only taken for one once the keys before it are handled
+	waitLen := func(n int) {
+		for rl.Operation.buf.Len() != n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for _, c := range []struct {
+		input           string
+		typed, restored int
+		expect          string
+	}{
+		// the common part inserted is dropped
+		{"g\t", 2, 1, "gZ"},
+		// so are the characters narrowing the menu
+		{"g\t\tt", 3, 1, "gZ"},
+		// and the cursor is where it was
+		{"x y\x02g\t\tt", 6, 4, "x gZy"},
+	} {
+		go func() {
+			w.Write([]byte(c.input))
+			waitLen(c.typed)
+			w.Write([]byte("\033"))
+			waitLen(c.restored)
+			w.Write([]byte("Z\r"))
+		}()
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+	}
+
+	// the pages are the rows of the screen, without the status line
+	go w.Write([]byte("c\t\t\033[6~\033[6~\033[5~\r\r"))
+	if line, err := rl.Readline(); err != nil || line != cands[3] {
+		t.Fatal("result not expect", line, err)
+	}
+	go w.Write([]byte("c\t\t\033[6~\033[6~\033[6~\033[6~\r\r"))
+	if line, err := rl.Readline(); err != nil || line != cands[9] {
+		t.Fatal("result not expect", line, err)
+	}
+}
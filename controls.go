@@ -0,0 +1,67 @@
+package readline
+
+import "bufio"
+
+// With Config.FilterControls, the control characters which aren't keys
+// are kept out of the line: a server which echoes the line of a peer, in
+// its prompts or its candidates, would have the terminal run them. The
+// terminal decodes the 8-bit CSI and SS3 like their 7-bit forms, and drops
+// the other C1 controls, and the control strings (OSC, DCS, APC, PM and
+// SOS) such as the replies of a terminal echoed back by the peer.
+
+const (
+	charSS3 = 0x8f
+	charCSI = 0x9b
+	// ST, which ends the control strings
+	charST = 0x9c
+)
+
+// isControl tells whether r is a C0 or C1 control character, or DEL.
+func isControl(r rune) bool {
+	return r >= 0 && r < 0x20 || r >= 0x7f && r < 0xa0
+}
+
+// isC1 tells whether r is a C1 control character, ESC r-0x40 in 7 bits.
+func isC1(r rune) bool {
+	return r >= 0x80 && r < 0xa0
+}
+
+// isStringIntroducer tells whether the C1 control r begins a control
+// string: DCS, SOS, OSC, PM or APC.
+func isStringIntroducer(r rune) bool {
+	switch r {
+	case 0x90, 0x98, 0x9d, 0x9e, 0x9f:
+		return true
+	}
+	return false
+}
+
+// skipControlString drops a control string up to its BEL or ST. It only
+// reads the input already buffered: a key typed alone, such as Alt-], isn't
+// followed by a string.
+func skipControlString(reader *bufio.Reader) {
+	for reader.Buffered() > 0 {
+		r, _, err := reader.ReadRune()
+		if err != nil || r == CharBell || r == charST {
+			return
+		}
+		if r == CharEsc {
+			if next, err := reader.Peek(1); err == nil && next[0] == '\\' {
+				reader.ReadByte()
+			}
+			return
+		}
+	}
+}
+
+// stripControls drops the control characters but the newlines and the
+// tabs from the pasted text.
+func stripControls(text []rune) []rune {
+	ret := make([]rune, 0, len(text))
+	for _, r := range text {
+		if !isControl(r) || r == '\n' || r == '\t' {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,29 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestFilterControls(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		FilterControls:       true,
+		EnableBracketedPaste: true,
+	})
+
+	for _, c := range []struct {
+		input  string
+		expect string
+	}{
+		{"a\u009b31mb\u0085c\x1cd\r", "abcd"},
+		// the replies of a terminal
+		{"e\033]11;rgb:0000/0000/0000\033\\f\033P1$r0m\u009cg\u009d0;x\x07h\r", "efgh"},
+		{"i\033[200~j\033[31m\tk\u009b\r\033[201~\r", "ij[31m\tk\n"},
+		// the 8-bit CSI is decoded
+		{"lm\u009bDn\r", "lnm"},
+	} {
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package readline
+
+import (
+	"sort"
+)
+
+// Diagnostic marks a range of the line, e.g. an error found by a
+// validator, so that it's shown in place.
+type Diagnostic struct {
+	// the range of runes of the line, End is exclusive
+	Start, End int
+	// the SGR parameters of the mark, Config.DiagnosticStyle if empty
+	Style string
+}
+
+const (
+	// a red undercurl
+	undercurlStyle = "4:3;58;5;1"
+	// for the terminals which would show a plain underline at best
+	reverseStyle = "7"
+)
+
+// diagnosticSpans turns the diagnostics of a line of n runes into the
+// spans for applySpans, sorted and without the overlaps.
+func diagnosticSpans(diags []Diagnostic, n int, style string) []matchSpan {
+	if len(diags) == 0 {
+		return nil
+	}
+	spans := make([]matchSpan, 0, len(diags))
+	for _, d := range diags {
+		if d.Start < 0 {
+			d.Start = 0
+		}
+		if d.End > n {
+			d.End = n
+		}
+		if d.Start >= d.End {
+			continue
+		}
+		if d.Style == "" {
+			d.Style = style
+		}
+		spans = append(spans, matchSpan{d.Start, d.End, d.Style})
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	ret := spans[:0]
+	for _, span := range spans {
+		if len(ret) > 0 && span.start < ret[len(ret)-1].end {
+			continue
+		}
+		ret = append(ret, span)
+	}
+	return ret
+}
@@ -0,0 +1,61 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	cfg := &Config{
+		Painter:         &defaultPainter{},
+		DiagnosticStyle: "7",
+		FuncIsTerminal:  func() bool { return false },
+		FuncDiagnose: func(line []rune) []Diagnostic {
+			return []Diagnostic{
+				{Start: 9, End: 99, Style: "4:3"},
+				{Start: 4, End: 7},
+				{Start: 5, End: 6}, // overlaps, dropped
+				{Start: 3, End: 3},
+			}
+		},
+	}
+	rb := NewRuneBuffer(nil, "", cfg, 80)
+	rb.buf = []rune("git comit -m")
+	if got := string(rb.paint()); got != "git \033[7mcom\033[0mit\033[4:3m -m\033[0m" {
+		t.Fatalf("result not expect %q", got)
+	}
+
+	cfg.Painter = &testPainter{}
+	if got := string(rb.paint()); got != "git comit -m!" {
+		t.Fatalf("result not expect %q", got)
+	}
+}
+
+type testPainter struct{}
+
+func (*testPainter) Paint(line []rune, _ int) []rune {
+	return append(runes.Copy(line), '!')
+}
+
+func TestHighlight(t *testing.T) {
+	cfg := &Config{
+		Painter:         &defaultPainter{},
+		DiagnosticStyle: "7",
+		FuncIsTerminal:  func() bool { return false },
+		FuncHighlight: func(line []rune, pos int) []StyleSpan {
+			return []StyleSpan{
+				{Start: 0, End: 6, Style: "1"},
+				{Start: 9, End: 13, Style: "1"},
+				{Start: 14, End: 99, Style: "32"},
+			}
+		},
+		FuncDiagnose: func(line []rune) []Diagnostic {
+			return []Diagnostic{{Start: 11, End: 16}}
+		},
+	}
+	rb := NewRuneBuffer(nil, "", cfg, 80)
+	rb.buf = []rune("select x from tab")
+	expect := "\033[1mselect\033[0m x \033[1mfr\033[0m\033[7mom ta\033[0m\033[32mb\033[0m"
+	if got := string(rb.paint()); got != expect {
+		t.Fatalf("result not expect %q", got)
+	}
+}
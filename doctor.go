@@ -0,0 +1,102 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+var doctorKeys = []string{
+	"Up", "Left", "Home", "End", "Backspace", "Delete",
+	"Ctrl-Left", "Alt-b",
+}
+
+// Doctor probes the current terminal and writes a report to w, which
+// users can attach to bug reports about rendering or keys.
+// It asks the user to press a few keys if stdin is a terminal.
+func Doctor(w io.Writer) error {
+	return DoctorEx(w, &Config{})
+}
+
+// DoctorEx is Doctor for the terminal of cfg: its Stdin, FuncIsTerminal,
+// FuncGetWidth, FuncGetHeight, FuncMakeRaw and FuncExitRaw, the defaults
+// of the ones which are nil.
+func DoctorEx(w io.Writer, cfg *Config) error {
+	c := *cfg
+	if c.Stdin == nil {
+		c.Stdin = Stdin
+	}
+	if c.FuncIsTerminal == nil {
+		c.FuncIsTerminal = DefaultIsTerminal
+	}
+	if c.FuncGetWidth == nil {
+		c.FuncGetWidth = GetScreenWidth
+	}
+	if c.FuncGetHeight == nil {
+		c.FuncGetHeight = GetScreenHeight
+	}
+	rm := new(RawMode)
+	if c.FuncMakeRaw == nil {
+		c.FuncMakeRaw = rm.Enter
+	}
+	if c.FuncExitRaw == nil {
+		c.FuncExitRaw = rm.Exit
+	}
+
+	fmt.Fprintf(w, "readline doctor (%s/%s, %s)\n", runtime.GOOS, runtime.GOARCH, runtime.Version())
+	for _, name := range []string{"TERM", "COLORTERM", "TERM_PROGRAM", "TMUX", "LANG", "LC_ALL", "LC_CTYPE"} {
+		fmt.Fprintf(w, "  %-12s %q\n", name, os.Getenv(name))
+	}
+
+	isTerm := c.FuncIsTerminal()
+	fmt.Fprintf(w, "  %-12s %v\n", "terminal", isTerm)
+	fmt.Fprintf(w, "  %-12s %vx%v\n", "size", c.FuncGetWidth(), c.FuncGetHeight())
+	caps := DetectCapabilities()
+	fmt.Fprintf(w, "  %-12s %v\n", "colors", caps.Colors)
+	fmt.Fprintf(w, "  %-12s %v\n", "undercurl", caps.Undercurl)
+	fmt.Fprintf(w, "  %-12s %v\n", "strike", caps.Strikethrough)
+	fmt.Fprintf(w, "  %-12s %v\n", "overline", caps.Overline)
+	kbs, kdch1 := terminfoEraseKeys(os.Getenv("TERM"))
+	fmt.Fprintf(w, "  %-12s %q\n", "kbs", kbs)
+	fmt.Fprintf(w, "  %-12s %q\n", "kdch1", kdch1)
+
+	fmt.Fprintf(w, "\ncolors:  \033[31mred\033[0m \033[32mgreen\033[0m \033[1;34mbold blue\033[0m"+
+		" \033[38;5;208m256-orange\033[0m \033[38;2;120;80;200mtruecolor-purple\033[0m\n")
+	fmt.Fprintf(w, "attrs:   \033[4:3;58;5;1mundercurl\033[0m \033[9mstrike\033[0m \033[53moverline\033[0m\n")
+	fmt.Fprintf(w, "unicode: [你好] [☭] [é] [é]\n")
+	fmt.Fprintf(w, "         the brackets above should be aligned with these: [1234] [1] [1] [1]\n")
+	if !isTerm {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\nkeys (press Enter to skip one):\n")
+	for _, key := range doctorKeys {
+		seq, err := doctorReadKey(w, &c, key)
+		if err != nil {
+			return err
+		}
+		if seq == "\r" {
+			seq = "skipped"
+		} else {
+			seq = fmt.Sprintf("%q", seq)
+		}
+		fmt.Fprintf(w, "\r\033[K  %-12s %s\n", key, seq)
+	}
+	return nil
+}
+
+func doctorReadKey(w io.Writer, cfg *Config, key string) (string, error) {
+	if err := cfg.FuncMakeRaw(); err != nil {
+		return "", err
+	}
+	defer cfg.FuncExitRaw()
+
+	fmt.Fprintf(w, "  press %s: ", key)
+	buf := make([]byte, 32)
+	n, err := cfg.Stdin.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
@@ -0,0 +1,58 @@
+package readline
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		// one key per read
+		for _, key := range []string{"\033[A", "\r", "\033[H"} {
+			w.Write([]byte(key))
+		}
+		w.Close()
+	}()
+	raw := 0
+	out := new(bytes.Buffer)
+	err := DoctorEx(out, &Config{
+		Stdin:          r,
+		FuncIsTerminal: func() bool { return true },
+		FuncGetWidth:   func() int { return 100 },
+		FuncGetHeight:  func() int { return 30 },
+		FuncMakeRaw:    func() error { raw++; return nil },
+		FuncExitRaw:    func() error { raw--; return nil },
+	})
+	// the input ends before the keys are all pressed
+	if err != io.EOF {
+		t.Fatal("result not expect", err)
+	}
+	for _, s := range []string{
+		"size         100x30\n",
+		"Up           \"\\x1b[A\"\n",
+		"Left         skipped\n",
+		"Home         \"\\x1b[H\"\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Fatalf("%q not in %q", s, out.String())
+		}
+	}
+	if raw != 0 {
+		t.Fatal("raw mode not exited", raw)
+	}
+
+	// the keys aren't asked without a terminal
+	out.Reset()
+	err = DoctorEx(out, &Config{
+		Stdin:          r,
+		FuncIsTerminal: func() bool { return false },
+		FuncGetWidth:   func() int { return 80 },
+		FuncGetHeight:  func() int { return -1 },
+	})
+	if err != nil || strings.Contains(out.String(), "press") || !strings.Contains(out.String(), "80x-1") {
+		t.Fatal("result not expect", out.String(), err)
+	}
+}
@@ -0,0 +1,99 @@
+package readline
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Driver operates an Instance like a user at a terminal, for the
+// integration tests of the applications built on the package: it types
+// the keys and waits for the screen to show what's expected, like expect
+// but in-process and without a terminal. The Instance is drawn on the
+// Screen of a Widget, so the screen is the one of a terminal of its size.
+//
+//	d, _ := NewDriver(&Config{Prompt: "> "}, 80, 24)
+//	go app.Run(d.Instance)
+//	d.Type("connect db1")
+//	d.Press("enter")
+//	if _, err := d.Expect(`^connected to (\w+)$`); err != nil {
+//		t.Fatal(err)
+//	}
+type Driver struct {
+	*Widget
+	// how long Expect waits, 5 seconds by default
+	Timeout time.Duration
+	changed chan struct{}
+}
+
+// NewDriver returns a Driver of the Instance of cfg, on a screen of the
+// given size. The Stdin, the outputs and the functions of the terminal of
+// cfg are replaced, see NewWidget.
+func NewDriver(cfg *Config, width, height int) (*Driver, error) {
+	d := &Driver{
+		Timeout: 5 * time.Second,
+		changed: make(chan struct{}, 1),
+	}
+	w, err := NewWidget(cfg, width, height, func() {
+		select {
+		case d.changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.Widget = w
+	return d, nil
+}
+
+// Type types text as it is.
+func (d *Driver) Type(text string) {
+	d.Feed([]byte(text))
+}
+
+// Press presses the keys of the given names, see KeyBytes. It returns an
+// error, before pressing any of them, if one of the names is unknown.
+func (d *Driver) Press(keys ...string) error {
+	var b []byte
+	for _, key := range keys {
+		seq, ok := KeyBytes(key)
+		if !ok {
+			return fmt.Errorf("readline: unknown key %q", key)
+		}
+		b = append(b, seq...)
+	}
+	d.Feed(b)
+	return nil
+}
+
+// Text returns the text of the screen, see Screen.String.
+func (d *Driver) Text() string {
+	return d.Screen().String()
+}
+
+// Expect waits for the text of the screen to match the regular expression
+// pattern, in which ^ and $ match at the start and the end of the rows,
+// and returns the match and its submatches. The screen is matched as it
+// is, not what was written since the last Expect: the pattern has to tell
+// a new prompt from the ones above it, e.g. `(?s)out\n> $`. It returns an
+// error holding the screen after the Timeout.
+func (d *Driver) Expect(pattern string) ([]string, error) {
+	re, err := regexp.Compile("(?m)" + pattern)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.NewTimer(d.Timeout)
+	defer timeout.Stop()
+	for {
+		text := d.Text()
+		if m := re.FindStringSubmatch(text); m != nil {
+			return m, nil
+		}
+		select {
+		case <-d.changed:
+		case <-timeout.C:
+			return nil, fmt.Errorf("readline: %q not on the screen after %v:\n%s", pattern, d.Timeout, text)
+		}
+	}
+}
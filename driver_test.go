@@ -0,0 +1,48 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDriver(t *testing.T) {
+	d, err := NewDriver(&Config{
+		Prompt:       "> ",
+		AutoComplete: staticCompleter{"hello", "help"},
+	}, 20, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := d.Readline()
+		lines <- line
+	}()
+
+	d.Type("he")
+	if err := d.Press("tab"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := d.Expect(`^> (he\w+)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m[1] != "hel" {
+		t.Fatal("result not expect", m)
+	}
+	d.Type("lo")
+	d.Press("enter")
+	if line := <-lines; line != "hello" {
+		t.Fatal("result not expect", line)
+	}
+
+	d.Timeout = 10 * time.Millisecond
+	if _, err := d.Expect(`^> bye$`); err == nil || !strings.Contains(err.Error(), "> hello") {
+		t.Fatal("error not expect", err)
+	}
+	if err := d.Press("enter", "no-such-key"); err == nil {
+		t.Fatal("unknown key pressed")
+	}
+}
@@ -0,0 +1,618 @@
+package readline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// The editor protocol lets thin clients, e.g. web UIs or editor plugins,
+// drive a line editor running on a server. Unlike RemoteSvr, which relays
+// the output to a terminal, the server draws the line on a Screen and
+// sends its rows: the clients needn't interpret escape sequences. The
+// frames are JSON-RPC 2.0 notifications, one per line, see
+// doc/protocol.md. The frames of several sessions can share a connection,
+// see EditorMux.
+
+// RenderFrame is a change of the screen of the server.
+type RenderFrame struct {
+	// the session of the screen, empty without EditorMux
+	Session string `json:"session,omitempty"`
+	// the size of the screen, the rows are all sent again when it changes
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// the rows which changed
+	Rows      []RenderRow `json:"rows"`
+	CursorRow int         `json:"cursorRow"`
+	CursorCol int         `json:"cursorCol"`
+}
+
+// RenderRow is a row of the screen, its text split into runs of the same
+// style, without the trailing blanks.
+type RenderRow struct {
+	Row  int         `json:"row"`
+	Runs []RenderRun `json:"runs"`
+}
+
+// RenderRun is the text of a row drawn with the SGR parameters of Style,
+// which is empty for the default style.
+type RenderRun struct {
+	Text  string `json:"text"`
+	Style string `json:"style,omitempty"`
+}
+
+// Text returns the text of the row.
+func (r RenderRow) Text() string {
+	var b strings.Builder
+	for _, run := range r.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type rpcFrame struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type sessionParams struct {
+	Session string `json:"session,omitempty"`
+}
+
+type helloParams struct {
+	Session string `json:"session,omitempty"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+}
+
+type keysParams struct {
+	Session string `json:"session,omitempty"`
+	Data    string `json:"data"`
+}
+
+// session returns the session of the frame, which is empty if it has
+// none.
+func (f *rpcFrame) session() (string, bool) {
+	var params sessionParams
+	if len(f.Params) > 0 && json.Unmarshal(f.Params, &params) != nil {
+		return "", false
+	}
+	return params.Session, true
+}
+
+// the longest frame read, the connection which sends a longer one is
+// closed
+const maxRPCFrameSize = 1 << 20
+
+// rpcConn reads and writes the frames of a connection.
+type rpcConn struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	m    sync.Mutex
+	enc  *json.Encoder
+}
+
+func newRPCConn(conn io.ReadWriteCloser) *rpcConn {
+	return &rpcConn{conn: conn, r: bufio.NewReader(conn), enc: json.NewEncoder(conn)}
+}
+
+func (c *rpcConn) send(method string, params interface{}) error {
+	frame := rpcFrame{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		frame.Params = data
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.enc.Encode(&frame)
+}
+
+// read reads the next frame, the blank lines are skipped. The line is
+// read up to maxRPCFrameSize before it's decoded.
+func (c *rpcConn) read() (*rpcFrame, error) {
+	for {
+		var line []byte
+		for {
+			chunk, err := c.r.ReadSlice('\n')
+			line = append(line, chunk...)
+			if len(line) > maxRPCFrameSize || len(line) == maxRPCFrameSize && err == bufio.ErrBufferFull {
+				return nil, fmt.Errorf("frame longer than %d bytes", maxRPCFrameSize)
+			}
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err != nil && (err != io.EOF || len(bytes.TrimSpace(line)) == 0) {
+				return nil, err
+			}
+			break
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		frame := new(rpcFrame)
+		if err := json.Unmarshal(line, frame); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+}
+
+// -----------------------------------------------------------------------------
+
+// EditorServer is the line editor of a client of the editor protocol, a
+// Widget of the size the client says.
+type EditorServer struct {
+	*Widget
+	conn    *rpcConn
+	session string
+	// the mux of the connection, if it's shared
+	mux *EditorMux
+	// signaled by the changes of the screen, see renderLoop
+	changed chan struct{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// NewEditorServer waits for the hello of the client on conn, then returns
+// the editor it drives. The Stdin, the outputs and the functions of the
+// terminal of cfg are replaced, see NewWidget.
+func NewEditorServer(conn io.ReadWriteCloser, cfg *Config) (*EditorServer, error) {
+	rc := newRPCConn(conn)
+	frame, err := rc.read()
+	if err != nil {
+		return nil, err
+	}
+	var hello helloParams
+	if frame.Method != "hello" || json.Unmarshal(frame.Params, &hello) != nil {
+		return nil, fmt.Errorf("unexpected init message")
+	}
+	s, err := newEditorServer(rc, cfg, hello)
+	if err != nil {
+		return nil, err
+	}
+	go s.readLoop()
+	return s, nil
+}
+
+func newEditorServer(rc *rpcConn, cfg *Config, hello helloParams) (*EditorServer, error) {
+	s := &EditorServer{
+		conn:    rc,
+		session: hello.Session,
+		changed: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+	var err error
+	s.Widget, err = NewWidget(cfg, hello.Width, hello.Height, func() {
+		select {
+		case s.changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	go s.renderLoop()
+	return s, nil
+}
+
+func (s *EditorServer) readLoop() {
+	defer s.Close()
+	defer recoverGoroutine(s.Config)
+	for {
+		frame, err := s.conn.read()
+		if err != nil || s.handle(frame) {
+			return
+		}
+	}
+}
+
+// handle applies the frame of the client, it returns true at the end of
+// the keys. The unknown methods are ignored, for the clients of later
+// versions.
+func (s *EditorServer) handle(frame *rpcFrame) (eof bool) {
+	switch frame.Method {
+	case "keys":
+		var keys keysParams
+		if json.Unmarshal(frame.Params, &keys) == nil {
+			s.Feed([]byte(keys.Data))
+		}
+	case "resize":
+		var size helloParams
+		if json.Unmarshal(frame.Params, &size) == nil {
+			s.Resize(size.Width, size.Height)
+		}
+	case "eof":
+		return true
+	}
+	return false
+}
+
+// Session returns the id of the session, empty without EditorMux.
+func (s *EditorServer) Session() string {
+	return s.session
+}
+
+// renderLoop sends the rows which changed since the last frame, the
+// changes made meanwhile go in the same frame.
+func (s *EditorServer) renderLoop() {
+	defer recoverGoroutine(s.Config)
+	var last [][]Cell
+	for {
+		select {
+		case <-s.changed:
+		case <-s.closed:
+			return
+		}
+		cells := s.Screen().Cells()
+		frame := &RenderFrame{Session: s.session, Width: len(cells[0]), Height: len(cells)}
+		frame.CursorRow, frame.CursorCol = s.Screen().Cursor()
+		resized := len(last) != len(cells) || len(last) > 0 && len(last[0]) != len(cells[0])
+		for i, row := range cells {
+			if resized || !cellsEqual(last[i], row) {
+				frame.Rows = append(frame.Rows, RenderRow{Row: i, Runs: renderRuns(row)})
+			}
+		}
+		last = cells
+		if s.conn.send("render", frame) != nil {
+			s.Close()
+			return
+		}
+	}
+}
+
+func cellsEqual(a, b []Cell) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// renderRuns returns the runs of the row, without the trailing blanks.
+func renderRuns(row []Cell) []RenderRun {
+	end := len(row)
+	for end > 0 && row[end-1] == (Cell{Rune: ' '}) {
+		end--
+	}
+	var runs []RenderRun
+	var b strings.Builder
+	style := ""
+	for i, c := range row[:end] {
+		if i > 0 && c.Style != style && b.Len() > 0 {
+			runs = append(runs, RenderRun{b.String(), style})
+			b.Reset()
+		}
+		style = c.Style
+		// the second cell of a wide rune
+		if c.Rune != 0 {
+			b.WriteRune(c.Rune)
+		}
+	}
+	if b.Len() > 0 {
+		runs = append(runs, RenderRun{b.String(), style})
+	}
+	return runs
+}
+
+// Close closes the editor and the connection, or only the session if the
+// connection is shared.
+func (s *EditorServer) Close() error {
+	s.once.Do(func() {
+		close(s.closed)
+		if s.mux != nil {
+			s.mux.remove(s)
+			s.conn.send("close", sessionParams{s.session})
+		} else {
+			s.conn.conn.Close()
+		}
+		s.Widget.Close()
+	})
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+
+// EditorMux hosts the sessions of the editor protocol which share a
+// connection, e.g. the consoles of a daemon shown by a single UI. The
+// frames of each session hold its id: a hello opens the session with the
+// given id, and the close from the server ends it.
+type EditorMux struct {
+	conn      *rpcConn
+	newConfig func(session string) *Config
+
+	m        sync.Mutex
+	sessions map[string]*EditorServer
+	accept   chan *EditorServer
+}
+
+// NewEditorMux serves the sessions of conn. newConfig returns the Config
+// of a session when it's opened, see NewEditorServer.
+func NewEditorMux(conn io.ReadWriteCloser, newConfig func(session string) *Config) *EditorMux {
+	m := &EditorMux{
+		conn:      newRPCConn(conn),
+		newConfig: newConfig,
+		sessions:  make(map[string]*EditorServer),
+		accept:    make(chan *EditorServer),
+	}
+	go m.readLoop()
+	return m
+}
+
+// Accept waits for the next session opened by the client, the frames of
+// the connection wait meanwhile. It returns io.EOF once the connection is
+// closed.
+func (m *EditorMux) Accept() (*EditorServer, error) {
+	s, ok := <-m.accept
+	if !ok {
+		return nil, io.EOF
+	}
+	return s, nil
+}
+
+func (m *EditorMux) readLoop() {
+	defer m.closeAll()
+	for {
+		frame, err := m.conn.read()
+		if err != nil {
+			return
+		}
+		session, ok := frame.session()
+		if !ok {
+			continue
+		}
+		m.m.Lock()
+		s := m.sessions[session]
+		m.m.Unlock()
+		if frame.Method == "hello" && s == nil {
+			var hello helloParams
+			if json.Unmarshal(frame.Params, &hello) != nil {
+				continue
+			}
+			cfg, err := m.config(hello.Session)
+			if err == nil {
+				s, err = newEditorServer(m.conn, cfg, hello)
+			}
+			if err != nil {
+				m.conn.send("close", sessionParams{hello.Session})
+				continue
+			}
+			s.mux = m
+			m.m.Lock()
+			m.sessions[hello.Session] = s
+			m.m.Unlock()
+			m.accept <- s
+			continue
+		}
+		if s != nil && s.handle(frame) {
+			s.Close()
+		}
+	}
+}
+
+// config returns the Config of the session, the panic of newConfig fails
+// the session only.
+func (m *EditorMux) config(session string) (cfg *Config, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &PanicError{Value: p, Stack: debug.Stack()}
+		}
+	}()
+	return m.newConfig(session), nil
+}
+
+func (m *EditorMux) remove(s *EditorServer) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.sessions[s.session] == s {
+		delete(m.sessions, s.session)
+	}
+}
+
+func (m *EditorMux) closeAll() {
+	m.m.Lock()
+	sessions := make([]*EditorServer, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.m.Unlock()
+	for _, s := range sessions {
+		s.Close()
+	}
+	close(m.accept)
+}
+
+// Close closes the sessions and the connection.
+func (m *EditorMux) Close() error {
+	return m.conn.conn.Close()
+}
+
+// -----------------------------------------------------------------------------
+
+// EditorClient drives an EditorServer, and keeps a copy of its screen.
+type EditorClient struct {
+	conn    *rpcConn
+	session string
+
+	m        sync.Mutex
+	rows     []string
+	row, col int
+}
+
+// NewEditorClient sends the hello with the size of the screen of the
+// client to the server.
+func NewEditorClient(conn io.ReadWriteCloser, width, height int) (*EditorClient, error) {
+	c := &EditorClient{conn: newRPCConn(conn)}
+	if err := c.conn.send("hello", helloParams{Width: width, Height: height}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Keys sends the bytes a terminal sends for the keys, see KeyBytes.
+func (c *EditorClient) Keys(b []byte) error {
+	return c.conn.send("keys", keysParams{c.session, string(b)})
+}
+
+// Resize tells the new size of the screen of the client.
+func (c *EditorClient) Resize(width, height int) error {
+	return c.conn.send("resize", helloParams{c.session, width, height})
+}
+
+// Next waits for the next frame of the server and applies it to the copy
+// of the screen. It returns io.EOF once the server is closed. The frames
+// of the sessions of an EditorClientMux are read by its Next instead.
+func (c *EditorClient) Next() (*RenderFrame, error) {
+	for {
+		frame, err := c.conn.read()
+		if err != nil {
+			return nil, err
+		}
+		if frame.Method != "render" {
+			continue
+		}
+		render, err := decodeRender(frame.Params)
+		if err != nil {
+			return nil, err
+		}
+		c.apply(render)
+		return render, nil
+	}
+}
+
+// decodeRender decodes the params of a render frame. Its size is checked
+// like the one of the screen of the server, since the client allocates
+// the rows.
+func decodeRender(params json.RawMessage) (*RenderFrame, error) {
+	render := new(RenderFrame)
+	if err := json.Unmarshal(params, render); err != nil {
+		return nil, err
+	}
+	if render.Width < 0 || render.Width > maxScreenWidth ||
+		render.Height < 0 || render.Height > maxScreenHeight {
+		return nil, fmt.Errorf("render frame of %dx%d out of range", render.Width, render.Height)
+	}
+	return render, nil
+}
+
+func (c *EditorClient) apply(frame *RenderFrame) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if len(c.rows) != frame.Height {
+		rows := make([]string, frame.Height)
+		copy(rows, c.rows)
+		c.rows = rows
+	}
+	for _, row := range frame.Rows {
+		if row.Row >= 0 && row.Row < len(c.rows) {
+			c.rows[row.Row] = row.Text()
+		}
+	}
+	c.row, c.col = frame.CursorRow, frame.CursorCol
+}
+
+// Rows returns the text of the rows of the screen.
+func (c *EditorClient) Rows() []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]string(nil), c.rows...)
+}
+
+// Cursor returns the row and the column of the cursor.
+func (c *EditorClient) Cursor() (row, col int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.row, c.col
+}
+
+// Close tells the server that there are no more keys, which ends the
+// Readline in progress with io.EOF.
+func (c *EditorClient) Close() error {
+	return c.conn.send("eof", sessionParams{c.session})
+}
+
+// Session returns the id of the session of the client.
+func (c *EditorClient) Session() string {
+	return c.session
+}
+
+// EditorClientMux opens several sessions of an EditorMux on a connection.
+type EditorClientMux struct {
+	conn *rpcConn
+
+	m       sync.Mutex
+	clients map[string]*EditorClient
+}
+
+func NewEditorClientMux(conn io.ReadWriteCloser) *EditorClientMux {
+	return &EditorClientMux{
+		conn:    newRPCConn(conn),
+		clients: make(map[string]*EditorClient),
+	}
+}
+
+// Open opens the session of the given id, with the size of its screen.
+func (m *EditorClientMux) Open(session string, width, height int) (*EditorClient, error) {
+	c := &EditorClient{conn: m.conn, session: session}
+	m.m.Lock()
+	m.clients[session] = c
+	m.m.Unlock()
+	if err := m.conn.send("hello", helloParams{session, width, height}); err != nil {
+		m.m.Lock()
+		delete(m.clients, session)
+		m.m.Unlock()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Next waits for the next frame of the server and applies it to the copy
+// of the screen of its session. The frame is nil if the server closed
+// the session. It returns io.EOF once the connection is closed.
+func (m *EditorClientMux) Next() (*EditorClient, *RenderFrame, error) {
+	for {
+		frame, err := m.conn.read()
+		if err != nil {
+			return nil, nil, err
+		}
+		session, ok := frame.session()
+		if !ok {
+			continue
+		}
+		m.m.Lock()
+		c := m.clients[session]
+		if c != nil && frame.Method == "close" {
+			delete(m.clients, session)
+		}
+		m.m.Unlock()
+		switch {
+		case c == nil:
+		case frame.Method == "close":
+			return c, nil, nil
+		case frame.Method == "render":
+			render, err := decodeRender(frame.Params)
+			if err != nil {
+				return nil, nil, err
+			}
+			c.apply(render)
+			return c, render, nil
+		}
+	}
+}
+
+// Close closes the connection, and so all the sessions.
+func (m *EditorClientMux) Close() error {
+	return m.conn.conn.Close()
+}
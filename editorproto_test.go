@@ -0,0 +1,245 @@
+package readline
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditorProtocol(t *testing.T) {
+	srvConn, cliConn := net.Pipe()
+	servers := make(chan *EditorServer, 1)
+	go func() {
+		srv, err := NewEditorServer(srvConn, &Config{Prompt: "> "})
+		if err != nil {
+			t.Error(err)
+		}
+		servers <- srv
+	}()
+	cli, err := NewEditorClient(cliConn, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := <-servers
+	if srv == nil {
+		return
+	}
+	defer srv.Close()
+	go func() {
+		for {
+			if _, err := cli.Next(); err != nil {
+				return
+			}
+		}
+	}()
+
+	expect := func(rows string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			got := strings.Join(cli.Rows(), "\n")
+			if got == rows {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %q, got %q", rows, got)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	type result struct {
+		line string
+		err  error
+	}
+	readline := func() chan result {
+		ret := make(chan result, 1)
+		go func() {
+			line, err := srv.Readline()
+			ret <- result{line, err}
+		}()
+		return ret
+	}
+
+	lines := readline()
+	cli.Keys([]byte("hi"))
+	expect("> hi\n\n")
+	if row, col := cli.Cursor(); row != 0 || col != 4 {
+		t.Fatal("cursor not expect", row, col)
+	}
+	cli.Keys([]byte("\r"))
+	if r := <-lines; r.err != nil || r.line != "hi" {
+		t.Fatal("result not expect", r.line, r.err)
+	}
+
+	lines = readline()
+	cli.Keys([]byte("abcdefghij"))
+	expect("> hi\n> abcdefgh\nij")
+	cli.Resize(14, 2)
+	expect("> abcdefghij\n")
+	cli.Close()
+	if r := <-lines; r.err != io.EOF {
+		t.Fatal("result not expect", r.line, r.err)
+	}
+}
+
+func TestEditorMux(t *testing.T) {
+	srvConn, cliConn := net.Pipe()
+	mux := NewEditorMux(srvConn, func(session string) *Config {
+		if session == "bad" {
+			panic("no config")
+		}
+		return &Config{Prompt: session + "> "}
+	})
+	defer mux.Close()
+	lines := make(chan string, 2)
+	accepted := make(chan error, 1)
+	go func() {
+		for {
+			s, err := mux.Accept()
+			if err != nil {
+				accepted <- err
+				return
+			}
+			go func() {
+				line, _ := s.Readline()
+				lines <- s.Session() + ":" + line
+			}()
+		}
+	}()
+
+	cli := NewEditorClientMux(cliConn)
+	closed := make(chan string, 2)
+	go func() {
+		for {
+			c, frame, err := cli.Next()
+			if err != nil {
+				return
+			}
+			if frame == nil {
+				closed <- c.Session()
+			}
+		}
+	}()
+	a, err := cli.Open("a", 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cli.Open("b", 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Keys([]byte("y"))
+	a.Keys([]byte("x\r"))
+	if line := <-lines; line != "a:x" {
+		t.Fatal("result not expect", line)
+	}
+	firstRow := func(c *EditorClient) string {
+		if rows := c.Rows(); len(rows) > 0 {
+			return rows[0]
+		}
+		return ""
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for firstRow(a) != "a> x" || firstRow(b) != "b> y" {
+		if time.Now().After(deadline) {
+			t.Fatalf("rows not expect: %q %q", a.Rows(), b.Rows())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the end of the keys of a session closes it alone, the line being
+	// edited is dropped
+	b.Close()
+	if line := <-lines; line != "b:" {
+		t.Fatal("result not expect", line)
+	}
+	if session := <-closed; session != "b" {
+		t.Fatal("result not expect", session)
+	}
+	// the panic of newConfig fails its session alone
+	if _, err := cli.Open("bad", 10, 2); err != nil {
+		t.Fatal(err)
+	}
+	if session := <-closed; session != "bad" {
+		t.Fatal("result not expect", session)
+	}
+	a.Keys([]byte("z"))
+
+	mux.Close()
+	if err := <-accepted; err != io.EOF {
+		t.Fatal("result not expect", err)
+	}
+}
+
+func TestRenderRuns(t *testing.T) {
+	row := []Cell{{'>', ""}, {' ', ""}, {'l', "1"}, {'s', "1"}, {'世', ""}, {0, ""}, {' ', ""}}
+	expect := []RenderRun{{"> ", ""}, {"ls", "1"}, {"世", ""}}
+	if got := renderRuns(row); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %v, got %v", expect, got)
+	}
+	if got := renderRuns([]Cell{{' ', ""}}); got != nil {
+		t.Fatalf("expect no runs, got %v", got)
+	}
+}
+
+func TestEditorLimits(t *testing.T) {
+	srvConn, cliConn := net.Pipe()
+	defer cliConn.Close()
+	servers := make(chan *EditorServer, 1)
+	go func() {
+		srv, _ := NewEditorServer(srvConn, &Config{Prompt: "> "})
+		servers <- srv
+	}()
+	go io.Copy(ioutil.Discard, cliConn)
+	io.WriteString(cliConn, `{"jsonrpc":"2.0","method":"hello","params":{"width":100000,"height":100000}}`+"\n")
+	srv := <-servers
+	if srv == nil {
+		t.Fatal("no server")
+	}
+	defer srv.Close()
+	if width, height := srv.Screen().Size(); width != maxScreenWidth || height != maxScreenHeight {
+		t.Fatal("size not expect", width, height)
+	}
+
+	// the connection which sends a frame too long is closed
+	go cliConn.Write(bytes.Repeat([]byte("x"), maxRPCFrameSize+1))
+	select {
+	case <-srv.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed")
+	}
+}
+
+func TestEditorClientMalformedFrame(t *testing.T) {
+	for _, size := range []string{`"width":10,"height":-1`, `"width":10,"height":1000000000`, `"width":-5,"height":3`} {
+		srvConn, cliConn := net.Pipe()
+		cli, errs := &EditorClient{conn: newRPCConn(cliConn)}, make(chan error, 1)
+		go func() {
+			_, err := cli.Next()
+			errs <- err
+		}()
+		io.WriteString(srvConn, `{"jsonrpc":"2.0","method":"render","params":{`+size+`}}`+"\n")
+		if err := <-errs; err == nil || err == io.EOF {
+			t.Fatal(size, "frame not rejected", err)
+		}
+
+		mux, errs := NewEditorClientMux(cliConn), make(chan error, 1)
+		mux.clients["s"] = &EditorClient{conn: mux.conn, session: "s"}
+		go func() {
+			_, _, err := mux.Next()
+			errs <- err
+		}()
+		io.WriteString(srvConn, `{"jsonrpc":"2.0","method":"render","params":{"session":"s",`+size+`}}`+"\n")
+		if err := <-errs; err == nil || err == io.EOF {
+			t.Fatal(size, "frame not rejected", err)
+		}
+		srvConn.Close()
+		cliConn.Close()
+	}
+}
@@ -0,0 +1,35 @@
+package readline
+
+import (
+	"bytes"
+	"io"
+)
+
+// eolWriter writes the line endings of Config.LineEnding in place of \n.
+type eolWriter struct {
+	w   io.Writer
+	eol []byte
+}
+
+func (e *eolWriter) Write(b []byte) (int, error) {
+	if _, err := e.w.Write(bytes.Replace(b, []byte("\n"), e.eol, -1)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// eolFilter turns the \r\n of DOS and the \r\0 of telnet into a single
+// \r, for Config.NormalizeEOL.
+type eolFilter struct {
+	afterCR bool
+}
+
+// skip tells whether r is the second half of a line ending.
+func (f *eolFilter) skip(r rune) bool {
+	if f.afterCR && (r == CharCtrlJ || r == 0) {
+		f.afterCR = false
+		return true
+	}
+	f.afterCR = r == CharEnter
+	return false
+}
@@ -0,0 +1,30 @@
+package readline
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNormalizeEOL(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		NormalizeEOL: true,
+	})
+
+	go w.Write([]byte("a\r\nb\r\x00c\rd\n"))
+	for _, expect := range []string{"a", "b", "c", "d"} {
+		if line, err := rl.Readline(); err != nil || line != expect {
+			t.Fatal("result not expect", line, err)
+		}
+	}
+}
+
+func TestLineEnding(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	w := &eolWriter{buf, []byte("\r\n")}
+	if n, err := w.Write([]byte("a\nb\n")); n != 4 || err != nil {
+		t.Fatal("write failed", n, err)
+	}
+	if buf.String() != "a\r\nb\r\n" {
+		t.Fatalf("unexpected %q", buf.String())
+	}
+}
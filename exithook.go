@@ -0,0 +1,89 @@
+package readline
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// The exit handler closes the open Instances when the process is told to
+// terminate, so that the terminal isn't left in raw mode and the history
+// file is merged, then runs the callbacks of OnExit and exits.
+
+var exitHooks struct {
+	sync.Mutex
+	instances map[*Instance]struct{}
+	callbacks []func(os.Signal)
+}
+
+// exitFunc is os.Exit, but for the tests.
+var exitFunc = os.Exit
+
+func registerInstance(i *Instance) {
+	exitHooks.Lock()
+	defer exitHooks.Unlock()
+	if exitHooks.instances == nil {
+		exitHooks.instances = make(map[*Instance]struct{})
+	}
+	exitHooks.instances[i] = struct{}{}
+}
+
+func unregisterInstance(i *Instance) {
+	exitHooks.Lock()
+	delete(exitHooks.instances, i)
+	exitHooks.Unlock()
+}
+
+// OnExit adds a callback of the exit handler, which is called after the
+// Instances have been closed, in the order they were added.
+func OnExit(f func(os.Signal)) {
+	exitHooks.Lock()
+	exitHooks.callbacks = append(exitHooks.callbacks, f)
+	exitHooks.Unlock()
+}
+
+// HandleExitSignals installs the exit handler for SIGTERM and SIGHUP. The
+// process exits with the status 128+signal, as if it had been killed. It
+// returns a function which uninstalls it.
+func HandleExitSignals() (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		select {
+		case sig := <-ch:
+			handleExit(sig)
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+func handleExit(sig os.Signal) {
+	exitHooks.Lock()
+	instances := make([]*Instance, 0, len(exitHooks.instances))
+	for i := range exitHooks.instances {
+		instances = append(instances, i)
+	}
+	callbacks := append([]func(os.Signal){}, exitHooks.callbacks...)
+	exitHooks.Unlock()
+
+	for _, i := range instances {
+		i.Close()
+	}
+	for _, f := range callbacks {
+		f(sig)
+	}
+	code := 1
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+	exitFunc(code)
+}
@@ -0,0 +1,34 @@
+package readline
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestHandleExit(t *testing.T) {
+	code := -1
+	exitFunc = func(c int) { code = c }
+	defer func() { exitFunc = os.Exit }()
+
+	restored := false
+	rl, _ := newTestInstance(t, &Config{
+		FuncExitRaw: func() error { restored = true; return nil },
+	})
+	var got os.Signal
+	OnExit(func(sig os.Signal) {
+		if !restored {
+			t.Error("the callback runs before the terminal is restored")
+		}
+		got = sig
+	})
+	defer func() { exitHooks.callbacks = nil }()
+
+	handleExit(syscall.SIGTERM)
+	if got != syscall.SIGTERM || code != 128+int(syscall.SIGTERM) {
+		t.Fatal("result not expect", got, code)
+	}
+	if _, err := rl.Readline(); err == nil {
+		t.Fatal("the instance isn't closed")
+	}
+}
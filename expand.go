@@ -0,0 +1,161 @@
+package readline
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+)
+
+// ExpandEnv expands $VAR, ${VAR} and ~user in line the way a shell does:
+// unknown variables expand to an empty string, while unknown users and
+// anything within single quotes or preceded by a backslash are left as is.
+// The variables are looked up in environ ("key=value" pairs, as returned
+// by os.Environ), which defaults to os.Environ if nil.
+func ExpandEnv(line string, environ func() []string) string {
+	env := envMap(environ)
+	rs := []rune(line)
+	ret := make([]rune, 0, len(rs))
+	quoted := false
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '\\' && i+1 < len(rs):
+			ret = append(ret, r, rs[i+1])
+			i++
+			continue
+		case r == '~' && (i == 0 || rs[i-1] == ' ' || rs[i-1] == '='):
+			end := i + 1
+			for end < len(rs) && rs[end] != '/' && rs[end] != ' ' {
+				end++
+			}
+			if home, ok := homeDir(string(rs[i+1:end]), env); ok {
+				ret = append(ret, []rune(home)...)
+				i = end - 1
+				continue
+			}
+		case r == '$':
+			name, size := envName(rs[i+1:])
+			if size > 0 {
+				ret = append(ret, []rune(env[name])...)
+				i += size
+				continue
+			}
+		}
+		ret = append(ret, r)
+	}
+	return string(ret)
+}
+
+// envName parses the variable name following a '$', size is the number
+// of runes it occupies (including the braces), or 0 if it's not a name.
+func envName(rs []rune) (name string, size int) {
+	if len(rs) > 0 && rs[0] == '{' {
+		end := runes.Index('}', rs)
+		if end < 0 {
+			return "", 0
+		}
+		return string(rs[1:end]), end + 1
+	}
+	for size < len(rs) && isEnvNameRune(rs[size]) {
+		size++
+	}
+	return string(rs[:size]), size
+}
+
+func isEnvNameRune(r rune) bool {
+	return r == '_' || !IsWordBreak(r)
+}
+
+func envMap(environ func() []string) map[string]string {
+	if environ == nil {
+		environ = os.Environ
+	}
+	env := make(map[string]string)
+	for _, kv := range environ() {
+		if idx := strings.Index(kv, "="); idx > 0 {
+			env[kv[:idx]] = kv[idx+1:]
+		}
+	}
+	return env
+}
+
+func homeDir(name string, env map[string]string) (string, bool) {
+	if name == "" {
+		home, ok := env["HOME"]
+		return home, ok
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", false
+	}
+	return u.HomeDir, true
+}
+
+// EnvCompleter completes the last word of the line if it's a $VAR,
+// ${VAR} or ~user form.
+type EnvCompleter struct {
+	// Environ returns the variable table, os.Environ is used if it's nil.
+	Environ func() []string
+}
+
+func (e *EnvCompleter) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	word := string(lastWord(line[:pos]))
+	var prefix, suffix string
+	var names []string
+	switch {
+	case strings.HasPrefix(word, "${"):
+		prefix, suffix = word[2:], "}"
+		names = envNames(e.Environ)
+	case strings.HasPrefix(word, "$"):
+		prefix = word[1:]
+		names = envNames(e.Environ)
+	case strings.HasPrefix(word, "~") && !strings.Contains(word, "/"):
+		prefix, suffix = word[1:], "/"
+		names = userNames()
+	default:
+		return nil, 0
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			newLine = append(newLine, []rune(name[len(prefix):]+suffix))
+		}
+	}
+	return newLine, len([]rune(prefix))
+}
+
+func envNames(environ func() []string) []string {
+	env := envMap(environ)
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// userNames lists the local users, it's best effort and only knows about
+// /etc/passwd.
+func userNames() []string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var names []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if idx := strings.Index(line, ":"); idx > 0 {
+			names = append(names, line[:idx])
+		}
+	}
+	return names
+}
@@ -0,0 +1,54 @@
+package readline
+
+import (
+	"testing"
+)
+
+func testEnviron() []string {
+	return []string{"HOME=/home/me", "HOST=box", "PATH=/bin"}
+}
+
+func TestExpandEnv(t *testing.T) {
+	cases := []struct {
+		line   string
+		expect string
+	}{
+		{"echo $HOST", "echo box"},
+		{"echo ${HOST}name", "echo boxname"},
+		{"echo $HOSTNAME", "echo "},
+		{"echo '$HOST' \\$HOST", "echo '$HOST' \\$HOST"},
+		{"cd ~/src a~b", "cd /home/me/src a~b"},
+		{"cost $ 5", "cost $ 5"},
+		{"x=~", "x=/home/me"},
+	}
+	for _, c := range cases {
+		if got := ExpandEnv(c.line, testEnviron); got != c.expect {
+			t.Fatalf("%q: expect %q, got %q", c.line, c.expect, got)
+		}
+	}
+}
+
+func TestEnvCompleter(t *testing.T) {
+	e := &EnvCompleter{Environ: testEnviron}
+	cases := []struct {
+		line   string
+		expect []string
+		offset int
+	}{
+		{"echo $HO", []string{"ME", "ST"}, 2},
+		{"echo ${PA", []string{"TH}"}, 2},
+		{"echo HO", nil, 0},
+	}
+	for _, c := range cases {
+		newLine, offset := e.Do([]rune(c.line), len(c.line))
+		got := rs(newLine)
+		if len(got) != len(c.expect) || offset != c.offset {
+			t.Fatalf("%q: expect %q %v, got %q %v", c.line, c.expect, c.offset, got, offset)
+		}
+		for i := range got {
+			if got[i] != c.expect[i] {
+				t.Fatalf("%q: expect %q, got %q", c.line, c.expect, got)
+			}
+		}
+	}
+}
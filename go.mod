@@ -4,7 +4,8 @@ go 1.15
 
 require (
 	github.com/chzyer/test v1.0.0
-	golang.org/x/sys v0.0.0-20220310020820-b874c991c1a5
+	golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f
+	golang.org/x/text v0.3.8
 )
 
 require github.com/chzyer/logex v1.2.1
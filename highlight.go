@@ -0,0 +1,37 @@
+package readline
+
+// StyleSpan styles a range of the line, see Config.FuncHighlight. It's a
+// Diagnostic whose Style is required.
+type StyleSpan = Diagnostic
+
+// layerSpans lays the spans of the Diagnostics over the highlights of a
+// line of n runes, into the spans for applySpans.
+func layerSpans(highlights []StyleSpan, diags []matchSpan, n int) []matchSpan {
+	styles := make([]string, n)
+	for _, h := range highlights {
+		if h.Start < 0 {
+			h.Start = 0
+		}
+		for i := h.Start; i < h.End && i < n; i++ {
+			styles[i] = h.Style
+		}
+	}
+	for _, d := range diags {
+		for i := d.start; i < d.end; i++ {
+			styles[i] = d.style
+		}
+	}
+
+	var spans []matchSpan
+	for i := 0; i < n; {
+		j := i + 1
+		for j < n && styles[j] == styles[i] {
+			j++
+		}
+		if styles[i] != "" {
+			spans = append(spans, matchSpan{i, j, styles[i]})
+		}
+		i = j
+	}
+	return spans
+}
@@ -0,0 +1,181 @@
+package readline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// browserEntry is a distinct line of the history, with the time it was
+// last saved (zero if it was loaded from the HistoryFile) and how many
+// times it's been saved.
+type browserEntry struct {
+	line  []rune
+	last  time.Time
+	count int
+}
+
+// opBrowser is the full screen history browser of MetaBrowseHistory, it's
+// drawn on the alternate screen so that the scrollback is left as is.
+type opBrowser struct {
+	w  io.Writer
+	op *Operation
+
+	inBrowser bool
+	entries   []browserEntry
+	matches   []int // the indexes of the entries matching the filter
+	filter    []rune
+	selected  int
+	offset    int
+}
+
+func newOpBrowser(w io.Writer, op *Operation) *opBrowser {
+	return &opBrowser{w: w, op: op}
+}
+
+func (o *opBrowser) IsHistoryBrowserMode() bool {
+	return o.inBrowser
+}
+
+// HistoryBrowserMode opens the browser, it returns false if the history
+// is empty.
+func (o *opBrowser) HistoryBrowserMode() bool {
+	o.entries = o.browserEntries()
+	if len(o.entries) == 0 {
+		return false
+	}
+	o.inBrowser = true
+	o.filter = nil
+	o.filterEntries()
+	io.WriteString(o.w, "\033[?1049h")
+	o.HistoryBrowserRefresh()
+	return true
+}
+
+// browserEntries collects the distinct lines of the history, the latest
+// first.
+func (o *opBrowser) browserEntries() []browserEntry {
+	var entries []browserEntry
+	seen := make(map[string]int)
+	h := o.op.history.history
+	if h.Back() == nil {
+		return nil
+	}
+	// the last item is the line being edited
+	for elem := h.Back().Prev(); elem != nil; elem = elem.Prev() {
+		item := elem.Value.(*hisItem)
+		if idx, ok := seen[string(item.Source)]; ok {
+			entries[idx].count++
+			continue
+		}
+		seen[string(item.Source)] = len(entries)
+		entries = append(entries, browserEntry{
+			line:  item.Source,
+			last:  item.Time,
+			count: 1,
+		})
+	}
+	return entries
+}
+
+func (o *opBrowser) filterEntries() {
+	o.matches = o.matches[:0]
+	for i, e := range o.entries {
+		if len(o.filter) == 0 || indexNorm(e.line, o.filter, o.op.cfg.searchNormalizer()) >= 0 {
+			o.matches = append(o.matches, i)
+		}
+	}
+	o.selected, o.offset = 0, 0
+}
+
+// HandleHistoryBrowser handles the key in the browser, Enter loads the
+// selected line into the buffer.
+func (o *opBrowser) HandleHistoryBrowser(r rune) {
+	switch r {
+	case CharEnter, CharCtrlJ:
+		o.op.t.KickRead()
+		var line []rune
+		if len(o.matches) > 0 {
+			line = runes.Copy(o.entries[o.matches[o.selected]].line)
+		}
+		o.ExitHistoryBrowser()
+		if line != nil {
+			o.op.buf.Set(line)
+		}
+		return
+	case CharInterrupt:
+		o.op.t.KickRead()
+		fallthrough
+	case CharBell, CharEsc:
+		o.ExitHistoryBrowser()
+		return
+	case CharPrev:
+		if o.selected > 0 {
+			o.selected--
+		}
+	case CharNext:
+		if o.selected < len(o.matches)-1 {
+			o.selected++
+		}
+	case CharBackspace, CharCtrlH:
+		if len(o.filter) == 0 {
+			o.op.t.Bell()
+			break
+		}
+		o.filter = o.filter[:len(o.filter)-1]
+		o.filterEntries()
+	default:
+		if !IsPrintable(r) {
+			o.op.t.Bell()
+			break
+		}
+		o.filter = append(o.filter, r)
+		o.filterEntries()
+	}
+	o.HistoryBrowserRefresh()
+}
+
+func (o *opBrowser) ExitHistoryBrowser() {
+	o.inBrowser = false
+	o.entries, o.matches, o.filter = nil, nil, nil
+	io.WriteString(o.w, "\033[?1049l")
+	o.op.buf.Refresh(nil)
+}
+
+func (o *opBrowser) HistoryBrowserRefresh() {
+	width := o.op.buf.width
+	rows := o.op.cfg.FuncGetHeight() - 1
+	if rows <= 0 {
+		rows = 23
+	}
+	if o.selected < o.offset {
+		o.offset = o.selected
+	} else if o.selected >= o.offset+rows {
+		o.offset = o.selected - rows + 1
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("\033[H\033[J")
+	fmt.Fprintf(buf, "history (%d/%d): %s\033[4m \033[0m", len(o.matches), len(o.entries), string(o.filter))
+	for i := o.offset; i < len(o.matches) && i < o.offset+rows; i++ {
+		e := o.entries[o.matches[i]]
+		date := "                "
+		if !e.last.IsZero() {
+			date = e.last.Format("2006-01-02 15:04")
+		}
+		line := []rune(fmt.Sprintf("%s %4d  %s", date, e.count, string(e.line)))
+		if runes.WidthAll(line) > width {
+			line = truncateColored(line, width)
+		}
+		buf.WriteString("\r\n")
+		if i == o.selected {
+			buf.WriteString("\033[7m")
+		}
+		buf.WriteString(string(line))
+		if i == o.selected {
+			buf.WriteString("\033[0m")
+		}
+	}
+	o.w.Write(buf.Bytes())
+}
@@ -0,0 +1,33 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistoryBrowser(t *testing.T) {
+	out := &syncBuffer{}
+	rl, w := newTestInstance(t, &Config{
+		Stdout:  out,
+		Keymaps: map[string]Keymap{KeymapEmacs: {'\x0f': MetaBrowseHistory}},
+	})
+	rl.SaveHistory("git status")
+	rl.SaveHistory("ls")
+	rl.SaveHistory("git log")
+	rl.SaveHistory("ls")
+
+	go w.Write([]byte("\x0fgit\x0e\r\r"))
+	if line, err := rl.Readline(); err != nil || line != "git status" {
+		t.Fatal("result not expect", line, err)
+	}
+	if !strings.Contains(out.String(), "\033[?1049h") ||
+		!strings.Contains(out.String(), "history (2/3): git") {
+		t.Fatal("browser not shown", out.String())
+	}
+
+	// cancelling leaves the line as is
+	go w.Write([]byte("x\x0f\x07\r"))
+	if line, err := rl.Readline(); err != nil || line != "x" {
+		t.Fatal("result not expect", line, err)
+	}
+}
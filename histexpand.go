@@ -0,0 +1,131 @@
+package readline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExpandHistory expands the history events of csh in line: !! is the
+// previous line, !N the Nth line of the history, from 1, !-N the Nth
+// previous one, !prefix the latest line starting with prefix and !$ the
+// last word of the previous line. A ! followed by a space, '=', a quote, a
+// shell operator or the end of the line, within single quotes or preceded
+// by a backslash is left as is. history holds the lines the oldest first, as GetHistory returns
+// them.
+func ExpandHistory(line string, history []string) (string, error) {
+	rs := []rune(line)
+	ret := make([]rune, 0, len(rs))
+	quoted := false
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case quoted:
+		case r == '\\' && i+1 < len(rs):
+			ret = append(ret, r, rs[i+1])
+			i++
+			continue
+		case r == '!' && i+1 < len(rs) && !isEventEnd(rs[i+1]):
+			event := historyEvent(rs[i+1:])
+			if len(event) == 0 {
+				// e.g. echo "hi!", like bash
+				break
+			}
+			found, ok := lookupEvent(string(event), history)
+			if !ok {
+				return line, fmt.Errorf("!%s: event not found", string(event))
+			}
+			ret = append(ret, []rune(found)...)
+			i += len(event)
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return string(ret), nil
+}
+
+func isEventEnd(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '=' || r == '('
+}
+
+// historyEvent returns the event following a '!'.
+func historyEvent(rs []rune) []rune {
+	if rs[0] == '!' || rs[0] == '$' {
+		return rs[:1]
+	}
+	end := 0
+	if rs[0] == '-' || rs[0] >= '0' && rs[0] <= '9' {
+		end = 1
+		for end < len(rs) && rs[end] >= '0' && rs[end] <= '9' {
+			end++
+		}
+		return rs[:end]
+	}
+	for end < len(rs) && !strings.ContainsRune(" \t\n;&|<>()'\"", rs[end]) {
+		end++
+	}
+	return rs[:end]
+}
+
+// lookupEvent returns the line or the word of the history the event
+// refers to.
+func lookupEvent(event string, history []string) (string, bool) {
+	if len(history) == 0 {
+		return "", false
+	}
+	last := history[len(history)-1]
+	switch event {
+	case "!":
+		return last, true
+	case "$":
+		args := splitArgs([]rune(last))
+		if len(args) == 0 {
+			return "", false
+		}
+		return string(args[len(args)-1]), true
+	}
+	if n, err := strconv.Atoi(event); err == nil {
+		if n < 0 {
+			n += len(history) + 1
+		}
+		if n < 1 || n > len(history) {
+			return "", false
+		}
+		return history[n-1], true
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if event != "" && strings.HasPrefix(history[i], event) {
+			return history[i], true
+		}
+	}
+	return "", false
+}
+
+// expandHistory expands the line being accepted, see Config.HistoryExpand.
+// It returns false to edit the line again: with a bell if an event isn't
+// found, or with the expanded line if FuncHistoryExpanded declines it.
+func (o *Operation) expandHistory() bool {
+	line := string(o.buf.Runes())
+	if !strings.ContainsRune(line, '!') {
+		return true
+	}
+	var history []string
+	for _, e := range o.history.Entries() {
+		history = append(history, e.Line)
+	}
+	expanded, err := ExpandHistory(line, history)
+	if err != nil {
+		o.t.Bell()
+		return false
+	}
+	if expanded == line {
+		return true
+	}
+	o.buf.Set([]rune(expanded))
+	if f := o.GetConfig().FuncHistoryExpanded; f != nil && !f(expanded) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestExpandHistory(t *testing.T) {
+	history := []string{"ssh box", "ls -l /tmp", "echo 'a b'"}
+	cases := []struct {
+		line   string
+		expect string
+		err    bool
+	}{
+		{"!!", "echo 'a b'", false},
+		{"sudo !!", "sudo echo 'a b'", false},
+		{"!1", "ssh box", false},
+		{"!-2 | less", "ls -l /tmp | less", false},
+		{"!ss", "ssh box", false},
+		{"cat !$", "cat 'a b'", false},
+		{"echo hi! '!!' \\!! a != b", "echo hi! '!!' \\!! a != b", false},
+		{`echo "hi!"`, `echo "hi!"`, false},
+		{"a!;b a!|b a!&b (a!) a!<b a!>b", "a!;b a!|b a!&b (a!) a!<b a!>b", false},
+		{"!4", "", true},
+		{"!nothing", "", true},
+	}
+	for _, c := range cases {
+		got, err := ExpandHistory(c.line, history)
+		if c.err {
+			if err == nil {
+				t.Fatalf("%q: expect an error, got %q", c.line, got)
+			}
+		} else if err != nil || got != c.expect {
+			t.Fatalf("%q: expect %q, got %q %v", c.line, c.expect, got, err)
+		}
+	}
+}
+
+func TestHistoryExpand(t *testing.T) {
+	var verified []string
+	rl, w := newTestInstance(t, &Config{
+		HistoryExpand: true,
+		FuncHistoryExpanded: func(line string) bool {
+			verified = append(verified, line)
+			return false
+		},
+	})
+	rl.SaveHistory("make test")
+
+	// the missing event is left to edit, the expansion is declined
+	go w.Write([]byte("!x\r\x15!!\r -v\r"))
+	if line, err := rl.Readline(); err != nil || line != "make test -v" {
+		t.Fatal("result not expect", line, err)
+	}
+	if len(verified) != 1 || verified[0] != "make test" {
+		t.Fatal("result not expect", verified)
+	}
+	if h := rl.GetHistory(); h[len(h)-1].Line != "make test -v" {
+		t.Fatal("result not expect", h)
+	}
+
+	// a ! before a quote isn't an event
+	go w.Write([]byte("echo \"hi!\"\r"))
+	if line, err := rl.Readline(); err != nil || line != `echo "hi!"` {
+		t.Fatal("result not expect", line, err)
+	}
+}
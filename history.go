@@ -4,15 +4,35 @@ import (
 	"bufio"
 	"container/list"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+// HistoryEntry is a line saved in the history, see Instance.GetHistory.
+type HistoryEntry struct {
+	Line string
+	// when it was saved, it's zero for the lines read from a HistoryFile
+	// without the times, see Config.HistoryTimestamps
+	Time time.Time
+	// given by Config.FuncHistoryTag
+	Tag    string
+	Pinned bool
+}
+
 type hisItem struct {
 	Source  []rune
 	Version int64
 	Tmp     []rune
+	// pinned items are never dropped by HistoryLimit
+	Pinned bool
+	// when it was saved and its tag, they're only read from the
+	// HistoryFile with Config.HistoryTimestamps
+	Time time.Time
+	Tag  string
 }
 
 func (h *hisItem) Clean() {
@@ -28,6 +48,15 @@ type opHistory struct {
 	fd         *os.File
 	fdLock     sync.Mutex
 	enable     bool
+	// the lines which failed to be appended to the HistoryFile, and
+	// whether some were saved, which merges the file on Close
+	unsaved []string
+	saved   bool
+	// the pins changed in this session, they're saved on Close
+	pins map[string]bool
+	// the size of the HistoryFile when it was last read or written, the
+	// lines past it were saved by the other sessions, see Sync
+	offset int64
 }
 
 func newOpHistory(cfg *Config) (o *opHistory) {
@@ -71,8 +100,12 @@ func (o *opHistory) historyUpdatePath(path string) {
 		return
 	}
 	o.fd = f
+	if lockFile(f) == nil {
+		defer unlockFile(f)
+	}
 	r := bufio.NewReader(o.fd)
 	total := 0
+	var stamp *hisItem
 	for ; ; total++ {
 		line, err := r.ReadString('\n')
 		if err != nil {
@@ -83,20 +116,126 @@ func (o *opHistory) historyUpdatePath(path string) {
 		if len(line) == 0 {
 			continue
 		}
+		if item, ok := o.parseStamp(line); ok {
+			stamp = item
+			total--
+			continue
+		}
 		o.Push([]rune(line))
+		if stamp != nil {
+			item := o.current.Value.(*hisItem)
+			item.Time, item.Tag, item.Pinned = stamp.Time, stamp.Tag, stamp.Pinned
+			stamp = nil
+		}
+		if o.cfg.HistoryEraseDups {
+			o.eraseDups(o.current)
+		}
 		o.Compact()
 	}
 	if total > o.cfg.HistoryLimit {
-		o.rewriteLocked()
+		if o.cfg.HistoryShared {
+			// the other sessions go on appending to the file they opened
+			o.mergeLocked()
+		} else {
+			o.rewriteLocked()
+		}
 	}
+	o.offset = fileSize(o.fd)
 	o.historyVer++
 	o.Push(nil)
 	return
 }
 
+func fileSize(f *os.File) int64 {
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Sync reads the lines the other sessions saved in the HistoryFile since
+// it was last read, with Config.HistoryShared.
+func (o *opHistory) Sync() {
+	o.fdLock.Lock()
+	defer o.fdLock.Unlock()
+	if o.fd == nil || !o.cfg.HistoryShared {
+		return
+	}
+	if lockFile(o.fd) == nil {
+		defer unlockFile(o.fd)
+	}
+	o.syncLocked()
+}
+
+// syncLocked adds the lines past offset before the one being edited. If
+// the file shrank, another session trimmed it and they can't be told
+// apart: they're skipped.
+func (o *opHistory) syncLocked() {
+	size := fileSize(o.fd)
+	if size <= o.offset {
+		o.offset = size
+		return
+	}
+	fd, err := os.Open(o.cfg.HistoryFile)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	if _, err := fd.Seek(o.offset, io.SeekStart); err != nil {
+		return
+	}
+	r := bufio.NewReader(io.LimitReader(fd, size-o.offset))
+	var stamp *hisItem
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			// the rest is being written
+			break
+		}
+		o.offset += int64(len(line))
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if item, ok := o.parseStamp(line); ok {
+			stamp = item
+			continue
+		}
+		item := &hisItem{Source: []rune(line)}
+		if stamp != nil {
+			item.Time, item.Tag, item.Pinned = stamp.Time, stamp.Tag, stamp.Pinned
+			stamp = nil
+		}
+		o.insert(item)
+	}
+	o.historyVer++
+}
+
+// insert adds the item saved by another session before the one being
+// edited, unless it's the same as the item before.
+func (o *opHistory) insert(item *hisItem) {
+	back := o.history.Back()
+	if back == nil {
+		o.history.PushBack(item)
+		return
+	}
+	if prev := back.Prev(); prev != nil && runes.Equal(prev.Value.(*hisItem).Source, item.Source) {
+		return
+	}
+	elem := o.history.InsertBefore(item, back)
+	if o.cfg.HistoryEraseDups {
+		o.eraseDups(elem)
+	}
+	o.Compact()
+}
+
 func (o *opHistory) Compact() {
-	for o.history.Len() > o.cfg.HistoryLimit && o.history.Len() > 0 {
-		o.history.Remove(o.history.Front())
+	for elem := o.history.Front(); elem != nil && o.history.Len() > o.cfg.HistoryLimit; {
+		next := elem.Next()
+		if !elem.Value.(*hisItem).Pinned && elem != o.current {
+			o.history.Remove(elem)
+		}
+		elem = next
 	}
 }
 
@@ -119,7 +258,7 @@ func (o *opHistory) rewriteLocked() {
 
 	buf := bufio.NewWriter(fd)
 	for elem := o.history.Front(); elem != nil; elem = elem.Next() {
-		buf.WriteString(string(elem.Value.(*hisItem).Source) + "\n")
+		buf.WriteString(o.record(elem.Value.(*hisItem)) + "\n")
 	}
 	buf.Flush()
 
@@ -136,16 +275,277 @@ func (o *opHistory) rewriteLocked() {
 	o.fd = fd
 }
 
+// Close merges the HistoryFile before closing it if lines were saved, see
+// mergeLocked.
 func (o *opHistory) Close() {
 	o.fdLock.Lock()
 	defer o.fdLock.Unlock()
-	if o.fd != nil {
+	if o.fd != nil && o.fd.Fd() != ^(uintptr(0)) {
+		if o.saved {
+			locked := lockFile(o.fd) == nil
+			o.mergeLocked()
+			if locked {
+				unlockFile(o.fd)
+			}
+		}
 		o.fd.Close()
 	}
 }
 
-func (o *opHistory) FindBck(isNewSearch bool, rs []rune, start int) (int, *list.Element) {
-	for elem := o.current; elem != nil; elem = elem.Prev() {
+// mergeLocked adds the lines of this session which failed to be appended
+// to the HistoryFile and its pins, and trims it to HistoryLimit, keeping
+// the pinned lines. The lines the other
+// processes appended meanwhile are kept in place: the file is in the
+// order the lines were saved by all of them, rather than overwritten by
+// the history of this one.
+func (o *opHistory) mergeLocked() {
+	if o.cfg.HistoryFile == "" || o.cfg.HistoryLimit <= 0 {
+		return
+	}
+	lines, err := readHistoryFile(o.cfg.HistoryFile, o.cfg.HistoryTimestamps)
+	if err != nil {
+		return
+	}
+	lines = append(lines, o.unsaved...)
+	erased := false
+	if o.cfg.HistoryEraseDups {
+		lines, erased = eraseDupLines(lines)
+	}
+	if len(o.unsaved) == 0 && len(o.pins) == 0 && !erased && len(lines) <= o.cfg.HistoryLimit {
+		return
+	}
+	lines = trimLines(pinLines(lines, o.pins), o.cfg.HistoryLimit)
+	// with HistoryShared in place, so that the other sessions go on
+	// appending to the file they opened
+	if writeHistoryFile(o.cfg.HistoryFile, lines, o.cfg.HistoryShared) == nil {
+		o.unsaved, o.pins = nil, nil
+	}
+}
+
+// pinLines pins or unpins the latest line of each of the pins.
+func pinLines(lines []string, pins map[string]bool) []string {
+	done := make(map[string]bool, len(pins))
+	for i := len(lines) - 1; i >= 0 && len(done) < len(pins); i-- {
+		_, text := splitStamp(lines[i])
+		if pinned, ok := pins[text]; ok && !done[text] {
+			done[text] = true
+			lines[i] = pinLine(lines[i], pinned)
+		}
+	}
+	return lines
+}
+
+// trimLines drops the oldest lines which aren't pinned until there are
+// at most limit.
+func trimLines(lines []string, limit int) []string {
+	drop := len(lines) - limit
+	if drop <= 0 {
+		return lines
+	}
+	kept := lines[:0]
+	for _, line := range lines {
+		if stamp, _ := splitStamp(line); drop > 0 && !stampPinned(stamp) {
+			drop--
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// writeHistoryFile replaces the content of the file with the lines, by
+// renaming a temporary file unless inPlace.
+func writeHistoryFile(path string, lines []string, inPlace bool) error {
+	name, flag := path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC
+	if inPlace {
+		name, flag = path, os.O_WRONLY
+	}
+	fd, err := os.OpenFile(name, flag, 0666)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(fd)
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+	if err = buf.Flush(); err == nil && inPlace {
+		var off int64
+		if off, err = fd.Seek(0, io.SeekCurrent); err == nil {
+			err = fd.Truncate(off)
+		}
+	}
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || inPlace {
+		return err
+	}
+	return os.Rename(name, path)
+}
+
+// eraseDupLines removes the lines of the HistoryFile equal to a later
+// one, after their stamps, see Config.HistoryEraseDups. The later one is
+// pinned if one of them was. It tells whether there were some.
+func eraseDupLines(lines []string) ([]string, bool) {
+	seen := make(map[string]int, len(lines))
+	kept := make([]string, len(lines))
+	n := len(lines)
+	for i := len(lines) - 1; i >= 0; i-- {
+		stamp, line := splitStamp(lines[i])
+		if at, ok := seen[line]; ok {
+			if stampPinned(stamp) {
+				kept[at] = pinLine(kept[at], true)
+			}
+			continue
+		}
+		n--
+		seen[line] = n
+		kept[n] = lines[i]
+	}
+	return kept[n:], n > 0
+}
+
+// readHistoryFile returns the non-empty lines of the file. With stamps,
+// the line of the time of each line is kept together with it.
+func readHistoryFile(path string, stamps bool) ([]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	var lines []string
+	var stamp string
+	r := bufio.NewReader(fd)
+	for {
+		line, err := r.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			if stamps && isStamp(line) || isStamp(line) && stampPinned(line) {
+				stamp = line + "\n"
+			} else {
+				lines = append(lines, stamp+line)
+				stamp = ""
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return lines, nil
+}
+
+// isStamp tells whether the line of the HistoryFile is the time of the
+// next one: # and the Unix time, like bash writes it, then ! if the next
+// one is pinned and the tag.
+func isStamp(line string) bool {
+	return len(line) > 1 && line[0] == '#' && line[1] >= '0' && line[1] <= '9'
+}
+
+// stampFields splits the stamp into the Unix time, whether it's pinned
+// and the tag.
+func stampFields(stamp string) (sec string, pinned bool, tag string) {
+	sec = stamp[1:]
+	if i := strings.IndexByte(sec, ' '); i >= 0 {
+		sec, tag = sec[:i], sec[i+1:]
+	}
+	if strings.HasSuffix(sec, "!") {
+		sec, pinned = sec[:len(sec)-1], true
+	}
+	return sec, pinned, tag
+}
+
+// stampPinned tells whether the stamp pins the next line. Pinned lines
+// have a stamp without Config.HistoryTimestamps too, with the time 0.
+func stampPinned(stamp string) bool {
+	if !isStamp(stamp) {
+		return false
+	}
+	_, pinned, _ := stampFields(stamp)
+	return pinned
+}
+
+// splitStamp splits the line of the HistoryFile read by readHistoryFile
+// into its stamp, if it has one, and its text.
+func splitStamp(line string) (stamp, text string) {
+	if i := strings.LastIndexByte(line, '\n'); i >= 0 {
+		return line[:i], line[i+1:]
+	}
+	return "", line
+}
+
+// pinLine returns the line of the HistoryFile with its stamp pinned or
+// not, it drops the stamp which was just for the pin.
+func pinLine(line string, pinned bool) string {
+	stamp, text := splitStamp(line)
+	sec, tag := "0", ""
+	if stamp != "" {
+		sec, _, tag = stampFields(stamp)
+	}
+	if !pinned && sec == "0" && tag == "" {
+		return text
+	}
+	return formatStamp(sec, pinned, tag) + "\n" + text
+}
+
+func formatStamp(sec string, pinned bool, tag string) string {
+	stamp := "#" + sec
+	if pinned {
+		stamp += "!"
+	}
+	if tag != "" {
+		stamp += " " + tag
+	}
+	return stamp
+}
+
+// parseStamp returns the time, the tag and the pin of the line if it's a
+// stamp, see Config.HistoryTimestamps. Without them only the pins are
+// read.
+func (o *opHistory) parseStamp(line string) (*hisItem, bool) {
+	if !isStamp(line) {
+		return nil, false
+	}
+	stamp, pinned, tag := stampFields(line)
+	if !o.cfg.HistoryTimestamps && !pinned {
+		return nil, false
+	}
+	sec, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	item := &hisItem{Pinned: pinned}
+	if o.cfg.HistoryTimestamps {
+		item.Tag = tag
+		if sec != 0 {
+			item.Time = time.Unix(sec, 0)
+		}
+	}
+	return item, true
+}
+
+// record returns the item as it's written to the HistoryFile, after the
+// line of its time with Config.HistoryTimestamps, or of its pin.
+func (o *opHistory) record(item *hisItem) string {
+	timed := o.cfg.HistoryTimestamps && !item.Time.IsZero()
+	if !timed && !item.Pinned {
+		return string(item.Source)
+	}
+	sec, tag := "0", ""
+	if timed {
+		sec = strconv.FormatInt(item.Time.Unix(), 10)
+		tag = strings.Map(func(r rune) rune {
+			if r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, item.Tag)
+	}
+	return formatStamp(sec, item.Pinned, tag) + "\n" + string(item.Source)
+}
+
+// FindBck finds rs backward from start in the current item, then in the
+// items after it as given by next.
+func (o *opHistory) FindBck(isNewSearch bool, rs []rune, start int, next func(*list.Element) *list.Element) (int, *list.Element) {
+	for elem := o.current; elem != nil; elem = next(elem) {
 		item := o.showItem(elem.Value)
 		if isNewSearch {
 			start += len(rs)
@@ -155,7 +555,7 @@ func (o *opHistory) FindBck(isNewSearch bool, rs []rune, start int) (int, *list.
 				item = item[:start]
 			}
 		}
-		idx := runes.IndexAllBckEx(item, rs, o.cfg.HistorySearchFold)
+		idx := indexBckNorm(item, rs, o.cfg.searchNormalizer())
 		if idx < 0 {
 			continue
 		}
@@ -164,8 +564,10 @@ func (o *opHistory) FindBck(isNewSearch bool, rs []rune, start int) (int, *list.
 	return -1, nil
 }
 
-func (o *opHistory) FindFwd(isNewSearch bool, rs []rune, start int) (int, *list.Element) {
-	for elem := o.current; elem != nil; elem = elem.Next() {
+// FindFwd finds rs forward from start in the current item, then in the
+// items after it as given by next.
+func (o *opHistory) FindFwd(isNewSearch bool, rs []rune, start int, next func(*list.Element) *list.Element) (int, *list.Element) {
+	for elem := o.current; elem != nil; elem = next(elem) {
 		item := o.showItem(elem.Value)
 		if isNewSearch {
 			start -= len(rs)
@@ -180,7 +582,7 @@ func (o *opHistory) FindFwd(isNewSearch bool, rs []rune, start int) (int, *list.
 				continue
 			}
 		}
-		idx := runes.IndexAllEx(item, rs, o.cfg.HistorySearchFold)
+		idx := indexNorm(item, rs, o.cfg.searchNormalizer())
 		if idx < 0 {
 			continue
 		}
@@ -204,6 +606,9 @@ func (o *opHistory) Prev() []rune {
 	if o.current == nil {
 		return nil
 	}
+	if o.current == o.history.Back() {
+		o.Sync()
+	}
 	current := o.current.Prev()
 	if current == nil {
 		return nil
@@ -225,6 +630,126 @@ func (o *opHistory) Next() ([]rune, bool) {
 	return runes.Copy(o.showItem(current.Value)), true
 }
 
+// FindPrefix moves to the item before the current one, or after it if
+// !back, which starts with prefix and isn't line, for
+// MetaHistorySearchBackward.
+func (o *opHistory) FindPrefix(prefix, line []rune, back bool) ([]rune, bool) {
+	if o.current == nil {
+		return nil, false
+	}
+	if back && o.current == o.history.Back() {
+		o.Sync()
+	}
+	for elem := o.current; ; {
+		if back {
+			elem = elem.Prev()
+		} else {
+			elem = elem.Next()
+		}
+		if elem == nil {
+			return nil, false
+		}
+		item := o.showItem(elem.Value)
+		if runes.HasPrefix(item, prefix) && !runes.Equal(item, line) {
+			o.current = elem
+			return runes.Copy(item), true
+		}
+	}
+}
+
+// Wrap moves to the newest item, which is being edited, or to the oldest
+// one, for Config.HistoryWrap.
+func (o *opHistory) Wrap(newest bool) ([]rune, bool) {
+	if o.current == nil || o.history.Len() < 2 {
+		return nil, false
+	}
+	if newest {
+		o.current = o.history.Back()
+	} else {
+		o.current = o.history.Front()
+	}
+	return runes.Copy(o.showItem(o.current.Value)), true
+}
+
+// Pin marks the latest item saved as s, it returns false if there isn't.
+func (o *opHistory) Pin(s []rune, pinned bool) bool {
+	for elem := o.history.Back(); elem != nil; elem = elem.Prev() {
+		item := elem.Value.(*hisItem)
+		if elem != o.history.Back() && runes.Equal(item.Source, s) {
+			item.Pinned = pinned
+			o.notePin(item)
+			return true
+		}
+	}
+	return false
+}
+
+// TogglePin pins or unpins the current item, it returns false if the
+// current one is the line being edited.
+func (o *opHistory) TogglePin() bool {
+	if o.current == nil || o.current == o.history.Back() {
+		return false
+	}
+	item := o.current.Value.(*hisItem)
+	item.Pinned = !item.Pinned
+	o.notePin(item)
+	return true
+}
+
+// notePin records the pin of the item, it's saved in the HistoryFile on
+// Close, see mergeLocked.
+func (o *opHistory) notePin(item *hisItem) {
+	o.fdLock.Lock()
+	defer o.fdLock.Unlock()
+	if o.fd == nil {
+		return
+	}
+	if o.pins == nil {
+		o.pins = make(map[string]bool)
+	}
+	o.pins[string(item.Source)] = item.Pinned
+	o.saved = true
+}
+
+// Recent returns the n-th saved item before the last one, which is being
+// edited, nil if there isn't.
+func (o *opHistory) Recent(n int) []rune {
+	elem := o.history.Back()
+	for ; n > 0 && elem != nil; n-- {
+		elem = elem.Prev()
+	}
+	if elem == nil {
+		return nil
+	}
+	return runes.Copy(elem.Value.(*hisItem).Source)
+}
+
+// Source returns the current item as it's saved, without the edits made
+// to it since the prompt started.
+func (o *opHistory) Source() []rune {
+	if o.current == nil {
+		return nil
+	}
+	return runes.Copy(o.current.Value.(*hisItem).Source)
+}
+
+// Entries returns the saved items, the oldest first.
+func (o *opHistory) Entries() []HistoryEntry {
+	var entries []HistoryEntry
+	// the last item is the line being edited
+	last := o.history.Back()
+	for elem := o.history.Front(); elem != nil && elem != last; elem = elem.Next() {
+		item := elem.Value.(*hisItem)
+		entries = append(entries, HistoryEntry{
+			Line:   string(item.Source),
+			Time:   item.Time,
+			Tag:    item.Tag,
+			Pinned: item.Pinned,
+		})
+	}
+	return entries
+}
+
 // Disable the current history
 func (o *opHistory) Disable() {
 	o.enable = false
@@ -242,6 +767,29 @@ func (o *opHistory) debug() {
 	}
 }
 
+// ignored tells whether the line isn't saved in the history, see
+// Config.HistoryIgnoreSpace and Config.HistoryFilter.
+func (o *opHistory) ignored(line []rune) bool {
+	if o.cfg.HistoryIgnoreSpace && len(line) > 0 && line[0] == ' ' {
+		return true
+	}
+	return o.cfg.HistoryFilter != nil && !o.cfg.HistoryFilter(string(line))
+}
+
+// eraseDups removes the items before elem which are equal to it, see
+// Config.HistoryEraseDups. elem is pinned if one of them was.
+func (o *opHistory) eraseDups(elem *list.Element) {
+	item := elem.Value.(*hisItem)
+	for e := elem.Prev(); e != nil; {
+		prev := e.Prev()
+		if dup := e.Value.(*hisItem); runes.Equal(dup.Source, item.Source) {
+			item.Pinned = item.Pinned || dup.Pinned
+			o.history.Remove(e)
+		}
+		e = prev
+	}
+}
+
 // save history
 func (o *opHistory) New(current []rune) (err error) {
 
@@ -252,6 +800,15 @@ func (o *opHistory) New(current []rune) (err error) {
 
 	current = runes.Copy(current)
 
+	if len(current) > 0 && o.ignored(current) {
+		o.current = o.history.Back()
+		if o.current != nil {
+			o.current.Value.(*hisItem).Clean()
+		}
+		o.historyVer++
+		return nil
+	}
+
 	// if just use last command without modify
 	// just clean lastest history
 	if back := o.history.Back(); back != nil {
@@ -286,6 +843,9 @@ func (o *opHistory) New(current []rune) (err error) {
 
 	// err only can be a IO error, just report
 	err = o.Update(current, true)
+	if o.cfg.HistoryEraseDups {
+		o.eraseDups(o.current)
+	}
 
 	// push a new one to commit current command
 	o.historyVer++
@@ -299,21 +859,24 @@ func (o *opHistory) Revert() {
 }
 
 func (o *opHistory) Update(s []rune, commit bool) (err error) {
+	var tag string
+	if commit && o.cfg.FuncHistoryTag != nil {
+		tag = o.cfg.FuncHistoryTag(string(s))
+	}
 	o.fdLock.Lock()
 	defer o.fdLock.Unlock()
-	s = runes.Copy(s)
 	if o.current == nil {
-		o.Push(s)
+		o.Push(runes.Copy(s))
 		o.Compact()
 		return
 	}
 	r := o.current.Value.(*hisItem)
 	r.Version = o.historyVer
 	if commit {
-		r.Source = s
+		r.Source = runes.Copy(s)
+		r.Time, r.Tag = time.Now(), tag
 		if o.fd != nil {
-			// just report the error
-			_, err = o.fd.Write([]byte(string(r.Source) + "\n"))
+			err = o.appendLocked(r)
 		}
 	} else {
 		r.Tmp = append(r.Tmp[:0], s...)
@@ -323,6 +886,44 @@ func (o *opHistory) Update(s []rune, commit bool) (err error) {
 	return
 }
 
+// appendLocked appends the item to the HistoryFile, after the lines the
+// other sessions saved with Config.HistoryShared. The error is just
+// reported, the line is saved on Close.
+func (o *opHistory) appendLocked(item *hisItem) (err error) {
+	o.reopenLocked()
+	if lockFile(o.fd) == nil {
+		defer unlockFile(o.fd)
+	}
+	if o.cfg.HistoryShared {
+		o.syncLocked()
+	}
+	o.saved = true
+	if _, err = o.fd.Write([]byte(o.record(item) + "\n")); err != nil {
+		o.unsaved = append(o.unsaved, o.record(item))
+	}
+	o.offset = fileSize(o.fd)
+	return err
+}
+
+// reopenLocked opens the HistoryFile again if another session replaced
+// it, see writeHistoryFile, so that the lines aren't appended to the file
+// it removed.
+func (o *opHistory) reopenLocked() {
+	info, err := os.Stat(o.cfg.HistoryFile)
+	if err != nil {
+		return
+	}
+	if cur, err := o.fd.Stat(); err != nil || os.SameFile(info, cur) {
+		return
+	}
+	f, err := os.OpenFile(o.cfg.HistoryFile, os.O_APPEND|os.O_RDWR, 0666)
+	if err != nil {
+		return
+	}
+	o.fd.Close()
+	o.fd = f
+}
+
 func (o *opHistory) Push(s []rune) {
 	s = runes.Copy(s)
 	elem := o.history.PushBack(&hisItem{Source: s})
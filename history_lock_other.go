@@ -0,0 +1,36 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package readline
+
+import (
+	"os"
+	"sync"
+)
+
+// there's no flock here: only the Instances of this process exclude each
+// other
+var historyFileLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: map[string]*sync.Mutex{}}
+
+func historyFileLock(f *os.File) *sync.Mutex {
+	historyFileLocks.Lock()
+	defer historyFileLocks.Unlock()
+	m := historyFileLocks.m[f.Name()]
+	if m == nil {
+		m = &sync.Mutex{}
+		historyFileLocks.m[f.Name()] = m
+	}
+	return m
+}
+
+func lockFile(f *os.File) error {
+	historyFileLock(f).Lock()
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	historyFileLock(f).Unlock()
+	return nil
+}
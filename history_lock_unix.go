@@ -0,0 +1,19 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package readline
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes the advisory lock of the HistoryFile, which the other
+// sessions take to append to it or rewrite it. It's held by the open
+// file, so the Instances of a process exclude each other too.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
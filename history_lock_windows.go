@@ -0,0 +1,37 @@
+// +build windows
+
+package readline
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	lockFileEx   = kernel32.NewProc("LockFileEx")
+	unlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const lockfileExclusiveLock = 2
+
+// lockFile takes the lock of the whole HistoryFile, see the unix one.
+func lockFile(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := lockFileEx.Call(f.Fd(), lockfileExclusiveLock, 0,
+		^uintptr(0), ^uintptr(0), uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := unlockFileEx.Call(f.Fd(), 0,
+		^uintptr(0), ^uintptr(0), uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
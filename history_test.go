@@ -0,0 +1,330 @@
+package readline
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryEdits(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+	rl.SaveHistory("one")
+	rl.SaveHistory("two")
+
+	// the edits survive moving to another item and back
+	go w.Write([]byte("\x10X\x10\x0e\r"))
+	if line, err := rl.Readline(); err != nil || line != "twoX" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	go w.Write([]byte("\x10\x10Y\x1br\r"))
+	if line, err := rl.Readline(); err != nil || line != "two" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestHistoryWrap(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		HistoryWrap: true,
+	})
+	rl.SaveHistory("one")
+	rl.SaveHistory("two")
+
+	// Up past the oldest item comes back to the line being edited
+	go w.Write([]byte("cur\x10\x10\x10\r"))
+	if line, err := rl.Readline(); err != nil || line != "cur" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	go w.Write([]byte("\x0e\r"))
+	if line, err := rl.Readline(); err != nil || line != "one" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestPinHistory(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		HistoryLimit: 4,
+	})
+	rl.SaveHistory("a")
+	rl.SaveHistory("b")
+	if !rl.PinHistory("a", true) || rl.PinHistory("z", true) {
+		t.Fatal("pin failed")
+	}
+	rl.SaveHistory("c")
+	rl.SaveHistory("d")
+
+	// pin "d" while navigating
+	go w.Write([]byte("\x10\x1bp\x0e\r"))
+	if line, err := rl.Readline(); err != nil || line != "" {
+		t.Fatal("result not expect", line, err)
+	}
+	for _, s := range []string{"e", "f"} {
+		go w.Write([]byte(s + "\r"))
+		if line, err := rl.Readline(); err != nil || line != s {
+			t.Fatal("result not expect", line, err)
+		}
+	}
+
+	go w.Write([]byte("\x10\x10\x10\r"))
+	if line, err := rl.Readline(); err != nil || line != "a" {
+		t.Fatal("result not expect", line, err)
+	}
+	go w.Write([]byte("\x10\x10\r"))
+	if line, err := rl.Readline(); err != nil || line != "d" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestPinHistoryFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+	if err := ioutil.WriteFile(file, []byte("make deploy\ny\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func() (*Instance, *io.PipeWriter) {
+		return newTestInstance(t, &Config{
+			HistoryFile:  file,
+			HistoryLimit: 3,
+		})
+	}
+	rl, _ := open()
+	rl.PinHistory("make deploy", true)
+	rl.SaveHistory("make test")
+	rl.SaveHistory("b")
+	rl.Close()
+
+	// the pinned line is kept when the file is trimmed
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "#0!\nmake deploy\nmake test\nb\n" {
+		t.Fatalf("result not expect %q", data)
+	}
+
+	rl, w := open()
+	if h := rl.GetHistory(); len(h) != 3 || !h[0].Pinned || h[1].Pinned {
+		t.Fatal("result not expect", h)
+	}
+	// and found first
+	go w.Write([]byte("\x12make\r"))
+	if line, err := rl.Readline(); err != nil || line != "make deploy" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestHistoryMergeOnClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+	if err := ioutil.WriteFile(file, []byte("x\ny\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func() *Instance {
+		rl, _ := newTestInstance(t, &Config{
+			HistoryFile:  file,
+			HistoryLimit: 3,
+		})
+		return rl
+	}
+	a, b := open(), open()
+	a.SaveHistory("a1")
+	b.SaveHistory("b1")
+	a.SaveHistory("a2")
+	a.Close()
+	b.SaveHistory("b2")
+	b.Close()
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "b1\na2\nb2\n" {
+		t.Fatalf("result not expect %q", data)
+	}
+
+	// without history, there is nothing to merge
+	rl, _ := newTestInstance(t, &Config{
+		HistoryFile:  file,
+		HistoryLimit: -1,
+	})
+	rl.SaveHistory("c")
+	rl.Close()
+}
+
+func TestHistoryTimestamps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+	if err := ioutil.WriteFile(file, []byte("#100 /tmp\nx\ny\n#200\nz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func() *Instance {
+		rl, _ := newTestInstance(t, &Config{
+			HistoryFile:       file,
+			HistoryLimit:      3,
+			HistoryTimestamps: true,
+			FuncHistoryTag:    func(line string) string { return "tag\n" + line },
+		})
+		return rl
+	}
+	a := open()
+	entries := a.GetHistory()
+	if len(entries) != 3 || entries[0].Line != "x" || entries[0].Tag != "/tmp" ||
+		entries[0].Time.Unix() != 100 || !entries[1].Time.IsZero() ||
+		entries[2].Line != "z" || entries[2].Time.Unix() != 200 {
+		t.Fatalf("result not expect %+v", entries)
+	}
+	a.SaveHistory("a")
+	a.Close()
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) != 6 || lines[0] != "y" || lines[1] != "#200" || lines[2] != "z" ||
+		!strings.HasSuffix(lines[3], " tag a") || lines[4] != "a" {
+		t.Fatalf("result not expect %q", data)
+	}
+
+	b := open()
+	defer b.Close()
+	entries = b.GetHistory()
+	if len(entries) != 3 || entries[2].Line != "a" || entries[2].Tag != "tag a" ||
+		time.Since(entries[2].Time) > time.Minute {
+		t.Fatalf("result not expect %+v", entries)
+	}
+}
+
+func TestHistoryControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+	if err := ioutil.WriteFile(file, []byte("a\nb\na\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rl, _ := newTestInstance(t, &Config{
+		HistoryFile:        file,
+		HistoryIgnoreSpace: true,
+		HistoryEraseDups:   true,
+		HistoryFilter:      func(line string) bool { return line != "skip" },
+	})
+	lines := func() string {
+		var lines []string
+		for _, e := range rl.GetHistory() {
+			lines = append(lines, e.Line)
+		}
+		return strings.Join(lines, ",")
+	}
+	if got := lines(); got != "b,a" {
+		t.Fatal("result not expect", got)
+	}
+	rl.SaveHistory(" secret")
+	rl.SaveHistory("skip")
+	rl.SaveHistory("b")
+	if got := lines(); got != "a,b" {
+		t.Fatal("result not expect", got)
+	}
+	rl.Close()
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a\nb\n" {
+		t.Fatalf("result not expect %q", data)
+	}
+}
+
+func TestHistoryShared(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "history")
+
+	open := func() *Instance {
+		rl, _ := newTestInstance(t, &Config{
+			HistoryFile:   file,
+			HistoryShared: true,
+		})
+		return rl
+	}
+	lines := func(rl *Instance) string {
+		var lines []string
+		for _, e := range rl.GetHistory() {
+			lines = append(lines, e.Line)
+		}
+		return strings.Join(lines, ",")
+	}
+	a, b := open(), open()
+	a.SaveHistory("a1")
+	b.SaveHistory("b1")
+	if got := lines(b); got != "a1,b1" {
+		t.Fatal("result not expect", got)
+	}
+	if got := lines(a); got != "a1" {
+		t.Fatal("result not expect", got)
+	}
+	a.Operation.history.Sync()
+	a.SaveHistory("a2")
+	if got := lines(a); got != "a1,b1,a2" {
+		t.Fatal("result not expect", got)
+	}
+	a.Close()
+	b.Close()
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a1\nb1\na2\n" {
+		t.Fatalf("result not expect %q", data)
+	}
+}
+
+func TestReadlineNoHistory(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+	rl.SaveHistory("old")
+
+	// Up and Ctrl-R don't recall "old"
+	go w.Write([]byte("\x10\x12old\rtoken\r"))
+	if line, err := rl.ReadlineNoHistory(); err != nil || line != "" {
+		t.Fatal("result not expect", line, err)
+	}
+	if line, err := rl.ReadlineNoHistory(); err != nil || line != "token" {
+		t.Fatal("result not expect", line, err)
+	}
+	if h := rl.GetHistory(); len(h) != 1 || h[0].Line != "old" {
+		t.Fatalf("result not expect %+v", h)
+	}
+
+	go w.Write([]byte("\x10\r"))
+	if line, err := rl.Readline(); err != nil || line != "old" {
+		t.Fatal("result not expect", line, err)
+	}
+}
@@ -0,0 +1,93 @@
+package readline
+
+import (
+	"sync"
+	"time"
+)
+
+// hookBudget runs the hooks of the user (the Listener, the Painter,
+// FuncDiagnose, FuncHighlight and the Suggester) within Config.HookBudget. A Go function can't be stopped,
+// so the hook which overruns keeps running on its own goroutine and its
+// result is dropped, as are the calls of the same hook until it returns:
+// the line is drawn without it meanwhile.
+type hookBudget struct {
+	sync.Mutex
+	// the hooks still running after their budget, and the panics they
+	// raised afterwards, which are raised again by their next call
+	busy   map[string]bool
+	panics map[string]interface{}
+}
+
+func newHookBudget() *hookBudget {
+	return &hookBudget{
+		busy:   make(map[string]bool),
+		panics: make(map[string]interface{}),
+	}
+}
+
+// run calls f, the hook named name, and tells whether it returned within
+// the budget. f is called directly if there isn't any budget.
+func (b *hookBudget) run(cfg *Config, name string, f func()) bool {
+	budget := cfg.HookBudget
+	if budget <= 0 {
+		f()
+		return true
+	}
+
+	b.Lock()
+	if p, ok := b.panics[name]; ok {
+		delete(b.panics, name)
+		b.Unlock()
+		panic(p)
+	}
+	if b.busy[name] {
+		b.Unlock()
+		return false
+	}
+	b.busy[name] = true
+	b.Unlock()
+
+	done := make(chan interface{}, 1)
+	go func() {
+		var p interface{}
+		defer func() {
+			if p = recover(); p != nil {
+				done <- p
+			}
+		}()
+		f()
+		done <- nil
+	}()
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+	select {
+	case p := <-done:
+		b.Lock()
+		delete(b.busy, name)
+		b.Unlock()
+		if p != nil {
+			panic(p)
+		}
+		return true
+	case <-timer.C:
+	}
+
+	go func() {
+		p := <-done
+		b.Lock()
+		delete(b.busy, name)
+		if p != nil {
+			b.panics[name] = p
+		}
+		b.Unlock()
+	}()
+	if cfg.FuncOnSlowHook != nil {
+		// not under the lock of the RuneBuffer which runs the Painter
+		go func() {
+			defer recoverGoroutine(cfg)
+			cfg.FuncOnSlowHook(name, budget)
+		}()
+	}
+	return false
+}
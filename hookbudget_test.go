@@ -0,0 +1,49 @@
+package readline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHookBudget(t *testing.T) {
+	release := make(chan struct{})
+	slow := make(chan string, 1)
+	cfg := &Config{
+		HookBudget:     10 * time.Millisecond,
+		FuncOnSlowHook: func(hook string, budget time.Duration) { slow <- hook },
+	}
+	b := newHookBudget()
+
+	ran := false
+	if !b.run(cfg, "Listener", func() { ran = true }) || !ran {
+		t.Fatal("the fast hook should run")
+	}
+	if b.run(cfg, "Listener", func() { <-release }) {
+		t.Fatal("the slow hook should overrun")
+	}
+	if hook := <-slow; hook != "Listener" {
+		t.Fatal("result not expect", hook)
+	}
+	// skipped while the slow one is still running
+	if b.run(cfg, "Listener", func() { t.Error("called while busy") }) {
+		t.Fatal("the hook should be skipped")
+	}
+	// the other hooks aren't
+	if !b.run(cfg, "Painter", func() {}) {
+		t.Fatal("the Painter should run")
+	}
+
+	close(release)
+	for {
+		b.Lock()
+		busy := b.busy["Listener"]
+		b.Unlock()
+		if !busy {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !b.run(cfg, "Listener", func() {}) {
+		t.Fatal("the hook should run again")
+	}
+}
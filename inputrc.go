@@ -0,0 +1,540 @@
+package readline
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The inputrc files of GNU readline are read into the Config: the key
+// bindings go to the Keymaps, or the KeySequences for the escape
+// sequences of the terminal, and the few variables which have a
+// counterpart here are set. What can't be done here (the macros, the
+// functions which aren't implemented, the sequences of several keys
+// which aren't decoded as a single key) is skipped, like the unknown
+// settings by GNU readline.
+
+// InputrcPath returns the inputrc file of the user, $INPUTRC or
+// ~/.inputrc, for Config.InputrcFile.
+func InputrcPath() string {
+	if path := os.Getenv("INPUTRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".inputrc")
+}
+
+// the functions of GNU readline which are implemented, by the key which
+// performs them
+var inputrcFunctions = map[string]rune{
+	"beginning-of-line":        CharLineStart,
+	"end-of-line":              CharLineEnd,
+	"forward-char":             CharForward,
+	"backward-char":            CharBackward,
+	"forward-word":             MetaForward,
+	"backward-word":            MetaBackward,
+	"clear-screen":             CharCtrlL,
+	"accept-line":              CharEnter,
+	"previous-history":         CharPrev,
+	"next-history":             CharNext,
+	"reverse-search-history":   CharBckSearch,
+	"forward-search-history":   CharFwdSearch,
+	"history-search-backward":  MetaHistorySearchBackward,
+	"history-search-forward":   MetaHistorySearchForward,
+	"yank-nth-arg":             MetaYankNthArg,
+	"yank-last-arg":            MetaYankLastArg,
+	"insert-last-argument":     MetaYankLastArg,
+	"delete-char":              CharDelete,
+	"backward-delete-char":     CharBackspace,
+	"transpose-chars":          CharTranspose,
+	"kill-line":                CharKill,
+	"unix-line-discard":        CharCtrlU,
+	"kill-word":                MetaDelete,
+	"backward-kill-word":       MetaBackspace,
+	"unix-word-rubout":         CharCtrlW,
+	"shell-kill-word":          MetaKillToken,
+	"shell-backward-kill-word": MetaBackKillToken,
+	"yank":                     CharCtrlY,
+	"yank-pop":                 MetaYankPop,
+	"complete":                 CharTab,
+	"menu-complete":            MetaMenuComplete,
+	"menu-complete-backward":   MetaMenuCompleteBackward,
+	"abort":                    CharBell,
+	"undo":                     CharUndo,
+	"revert-line":              MetaRevertLine,
+	"set-mark":                 MetaSetMark,
+	"insert-comment":           MetaInsertComment,
+	"start-kbd-macro":          MetaStartMacro,
+	"end-kbd-macro":            MetaEndMacro,
+	"call-last-kbd-macro":      MetaPlayMacro,
+	"universal-argument":       MetaUniversalArgument,
+	"negative-argument":        MetaNegativeArgument,
+}
+
+// the keymaps of GNU readline
+var inputrcKeymaps = map[string]string{
+	"emacs":          KeymapEmacs,
+	"emacs-standard": KeymapEmacs,
+	"vi":             KeymapViCommand,
+	"vi-move":        KeymapViCommand,
+	"vi-command":     KeymapViCommand,
+	"vi-insert":      KeymapViInsert,
+}
+
+// the names of the keys in the bindings like `Control-u: kill-line`
+var inputrcKeyNames = map[string]rune{
+	"del":     CharBackspace,
+	"rubout":  CharBackspace,
+	"esc":     CharEsc,
+	"escape":  CharEsc,
+	"lfd":     CharCtrlJ,
+	"newline": CharCtrlJ,
+	"ret":     CharEnter,
+	"return":  CharEnter,
+	"space":   ' ',
+	"spc":     ' ',
+	"tab":     CharTab,
+}
+
+// maxInputrcIncludes bounds the nesting of $include.
+const maxInputrcIncludes = 8
+
+// inputrc is the state of the parsing of an inputrc file.
+type inputrc struct {
+	cfg    *Config
+	keymap string
+	term   string
+	// the bindings read, which don't override the ones of the program
+	keymaps   map[string]Keymap
+	sequences map[string]rune
+	chords    map[string][]Chord
+	// the $if being read, whether their branch is taken
+	conds []bool
+}
+
+// loadInputrc applies the inputrc file at path, which may be missing.
+func (c *Config) loadInputrc(path string) error {
+	p := &inputrc{
+		cfg:       c,
+		keymap:    KeymapEmacs,
+		term:      os.Getenv("TERM"),
+		keymaps:   make(map[string]Keymap),
+		sequences: make(map[string]rune),
+		chords:    make(map[string][]Chord),
+	}
+	if c.VimMode {
+		p.keymap = KeymapViInsert
+	}
+	if err := p.readFile(path, 0); err != nil {
+		return err
+	}
+
+	keymaps := make(map[string]Keymap)
+	for name, km := range p.keymaps {
+		keymaps[name] = km
+	}
+	for name, km := range c.Keymaps {
+		merged := make(Keymap)
+		for key, action := range keymaps[name] {
+			merged[key] = action
+		}
+		for key, action := range km {
+			merged[key] = action
+		}
+		keymaps[name] = merged
+	}
+	for seq, key := range c.KeySequences {
+		p.sequences[seq] = key
+	}
+	for name, chords := range c.Chords {
+		for _, chord := range chords {
+			p.chords[name] = bindChord(p.chords[name], chord)
+		}
+	}
+	c.Keymaps, c.KeySequences, c.Chords = keymaps, p.sequences, p.chords
+	return nil
+}
+
+func (p *inputrc) readFile(path string, depth int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		p.parseLine(scanner.Text(), filepath.Dir(path), depth)
+	}
+	return scanner.Err()
+}
+
+// active tells whether the lines are in the taken branches of the $if.
+func (p *inputrc) active() bool {
+	for _, taken := range p.conds {
+		if !taken {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *inputrc) parseLine(line, dir string, depth int) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return
+	}
+	if line[0] == '$' {
+		p.parseDirective(line, dir, depth)
+		return
+	}
+	if !p.active() {
+		return
+	}
+	if fields := strings.Fields(line); fields[0] == "set" {
+		if len(fields) >= 3 {
+			p.set(strings.ToLower(fields[1]), fields[2])
+		}
+		return
+	}
+	p.parseBinding(line)
+}
+
+func (p *inputrc) parseDirective(line, dir string, depth int) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "$if":
+		test := strings.TrimSpace(strings.TrimPrefix(line, "$if"))
+		p.conds = append(p.conds, p.test(test))
+	case "$else":
+		if n := len(p.conds); n > 0 {
+			p.conds[n-1] = !p.conds[n-1]
+		}
+	case "$endif":
+		if n := len(p.conds); n > 0 {
+			p.conds = p.conds[:n-1]
+		}
+	case "$include":
+		if len(fields) < 2 || !p.active() || depth >= maxInputrcIncludes {
+			return
+		}
+		path := fields[1]
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		} else if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		p.readFile(path, depth+1)
+	}
+}
+
+// test evaluates the condition of $if: the editing mode and the
+// terminal are known, the application isn't.
+func (p *inputrc) test(test string) bool {
+	switch {
+	case strings.HasPrefix(test, "mode="):
+		mode := strings.TrimPrefix(test, "mode=")
+		return (mode == "vi") == p.cfg.VimMode
+	case strings.HasPrefix(test, "term="):
+		term := strings.TrimPrefix(test, "term=")
+		return term == p.term || term == strings.SplitN(p.term, "-", 2)[0]
+	}
+	return false
+}
+
+func (p *inputrc) set(name, value string) {
+	on := strings.EqualFold(value, "on") || value == "1"
+	switch name {
+	case "editing-mode":
+		p.cfg.VimMode = value == "vi"
+		p.keymap = KeymapEmacs
+		if p.cfg.VimMode {
+			p.keymap = KeymapViInsert
+		}
+	case "keymap":
+		if keymap, ok := inputrcKeymaps[value]; ok {
+			p.keymap = keymap
+		}
+	case "comment-begin":
+		p.cfg.CommentBegin = strings.Trim(value, `"`)
+	case "enable-bracketed-paste":
+		p.cfg.EnableBracketedPaste = on
+	case "show-all-if-ambiguous", "show-all-if-unmodified":
+		ambiguous := p.cfg.CompleteListMode == CompleteListAmbiguous
+		unmodified := p.cfg.CompleteListMode != CompleteListOnSecondTab
+		if name == "show-all-if-ambiguous" {
+			ambiguous = on
+		} else {
+			unmodified = on
+		}
+		switch {
+		case ambiguous:
+			p.cfg.CompleteListMode = CompleteListAmbiguous
+		case unmodified:
+			p.cfg.CompleteListMode = CompleteListUnmodified
+		default:
+			p.cfg.CompleteListMode = CompleteListOnSecondTab
+		}
+	case "completion-query-items":
+		if n, err := strconv.Atoi(value); err == nil {
+			if n == 0 {
+				// asks always
+				n = 1
+			}
+			p.cfg.CompletionQueryItems = n
+		}
+	case "history-size":
+		if n, err := strconv.Atoi(value); err == nil {
+			if n <= 0 {
+				n = -1
+			}
+			p.cfg.HistoryLimit = n
+		}
+	}
+}
+
+// parseBinding reads `keyname: function` or `"keyseq": function`.
+func (p *inputrc) parseBinding(line string) {
+	var seq []rune
+	var rest string
+	if line[0] == '"' {
+		end := quotedEnd(line)
+		if end < 0 {
+			return
+		}
+		seq = unescapeKeyseq(line[1:end])
+		rest = strings.TrimSpace(line[end+1:])
+		if !strings.HasPrefix(rest, ":") {
+			return
+		}
+		rest = rest[1:]
+	} else {
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			return
+		}
+		seq = parseKeyname(strings.TrimSpace(line[:colon]))
+		rest = line[colon+1:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(seq) == 0 || len(fields) == 0 {
+		return
+	}
+	name := strings.ToLower(fields[0])
+	action, ok := inputrcFunctions[name]
+	if name == "digit-argument" {
+		action, ok = digitArgument(seq)
+	}
+	if !ok {
+		// the macros and the functions which aren't implemented
+		return
+	}
+	p.bind(seq, action)
+}
+
+// digitArgument returns the Meta digit key of the digit which seq ends
+// with, like digit-argument takes it from the key it's bound to.
+func digitArgument(seq []rune) (rune, bool) {
+	d := seq[len(seq)-1]
+	if d < '0' || d > '9' {
+		return 0, false
+	}
+	return MetaDigit0 - (d - '0'), true
+}
+
+func (p *inputrc) bind(seq []rune, action rune) {
+	if len(seq) > 2 && seq[0] == CharEsc && (seq[1] == CharEscapeEx || seq[1] == CharO) {
+		p.sequences[string(seq)] = action
+		return
+	}
+	key, ok := decodedKey(seq)
+	if !ok {
+		if keys, ok := decodedChord(seq); ok {
+			p.chords[p.keymap] = bindChord(p.chords[p.keymap], Chord{keys, action})
+		}
+		return
+	}
+	if p.keymaps[p.keymap] == nil {
+		p.keymaps[p.keymap] = make(Keymap)
+	}
+	p.keymaps[p.keymap][key] = action
+}
+
+// decodedKey returns the key which the Terminal decodes from seq, if it's
+// a single one.
+func decodedKey(seq []rune) (rune, bool) {
+	switch {
+	case len(seq) == 1:
+		return seq[0], true
+	case len(seq) != 2:
+	case seq[0] == CharEsc && seq[1] != CharEscapeEx && seq[1] != CharO && seq[1] != CharEsc:
+		if key := escapeKey(seq[1], nil); key != seq[1] {
+			return key, true
+		}
+	case seq[0] == CharCtrlX:
+		if key := ctrlXKey(seq[1]); key != CharBell {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+// decodedChord returns the keys which the Terminal decodes from seq, one
+// after the other, e.g. {CharCtrlX, CharBckSearch} for "\C-x\C-r".
+func decodedChord(seq []rune) ([]rune, bool) {
+	var keys []rune
+	for i := 0; i < len(seq); i++ {
+		if seq[i] == CharEsc || seq[i] == CharCtrlX {
+			if i+1 < len(seq) {
+				if key, ok := decodedKey(seq[i : i+2]); ok {
+					keys = append(keys, key)
+					i++
+					continue
+				}
+			}
+			if seq[i] == CharEsc {
+				return nil, false
+			}
+		}
+		keys = append(keys, seq[i])
+	}
+	return keys, len(keys) > 1
+}
+
+// quotedEnd returns the index of the quote closing the string which line
+// starts with, or -1.
+func quotedEnd(line string) int {
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseKeyname reads the names like Control-u, M-b or Meta-Rubout.
+func parseKeyname(name string) []rune {
+	var ctrl, meta bool
+	for {
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(lower, "control-"):
+			ctrl, name = true, name[len("control-"):]
+		case strings.HasPrefix(lower, "c-"):
+			ctrl, name = true, name[len("c-"):]
+		case strings.HasPrefix(lower, "meta-"):
+			meta, name = true, name[len("meta-"):]
+		case strings.HasPrefix(lower, "m-"):
+			meta, name = true, name[len("m-"):]
+		default:
+			var key rune
+			if k, ok := inputrcKeyNames[strings.ToLower(name)]; ok {
+				key = k
+			} else if rs := []rune(name); len(rs) == 1 {
+				key = rs[0]
+			} else {
+				return nil
+			}
+			if ctrl {
+				key = controlKey(key)
+			}
+			if meta {
+				return []rune{CharEsc, key}
+			}
+			return []rune{key}
+		}
+	}
+}
+
+func controlKey(r rune) rune {
+	if r == '?' {
+		return CharBackspace
+	}
+	return r & 0x1f
+}
+
+// unescapeKeyseq reads the escapes of the quoted key sequences, like \C-u,
+// \M-b, \e or \033.
+func unescapeKeyseq(s string) []rune {
+	rs := []rune(s)
+	var ret []rune
+	var ctrl, meta bool
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if r == '\\' && i+1 < len(rs) {
+			i++
+			switch c := rs[i]; {
+			case (c == 'C' || c == 'M') && i+1 < len(rs) && rs[i+1] == '-':
+				if c == 'C' {
+					ctrl = true
+				} else {
+					meta = true
+				}
+				i++
+				continue
+			case c == 'e':
+				r = CharEsc
+			case c == 'a':
+				r = CharBell
+			case c == 'b':
+				r = CharCtrlH
+			case c == 'd':
+				r = CharBackspace
+			case c == 'f':
+				r = CharCtrlL
+			case c == 'n':
+				r = CharCtrlJ
+			case c == 'r':
+				r = CharEnter
+			case c == 't':
+				r = CharTab
+			case c == 'v':
+				r = 11
+			case c >= '0' && c <= '7':
+				n := 0
+				for j := 0; j < 3 && i < len(rs) && rs[i] >= '0' && rs[i] <= '7'; j++ {
+					n = n*8 + int(rs[i]-'0')
+					i++
+				}
+				i--
+				r = rune(n)
+			case c == 'x':
+				n, digits := 0, 0
+				for ; digits < 2 && i+1 < len(rs); digits++ {
+					d, err := strconv.ParseUint(string(rs[i+1]), 16, 8)
+					if err != nil {
+						break
+					}
+					n = n*16 + int(d)
+					i++
+				}
+				r = rune(n)
+			default:
+				// \\, \", \' and the others stand for themselves
+				r = c
+			}
+		}
+		if ctrl {
+			r, ctrl = controlKey(r), false
+		}
+		if meta {
+			ret, meta = append(ret, CharEsc), false
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
@@ -0,0 +1,165 @@
+package readline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeInputrc(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInputrc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inputrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeInputrc(t, dir, "included", `set comment-begin "//"`)
+	path := writeInputrc(t, dir, "inputrc", `# bindings
+set editing-mode emacs
+set show-all-if-unmodified off
+set completion-query-items 50
+"\C-o": kill-line
+Control-t: unix-line-discard
+"\eb": kill-word
+"\e[A": beginning-of-line
+"\C-x\C-u": abort
+"\C-xa\C-a": beginning-of-line
+"\C-w": "a macro"
+Control-v: no-such-function
+$if mode=vi
+"\C-a": end-of-line
+$else
+"\C-e": beginning-of-line
+$endif
+$if Bash
+Control-k: undo
+$endif
+$include included
+`)
+	cfg := &Config{
+		InputrcFile: path,
+		Keymaps:     map[string]Keymap{KeymapEmacs: {CharTranspose: CharTab}},
+	}
+	if err := cfg.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Keymap{
+		15:            CharKill,
+		CharTranspose: CharTab, // the program's binding wins
+		MetaBackward:  MetaDelete,
+		CharUndo:      CharBell,
+		CharLineEnd:   CharLineStart,
+	}
+	km := cfg.Keymaps[KeymapEmacs]
+	if len(km) != len(expect) {
+		t.Fatal("result not expect", km)
+	}
+	for key, action := range expect {
+		if km[key] != action {
+			t.Fatalf("%v: expect %v, got %v", KeyName(key), KeyName(action), KeyName(km[key]))
+		}
+	}
+	if cfg.KeySequences["\033[A"] != CharLineStart || cfg.CommentBegin != "//" || cfg.VimMode {
+		t.Fatal("result not expect", cfg.KeySequences, cfg.CommentBegin, cfg.VimMode)
+	}
+	chords := cfg.Chords[KeymapEmacs]
+	if len(chords) != 1 || !runes.Equal(chords[0].Keys, []rune{CharCtrlX, 'a', CharLineStart}) || chords[0].Action != CharLineStart {
+		t.Fatal("result not expect", chords)
+	}
+	if cfg.CompleteListMode != CompleteListOnSecondTab || cfg.CompletionQueryItems != 50 {
+		t.Fatal("result not expect", cfg.CompleteListMode, cfg.CompletionQueryItems)
+	}
+
+	// a missing file isn't an error
+	cfg = &Config{InputrcFile: filepath.Join(dir, "missing")}
+	if err := cfg.Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnescapeKeyseq(t *testing.T) {
+	for in, expect := range map[string]string{
+		`\C-x\C-u`:  "\x18\x15",
+		`\M-b`:      "\033b",
+		`\033[1;5D`: "\033[1;5D",
+		`\e\C-?`:    "\033\x7f",
+		`\x41\"\\`:  "A\"\\",
+	} {
+		if got := string(unescapeKeyseq(in)); got != expect {
+			t.Fatalf("%s: expect %q, got %q", in, expect, got)
+		}
+	}
+}
+
+func TestInputrcViCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inputrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeInputrc(t, dir, "inputrc", "set editing-mode vi\nset keymap vi-command\n\"\\C-k\": kill-line\n")
+
+	rl, w := newTestInstance(t, &Config{
+		InputrcFile: path,
+	})
+
+	go w.Write([]byte("abc def\x1bb\x0b\r"))
+	if line, err := rl.Readline(); err != nil || line != "abc " {
+		t.Fatalf("result not expect %q %v", line, err)
+	}
+}
+
+func TestInputrcHistorySearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inputrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeInputrc(t, dir, "inputrc", `"\e[A": history-search-backward
+"\e[B": history-search-forward
+Control-o: negative-argument
+"\C-x5": digit-argument
+Control-t: digit-argument
+`)
+
+	rl, w := newTestInstance(t, &Config{
+		InputrcFile: path,
+	})
+
+	km := rl.Config.Keymaps[KeymapEmacs]
+	if km[15] != MetaNegativeArgument || km[CharTranspose] != 0 {
+		t.Fatal("result not expect", km)
+	}
+	if chords := rl.Config.Chords[KeymapEmacs]; len(chords) != 1 || chords[0].Action != MetaDigit5 {
+		t.Fatal("result not expect", chords)
+	}
+
+	for _, s := range []string{"git status", "ls", "git log"} {
+		rl.SaveHistory(s)
+	}
+	for _, c := range []struct {
+		input  string
+		expect string
+	}{
+		{"git\x1b[A\r", "git log"},
+		{"git\x1b[A\x1b[A\x1b[B\r", "git log"},
+		// the cursor stays after the prefix
+		{"git\x1b[A\x1b[AX\r", "gitX status"},
+		{"abc def\x01\x0f\x17\r", " def"},
+	} {
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+	}
+}
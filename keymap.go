@@ -0,0 +1,103 @@
+package readline
+
+// the names of the keymaps in Config.Keymaps
+const (
+	KeymapEmacs     = "emacs"
+	KeymapViInsert  = "vi-insert"
+	KeymapViCommand = "vi-command"
+	KeymapSearch    = "isearch"
+	KeymapMenu      = "menu-select"
+	KeymapBrowser   = "history-browser"
+	KeymapPager     = "pager"
+)
+
+// Keymap binds keys to the keys whose action they perform in a mode, e.g.
+// {CharCtrlJ: CharTab}, or to 0 to ignore them.
+//
+// The keymaps are stacked: the one of the pager, the history browser,
+// the search or the completion menu comes first if it's active, then
+// vi-command, or vi-insert and emacs (since the emacs keys work in vi
+// insert mode), or emacs. The first one which binds a key wins, the keys
+// which aren't bound keep their action. In vi-command, the keys bound to
+// the control or Meta keys perform their action of emacs mode.
+type Keymap map[rune]rune
+
+// keymapStack returns the names of the active keymaps, the first one
+// has the precedence.
+func (o *Operation) keymapStack() []string {
+	var stack []string
+	switch mode := o.mode(); mode {
+	case ModePager, ModeBrowser, ModeMenu, ModeSearch:
+		stack = append(stack, mode.String())
+	}
+	switch o.editMode() {
+	case ModeViCommand:
+		return append(stack, KeymapViCommand)
+	case ModeViInsert:
+		stack = append(stack, KeymapViInsert)
+	}
+	return append(stack, KeymapEmacs)
+}
+
+// mapKey looks up r in the active keymaps.
+func (o *Operation) mapKey(r rune) (rune, bool) {
+	stack := o.keymapStack()
+	o.m.Lock()
+	defer o.m.Unlock()
+	for _, name := range stack {
+		if action, ok := o.cfg.Keymaps[name][r]; ok {
+			return action, true
+		}
+	}
+	return r, false
+}
+
+// keyFor returns the key which performs action in the active keymaps: a
+// key bound to it, or else its own key unless that's bound to another
+// action.
+func (o *Operation) keyFor(action rune) (rune, bool) {
+	stack := o.keymapStack()
+	o.m.Lock()
+	defer o.m.Unlock()
+	bound, found := rune(0), false
+	for _, name := range stack {
+		for key, a := range o.cfg.Keymaps[name] {
+			// the lowest one, the same every time
+			if a == action && key != action && (!found || key < bound) {
+				bound, found = key, true
+			}
+		}
+	}
+	if found {
+		return bound, true
+	}
+	for _, name := range stack {
+		if a, ok := o.cfg.Keymaps[name][action]; ok {
+			return action, a == action
+		}
+	}
+	return action, true
+}
+
+// bypassesVi tells whether the action bound to a key in vi-command mode
+// is performed as it is rather than taken for a vi command: the control
+// and Meta keys of emacs mode, e.g. bound by an inputrc, which aren't vi
+// commands.
+func bypassesVi(action rune) bool {
+	switch action {
+	case CharEnter, CharCtrlJ, CharInterrupt, CharEsc:
+		return false
+	}
+	return !IsPrintable(action)
+}
+
+// stopsReading tells whether the Terminal waits to be kicked before
+// reading on after the key, which has to be done by hand if the key gets
+// the action of another one.
+func stopsReading(r rune) bool {
+	switch r {
+	case CharInterrupt, CharEnter, CharCtrlJ, CharDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestKeymaps(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		AutoComplete: staticCompleter{"get", "git"},
+		Keymaps: map[string]Keymap{
+			KeymapEmacs: {CharCtrlZ: 0, CharCtrlJ: CharTab},
+			// Ctrl-B picks the next candidate in the menu only
+			KeymapMenu: {CharBackward: CharTab},
+		},
+	})
+
+	go w.Write([]byte("ab\x1a\r"))
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	go w.Write([]byte("g\n\n\x02\r\r"))
+	if line, err := rl.Readline(); err != nil || line != "git" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	cfg := rl.Config.Clone()
+	cfg.Keymaps = nil
+	rl.SetConfig(cfg)
+	go w.Write([]byte("g\n"))
+	if line, err := rl.Readline(); err != nil || line != "g" {
+		t.Fatal("result not expect", line, err)
+	}
+}
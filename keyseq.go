@@ -0,0 +1,105 @@
+package readline
+
+import (
+	"bytes"
+	"strings"
+)
+
+// The modified arrow keys are encoded with the xterm modifier parameter
+// by most terminals, e.g. \033[1;5D for Ctrl-Left, which escapeExKey
+// decodes. The others use sequences of their own, which are listed here
+// by the TERM they set, like their terminfo entries (kLFT5, kRIT5 and
+// kDC5) would tell. Config.KeySequences overrides both.
+var termKeySequences = []struct {
+	prefix string
+	keys   map[string]rune
+}{
+	{"rxvt", map[string]rune{
+		"\033Od": MetaBackward, "\033Oc": MetaForward, "\033[3^": MetaDelete,
+	}},
+	// tmux and screen without xterm-keys, and PuTTY, send the application
+	// mode arrows for Ctrl while the cursor keys are in normal mode
+	{"screen", map[string]rune{"\033OD": MetaBackward, "\033OC": MetaForward}},
+	{"tmux", map[string]rune{"\033OD": MetaBackward, "\033OC": MetaForward}},
+	{"putty", map[string]rune{"\033OD": MetaBackward, "\033OC": MetaForward}},
+}
+
+// termKeySequence looks up the sequence of a modified key sent by the
+// terminal named term.
+func termKeySequence(term string, seq []byte) (rune, bool) {
+	for _, t := range termKeySequences {
+		if strings.HasPrefix(term, t.prefix) {
+			r, ok := t.keys[string(seq)]
+			return r, ok
+		}
+	}
+	return 0, false
+}
+
+// keySequence looks up the escape sequence seq, e.g. "\033[1;5D", in
+// Config.KeySequences and then in the sequences known for the TERM.
+func (t *Terminal) keySequence(seq []byte) (rune, bool) {
+	if r, ok := t.cfg.KeySequences[string(seq)]; ok {
+		return r, true
+	}
+	return termKeySequence(t.term, seq)
+}
+
+// modifiedKey returns the action of the arrow and editing keys sent with
+// the xterm modifier parameter, e.g. \033[1;5D (Ctrl-Left) or \033[3;3~
+// (Alt-Delete): Ctrl or Alt make them act on words. It's 0 otherwise.
+func modifiedKey(key *escapeKeyPair) rune {
+	attr := key.attr
+	if i := bytes.LastIndexByte(attr, ';'); i >= 0 {
+		attr = attr[i+1:]
+	} else if key.typ == '~' {
+		return 0
+	}
+	mod := 0
+	for _, c := range attr {
+		mod = mod*10 + int(c-'0')
+	}
+	// 1 + the bits of Shift (1), Alt (2) and Ctrl (4)
+	if mod < 2 || (mod-1)&6 == 0 {
+		return 0
+	}
+	switch key.typ {
+	case 'D':
+		return MetaBackward
+	case 'C':
+		return MetaForward
+	case '~':
+		if bytes.HasPrefix(key.attr, []byte("3;")) {
+			return MetaDelete
+		}
+	}
+	return 0
+}
+
+// bindEraseKeys adds the escape sequences of Config.KeyBackspace and
+// Config.KeyDelete to the KeySequences, unless the program binds them.
+func (c *Config) bindEraseKeys() {
+	for seq, key := range map[string]rune{c.KeyBackspace: CharBackspace, c.KeyDelete: CharDelete} {
+		if !strings.HasPrefix(seq, "\033") || seq == "\033[3~" && key == CharDelete {
+			continue
+		}
+		if c.KeySequences == nil {
+			c.KeySequences = make(map[string]rune)
+		}
+		if _, ok := c.KeySequences[seq]; !ok {
+			c.KeySequences[seq] = key
+		}
+	}
+}
+
+// eraseKey translates DEL and Ctrl-H by Config.KeyBackspace and
+// Config.KeyDelete, both erase backward otherwise.
+func (c *Config) eraseKey(r rune) rune {
+	switch string(r) {
+	case c.KeyDelete:
+		return CharDelete
+	case c.KeyBackspace:
+		return CharBackspace
+	}
+	return r
+}
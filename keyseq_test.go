@@ -0,0 +1,48 @@
+package readline
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestModifiedKeys(t *testing.T) {
+	cases := []struct {
+		seq    string
+		expect rune
+	}{
+		{"D", CharBackward},
+		{"1;5D", MetaBackward},
+		{"1;3C", MetaForward},
+		{"5C", MetaForward},
+		{"1;2D", CharBackward},
+		{"1;5A", CharPrev},
+		{"3~", CharDelete},
+		{"3;5~", MetaDelete},
+	}
+	for _, c := range cases {
+		var key escapeKeyPair
+		key.read(rune(c.seq[0]), bufio.NewReader(strings.NewReader(c.seq[1:])))
+		if got := escapeExKey(&key); got != c.expect {
+			t.Fatalf("%q: expect %v, got %v", c.seq, c.expect, got)
+		}
+	}
+
+	if r, ok := termKeySequence("rxvt-unicode-256color", []byte("\033Od")); !ok || r != MetaBackward {
+		t.Fatal("rxvt Ctrl-Left not decoded")
+	}
+	if _, ok := termKeySequence("xterm-256color", []byte("\033OD")); ok {
+		t.Fatal("xterm left in application mode taken for Ctrl-Left")
+	}
+}
+
+func TestKeySequences(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		KeySequences: map[string]rune{"\033[27Z": MetaBackward},
+	})
+
+	go w.Write([]byte("ls foo bar\033[1;5Dx\033[27Zy\r"))
+	if line, err := rl.Readline(); err != nil || line != "ls foo yxbar" {
+		t.Fatal("result not expect", line, err)
+	}
+}
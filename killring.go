@@ -0,0 +1,76 @@
+package readline
+
+// The kill ring keeps the last kills like GNU readline: the kills made by
+// consecutive keys join into a single entry (the backward ones in front
+// of it), Ctrl-Y yanks the latest entry and Meta-y, right after a yank,
+// replaces the yanked text by the entry before it, wrapping around.
+
+// maxKills is the size of the kill ring.
+const maxKills = 10
+
+// pushKill records the text killed forward of the cursor.
+func (r *RuneBuffer) pushKill(text []rune) {
+	r.addKill(text, false)
+}
+
+// pushBackKill records the text killed backward of the cursor.
+func (r *RuneBuffer) pushBackKill(text []rune) {
+	r.addKill(text, true)
+}
+
+func (r *RuneBuffer) addKill(text []rune, back bool) {
+	if n := len(r.killRing); r.appendKill && n > 0 {
+		if back {
+			text = append(runes.Copy(text), r.killRing[n-1]...)
+		} else {
+			text = append(runes.Copy(r.killRing[n-1]), text...)
+		}
+		r.killRing[n-1] = text
+	} else {
+		r.killRing = append(r.killRing, runes.Copy(text))
+		if len(r.killRing) > maxKills {
+			r.killRing = r.killRing[1:]
+		}
+	}
+	r.lastKill = r.killRing[len(r.killRing)-1]
+	r.kills++
+}
+
+// SetAppendKill makes the next kills join the latest one, while the keys
+// kill in a row.
+func (r *RuneBuffer) SetAppendKill(on bool) {
+	r.Lock()
+	r.appendKill = on
+	r.Unlock()
+}
+
+// ResetYank ends the yanks in a row, after which YankPop fails.
+func (r *RuneBuffer) ResetYank() {
+	r.Lock()
+	r.yanked = -1
+	r.Unlock()
+}
+
+// YankPop replaces the text before the cursor inserted by the last Yank
+// or YankPop by the previous entry of the kill ring. It returns false if
+// the last key didn't yank.
+func (r *RuneBuffer) YankPop() (success bool) {
+	r.Refresh(func() {
+		if r.yanked < 0 || len(r.killRing) == 0 || r.yanked > r.idx {
+			return
+		}
+		r.yankPos--
+		if r.yankPos < 0 {
+			r.yankPos = len(r.killRing) - 1
+		}
+		text := r.killRing[r.yankPos]
+		start := r.idx - r.yanked
+		buf := make([]rune, 0, len(r.buf)-r.yanked+len(text))
+		buf = append(buf, r.buf[:start]...)
+		buf = append(buf, text...)
+		buf = append(buf, r.buf[r.idx:]...)
+		r.buf, r.idx, r.yanked = buf, start+len(text), len(text)
+		success = true
+	})
+	return
+}
@@ -0,0 +1,29 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestKillRing(t *testing.T) {
+	for _, c := range []struct {
+		input  string
+		expect string
+	}{
+		// the kills in a row join
+		{"a b c\x17\x17\x01\x19\r", "b ca "},
+		{"a b c\x01\x1bd\x0b\x19\x19\r", "a b ca b c"},
+		// yank-pop goes back in the ring, wrapping around
+		{"one\x15two\x15\x19\x1by\r", "one"},
+		{"one\x15two\x15\x19\x1by\x1by\r", "two"},
+		// only right after a yank
+		{"one\x15two\x15\x19x\x1by\r", "twox"},
+	} {
+		rl, w := newTestInstance(t, nil)
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
@@ -0,0 +1,85 @@
+package readline
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// KeyLatency tells where the time of handling a key went, it's reported
+// to Config.FuncOnKeyLatency.
+type KeyLatency struct {
+	Key rune
+	// from reading the first byte of the key to decoding it, which
+	// includes waiting for the rest of an escape sequence
+	Decode time.Duration
+	// running the bindings, completers and listeners
+	Widgets time.Duration
+	// building the output
+	Render time.Duration
+	// writing the output to the terminal
+	Write time.Duration
+}
+
+func (l KeyLatency) Total() time.Duration {
+	return l.Decode + l.Widgets + l.Render + l.Write
+}
+
+func (l KeyLatency) String() string {
+	return fmt.Sprintf("%s %.1fms (decode %.1f, widgets %.1f, render %.1f, write %.1f)",
+		KeyName(l.Key), inMillis(l.Total()), inMillis(l.Decode), inMillis(l.Widgets), inMillis(l.Render), inMillis(l.Write))
+}
+
+func inMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// latencyMeter sums up the time spent on rendering and writing, which
+// happen in several places for a single key, and in other goroutines as
+// well.
+type latencyMeter struct {
+	render int64
+	write  int64
+}
+
+func (m *latencyMeter) addRender(since time.Time) {
+	if m != nil {
+		atomic.AddInt64(&m.render, int64(time.Since(since)))
+	}
+}
+
+func (m *latencyMeter) addWrite(since time.Time) {
+	if m != nil {
+		atomic.AddInt64(&m.write, int64(time.Since(since)))
+	}
+}
+
+// take returns the sums and resets them.
+func (m *latencyMeter) take() (render, write time.Duration) {
+	render = time.Duration(atomic.SwapInt64(&m.render, 0))
+	write = time.Duration(atomic.SwapInt64(&m.write, 0))
+	return
+}
+
+// reportLatency measures the key which has been handled since start.
+func (o *Operation) reportLatency(r rune, start time.Time) {
+	cfg := o.keyConfig()
+	if cfg.FuncOnKeyLatency == nil && !cfg.ShowLatency {
+		return
+	}
+	l := KeyLatency{Key: r, Decode: o.t.lastDecode}
+	l.Render, l.Write = o.t.latency.take()
+	l.Widgets = time.Since(start) - l.Render - l.Write
+	if cfg.FuncOnKeyLatency != nil {
+		cfg.FuncOnKeyLatency(l)
+	}
+	if cfg.ShowLatency && cfg.useInteractive() {
+		// draw it at the right of the cursor line, it's cleared by the
+		// next refresh
+		text := fmt.Sprintf("%.1fms", inMillis(l.Total()))
+		col := o.buf.width - len(text) - 1
+		if col > 0 {
+			fmt.Fprintf(o.w, "\0337\r\033[%dC\033[2m%s\033[0m\0338", col, text)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestKeyLatency(t *testing.T) {
+	keys := make(chan KeyLatency, 10)
+	rl, w := newTestInstance(t, &Config{
+		FuncOnKeyLatency: func(l KeyLatency) { keys <- l },
+	})
+
+	go w.Write([]byte("ab\x1bb\r"))
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+	for _, key := range []rune{'a', 'b', MetaBackward, CharEnter} {
+		l := <-keys
+		if l.Key != key {
+			t.Fatal("key not expect", l)
+		}
+		if l.Total() <= 0 || l.Write <= 0 {
+			t.Fatal("latency not measured", l)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package readline
+
+// Token is a range of runes of the line, End is exclusive.
+type Token struct {
+	Start, End int
+}
+
+// Lexer splits the line into the units which the shell-aware word kills
+// (MetaKillToken and MetaBackKillToken) remove at once, see Config.Lexer.
+// The tokens must be sorted and not overlap, what's between them is
+// killed along with the token next to it.
+type Lexer interface {
+	Tokens(line []rune) []Token
+}
+
+// ShellLexer is the default Lexer: the words, quoted strings and the ${...}
+// or $(...) expansions are tokens, so that `"a b"` or `${HOME}` are killed
+// at once, unlike the plain word kills which stop at any punctuation.
+type ShellLexer struct{}
+
+func (ShellLexer) Tokens(line []rune) []Token {
+	var tokens []Token
+	for i := 0; i < len(line); {
+		start := i
+		switch r := line[i]; {
+		case r == '\'' || r == '"':
+			i = skipQuoted(line, i+1, r)
+		case r == '$' && i+1 < len(line) && (line[i+1] == '{' || line[i+1] == '('):
+			i = skipGroup(line, i+1)
+		case r == '\\' && i+1 < len(line):
+			i += 2
+			for i < len(line) && !IsWordBreak(line[i]) {
+				i++
+			}
+		case !IsWordBreak(r):
+			for i < len(line) && !IsWordBreak(line[i]) {
+				i++
+			}
+		default:
+			i++
+			continue
+		}
+		tokens = append(tokens, Token{start, i})
+	}
+	return tokens
+}
+
+// skipQuoted returns the end of the string quoted by q which starts at i,
+// the unterminated ones go on to the end of the line.
+func skipQuoted(line []rune, i int, q rune) int {
+	for ; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && q == '"':
+			i++
+		case line[i] == q:
+			return i + 1
+		}
+	}
+	return len(line)
+}
+
+// skipGroup returns the end of the group opened by the bracket at i,
+// minding the nested ones and the quotes.
+func skipGroup(line []rune, i int) int {
+	open, closing := line[i], '}'
+	if open == '(' {
+		closing = ')'
+	}
+	depth := 0
+	for ; i < len(line); i++ {
+		switch line[i] {
+		case '\'', '"':
+			i = skipQuoted(line, i+1, line[i]) - 1
+		case open:
+			depth++
+		case closing:
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(line)
+}
+
+// KillToken kills to the end of the token under or after the cursor.
+func (r *RuneBuffer) KillToken(lexer Lexer) {
+	r.Refresh(func() {
+		end := len(r.buf)
+		for _, t := range lexer.Tokens(runes.Copy(r.buf)) {
+			if t.End > r.idx {
+				end = t.End
+				break
+			}
+		}
+		if end == r.idx {
+			return
+		}
+		r.pushKill(r.buf[r.idx:end])
+		r.buf = append(r.buf[:r.idx], r.buf[end:]...)
+	})
+}
+
+// BackKillToken kills to the start of the token under or before the
+// cursor.
+func (r *RuneBuffer) BackKillToken(lexer Lexer) {
+	r.Refresh(func() {
+		start := 0
+		for _, t := range lexer.Tokens(runes.Copy(r.buf)) {
+			if t.Start >= r.idx {
+				break
+			}
+			start = t.Start
+		}
+		if start == r.idx {
+			return
+		}
+		r.pushBackKill(r.buf[start:r.idx])
+		r.buf = append(r.buf[:start], r.buf[r.idx:]...)
+		r.idx = start
+	})
+}
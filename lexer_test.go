@@ -0,0 +1,39 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestShellLexer(t *testing.T) {
+	line := []rune(`echo "a \" b" ${A:-{x}}/bin $(ls ')') c\ d 'open`)
+	var got []string
+	for _, tok := range (ShellLexer{}).Tokens(line) {
+		got = append(got, string(line[tok.Start:tok.End]))
+	}
+	expect := []string{`echo`, `"a \" b"`, `${A:-{x}}`, `bin`, `$(ls ')')`, `c`, `\ d`, `'open`}
+	if len(got) != len(expect) {
+		t.Fatalf("result not expect %q", got)
+	}
+	for i := range got {
+		if got[i] != expect[i] {
+			t.Fatalf("result not expect %q", got)
+		}
+	}
+}
+
+func TestKillToken(t *testing.T) {
+	cfg := &Config{Painter: &defaultPainter{}, FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(nil, "", cfg, 80)
+	rb.SetWithIdx(7, []rune(`echo -n "a b" ${HOME}`))
+	rb.KillToken(ShellLexer{})
+	if string(rb.buf) != `echo -n ${HOME}` || string(rb.lastKill) != ` "a b"` {
+		t.Fatal("result not expect", string(rb.buf), string(rb.lastKill))
+	}
+
+	rb.SetWithIdx(len(`echo -n "a b" ${HOME}`), []rune(`echo -n "a b" ${HOME}`))
+	rb.BackKillToken(ShellLexer{})
+	rb.BackKillToken(ShellLexer{})
+	if string(rb.buf) != `echo -n ` || rb.idx != 8 {
+		t.Fatal("result not expect", string(rb.buf), rb.idx)
+	}
+}
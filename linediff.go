@@ -0,0 +1,94 @@
+package readline
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// DiffKind is the kind of a DiffOp.
+type DiffKind int
+
+const (
+	// move the cursor by Cols columns, backward if it's negative
+	DiffMove DiffKind = iota
+	// write Text at the cursor, which moves after it
+	DiffWrite
+	// erase from the cursor to the end of the row
+	DiffErase
+)
+
+// DiffOp is a terminal operation of DiffLine.
+type DiffOp struct {
+	Kind DiffKind
+	Cols int
+	Text string
+}
+
+// DiffLine returns the operations which turn the displayed line old, with
+// the cursor at the rune oldPos, into new with the cursor at newPos,
+// rewriting as few columns as possible. The lines are the runes as
+// displayed, without escape sequences, and must fit in a row: the Painter
+// and the wrapped lines are left to the callers, which can redraw them.
+func DiffLine(old, new []rune, oldPos, newPos int) []DiffOp {
+	var ops []DiffOp
+	cursor := runes.WidthAll(old[:oldPos])
+	moveTo := func(col int) {
+		if col != cursor {
+			ops = append(ops, DiffOp{Kind: DiffMove, Cols: col - cursor})
+			cursor = col
+		}
+	}
+
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix &&
+		old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	start := runes.WidthAll(old[:prefix])
+	oldMid, newMid := old[prefix:len(old)-suffix], new[prefix:len(new)-suffix]
+	switch {
+	case len(oldMid) == 0 && len(newMid) == 0:
+		// same line
+	case runes.WidthAll(oldMid) == runes.WidthAll(newMid):
+		// the rest stays in place
+		moveTo(start)
+		ops = append(ops, DiffOp{Kind: DiffWrite, Text: string(newMid)})
+		cursor += runes.WidthAll(newMid)
+	default:
+		moveTo(start)
+		if tail := new[prefix:]; len(tail) > 0 {
+			ops = append(ops, DiffOp{Kind: DiffWrite, Text: string(tail)})
+			cursor += runes.WidthAll(tail)
+		}
+		if runes.WidthAll(new) < runes.WidthAll(old) {
+			ops = append(ops, DiffOp{Kind: DiffErase})
+		}
+	}
+	moveTo(runes.WidthAll(new[:newPos]))
+	return ops
+}
+
+// EncodeDiff returns the escape sequences of the operations.
+func EncodeDiff(ops []DiffOp) []byte {
+	buf := bytes.NewBuffer(nil)
+	for _, op := range ops {
+		switch op.Kind {
+		case DiffMove:
+			if op.Cols > 0 {
+				buf.WriteString("\033[" + strconv.Itoa(op.Cols) + "C")
+			} else if op.Cols < 0 {
+				buf.WriteString("\033[" + strconv.Itoa(-op.Cols) + "D")
+			}
+		case DiffWrite:
+			buf.WriteString(op.Text)
+		case DiffErase:
+			buf.WriteString("\033[K")
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,31 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestDiffLine(t *testing.T) {
+	cases := []struct {
+		old, new       string
+		oldPos, newPos int
+		expect         string
+	}{
+		// typing at the end
+		{"ls", "ls ", 2, 3, " "},
+		// the same width in the middle
+		{"cat foo", "cat bar", 7, 7, "\033[3Dbar"},
+		// inserting in the middle shifts the rest
+		{"ls -l", "ls -al", 4, 5, "al\033[1D"},
+		// deleting erases the leftover
+		{"ls -al", "ls -l", 5, 4, "\033[1Dl\033[K\033[1D"},
+		{"ls", "ls", 2, 0, "\033[2D"},
+		// wide runes count for two columns
+		{"世界", "世间", 2, 2, "\033[2D间"},
+	}
+	for _, c := range cases {
+		got := string(EncodeDiff(DiffLine([]rune(c.old), []rune(c.new), c.oldPos, c.newPos)))
+		if got != c.expect {
+			t.Fatalf("%q -> %q: expect %q, got %q", c.old, c.new, c.expect, got)
+		}
+	}
+}
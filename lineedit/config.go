@@ -0,0 +1,209 @@
+package lineedit
+
+import (
+	"io"
+
+	"github.com/chzyer/readline"
+)
+
+// Config configures an Instance. The zero value reads from the terminal
+// of the process, with the defaults of each field.
+type Config struct {
+	// the prompt, or its segments which take precedence, e.g. with the
+	// git branch of the directory. ContinuationPrompt is drawn before the
+	// rows of a MultiLine line after the first, RightPrompt flush right.
+	Prompt             string
+	PromptSegments     []PromptSegment
+	ContinuationPrompt string
+	RightPrompt        string
+
+	// the file the history is loaded from and saved to, which SetConfig
+	// doesn't change, see Instance.SetHistoryPath, and the number of lines
+	// kept, 500 if 0 and none if negative
+	HistoryFile  string
+	HistoryLimit int
+	// the accepted lines aren't saved, see Instance.SaveHistory
+	DisableAutoSaveHistory bool
+	// a time stamp is saved with each line, see Instance.GetHistory
+	HistoryTimestamps bool
+	// the lines starting with a space, the duplicates of a line and the
+	// lines HistoryFilter returns false for aren't saved
+	HistoryIgnoreSpace bool
+	HistoryEraseDups   bool
+	HistoryFilter      func(line string) bool
+	// the sessions on the same HistoryFile see the lines of each other
+	// as they're saved
+	HistoryShared bool
+	// Ctrl-R matches ignoring the case
+	HistorySearchFold bool
+	// the previous line of the oldest one is the newest, and conversely
+	HistoryWrap bool
+	// !!, !N, !prefix and !$ are expanded in the accepted line
+	HistoryExpand bool
+
+	// the completion of the line with Tab, and how its candidates are
+	// listed, matched and sorted: with the collation of Locale, a BCP 47
+	// tag like "sv-SE", or FuncCollate, else in byte order
+	AutoComplete      Completer
+	CompleteListMode  CompleteListMode
+	MenuComplete      bool
+	CompletionMatcher CompletionMatcher
+	Locale            string
+	FuncCollate       func(a, b string) int
+
+	// the keys: the actions of the keys per keymap, the sequences of keys
+	// which perform several, and the inputrc file merged under them, see
+	// the Keymap* and the Char* and Meta* constants. SetConfig doesn't
+	// change them, see Instance.BindKey.
+	Keymaps     map[string]Keymap
+	Chords      map[string][]Chord
+	InputrcFile string
+	VimMode     bool
+
+	// Enter inserts a newline rather than accepting the line, until
+	// FuncIsComplete returns true for it
+	MultiLine      bool
+	FuncIsComplete func(line []rune) bool
+
+	// what's drawn of the line: its colors, the marks of its errors and
+	// the suggestion after it, the latest history item beginning with the
+	// line if AutoSuggest is set without a Suggester
+	Painter       Renderer
+	FuncHighlight func(line []rune, pos int) []StyleSpan
+	FuncDiagnose  func(line []rune) []Diagnostic
+	AutoSuggest   bool
+	Suggester     Suggester
+
+	// told about every key, and about the changes of the line editor
+	Listener          Listener
+	FuncOnStateChange func(EditorState)
+	// suggest below the line the key which does at once what a key
+	// pressed over and over did, e.g. M-b after Left, Left, Left, Left
+	Trainer bool
+
+	// where the kills are copied to, with the yanks taken from
+	Clipboard Clipboard
+
+	// printed when the line is interrupted with Ctrl-C or ended with
+	// Ctrl-D
+	InterruptPrompt string
+	EOFPrompt       string
+
+	// the line is drawn with MaskRune in place of each rune;
+	// ReadPasswordConfirm gives PasswordConfirmTries tries, 3 if 0
+	EnableMask           bool
+	MaskRune             rune
+	PasswordConfirmTries int
+
+	// a paste is inserted as is rather than performing its keys
+	EnableBracketedPaste bool
+
+	// the terminal, which is the one of the process if they're nil; they
+	// can't be changed by SetConfig
+	Stdin          io.ReadCloser
+	Stdout         io.Writer
+	Stderr         io.Writer
+	FuncIsTerminal func() bool
+	FuncGetWidth   func() int
+	FuncGetHeight  func() int
+	FuncMakeRaw    func() error
+	FuncExitRaw    func() error
+
+	// the panics of the callbacks are recovered, and reported here
+	FuncOnPanic func(err *PanicError)
+}
+
+// apply sets the fields of c which SetConfig changes on cfg.
+func (c *Config) apply(cfg *readline.Config) {
+	cfg.Prompt = c.Prompt
+	cfg.PromptSegments = c.PromptSegments
+	cfg.ContinuationPrompt = c.ContinuationPrompt
+	cfg.RightPrompt = c.RightPrompt
+
+	cfg.HistoryLimit = c.HistoryLimit
+	cfg.DisableAutoSaveHistory = c.DisableAutoSaveHistory
+	cfg.HistoryTimestamps = c.HistoryTimestamps
+	cfg.HistoryIgnoreSpace = c.HistoryIgnoreSpace
+	cfg.HistoryEraseDups = c.HistoryEraseDups
+	cfg.HistoryFilter = c.HistoryFilter
+	cfg.HistoryShared = c.HistoryShared
+	cfg.HistorySearchFold = c.HistorySearchFold
+	cfg.HistoryWrap = c.HistoryWrap
+	cfg.HistoryExpand = c.HistoryExpand
+
+	cfg.AutoComplete = c.AutoComplete
+	cfg.CompleteListMode = c.CompleteListMode
+	cfg.MenuComplete = c.MenuComplete
+	cfg.CompletionMatcher = c.CompletionMatcher
+	cfg.Locale = c.Locale
+	cfg.FuncCollate = c.FuncCollate
+
+	cfg.VimMode = c.VimMode
+
+	cfg.MultiLine = c.MultiLine
+	cfg.FuncIsComplete = c.FuncIsComplete
+
+	cfg.Painter = c.Painter
+	cfg.FuncHighlight = c.FuncHighlight
+	cfg.FuncDiagnose = c.FuncDiagnose
+	cfg.AutoSuggest = c.AutoSuggest
+	cfg.Suggester = c.Suggester
+
+	cfg.Listener = c.Listener
+	cfg.FuncOnStateChange = c.FuncOnStateChange
+	cfg.Trainer = c.Trainer
+
+	cfg.Clipboard = c.Clipboard
+
+	cfg.InterruptPrompt = c.InterruptPrompt
+	cfg.EOFPrompt = c.EOFPrompt
+
+	cfg.EnableMask = c.EnableMask
+	cfg.MaskRune = c.MaskRune
+	cfg.PasswordConfirmTries = c.PasswordConfirmTries
+
+	cfg.EnableBracketedPaste = c.EnableBracketedPaste
+
+	cfg.FuncOnPanic = c.FuncOnPanic
+}
+
+// setDefaults fills in the defaults of readline.Config.Init for the fields
+// apply sets, since Init fills them in only once, when NewEx is called.
+func setDefaults(cfg *readline.Config) {
+	if cfg.HistoryLimit == 0 {
+		cfg.HistoryLimit = 500
+	}
+	if cfg.AutoComplete == nil {
+		cfg.AutoComplete = &readline.TabCompleter{}
+	}
+	if cfg.InterruptPrompt == "" {
+		cfg.InterruptPrompt = "^C"
+	} else if cfg.InterruptPrompt == "\n" {
+		cfg.InterruptPrompt = ""
+	}
+	if cfg.EOFPrompt == "" {
+		cfg.EOFPrompt = "^D"
+	} else if cfg.EOFPrompt == "\n" {
+		cfg.EOFPrompt = ""
+	}
+}
+
+// config returns the readline Config of c, for NewEx.
+func (c *Config) config() *readline.Config {
+	cfg := &readline.Config{
+		Stdin:          c.Stdin,
+		Stdout:         c.Stdout,
+		Stderr:         c.Stderr,
+		FuncIsTerminal: c.FuncIsTerminal,
+		FuncGetWidth:   c.FuncGetWidth,
+		FuncGetHeight:  c.FuncGetHeight,
+		FuncMakeRaw:    c.FuncMakeRaw,
+		FuncExitRaw:    c.FuncExitRaw,
+		HistoryFile:    c.HistoryFile,
+		Keymaps:        c.Keymaps,
+		Chords:         c.Chords,
+		InputrcFile:    c.InputrcFile,
+	}
+	c.apply(cfg)
+	return cfg
+}
@@ -0,0 +1,338 @@
+// Package lineedit is the stable API of github.com/chzyer/readline.
+//
+// It's the line editor of readline with only the Instance, its Config and
+// the interfaces to plug into it exported. The internals which readline
+// leaked (the RuneBuffer, Terminal and Operation) aren't reachable: a
+// KeyHandler edits the line through the Buffer interface, and the Config
+// holds the options of the applications but not the ones of the terminal
+// plumbing or of debugging. It's a package of the readline module, so it
+// always wraps the readline of the same release.
+//
+// example:
+//
+//	rl, err := lineedit.New("> ")
+//	if err != nil {
+//		panic(err)
+//	}
+//	defer rl.Close()
+//
+//	for {
+//		line, err := rl.Readline()
+//		if err != nil { // io.EOF or lineedit.ErrInterrupt
+//			break
+//		}
+//		println(line)
+//	}
+package lineedit
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/chzyer/readline"
+)
+
+var ErrInterrupt = readline.ErrInterrupt
+
+// ErrPasswordMismatch is returned by ReadPasswordConfirm.
+var ErrPasswordMismatch = readline.ErrPasswordMismatch
+
+// LineEditor reads lines interactively, it's implemented by *Instance.
+type LineEditor interface {
+	Readline() (string, error)
+	ReadlineWithDefault(what string) (string, error)
+	ReadPassword(prompt string) ([]byte, error)
+	SetPrompt(prompt string)
+	Refresh()
+	Write(b []byte) (int, error)
+	Close() error
+}
+
+// History is the history of the lines read by a LineEditor, it's
+// implemented by *Instance.
+type History interface {
+	SaveHistory(content string) error
+	ResetHistory()
+	HistoryDisable()
+	HistoryEnable()
+	PinHistory(content string, pinned bool) bool
+}
+
+// Buffer is the line being edited, as a KeyHandler sees it.
+type Buffer interface {
+	// Runes returns a copy of the line.
+	Runes() []rune
+	Pos() int
+	SetPos(pos int)
+	// Set replaces the line, with the cursor at its end.
+	Set(line []rune)
+	// SetWithIdx replaces the line, with the cursor at pos.
+	SetWithIdx(pos int, line []rune)
+	// WriteRunes inserts r at the cursor.
+	WriteRunes(r []rune)
+	// Abort abandons the line, like Ctrl-C.
+	Abort()
+}
+
+// KeyHandler is the action bound to a sequence of keys by BindKey. It
+// edits buf, and returns true to accept the line, like Enter.
+type KeyHandler func(buf Buffer) bool
+
+// lineBuffer hides the RuneBuffer of v1 behind a Buffer.
+type lineBuffer struct {
+	buf *readline.RuneBuffer
+}
+
+func (b lineBuffer) Runes() []rune                   { return b.buf.Runes() }
+func (b lineBuffer) Pos() int                        { return b.buf.Pos() }
+func (b lineBuffer) SetPos(pos int)                  { b.buf.SetPos(pos) }
+func (b lineBuffer) Set(line []rune)                 { b.buf.Set(line) }
+func (b lineBuffer) SetWithIdx(pos int, line []rune) { b.buf.SetWithIdx(pos, line) }
+func (b lineBuffer) WriteRunes(r []rune)             { b.buf.WriteRunes(r) }
+func (b lineBuffer) Abort()                          { b.buf.Abort() }
+
+// Instance is a LineEditor with a History.
+type Instance struct {
+	rl *readline.Instance
+
+	m   sync.Mutex
+	cfg *Config
+}
+
+var (
+	_ LineEditor = (*Instance)(nil)
+	_ History    = (*Instance)(nil)
+)
+
+func New(prompt string) (*Instance, error) {
+	return NewEx(&Config{Prompt: prompt})
+}
+
+func NewEx(cfg *Config) (*Instance, error) {
+	rl, err := readline.NewEx(cfg.config())
+	if err != nil {
+		return nil, err
+	}
+	return &Instance{rl: rl, cfg: cfg}, nil
+}
+
+func (i *Instance) Readline() (string, error) {
+	return i.rl.Readline()
+}
+
+// ReadlineContext is Readline, but it returns ctx.Err() when ctx is done
+// and the Instance can read the next line.
+func (i *Instance) ReadlineContext(ctx context.Context) (string, error) {
+	return i.rl.ReadlineContext(ctx)
+}
+
+// ReadlineNoHistory is Readline, but the line isn't saved in the history
+// and the history can't be recalled while it's edited.
+func (i *Instance) ReadlineNoHistory() (string, error) {
+	return i.rl.ReadlineNoHistory()
+}
+
+func (i *Instance) ReadlineWithDefault(what string) (string, error) {
+	return i.rl.ReadlineWithDefault(what)
+}
+
+func (i *Instance) ReadPassword(prompt string) ([]byte, error) {
+	return i.rl.ReadPassword(prompt)
+}
+
+// ReadPasswordConfirm reads a new password twice, see
+// Config.PasswordConfirmTries.
+func (i *Instance) ReadPasswordConfirm(prompt, confirmPrompt string) ([]byte, error) {
+	return i.rl.ReadPasswordConfirm(prompt, confirmPrompt)
+}
+
+// Config returns the config last given to NewEx or SetConfig, which the
+// setters like SetPrompt don't change. It must be changed by SetConfig.
+func (i *Instance) Config() *Config {
+	i.m.Lock()
+	defer i.m.Unlock()
+	return i.cfg
+}
+
+// SetConfig replaces the config from the next key on, and returns the
+// previous one. The line, the history and the fields of the config which
+// are given to NewEx only are kept.
+func (i *Instance) SetConfig(cfg *Config) *Config {
+	i.m.Lock()
+	defer i.m.Unlock()
+	next := *i.rl.Config
+	cfg.apply(&next)
+	setDefaults(&next)
+	i.rl.SetConfig(&next)
+	old := i.cfg
+	i.cfg = cfg
+	return old
+}
+
+func (i *Instance) SetPrompt(prompt string) {
+	i.rl.SetPrompt(prompt)
+}
+
+func (i *Instance) SetPromptSegments(segs ...PromptSegment) {
+	i.rl.SetPromptSegments(segs...)
+}
+
+// SetRightPrompt replaces the prompt drawn flush right, see
+// Config.RightPrompt.
+func (i *Instance) SetRightPrompt(prompt string) {
+	i.rl.SetRightPrompt(prompt)
+}
+
+// SetMaskRune changes the mask rune from the next key on, without
+// touching the line or the history.
+func (i *Instance) SetMaskRune(r rune) {
+	i.rl.SetMaskRune(r)
+}
+
+// SetCompleter changes the completer from the next key on.
+func (i *Instance) SetCompleter(c Completer) {
+	i.rl.SetCompleter(c)
+}
+
+// SetListener changes the listener from the next key on.
+func (i *Instance) SetListener(l Listener) {
+	i.rl.SetListener(l)
+}
+
+// SetTrainer turns Config.Trainer on or off.
+func (i *Instance) SetTrainer(on bool) {
+	i.rl.SetTrainer(on)
+}
+
+func (i *Instance) SetVimMode(on bool) {
+	i.rl.SetVimMode(on)
+}
+
+// PlayMacro replays the keyboard macro recorded with C-x ( and C-x ), as
+// C-x e does.
+func (i *Instance) PlayMacro() {
+	i.rl.PlayMacro()
+}
+
+func (i *Instance) IsVimMode() bool {
+	return i.rl.IsVimMode()
+}
+
+// BindKey makes the keys of sequence run handler while editing the line,
+// which can edit the buffer, accept the line or abandon it. The keys
+// which perform the actions of other keys per mode are bound with
+// Config.Keymaps and Config.Chords instead.
+func (i *Instance) BindKey(sequence []rune, handler KeyHandler) {
+	i.rl.BindKey(sequence, func(buf *readline.RuneBuffer) bool {
+		return handler(lineBuffer{buf})
+	})
+}
+
+// Unbind removes the handler bound to sequence by BindKey.
+func (i *Instance) Unbind(sequence []rune) {
+	i.rl.Unbind(sequence)
+}
+
+// Stdout returns a writer which prints above the line being edited.
+func (i *Instance) Stdout() io.Writer {
+	return i.rl.Stdout()
+}
+
+// Stderr is like Stdout.
+func (i *Instance) Stderr() io.Writer {
+	return i.rl.Stderr()
+}
+
+func (i *Instance) Write(b []byte) (int, error) {
+	return i.rl.Write(b)
+}
+
+// PrintAbovePrompt prints lines, e.g. a banner, to Stdout above the line
+// being edited, if there's one.
+func (i *Instance) PrintAbovePrompt(lines ...string) {
+	i.rl.PrintAbovePrompt(lines...)
+}
+
+// Refresh repaints the line.
+func (i *Instance) Refresh() {
+	i.rl.Refresh()
+}
+
+// BeginUpdate starts a batch of changes, e.g. SetPrompt and Refresh,
+// which are drawn at once by the matching EndUpdate.
+func (i *Instance) BeginUpdate() {
+	i.rl.BeginUpdate()
+}
+
+func (i *Instance) EndUpdate() {
+	i.rl.EndUpdate()
+}
+
+// Redraw repaints the line from scratch, for when the screen has been
+// messed up.
+func (i *Instance) Redraw() {
+	i.rl.Redraw()
+}
+
+// Clean erases the line from the screen.
+func (i *Instance) Clean() {
+	i.rl.Clean()
+}
+
+func (i *Instance) SaveHistory(content string) error {
+	return i.rl.SaveHistory(content)
+}
+
+func (i *Instance) ResetHistory() {
+	i.rl.ResetHistory()
+}
+
+func (i *Instance) SetHistoryPath(path string) {
+	i.rl.SetHistoryPath(path)
+}
+
+func (i *Instance) HistoryDisable() {
+	i.rl.HistoryDisable()
+}
+
+func (i *Instance) HistoryEnable() {
+	i.rl.HistoryEnable()
+}
+
+// State returns a snapshot of the line editor as of the last key.
+func (i *Instance) State() EditorState {
+	return i.rl.State()
+}
+
+// Origin returns where the line is drawn relative to the cursor, for the
+// Renderers which draw around it.
+func (i *Instance) Origin() LineOrigin {
+	return i.rl.Origin()
+}
+
+// GetHistory returns the lines saved in the history, the oldest first.
+func (i *Instance) GetHistory() []HistoryEntry {
+	return i.rl.GetHistory()
+}
+
+// PinHistory pins or unpins the latest history item which is content,
+// so that it survives HistoryLimit.
+func (i *Instance) PinHistory(content string, pinned bool) bool {
+	return i.rl.PinHistory(content, pinned)
+}
+
+// Page shows text in the built-in pager if it's longer than the screen,
+// it must be called from the callbacks such as the Listener.
+func (i *Instance) Page(text string) {
+	i.rl.Page(text)
+}
+
+// CaptureExitSignal closes the Instance on SIGINT, SIGTERM and so on.
+func (i *Instance) CaptureExitSignal() {
+	i.rl.CaptureExitSignal()
+}
+
+func (i *Instance) Close() error {
+	return i.rl.Close()
+}
@@ -0,0 +1,110 @@
+package lineedit
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// newTestInstance returns an Instance reading the keys written to w, on a
+// terminal of 80 columns. Both are closed when the test ends.
+func newTestInstance(t *testing.T) (*Instance, *io.PipeWriter) {
+	t.Helper()
+	r, w := io.Pipe()
+	rl, err := NewEx(&Config{
+		Stdin:          r,
+		Stdout:         ioutil.Discard,
+		FuncGetWidth:   func() int { return 80 },
+		FuncIsTerminal: func() bool { return true },
+		FuncMakeRaw:    func() error { return nil },
+		FuncExitRaw:    func() error { return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		w.Close()
+		rl.Close()
+	})
+	return rl, w
+}
+
+func TestBindKey(t *testing.T) {
+	rl, w := newTestInstance(t)
+
+	rl.BindKey([]rune{CharCtrlX, 'u'}, func(buf Buffer) bool {
+		buf.SetWithIdx(buf.Pos(), []rune(strings.ToUpper(string(buf.Runes()))))
+		return true
+	})
+	rl.BindKey([]rune{CharCtrlX, 'a'}, func(buf Buffer) bool {
+		buf.Abort()
+		return false
+	})
+
+	go w.Write([]byte("abc\x18u"))
+	if line, err := rl.Readline(); err != nil || line != "ABC" {
+		t.Fatal("result not expect", line, err)
+	}
+	go w.Write([]byte("abc\x18a"))
+	if line, err := rl.Readline(); err != ErrInterrupt {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestPlayMacro(t *testing.T) {
+	rl, w := newTestInstance(t)
+
+	go w.Write([]byte("\x18(ls\r\x18)\r"))
+	for _, expect := range []string{"ls", ""} {
+		if line, err := rl.Readline(); err != nil || line != expect {
+			t.Fatal("result not expect", line, err)
+		}
+	}
+	rl.PlayMacro()
+	if line, err := rl.Readline(); err != nil || line != "ls" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestSetters(t *testing.T) {
+	rl, w := newTestInstance(t)
+
+	rl.SetCompleter(NewPrefixCompleter(PcItem("hello")))
+	rl.SetMaskRune('*')
+	rl.SetTrainer(true)
+	rl.SetVimMode(true)
+	if !rl.IsVimMode() {
+		t.Fatal("vim mode not set")
+	}
+	rl.SetVimMode(false)
+	go w.Write([]byte("he\t\r"))
+	if line, err := rl.Readline(); err != nil || line != "hello " {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	rl, w := newTestInstance(t)
+
+	go w.Write([]byte("ls\r"))
+	if line, err := rl.Readline(); err != nil || line != "ls" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	cfg := *rl.Config()
+	cfg.Prompt = "$ "
+	cfg.AutoComplete = NewPrefixCompleter(PcItem("hello"))
+	if old := rl.SetConfig(&cfg); old.Prompt != "" {
+		t.Fatal("result not expect", old.Prompt)
+	}
+	if rl.Config() != &cfg {
+		t.Fatal("config not replaced")
+	}
+	go w.Write([]byte("he\t\r\x1b[A\x1b[A\r"))
+	for _, expect := range []string{"hello ", "ls"} {
+		if line, err := rl.Readline(); err != nil || line != expect {
+			t.Fatal("result not expect", line, err)
+		}
+	}
+}
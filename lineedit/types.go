@@ -0,0 +1,164 @@
+package lineedit
+
+import (
+	"github.com/chzyer/readline"
+)
+
+// Completer offers the candidates to complete the line with, see
+// Config.AutoComplete.
+type Completer = readline.AutoCompleter
+
+// Renderer changes how the line is displayed, e.g. to highlight it, see
+// Config.Painter.
+type Renderer = readline.Painter
+
+// Listener is told about every key, see Config.Listener.
+type Listener = readline.Listener
+
+// Suggester gives the suggestion drawn after the line, see
+// Config.Suggester.
+type Suggester = readline.Suggester
+
+type (
+	PrefixCompleter          = readline.PrefixCompleter
+	PrefixCompleterInterface = readline.PrefixCompleterInterface
+	DynamicCompleteFunc      = readline.DynamicCompleteFunc
+	DynamicChildrenFunc      = readline.DynamicChildrenFunc
+	PromptSegment            = readline.PromptSegment
+	Keymap                   = readline.Keymap
+	Chord                    = readline.Chord
+	CompleteListMode         = readline.CompleteListMode
+	Clipboard                = readline.Clipboard
+	OSC52Clipboard           = readline.OSC52Clipboard
+	NoopClipboard            = readline.NoopClipboard
+	PanicError               = readline.PanicError
+	Diagnostic               = readline.Diagnostic
+	StyleSpan                = readline.StyleSpan
+	Mode                     = readline.Mode
+	EditorState              = readline.EditorState
+	HistoryEntry             = readline.HistoryEntry
+	LineOrigin               = readline.LineOrigin
+	Candidate                = readline.Candidate
+	DescribedCompleter       = readline.DescribedCompleter
+	CompletionMatcher        = readline.CompletionMatcher
+	FilePathCompleter        = readline.FilePathCompleter
+	GlobCompleter            = readline.GlobCompleter
+	AsyncCompleter           = readline.AsyncCompleter
+)
+
+var (
+	NewPrefixCompleter = readline.NewPrefixCompleter
+	PcItem             = readline.PcItem
+	PcItemDynamic      = readline.PcItemDynamic
+	PcItemChildren     = readline.PcItemChildren
+	PcItemValues       = readline.PcItemValues
+	InputrcPath        = readline.InputrcPath
+	FuncSuggester      = readline.FuncSuggester
+
+	NewFilePathCompleter = readline.NewFilePathCompleter
+)
+
+const (
+	KeymapEmacs     = readline.KeymapEmacs
+	KeymapViInsert  = readline.KeymapViInsert
+	KeymapViCommand = readline.KeymapViCommand
+	KeymapSearch    = readline.KeymapSearch
+	KeymapMenu      = readline.KeymapMenu
+	KeymapBrowser   = readline.KeymapBrowser
+	KeymapPager     = readline.KeymapPager
+
+	CompleteListUnmodified  = readline.CompleteListUnmodified
+	CompleteListAmbiguous   = readline.CompleteListAmbiguous
+	CompleteListOnSecondTab = readline.CompleteListOnSecondTab
+
+	CompletionMatchPrefix    = readline.CompletionMatchPrefix
+	CompletionMatchFold      = readline.CompletionMatchFold
+	CompletionMatchSubstring = readline.CompletionMatchSubstring
+	CompletionMatchFuzzy     = readline.CompletionMatchFuzzy
+
+	ModeEmacs     = readline.ModeEmacs
+	ModeViInsert  = readline.ModeViInsert
+	ModeViCommand = readline.ModeViCommand
+	ModeSearch    = readline.ModeSearch
+	ModeComplete  = readline.ModeComplete
+	ModeMenu      = readline.ModeMenu
+	ModeBrowser   = readline.ModeBrowser
+	ModePager     = readline.ModePager
+)
+
+// the keys, for the Keymaps
+const (
+	CharLineStart = readline.CharLineStart
+	CharBackward  = readline.CharBackward
+	CharInterrupt = readline.CharInterrupt
+	CharDelete    = readline.CharDelete
+	CharLineEnd   = readline.CharLineEnd
+	CharForward   = readline.CharForward
+	CharBell      = readline.CharBell
+	CharCtrlH     = readline.CharCtrlH
+	CharTab       = readline.CharTab
+	CharCtrlJ     = readline.CharCtrlJ
+	CharKill      = readline.CharKill
+	CharCtrlL     = readline.CharCtrlL
+	CharEnter     = readline.CharEnter
+	CharNext      = readline.CharNext
+	CharPrev      = readline.CharPrev
+	CharBckSearch = readline.CharBckSearch
+	CharFwdSearch = readline.CharFwdSearch
+	CharTranspose = readline.CharTranspose
+	CharCtrlU     = readline.CharCtrlU
+	CharCtrlW     = readline.CharCtrlW
+	CharCtrlX     = readline.CharCtrlX
+	CharCtrlY     = readline.CharCtrlY
+	CharCtrlZ     = readline.CharCtrlZ
+	CharEsc       = readline.CharEsc
+	CharUndo      = readline.CharUndo
+	CharBackspace = readline.CharBackspace
+
+	MetaBackward      = readline.MetaBackward
+	MetaForward       = readline.MetaForward
+	MetaDelete        = readline.MetaDelete
+	MetaBackspace     = readline.MetaBackspace
+	MetaTranspose     = readline.MetaTranspose
+	MetaEnter         = readline.MetaEnter
+	MetaPushLine      = readline.MetaPushLine
+	MetaRevertLine    = readline.MetaRevertLine
+	MetaYankLastArg   = readline.MetaYankLastArg
+	MetaYankNthArg    = readline.MetaYankNthArg
+	MetaInsertComment = readline.MetaInsertComment
+	MetaTogglePin     = readline.MetaTogglePin
+	MetaBrowseHistory = readline.MetaBrowseHistory
+	MetaAddCursor     = readline.MetaAddCursor
+	MetaSetMark       = readline.MetaSetMark
+	MetaKillRectangle = readline.MetaKillRectangle
+	MetaYankRectangle = readline.MetaYankRectangle
+	MetaKillToken     = readline.MetaKillToken
+	MetaBackKillToken = readline.MetaBackKillToken
+	MetaRedo          = readline.MetaRedo
+	MetaYankPop       = readline.MetaYankPop
+	MetaPaste         = readline.MetaPaste
+	MetaPageUp        = readline.MetaPageUp
+	MetaPageDown      = readline.MetaPageDown
+	MetaStartMacro    = readline.MetaStartMacro
+	MetaEndMacro      = readline.MetaEndMacro
+	MetaPlayMacro     = readline.MetaPlayMacro
+
+	MetaUniversalArgument = readline.MetaUniversalArgument
+	MetaNegativeArgument  = readline.MetaNegativeArgument
+	MetaDigit0            = readline.MetaDigit0
+	MetaDigit1            = readline.MetaDigit1
+	MetaDigit2            = readline.MetaDigit2
+	MetaDigit3            = readline.MetaDigit3
+	MetaDigit4            = readline.MetaDigit4
+	MetaDigit5            = readline.MetaDigit5
+	MetaDigit6            = readline.MetaDigit6
+	MetaDigit7            = readline.MetaDigit7
+	MetaDigit8            = readline.MetaDigit8
+	MetaDigit9            = readline.MetaDigit9
+
+	MetaHistorySearchBackward = readline.MetaHistorySearchBackward
+	MetaHistorySearchForward  = readline.MetaHistorySearchForward
+
+	MetaMenuComplete         = readline.MetaMenuComplete
+	MetaMenuCompleteBackward = readline.MetaMenuCompleteBackward
+)
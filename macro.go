@@ -0,0 +1,57 @@
+package readline
+
+// opMacro is the keyboard macro: the keys typed between C-x ( and C-x ),
+// which C-x e replays as if they were typed again.
+type opMacro struct {
+	recording bool
+	// the keys being recorded, and the last macro
+	keys  []rune
+	macro []rune
+}
+
+// record records r if a macro is being recorded.
+func (o *opMacro) record(r rune) {
+	if o.recording {
+		o.keys = append(o.keys, r)
+	}
+}
+
+// handleMacro starts or ends the recording of the macro, or replays it. It
+// returns false if that can't be done, e.g. replaying it while it's being
+// recorded.
+func (o *Operation) handleMacro(r rune) bool {
+	m := &o.macro
+	switch r {
+	case MetaStartMacro:
+		if m.recording {
+			return false
+		}
+		m.recording, m.keys = true, m.keys[:0]
+	case MetaEndMacro:
+		if !m.recording {
+			return false
+		}
+		// without the keys which ended it
+		if n := len(m.keys) - o.bindings.size; n >= 0 {
+			m.keys = m.keys[:n]
+		}
+		m.recording, m.macro = false, runes.Copy(m.keys)
+	case MetaPlayMacro:
+		if m.recording || len(m.macro) == 0 {
+			return false
+		}
+		o.bindings.replay = append(runes.Copy(m.macro), o.bindings.replay...)
+	}
+	return true
+}
+
+// PlayMacro replays the keyboard macro, like C-x e.
+func (o *Operation) PlayMacro() {
+	o.updateConfig(func(*Config) {
+		if !o.handleMacro(MetaPlayMacro) {
+			o.t.Bell()
+		}
+	})
+	// the ioloop may be waiting for a key
+	o.t.wake()
+}
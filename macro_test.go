@@ -0,0 +1,46 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestMacro(t *testing.T) {
+	for _, c := range []struct {
+		vim    bool
+		input  string
+		expect string
+	}{
+		{false, "\x18(ab\x18)\x18e\x18e\r", "ababab"},
+		{false, "ab\x18(\x02\x02X\x18)\x18e\r", "XXab"},
+		// nothing to replay, or replayed while recording
+		{false, "a\x18e\x18(\x18e\x18)b\r", "ab"},
+		// the keys of the vi commands are replayed too
+		{true, "\x18(ab\x1b0fbxA\x18)\x18e\r", "aa"},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			VimMode: c.vim,
+		})
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Errorf("%q: result not expect %q %v", c.input, line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestPlayMacro(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+
+	// the macro goes on over the lines
+	go w.Write([]byte("\x18(ls\r\x18)\r"))
+	for _, expect := range []string{"ls", ""} {
+		if line, err := rl.Readline(); err != nil || line != expect {
+			t.Fatal("result not expect", line, err)
+		}
+	}
+	rl.PlayMacro()
+	if line, err := rl.Readline(); err != nil || line != "ls" {
+		t.Fatal("result not expect", line, err)
+	}
+}
@@ -0,0 +1,196 @@
+package readline
+
+import (
+	"sort"
+)
+
+// The multiple cursors are experimental: MetaAddCursor puts a cursor on
+// the next occurrence of the word under the cursor, then the keys which
+// type, delete or move by a character apply at all the cursors. Any other
+// key removes the extra cursors before performing its own action.
+
+const cursorStyle = "7"
+
+// HasCursors tells whether there are secondary cursors.
+func (r *RuneBuffer) HasCursors() bool {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.cursors) > 0
+}
+
+func (r *RuneBuffer) ClearCursors() {
+	r.Refresh(func() {
+		r.cursors = nil
+	})
+}
+
+// AddCursor puts a secondary cursor at the same offset in the next
+// occurrence of the word under the cursor, after the last cursor and
+// wrapping around. It returns false if there isn't.
+func (r *RuneBuffer) AddCursor() (success bool) {
+	r.Refresh(func() {
+		start, end := r.idx, r.idx
+		for start > 0 && !IsWordBreak(r.buf[start-1]) {
+			start--
+		}
+		for end < len(r.buf) && !IsWordBreak(r.buf[end]) {
+			end++
+		}
+		if start == end {
+			return
+		}
+		word, offset := r.buf[start:end], r.idx-start
+
+		taken := map[int]bool{r.idx: true}
+		last := r.idx
+		for _, c := range r.cursors {
+			taken[c] = true
+			if c > last {
+				last = c
+			}
+		}
+		n := len(r.buf)
+		for i := 1; i <= n; i++ {
+			p := (last - offset + i) % n
+			if p+len(word) > n || !runes.Equal(r.buf[p:p+len(word)], word) {
+				continue
+			}
+			if taken[p+offset] {
+				continue
+			}
+			r.cursors = append(r.cursors, p+offset)
+			success = true
+			return
+		}
+	})
+	return
+}
+
+// editAtCursors replaces buf[start:end] by text around each cursor, the
+// edits overlapping a previous one are skipped. The cursors end up after
+// the text.
+func (r *RuneBuffer) editAtCursors(edit func(pos int) (start, end int, text []rune)) {
+	r.Refresh(func() {
+		positions := append([]int{r.idx}, r.cursors...)
+		primary := r.idx
+		sort.Ints(positions)
+
+		var out []rune
+		last := 0
+		moved := make([]int, 0, len(positions))
+		newIdx := 0
+		for _, p := range positions {
+			start, end, text := edit(p)
+			if start >= last {
+				out = append(out, r.buf[last:start]...)
+				out = append(out, text...)
+				last = end
+			}
+			if p == primary {
+				newIdx = len(out)
+			} else {
+				moved = append(moved, len(out))
+			}
+		}
+		r.buf = append(out, r.buf[last:]...)
+		r.idx = newIdx
+		r.cursors = dedupCursors(moved, newIdx)
+	})
+}
+
+func (r *RuneBuffer) WriteRuneAtCursors(ch rune) {
+	r.editAtCursors(func(p int) (int, int, []rune) {
+		return p, p, []rune{ch}
+	})
+}
+
+func (r *RuneBuffer) BackspaceAtCursors() {
+	r.editAtCursors(func(p int) (int, int, []rune) {
+		if p == 0 {
+			return p, p, nil
+		}
+		return p - 1, p, nil
+	})
+}
+
+func (r *RuneBuffer) DeleteAtCursors() {
+	n := r.Len()
+	r.editAtCursors(func(p int) (int, int, []rune) {
+		if p == n {
+			return p, p, nil
+		}
+		return p, p + 1, nil
+	})
+}
+
+// MoveCursors moves all the cursors by delta runes.
+func (r *RuneBuffer) MoveCursors(delta int) {
+	r.Refresh(func() {
+		clamp := func(p int) int {
+			p += delta
+			if p < 0 {
+				return 0
+			} else if p > len(r.buf) {
+				return len(r.buf)
+			}
+			return p
+		}
+		r.idx = clamp(r.idx)
+		for i := range r.cursors {
+			r.cursors[i] = clamp(r.cursors[i])
+		}
+		r.cursors = dedupCursors(r.cursors, r.idx)
+	})
+}
+
+// dedupCursors drops the secondary cursors which have run into another
+// one or the primary one at idx.
+func dedupCursors(cursors []int, idx int) []int {
+	seen := map[int]bool{idx: true}
+	ret := cursors[:0]
+	for _, c := range cursors {
+		if !seen[c] {
+			seen[c] = true
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// cursorSpans marks the secondary cursors for paint.
+func (r *RuneBuffer) cursorSpans() []Diagnostic {
+	var spans []Diagnostic
+	for _, c := range r.cursors {
+		if c < len(r.buf) {
+			spans = append(spans, Diagnostic{Start: c, End: c + 1, Style: cursorStyle})
+		}
+	}
+	return spans
+}
+
+// handleMultiCursor performs the key at all the cursors, it returns false
+// if it's not such a key, after removing the secondary cursors.
+func (o *Operation) handleMultiCursor(r rune) bool {
+	switch r {
+	case MetaAddCursor:
+		return false
+	case CharBackspace, CharCtrlH:
+		o.buf.BackspaceAtCursors()
+	case CharDelete:
+		o.t.KickRead()
+		o.buf.DeleteAtCursors()
+	case CharBackward:
+		o.buf.MoveCursors(-1)
+	case CharForward:
+		o.buf.MoveCursors(1)
+	case CharBell:
+		o.buf.ClearCursors()
+	default:
+		if !IsPrintable(r) {
+			o.buf.ClearCursors()
+			return false
+		}
+		o.buf.WriteRuneAtCursors(r)
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestMultiCursorEdits(t *testing.T) {
+	cfg := &Config{Painter: &defaultPainter{}, FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(nil, "", cfg, 80)
+	rb.SetWithIdx(6, []rune("cp foo foo.bak foo"))
+	if !rb.AddCursor() || !rb.AddCursor() || rb.AddCursor() {
+		t.Fatal("cursors not expect", rb.cursors)
+	}
+
+	rb.WriteRuneAtCursors('2')
+	if string(rb.buf) != "cp foo2 foo2.bak foo2" || rb.idx != 7 {
+		t.Fatal("result not expect", string(rb.buf), rb.idx, rb.cursors)
+	}
+	rb.BackspaceAtCursors()
+	rb.MoveCursors(-1)
+	if string(rb.buf) != "cp foo foo.bak foo" || rb.idx != 5 {
+		t.Fatal("result not expect", string(rb.buf), rb.idx, rb.cursors)
+	}
+	if got := string(rb.paint()); got != "cp foo fo\033[7mo\033[0m.bak fo\033[7mo\033[0m" {
+		t.Fatalf("result not expect %q", got)
+	}
+
+	// running into the primary cursor
+	rb.MoveCursors(-99)
+	if rb.idx != 0 || len(rb.cursors) != 0 {
+		t.Fatal("cursors not expect", rb.idx, rb.cursors)
+	}
+}
+
+func TestMultiCursor(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		MultiCursor: true,
+	})
+
+	// the cursors are gone after Ctrl-A
+	go w.Write([]byte("a=1 a\x1bn\x7fb\x01x\r"))
+	if line, err := rl.Readline(); err != nil || line != "xb=1 b" {
+		t.Fatal("result not expect", line, err)
+	}
+}
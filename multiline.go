@@ -0,0 +1,163 @@
+package readline
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The line may hold newlines, inserted by M-Enter with Config.MultiLine,
+// by Enter while Config.FuncIsComplete returns false, or pasted. The rows
+// after a newline begin with Config.ContinuationPrompt, and the cursor is
+// placed by its row and column rather than by backspaces. The lines
+// without newlines are drawn as before.
+
+// rowCol is where a position of the line is drawn, the rows are counted
+// from the one of the prompt.
+type rowCol struct {
+	row, col int
+}
+
+// multiline tells whether the line is drawn by rows.
+func (r *RuneBuffer) multiline() bool {
+	return r.width > 0 && !r.cfg.EnableMask && runes.Index('\n', r.buf) >= 0
+}
+
+// continuationPrompt returns Config.ContinuationPrompt and its width.
+func (r *RuneBuffer) continuationPrompt() (string, int) {
+	prompt := r.cfg.ContinuationPrompt
+	return prompt, runes.WidthAll(runes.ColorFilter([]rune(prompt)))
+}
+
+// layout returns where each position of the line is drawn, up to the end
+// of the line. A row which fills the width wraps to the next one, where a
+// newline right after it doesn't start another row. The positions are
+// overwritten by the next call.
+func (r *RuneBuffer) layout() []rowCol {
+	_, contWidth := r.continuationPrompt()
+	if cap(r.positions) < len(r.buf)+1 {
+		r.positions = make([]rowCol, len(r.buf)+1, 2*len(r.buf)+1)
+	}
+	pos := r.positions[:len(r.buf)+1]
+	row, col, wrapped := 0, r.promptLen(), false
+	pos[0] = rowCol{row, col}
+	for i, c := range r.buf {
+		if c == '\n' {
+			if !wrapped {
+				row++
+			}
+			col, wrapped = contWidth, false
+		} else {
+			col += runes.Width(c)
+			wrapped = col >= r.width
+			if wrapped {
+				row, col = row+1, 0
+			}
+		}
+		pos[i+1] = rowCol{row, col}
+	}
+	return pos
+}
+
+// rowsOutput draws the painted line, the newlines start the rows with the
+// continuation prompt. The cursor is left at the end of the line.
+func (r *RuneBuffer) rowsOutput(painted []rune, pos []rowCol) []byte {
+	cont, _ := r.continuationPrompt()
+	var newlines []int
+	for i, c := range r.buf {
+		if c == '\n' {
+			newlines = append(newlines, i)
+		}
+	}
+
+	var buf []byte
+	for _, e := range painted {
+		switch e {
+		case '\t':
+			buf = append(buf, strings.Repeat(" ", TabWidth)...)
+		case '\n':
+			if len(newlines) > 0 && pos[newlines[0]+1].row == pos[newlines[0]].row {
+				// the row wrapped already, the cursor is moved there
+				// unless the terminal did
+				if !isWindows {
+					buf = append(buf, " \b"...)
+				}
+			} else {
+				buf = append(buf, '\n')
+			}
+			if len(newlines) > 0 {
+				newlines = newlines[1:]
+			}
+			buf = append(buf, cont...)
+		default:
+			buf = append(buf, string(e)...)
+		}
+	}
+	return buf
+}
+
+// cursorOutput moves the cursor from the end of the line to its position.
+func (r *RuneBuffer) cursorOutput(pos []rowCol) []byte {
+	end, cur := pos[len(r.buf)], pos[r.idx]
+	if end == cur {
+		return nil
+	}
+	var buf []byte
+	if up := end.row - cur.row; up > 0 {
+		buf = append(buf, "\033["+strconv.Itoa(up)+"A"...)
+	}
+	buf = append(buf, '\r')
+	if cur.col > 0 {
+		buf = append(buf, "\033["+strconv.Itoa(cur.col)+"C"...)
+	}
+	return buf
+}
+
+// rowBounds returns the start and the end of the row of the line, between
+// newlines, which holds the position idx.
+func (r *RuneBuffer) rowBounds(idx int) (start, end int) {
+	start, end = idx, idx
+	for start > 0 && r.buf[start-1] != '\n' {
+		start--
+	}
+	for end < len(r.buf) && r.buf[end] != '\n' {
+		end++
+	}
+	return start, end
+}
+
+// MoveRow moves the cursor to the previous row of the line if delta is
+// negative, else the next one, at the same width from the start of the
+// row if it's long enough. It returns false if there isn't such a row.
+func (r *RuneBuffer) MoveRow(delta int) bool {
+	r.Lock()
+	start, end := r.rowBounds(r.idx)
+	if delta < 0 && start == 0 || delta >= 0 && end == len(r.buf) {
+		r.Unlock()
+		return false
+	}
+	r.Unlock()
+
+	r.Refresh(func() {
+		start, end := r.rowBounds(r.idx)
+		width := runes.WidthAll(r.buf[start:r.idx])
+		if delta < 0 {
+			start, end = r.rowBounds(start - 1)
+		} else {
+			start, end = r.rowBounds(end + 1)
+		}
+		idx := start
+		for idx < end && runes.Width(r.buf[idx]) <= width {
+			width -= runes.Width(r.buf[idx])
+			idx++
+		}
+		r.idx = idx
+	})
+	return true
+}
+
+// isComplete tells whether Enter accepts the line, see
+// Config.FuncIsComplete.
+func (o *Operation) isComplete() bool {
+	isComplete := o.GetConfig().FuncIsComplete
+	return isComplete == nil || isComplete(o.buf.Runes())
+}
@@ -0,0 +1,66 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMultiLineLayout(t *testing.T) {
+	cfg := &Config{ContinuationPrompt: "..", FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(nil, "> ", cfg, 10)
+	for _, c := range []struct {
+		line   string
+		expect rowCol
+		edge   bool
+	}{
+		{"abc\ndefghijkl\nx", rowCol{3, 3}, false},
+		// the newline after a full row doesn't start another one
+		{"abcdefgh\nx", rowCol{1, 3}, false},
+		{"a\nbcdefghi", rowCol{2, 0}, true},
+	} {
+		rb.Set([]rune(c.line))
+		if !rb.multiline() {
+			t.Fatalf("%q: not multiline", c.line)
+		}
+		pos := rb.layout()
+		if got := pos[len(pos)-1]; got != c.expect || rb.isInLineEdge() != c.edge {
+			t.Fatalf("%q: expect %v, got %v", c.line, c.expect, got)
+		}
+	}
+}
+
+func TestMultiLine(t *testing.T) {
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Stdout:             out,
+		Prompt:             "> ",
+		ContinuationPrompt: "... ",
+		MultiLine:          true,
+		FuncIsComplete: func(line []rune) bool {
+			return strings.Count(string(line), "(") <= strings.Count(string(line), ")")
+		},
+	})
+
+	for _, c := range []struct {
+		input  string
+		expect string
+	}{
+		{"a\033\rb\r", "a\nb"},
+		{"(a\rb)\r", "(a\nb)"},
+		// Up and Down move between the rows, at the same width
+		{"ab\033\rcd\033[AX\033[BY\r", "abX\ncdY"},
+		// then through the history from the first row
+		{"x\033\ry\033[A\033[A\r", "abX\ncdY"},
+	} {
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+	}
+	if !strings.Contains(out.String(), "> a\n... b") {
+		t.Fatalf("rows not drawn: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "> ab\n... cd\033[1A\r\033[4C") {
+		t.Fatalf("cursor not moved: %q", out.String())
+	}
+}
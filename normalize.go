@@ -0,0 +1,76 @@
+package readline
+
+import (
+	"unicode"
+)
+
+// FoldCase folds the case of r, it's the normalization of
+// Config.FuncNormalize by default.
+func FoldCase(r rune) rune {
+	// ToUpper first, so that e.g. ſ and s or K (Kelvin) and k match
+	return unicode.ToLower(unicode.ToUpper(r))
+}
+
+// FoldDiacritics folds the case of r and strips its diacritic, for
+// Config.FuncNormalize: "cafe" matches "Café".
+func FoldDiacritics(r rune) rune {
+	return FoldCase(StripDiacritic(r))
+}
+
+// searchNormalizer returns how the history search compares the runes:
+// nil compares them as they are.
+func (c *Config) searchNormalizer() func(rune) rune {
+	switch {
+	case c.FuncNormalize != nil:
+		return c.FuncNormalize
+	case c.HistorySearchFold:
+		return FoldCase
+	}
+	return nil
+}
+
+// completionNormalizer returns how the completion matching compares the
+// runes, see CompletionMatcher.
+func (c *Config) completionNormalizer() func(rune) rune {
+	if c.FuncNormalize != nil {
+		return c.FuncNormalize
+	}
+	return FoldCase
+}
+
+func equalNorm(a, b rune, norm func(rune) rune) bool {
+	return a == b || norm != nil && norm(a) == norm(b)
+}
+
+func hasPrefixNorm(r, prefix []rune, norm func(rune) rune) bool {
+	if len(r) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if !equalNorm(r[i], prefix[i], norm) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexNorm returns the index of the first sub in r, comparing the runes
+// normalized by norm, or -1.
+func indexNorm(r, sub []rune, norm func(rune) rune) int {
+	for i := 0; i+len(sub) <= len(r); i++ {
+		if hasPrefixNorm(r[i:], sub, norm) {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexBckNorm is indexNorm searching from the end.
+func indexBckNorm(r, sub []rune, norm func(rune) rune) int {
+	for i := len(r) - len(sub); i >= 0; i-- {
+		if hasPrefixNorm(r[i:], sub, norm) {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,13 +1,24 @@
 package readline
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"io"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 var (
 	ErrInterrupt = errors.New("Interrupt")
+	// returned by ReadPasswordConfirm when the passwords don't match
+	// after all the tries
+	ErrPasswordMismatch = errors.New("passwords don't match")
 )
 
 type InterruptError struct {
@@ -18,6 +29,21 @@ func (*InterruptError) Error() string {
 	return "Interrupted"
 }
 
+// PanicError is returned by Readline if the input loop recovered from a
+// panic, which is reported to Config.FuncOnPanic as well.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("readline: recovered from panic: %v", e.Value)
+}
+
+// Operation runs the line editor.
+//
+// Deprecated: it's an internal of the Instance, which isn't exported by
+// github.com/chzyer/readline/lineedit.
 type Operation struct {
 	m       sync.Mutex
 	cfg     *Config
@@ -25,11 +51,41 @@ type Operation struct {
 	buf     *RuneBuffer
 	outchan chan []rune
 	errchan chan error
-	w       io.Writer
+	// the ioloop abandoned the line after the Terminal was cancelled,
+	// see RunesContext
+	cancelled chan struct{}
+	w         io.Writer
 
-	history *opHistory
+	history    *opHistory
+	transcript *transcript
+	clipboard  Clipboard
+	// the inputs pushed for the next prompts, it's a stack
+	pushed   [][]rune
+	yankArgs opYankArg
+	// the last key killed, the kills of the next one join it
+	killed bool
+	// the key sequences bound to handlers, and the ones of the chords
+	// being typed, see BindKey
+	bindings opBindings
+	// the changes of the setters, which the ioloop applies before the
+	// next key so that they don't race with it
+	updates []func(*Config)
+	// what the ioloop draws again, as the screen was resized or written
+	// to from another goroutine, see redrawPending
+	pendingResize, pendingRedraw, pendingModes bool
+	// the snapshot for State, taken by the ioloop
+	state EditorState
+	// the copy of the Config read on every key, see keyConfig
+	keyCfg Config
+	// the numeric argument of the next key, e.g. M-3
+	argument opArgument
+	// the keys pressed in a row, see Config.Trainer
+	trainer opTrainer
+	macro   opMacro
 	*opSearch
 	*opCompleter
+	*opBrowser
+	*opPager
 	*opPassword
 	*opVim
 }
@@ -48,42 +104,43 @@ func (w *wrapWriter) Write(b []byte) (int, error) {
 	if !w.t.IsReading() {
 		return w.target.Write(b)
 	}
+	n, drawn, err := w.r.buf.PrintAbove(w.target, b)
+	if drawn {
+		w.r.redrawLater(&w.r.pendingModes)
+	}
+	return n, err
+}
 
-	var (
-		n   int
-		err error
-	)
-	w.r.buf.Refresh(func() {
-		n, err = w.target.Write(b)
-	})
-
-	if w.r.IsSearchMode() {
-		w.r.SearchRefresh(-1)
+// refreshModes draws again what the search and the completion modes show
+// under the line.
+func (o *Operation) refreshModes() {
+	if o.IsSearchMode() {
+		o.SearchRefresh(-1)
 	}
-	if w.r.IsInCompleteMode() {
-		w.r.CompleteRefresh()
+	if o.IsInCompleteMode() {
+		o.CompleteRefresh()
 	}
-	return n, err
 }
 
 func NewOperation(t *Terminal, cfg *Config) *Operation {
 	width := cfg.FuncGetWidth()
 	op := &Operation{
-		t:       t,
-		buf:     NewRuneBuffer(t, cfg.Prompt, cfg, width),
-		outchan: make(chan []rune),
-		errchan: make(chan error, 1),
+		t:         t,
+		buf:       NewRuneBuffer(t, cfg.Prompt, cfg, width),
+		outchan:   make(chan []rune),
+		errchan:   make(chan error, 1),
+		cancelled: make(chan struct{}, 1),
 	}
 	op.w = op.buf.w
+	op.buf.meter = &t.latency
 	op.SetConfig(cfg)
 	op.opVim = newVimMode(op)
 	op.opCompleter = newOpCompleter(op.buf.w, op, width)
+	op.opBrowser = newOpBrowser(op.buf.w, op)
+	op.opPager = newOpPager(op.buf.w, op)
 	op.opPassword = newOpPassword(op)
 	op.cfg.FuncOnWidthChanged(func() {
-		newWidth := cfg.FuncGetWidth()
-		op.opCompleter.OnWidthChange(newWidth)
-		op.opSearch.OnWidthChange(newWidth)
-		op.buf.OnWidthChange(newWidth)
+		op.redrawLater(&op.pendingResize)
 	})
 	go op.ioloop()
 	return op
@@ -93,8 +150,67 @@ func (o *Operation) SetPrompt(s string) {
 	o.buf.SetPrompt(s)
 }
 
+func (o *Operation) SetPromptSegments(segs []PromptSegment) {
+	o.buf.SetPromptSegments(segs)
+}
+
+func (o *Operation) SetRightPrompt(s string) {
+	o.buf.SetRightPrompt(s)
+}
+
+// SetMaskRune changes Config.MaskRune from the next key on.
 func (o *Operation) SetMaskRune(r rune) {
-	o.buf.SetMask(r)
+	o.updateConfig(func(*Config) {
+		o.buf.SetMask(r)
+	})
+}
+
+// SetVimMode switches the vim mode at once, the line is back in the
+// insert mode from the next key on.
+func (o *Operation) SetVimMode(on bool) {
+	o.m.Lock()
+	off := o.cfg.VimMode && !on
+	o.cfg.VimMode = on
+	o.opVim.setEnabled(on)
+	o.m.Unlock()
+	o.t.setVimMode(on)
+	o.updateConfig(func(*Config) {
+		if off {
+			o.opVim.ExitVimMode()
+		}
+		o.vimMode = VIM_INSERT
+	})
+}
+
+// SetCompleter changes Config.AutoComplete from the next key on.
+func (o *Operation) SetCompleter(c AutoCompleter) {
+	o.updateConfig(func(cfg *Config) {
+		cfg.AutoComplete = c
+	})
+}
+
+// SetListener changes Config.Listener from the next key on.
+func (o *Operation) SetListener(l Listener) {
+	o.updateConfig(func(cfg *Config) {
+		cfg.Listener = l
+	})
+}
+
+func (o *Operation) updateConfig(f func(*Config)) {
+	o.m.Lock()
+	o.updates = append(o.updates, f)
+	o.m.Unlock()
+}
+
+func (o *Operation) applyUpdates() {
+	o.m.Lock()
+	updates := o.updates
+	o.updates = nil
+	cfg := o.cfg
+	o.m.Unlock()
+	for _, f := range updates {
+		f(cfg)
+	}
 }
 
 func (o *Operation) GetConfig() *Config {
@@ -104,15 +220,77 @@ func (o *Operation) GetConfig() *Config {
 	return &cfg
 }
 
+// keyConfig is GetConfig for what the ioloop does on every key: the Config
+// is copied into the same struct every time rather than a new one, which
+// is only valid until the next call and only for the ioloop.
+func (o *Operation) keyConfig() *Config {
+	o.m.Lock()
+	o.keyCfg = *o.cfg
+	o.m.Unlock()
+	return &o.keyCfg
+}
+
+// acceptLine ends the line being edited, below which the next prompt is
+// drawn, saves it in the history and returns it.
+func (o *Operation) acceptLine(cfg *Config) []rune {
+	o.buf.MoveToLineEnd()
+	var data []rune
+	if !cfg.UniqueEditLine {
+		o.buf.WriteRune('\n')
+		data = o.buf.Reset()
+		data = data[:len(data)-1] // trim \n
+	} else {
+		o.buf.Clean()
+		data = o.buf.Reset()
+	}
+	// the history is saved before the line is returned, the caller may
+	// switch it then, e.g. after a password
+	if !cfg.DisableAutoSaveHistory {
+		// ignore IO error
+		_ = o.history.New(data)
+	}
+	return data
+}
+
 func (o *Operation) ioloop() {
+	defer o.recoverLoop()
 	for {
 		keepInSearchMode := false
 		keepInCompleteMode := false
-		r := o.t.ReadRune()
+		o.updateState(nil)
+		r, replayed := o.nextKey()
+		if r == keyWake {
+			// e.g. PlayMacro
+			o.applyUpdates()
+			// the candidates of an AsyncCompleter came, in place of "…"
+			o.buf.Refresh(nil)
+			ok := o.ResumeAsync()
+			if !ok {
+				o.t.Bell()
+			}
+			o.endKey(false, ok, true)
+			continue
+		}
+		o.CancelAsync()
+		if r == keyCancel {
+			o.cancelLine()
+			continue
+		}
+		if r == keyRedraw {
+			o.redrawPending()
+			continue
+		}
+		o.applyUpdates()
+		cfg := o.keyConfig()
+		start := time.Now()
+		o.t.latency.take()
+		if !replayed {
+			o.recordKey(r)
+		}
 
-		if o.GetConfig().FuncFilterInputRune != nil {
+		if filter := cfg.FuncFilterInputRune; filter != nil && !replayed {
 			var process bool
-			r, process = o.GetConfig().FuncFilterInputRune(r)
+			r, process = filter(r)
 			if !process {
 				o.t.KickRead()
 				o.buf.Refresh(nil) // to refresh the line
@@ -120,6 +298,58 @@ func (o *Operation) ioloop() {
 			}
 		}
 
+		if !replayed {
+			o.macro.record(r)
+		}
+
+		var action rune
+		var bound, ok bool
+		if r, action, bound, ok = o.sequenceKey(r); !ok {
+			continue
+		}
+
+		viAction := false
+		if r != 0 {
+			if !bound {
+				action, bound = o.mapKey(r)
+			}
+			if bound {
+				if action == 0 {
+					o.t.KickRead()
+					continue
+				}
+				if stopsReading(r) && !stopsReading(action) {
+					o.t.KickRead()
+				}
+				r = action
+				viAction = o.editMode() == ModeViCommand && bypassesVi(action)
+			}
+		}
+
+		if o.IsPagerMode() {
+			if r != 0 {
+				o.HandlePager(r)
+				continue
+			}
+			o.ExitPager()
+		}
+
+		if o.IsHistoryBrowserMode() {
+			if r != 0 {
+				o.HandleHistoryBrowser(r)
+				continue
+			}
+			o.ExitHistoryBrowser()
+		}
+
+		if o.IsInCompleteQuery() {
+			if r != 0 {
+				o.HandleCompleteQuery(r)
+				continue
+			}
+			o.ExitCompleteMode(false)
+		}
+
 		if r == 0 { // io.EOF
 			if o.buf.Len() == 0 {
 				o.buf.Clean()
@@ -135,6 +365,9 @@ func (o *Operation) ioloop() {
 			}
 		}
 		isUpdateHistory := true
+		kills := o.buf.kills
+		o.buf.SetAppendKill(o.killed)
+		o.killed = false
 
 		if o.IsInCompleteSelectMode() {
 			keepInCompleteMode = o.HandleCompleteSelect(r)
@@ -150,18 +383,53 @@ func (o *Operation) ioloop() {
 			case CharInterrupt:
 				o.t.KickRead()
 				fallthrough
-			case CharBell:
+			case CharBell, CharEsc:
 				continue
 			}
 		}
 
-		if o.IsEnableVimMode() {
-			r = o.HandleVim(r, o.t.ReadRune)
+		if r == CharEsc && o.IsInCompleteMode() {
+			// cancels the listing like the menu, even in vi insert mode
+			o.ExitCompleteMode(true)
+			o.buf.Refresh(nil)
+			continue
+		}
+
+		if o.buf.HasCursors() {
+			if o.editMode() == ModeViCommand {
+				o.buf.ClearCursors()
+			} else if o.handleMultiCursor(r) {
+				o.endKey(false, false, true)
+				continue
+			}
+		}
+
+		if o.IsEnableVimMode() && r != MetaPaste && !viAction {
+			r = o.HandleVim(r, o.vimReader(r))
 			if r == 0 {
 				continue
 			}
 		}
 
+		count, ok := o.argumentKey(r)
+		if !ok {
+			continue
+		}
+		if r, count = o.repeatedKey(r, count); count == 0 {
+			continue
+		}
+		if count > 1 {
+			// drawn once
+			o.buf.BeginUpdate(true)
+		}
+
+		if r != MetaYankLastArg && r != MetaYankNthArg {
+			o.yankArgs.reset()
+		}
+		if r != CharCtrlY && r != MetaYankPop {
+			o.buf.ResetYank()
+		}
+
 		switch r {
 		case CharBell:
 			if o.IsSearchMode() {
@@ -172,12 +440,21 @@ func (o *Operation) ioloop() {
 				o.ExitCompleteMode(true)
 				o.buf.Refresh(nil)
 			}
-		case CharTab:
-			if o.GetConfig().AutoComplete == nil {
+		case CharTab, MetaMenuComplete, MetaMenuCompleteBackward:
+			if cfg.AutoComplete == nil {
 				o.t.Bell()
 				break
 			}
-			if o.OnComplete() {
+			var ok bool
+			switch {
+			case r == MetaMenuCompleteBackward:
+				ok = o.OnMenuComplete(-1)
+			case r == MetaMenuComplete || cfg.MenuComplete:
+				ok = o.OnMenuComplete(1)
+			default:
+				ok = o.OnComplete()
+			}
+			if ok {
 				keepInCompleteMode = true
 			} else {
 				o.t.Bell()
@@ -191,7 +468,7 @@ func (o *Operation) ioloop() {
 			}
 			keepInSearchMode = true
 		case CharCtrlU:
-			o.buf.KillFront()
+			o.repeat(count, o.buf.KillFront)
 		case CharFwdSearch:
 			if !o.SearchMode(S_DIR_FWD) {
 				o.t.Bell()
@@ -199,20 +476,22 @@ func (o *Operation) ioloop() {
 			}
 			keepInSearchMode = true
 		case CharKill:
-			o.buf.Kill()
+			o.repeat(count, o.buf.Kill)
 			keepInCompleteMode = true
 		case MetaForward:
-			o.buf.MoveToNextWord()
+			o.repeat(count, o.buf.MoveToNextWord)
 		case CharTranspose:
 			o.buf.Transpose()
 		case MetaBackward:
-			o.buf.MoveToPrevWord()
+			o.repeat(count, func() { o.buf.MoveToPrevWord() })
 		case MetaDelete:
-			o.buf.DeleteWord()
+			o.repeat(count, o.buf.DeleteWord)
 		case CharLineStart:
 			o.buf.MoveToLineStart()
 		case CharLineEnd:
-			o.buf.MoveToLineEnd()
+			if !o.buf.AcceptSuggestion() {
+				o.buf.MoveToLineEnd()
+			}
 		case CharBackspace, CharCtrlH:
 			if o.IsSearchMode() {
 				o.SearchBackspace()
@@ -224,7 +503,7 @@ func (o *Operation) ioloop() {
 				o.t.Bell()
 				break
 			}
-			o.buf.Backspace()
+			o.repeat(count, o.buf.Backspace)
 			if o.IsInCompleteMode() {
 				o.OnComplete()
 			}
@@ -233,69 +512,201 @@ func (o *Operation) ioloop() {
 			o.t.SleepToResume()
 			o.Refresh()
 		case CharCtrlL:
-			ClearScreen(o.w)
-			o.Refresh()
+			o.clearScreen()
 		case MetaBackspace, CharCtrlW:
-			o.buf.BackEscapeWord()
+			o.repeat(count, o.buf.BackEscapeWord)
+		case MetaKillToken:
+			o.buf.KillToken(cfg.Lexer)
+		case MetaBackKillToken:
+			o.buf.BackKillToken(cfg.Lexer)
 		case CharCtrlY:
+			if cfg.BridgeClipboard {
+				if text, err := o.getClipboard().Read(); err == nil {
+					o.buf.WriteString(text)
+					break
+				}
+			}
 			o.buf.Yank()
+		case MetaYankPop:
+			if !o.buf.YankPop() {
+				o.t.Bell()
+			}
+		case MetaEnter:
+			if cfg.MultiLine && !o.IsSearchMode() {
+				o.buf.WriteRune('\n')
+				break
+			}
+			// accept the text before the cursor only, the rest is
+			// restored in the next prompt
+			if o.IsSearchMode() {
+				o.ExitSearchMode(false)
+			}
+			line, pos := o.buf.Runes(), o.buf.Pos()
+			o.pushed = append(o.pushed, runes.Copy(line[pos:]))
+			o.buf.Set(line[:pos])
+			fallthrough
 		case CharEnter, CharCtrlJ:
 			if o.IsSearchMode() {
 				o.ExitSearchMode(false)
 			}
-			o.buf.MoveToLineEnd()
-			var data []rune
-			if !o.GetConfig().UniqueEditLine {
+			if r != MetaEnter && !o.isComplete() {
+				o.t.KickRead()
 				o.buf.WriteRune('\n')
-				data = o.buf.Reset()
-				data = data[:len(data)-1] // trim \n
-			} else {
-				o.buf.Clean()
-				data = o.buf.Reset()
+				break
+			}
+			if cfg.HistoryExpand && !o.expandHistory() {
+				o.t.KickRead()
+				break
 			}
-			o.outchan <- data
-			if !o.GetConfig().DisableAutoSaveHistory {
-				// ignore IO error
-				_ = o.history.New(data)
+			data := o.acceptLine(cfg)
+			isUpdateHistory = false
+			if cfg.ExpandEnv {
+				o.outchan <- []rune(ExpandEnv(string(data), cfg.FuncEnviron))
 			} else {
-				isUpdateHistory = false
+				o.outchan <- data
+			}
+		case MetaInsertComment:
+			// shelve the line in the history as a comment, without
+			// returning it
+			if o.IsSearchMode() {
+				o.ExitSearchMode(false)
+			}
+			o.buf.Set(append([]rune(cfg.CommentBegin), o.buf.Runes()...))
+			o.acceptLine(cfg)
+			o.buf.Refresh(nil) // print a new prompt
+		case MetaYankLastArg, MetaYankNthArg:
+			o.yankArg(r)
+		case MetaRevertLine:
+			// the edits of the recalled items are kept until the line is
+			// accepted, revert those of the current one
+			o.buf.Set(o.history.Source())
+		case MetaBrowseHistory:
+			if o.IsSearchMode() {
+				o.ExitSearchMode(false)
+			}
+			if o.IsInCompleteMode() {
+				o.ExitCompleteMode(true)
+				o.buf.Refresh(nil)
+			}
+			if !o.HistoryBrowserMode() {
+				o.t.Bell()
+			}
+		case MetaStartMacro, MetaEndMacro, MetaPlayMacro:
+			if !o.handleMacro(r) {
+				o.t.Bell()
+			}
+		case MetaSetMark:
+			o.buf.SetMark()
+		case MetaPaste:
+			text := o.t.Paste()
+			if cfg.FilterControls {
+				text = stripControls(text)
+			}
+			if o.IsSearchMode() {
+				for _, e := range text {
+					o.SearchChar(e)
+				}
+				keepInSearchMode = true
+				break
+			}
+			o.buf.WriteRunes(text)
+		case MetaPageUp, MetaPageDown:
+			// only for the completion menu
+		case CharUndo:
+			if !o.buf.Undo() {
+				o.t.Bell()
+			}
+		case MetaRedo:
+			if !o.buf.Redo() {
+				o.t.Bell()
+			}
+		case MetaKillRectangle:
+			if !o.buf.KillRectangle() {
+				o.t.Bell()
+			}
+		case MetaYankRectangle:
+			if !o.buf.YankRectangle() {
+				o.t.Bell()
+			}
+		case MetaAddCursor:
+			if !cfg.MultiCursor || !o.buf.AddCursor() {
+				o.t.Bell()
+			}
+		case MetaTogglePin:
+			// (un)pin the recalled item so that HistoryLimit keeps it
+			if !o.history.TogglePin() {
+				o.t.Bell()
+			}
+		case MetaPushLine:
+			// stash the line and start over, it comes back in the next
+			// prompt
+			if o.buf.Len() > 0 {
+				o.pushed = append(o.pushed, o.buf.Runes())
+				o.buf.Set(nil)
 			}
 		case CharBackward:
-			o.buf.MoveBackward()
+			o.repeat(count, o.buf.MoveBackward)
 		case CharForward:
-			o.buf.MoveForward()
+			if !o.buf.AcceptSuggestion() {
+				o.repeat(count, o.buf.MoveForward)
+			}
 		case CharPrev:
+			if o.buf.MoveRow(-1) {
+				break
+			}
 			buf := o.history.Prev()
 			if buf != nil {
 				o.buf.Set(buf)
+				break
+			}
+			o.t.Bell()
+			if cfg.HistoryWrap {
+				if buf, ok := o.history.Wrap(true); ok {
+					o.buf.Set(buf)
+				}
+			}
+		case MetaHistorySearchBackward, MetaHistorySearchForward:
+			prefix := o.buf.Runes()[:o.buf.Pos()]
+			if buf, ok := o.history.FindPrefix(prefix, o.buf.Runes(), r == MetaHistorySearchBackward); ok {
+				o.buf.SetWithIdx(len(prefix), buf)
 			} else {
 				o.t.Bell()
 			}
 		case CharNext:
+			if o.buf.MoveRow(1) {
+				break
+			}
 			buf, ok := o.history.Next()
 			if ok {
 				o.buf.Set(buf)
-			} else {
-				o.t.Bell()
+				break
+			}
+			o.t.Bell()
+			if cfg.HistoryWrap {
+				if buf, ok := o.history.Wrap(false); ok {
+					o.buf.Set(buf)
+				}
 			}
 		case CharDelete:
 			if o.buf.Len() > 0 || !o.IsNormalMode() {
 				o.t.KickRead()
-				if !o.buf.Delete() {
+				deleted := false
+				o.repeat(count, func() { deleted = o.buf.Delete() })
+				if !deleted {
 					o.t.Bell()
 				}
 				break
 			}
 
 			// treat as EOF
-			if !o.GetConfig().UniqueEditLine {
-				o.buf.WriteString(o.GetConfig().EOFPrompt + "\n")
+			if !cfg.UniqueEditLine {
+				o.buf.WriteString(cfg.EOFPrompt + "\n")
 			}
 			o.buf.Reset()
 			isUpdateHistory = false
 			o.history.Revert()
 			o.errchan <- io.EOF
-			if o.GetConfig().UniqueEditLine {
+			if cfg.UniqueEditLine {
 				o.buf.Clean()
 			}
 		case CharInterrupt:
@@ -312,56 +723,167 @@ func (o *Operation) ioloop() {
 			}
 			o.buf.MoveToLineEnd()
 			o.buf.Refresh(nil)
-			hint := o.GetConfig().InterruptPrompt + "\n"
-			if !o.GetConfig().UniqueEditLine {
+			hint := cfg.InterruptPrompt + "\n"
+			if !cfg.UniqueEditLine {
 				o.buf.WriteString(hint)
 			}
 			remain := o.buf.Reset()
-			if !o.GetConfig().UniqueEditLine {
+			if !cfg.UniqueEditLine {
 				remain = remain[:len(remain)-len([]rune(hint))]
 			}
 			isUpdateHistory = false
 			o.history.Revert()
 			o.errchan <- &InterruptError{remain}
 		default:
+			if cfg.FilterControls && isControl(r) {
+				break
+			}
 			if o.IsSearchMode() {
 				o.SearchChar(r)
 				keepInSearchMode = true
 				break
 			}
-			o.buf.WriteRune(r)
+			o.repeat(count, func() { o.buf.WriteRune(r) })
 			if o.IsInCompleteMode() {
 				o.OnComplete()
 				keepInCompleteMode = true
 			}
 		}
+		if count > 1 {
+			o.buf.EndUpdate()
+		}
+
+		o.killed = o.buf.kills != kills
+		if o.killed && cfg.BridgeClipboard {
+			o.getClipboard().Write(string(o.buf.lastKill))
+		}
 
-		listener := o.GetConfig().Listener
+		listener := cfg.Listener
 		if listener != nil {
-			newLine, newPos, ok := listener.OnChange(o.buf.Runes(), o.buf.Pos(), r)
-			if ok {
+			line, pos := o.buf.Runes(), o.buf.Pos()
+			var newLine []rune
+			var newPos int
+			var ok bool
+			inBudget := o.buf.hooks.run(cfg, "Listener", func() {
+				newLine, newPos, ok = listener.OnChange(line, pos, r)
+			})
+			if inBudget && ok {
 				o.buf.SetWithIdx(newPos, newLine)
 			}
 		}
 
-		o.m.Lock()
-		if !keepInSearchMode && o.IsSearchMode() {
-			o.ExitSearchMode(false)
+		o.endKey(keepInSearchMode, keepInCompleteMode, isUpdateHistory)
+		o.updateSuggestion()
+		o.showTip(r)
+		o.reportLatency(r, start)
+	}
+}
+
+func (o *Operation) getClipboard() Clipboard {
+	if cb := o.GetConfig().Clipboard; cb != nil {
+		return cb
+	}
+	if o.clipboard == nil {
+		o.clipboard = newDefaultClipboard(o.w)
+	}
+	return o.clipboard
+}
+
+func (o *Operation) recordKey(r rune) {
+	cfg := o.keyConfig()
+	o.m.Lock()
+	var old *transcript
+	t := o.transcript
+	if t != nil && t.w != cfg.Transcript {
+		old, t = t, nil
+	}
+	if t == nil && cfg.Transcript != nil {
+		t = newTranscript(cfg.Transcript, cfg.TranscriptHashText)
+	}
+	o.transcript = t
+	o.m.Unlock()
+	// the characters typed so far go to the writer they were typed for
+	if old != nil {
+		old.Flush()
+	}
+	if t != nil {
+		t.Key(r)
+	}
+}
+
+// flushTranscript writes the characters typed since the last other key.
+func (o *Operation) flushTranscript() {
+	o.m.Lock()
+	t := o.transcript
+	o.m.Unlock()
+	if t != nil {
+		t.Flush()
+	}
+}
+
+// endKey leaves the modes which weren't kept by the key and repaints.
+func (o *Operation) endKey(keepInSearchMode, keepInCompleteMode, isUpdateHistory bool) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if !keepInSearchMode && o.IsSearchMode() {
+		o.ExitSearchMode(false)
+		o.buf.Refresh(nil)
+	} else if o.IsInCompleteMode() {
+		if !keepInCompleteMode {
+			o.ExitCompleteMode(false)
+			o.Refresh()
+		} else {
 			o.buf.Refresh(nil)
-		} else if o.IsInCompleteMode() {
-			if !keepInCompleteMode {
-				o.ExitCompleteMode(false)
-				o.Refresh()
-			} else {
-				o.buf.Refresh(nil)
-				o.CompleteRefresh()
-			}
-		}
-		if isUpdateHistory && !o.IsSearchMode() {
-			// it will cause null history
-			o.history.Update(o.buf.Runes(), false)
+			o.CompleteRefresh()
 		}
-		o.m.Unlock()
+	}
+	if isUpdateHistory && !o.IsSearchMode() {
+		// it will cause null history
+		o.history.Update(o.buf.Runes(), false)
+	}
+}
+
+// recoverLoop turns a panic of the ioloop, usually raised by a user
+// provided callback, into an error of the pending Readline call, and
+// starts a new ioloop so that the Instance is still usable.
+func (o *Operation) recoverLoop() {
+	p := recover()
+	if p == nil {
+		return
+	}
+	err := &PanicError{Value: p, Stack: debug.Stack()}
+	o.t.ExitRawMode()
+	if f := o.GetConfig().FuncOnPanic; f != nil {
+		f(err)
+	}
+
+	if o.IsSearchMode() {
+		o.ExitSearchMode(false)
+	}
+	o.ExitCompleteMode(false)
+	o.buf.dropFrame()
+	o.buf.Clean()
+	o.buf.Reset()
+	o.history.Revert()
+
+	go o.ioloop()
+	select {
+	case o.errchan <- err:
+	default:
+	}
+}
+
+// recoverGoroutine reports the panic of a goroutine other than the
+// ioloop, which runs a callback of the program or serves a connection, to
+// Config.FuncOnPanic rather than crashing the program. The goroutine ends
+// there. cfg may be nil.
+func recoverGoroutine(cfg *Config) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if cfg != nil && cfg.FuncOnPanic != nil {
+		cfg.FuncOnPanic(&PanicError{Value: p, Stack: debug.Stack()})
 	}
 }
 
@@ -379,6 +901,12 @@ func (o *Operation) String() (string, error) {
 }
 
 func (o *Operation) Runes() ([]rune, error) {
+	return o.RunesContext(context.Background())
+}
+
+// RunesContext is Runes, but it returns ctx.Err() when ctx is done, after
+// abandoning the line as if Ctrl-C had been typed.
+func (o *Operation) RunesContext(ctx context.Context) ([]rune, error) {
 	o.t.EnterRawMode()
 	defer o.t.ExitRawMode()
 
@@ -387,7 +915,12 @@ func (o *Operation) Runes() ([]rune, error) {
 		listener.OnChange(nil, 0, 0)
 	}
 
-	o.buf.Refresh(nil) // print prompt
+	if n := len(o.pushed); n > 0 {
+		o.buf.Set(o.pushed[n-1]) // print prompt with the pushed input
+		o.pushed = o.pushed[:n-1]
+	} else {
+		o.buf.Refresh(nil) // print prompt
+	}
 	o.t.KickRead()
 	select {
 	case r := <-o.outchan:
@@ -397,6 +930,68 @@ func (o *Operation) Runes() ([]rune, error) {
 			return e.Line, ErrInterrupt
 		}
 		return nil, err
+	case <-ctx.Done():
+		o.t.Cancel()
+	}
+	// the line typed meanwhile is dropped until the ioloop abandons it,
+	// rather than returned by the next call
+	for {
+		select {
+		case <-o.outchan:
+		case <-o.errchan:
+		case <-o.cancelled:
+			select {
+			case <-o.errchan:
+			default:
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// RunesNoHistory is Runes, but the line isn't saved in the history, and
+// the history can't be recalled while it's edited.
+func (o *Operation) RunesNoHistory() ([]rune, error) {
+	h := newOpHistory(o.GetConfig())
+	h.Disable()
+	o.m.Lock()
+	saved := o.history
+	o.history, o.opSearch.history = h, h
+	o.m.Unlock()
+	defer func() {
+		o.m.Lock()
+		o.history, o.opSearch.history = saved, saved
+		o.m.Unlock()
+	}()
+	return o.Runes()
+}
+
+// cancelLine abandons the line after RunesContext has returned.
+func (o *Operation) cancelLine() {
+	if o.IsPagerMode() {
+		o.ExitPager()
+	}
+	if o.IsHistoryBrowserMode() {
+		o.ExitHistoryBrowser()
+	}
+	if o.IsSearchMode() {
+		o.ExitSearchMode(true)
+	}
+	if o.IsInCompleteMode() {
+		o.ExitCompleteMode(true)
+	}
+	o.buf.MoveToLineEnd()
+	o.buf.Refresh(nil)
+	if !o.GetConfig().UniqueEditLine {
+		o.buf.WriteString("\n")
+	}
+	o.buf.Reset()
+	o.history.Revert()
+	o.bindings.typed, o.bindings.replay, o.bindings.skip = nil, nil, 0
+	o.argument = opArgument{}
+	select {
+	case o.cancelled <- struct{}{}:
+	default:
 	}
 }
 
@@ -423,6 +1018,43 @@ func (o *Operation) Password(prompt string) ([]byte, error) {
 	return o.PasswordEx(prompt, nil)
 }
 
+// PasswordConfirm reads the password twice and starts over if the two
+// don't match, up to Config.PasswordConfirmTries times. The passwords
+// which aren't returned are zeroed.
+func (o *Operation) PasswordConfirm(prompt, confirmPrompt string) ([]byte, error) {
+	tries := o.GetConfig().PasswordConfirmTries
+	if tries <= 0 {
+		tries = 3
+	}
+	for i := 0; i < tries; i++ {
+		if i > 0 {
+			o.t.Write([]byte("passwords don't match, try again\n"))
+		}
+		pw, err := o.Password(prompt)
+		if err != nil {
+			return nil, err
+		}
+		again, err := o.Password(confirmPrompt)
+		if err != nil {
+			zeroBytes(pw)
+			return nil, err
+		}
+		match := subtle.ConstantTimeCompare(pw, again) == 1
+		zeroBytes(again)
+		if match {
+			return pw, nil
+		}
+		zeroBytes(pw)
+	}
+	return nil, ErrPasswordMismatch
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 func (o *Operation) SetTitle(t string) {
 	o.w.Write([]byte("\033[2;" + t + "\007"))
 }
@@ -432,7 +1064,27 @@ func (o *Operation) Slice() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return []byte(string(r)), nil
+	return encodeRunes(r), nil
+}
+
+// encodeRunes returns r in UTF-8 and zeroes it. It's encoded without an
+// intermediate string, which couldn't be zeroed, nor a buffer growing.
+func encodeRunes(r []rune) []byte {
+	n := 0
+	for _, e := range r {
+		if l := utf8.RuneLen(e); l > 0 {
+			n += l
+		} else {
+			n += utf8.RuneLen(utf8.RuneError)
+		}
+	}
+	buf := make([]byte, n)
+	n = 0
+	for i, e := range r {
+		n += utf8.EncodeRune(buf[n:], e)
+		r[i] = 0
+	}
+	return buf
 }
 
 func (o *Operation) Close() {
@@ -440,6 +1092,7 @@ func (o *Operation) Close() {
 	case o.errchan <- io.EOF:
 	default:
 	}
+	o.flushTranscript()
 	o.history.Close()
 }
 
@@ -466,8 +1119,16 @@ func (op *Operation) SetConfig(cfg *Config) (*Config, error) {
 	}
 	old := op.cfg
 	op.cfg = cfg
-	op.SetPrompt(cfg.Prompt)
-	op.SetMaskRune(cfg.MaskRune)
+	if op.opVim != nil {
+		op.opVim.setEnabled(cfg.VimMode)
+	}
+	if len(cfg.PromptSegments) > 0 {
+		op.SetPromptSegments(cfg.PromptSegments)
+	} else {
+		op.SetPrompt(cfg.Prompt)
+	}
+	op.SetRightPrompt(cfg.RightPrompt)
+	op.buf.SetMask(cfg.MaskRune)
 	op.buf.SetConfig(cfg)
 	width := op.cfg.FuncGetWidth()
 
@@ -500,12 +1161,123 @@ func (o *Operation) SaveHistory(content string) error {
 	return o.history.New([]rune(content))
 }
 
+// Origin returns where the line is drawn, see LineOrigin.
+func (o *Operation) Origin() LineOrigin {
+	return o.buf.Origin()
+}
+
+// GetHistory returns the lines saved in the history, the oldest first.
+func (o *Operation) GetHistory() []HistoryEntry {
+	return o.history.Entries()
+}
+
+// PinHistory pins or unpins the latest history item which is content,
+// pinned items are never dropped by HistoryLimit. Pins are saved to the
+// HistoryFile on Close.
+func (o *Operation) PinHistory(content string, pinned bool) bool {
+	return o.history.Pin([]rune(content), pinned)
+}
+
 func (o *Operation) Refresh() {
 	if o.t.IsReading() {
 		o.buf.Refresh(nil)
 	}
 }
 
+// BeginUpdate defers the drawing of the line until the matching
+// EndUpdate, see Instance.BeginUpdate.
+func (o *Operation) BeginUpdate() {
+	o.buf.BeginUpdate(o.t.IsReading())
+}
+
+func (o *Operation) EndUpdate() {
+	o.buf.EndUpdate()
+}
+
+// Redraw repaints the line from scratch, for when the screen has been
+// messed up by other writes. It's done by the ioloop, before the next key.
+func (o *Operation) Redraw() {
+	o.redrawLater(&o.pendingRedraw)
+}
+
+// redrawLater sets the flag of what to draw again, and makes the ioloop
+// do it, see redrawPending. The callers are on other goroutines.
+func (o *Operation) redrawLater(flag *bool) {
+	o.m.Lock()
+	*flag = true
+	o.m.Unlock()
+	o.t.redraw()
+}
+
+// redrawPending draws again what the other goroutines asked for: it lays
+// the line and the menu out again for the width of the resized screen,
+// and repaints the line from scratch or what the modes show under it.
+func (o *Operation) redrawPending() {
+	o.m.Lock()
+	resize, redraw, modes := o.pendingResize, o.pendingRedraw, o.pendingModes
+	o.pendingResize, o.pendingRedraw, o.pendingModes = false, false, false
+	o.m.Unlock()
+	if resize {
+		width := o.keyConfig().FuncGetWidth()
+		o.opCompleter.OnWidthChange(width)
+		o.opSearch.OnWidthChange(width)
+		o.buf.OnWidthChange(width)
+		if o.IsInCompleteMode() {
+			o.buf.Refresh(nil)
+			o.CompleteRefresh()
+		}
+	}
+	switch {
+	case redraw:
+		o.redraw()
+	case modes:
+		o.refreshModes()
+	}
+}
+
+// redraw is Redraw for the ioloop.
+func (o *Operation) redraw() {
+	if !o.t.IsReading() {
+		return
+	}
+	o.buf.Redraw()
+	o.refreshModes()
+}
+
+// PrintAbovePrompt prints lines to Stdout, see Instance.PrintAbovePrompt.
+func (o *Operation) PrintAbovePrompt(lines ...string) {
+	if len(lines) == 0 {
+		return
+	}
+	var text strings.Builder
+	for _, line := range lines {
+		text.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			text.WriteByte('\n')
+		}
+	}
+	if _, drawn, _ := o.buf.PrintAbove(o.GetConfig().Stdout, []byte(text.String())); drawn {
+		o.redrawLater(&o.pendingModes)
+	}
+}
+
+func (o *Operation) clearScreen() {
+	cfg := o.GetConfig()
+	switch cfg.ClearScreenMode {
+	case ClearScreenRepaint:
+		o.redraw()
+		return
+	case ClearScreenScroll:
+		// scroll the screen into the scrollback, without the line
+		o.buf.Clean()
+		if height := cfg.FuncGetHeight(); height > 0 {
+			o.w.Write(bytes.Repeat([]byte("\n"), height))
+		}
+	}
+	ClearScreen(o.w)
+	o.Refresh()
+}
+
 func (o *Operation) Clean() {
 	o.buf.Clean()
 }
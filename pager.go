@@ -0,0 +1,140 @@
+package readline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// opPager is the built-in pager of the output which doesn't fit the
+// screen, like long completion listings. It's drawn on the alternate
+// screen like the history browser: Space shows the next page (and quits
+// on the last one), b the previous one, Enter or j the next line, k the
+// previous one, and q quits.
+type opPager struct {
+	w  io.Writer
+	op *Operation
+
+	inPager bool
+	lines   []string
+	top     int
+}
+
+func newOpPager(w io.Writer, op *Operation) *opPager {
+	return &opPager{w: w, op: op}
+}
+
+func (o *opPager) IsPagerMode() bool {
+	return o.inPager
+}
+
+// pagerRows returns the rows of the page, without the status line, or
+// -1 if the height of the screen is unknown.
+func (o *opPager) pagerRows() int {
+	height := o.op.cfg.FuncGetHeight()
+	if height <= 1 {
+		return -1
+	}
+	return height - 1
+}
+
+// Page shows text in the pager if it's longer than the screen, or above
+// the prompt otherwise. It must be called from the event loop, i.e. from
+// the callbacks such as the Listener or the AutoCompleter, the pager
+// takes the keys until it's quit.
+func (o *opPager) Page(text string) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	rows := o.pagerRows()
+	if rows < 0 || len(lines) <= rows {
+		o.op.buf.Clean()
+		io.WriteString(o.w, strings.Join(lines, "\r\n")+"\r\n")
+		o.op.buf.Refresh(nil)
+		return
+	}
+	o.inPager = true
+	o.lines, o.top = lines, 0
+	io.WriteString(o.w, "\033[?1049h")
+	o.PagerRefresh()
+}
+
+// HandlePager handles the key in the pager.
+func (o *opPager) HandlePager(r rune) {
+	rows := o.pagerRows()
+	if rows < 0 {
+		rows = 23
+	}
+	last := len(o.lines) - rows
+	if last < 0 {
+		last = 0
+	}
+	switch r {
+	case ' ', 'f':
+		if o.top >= last {
+			o.ExitPager()
+			return
+		}
+		o.top += rows
+	case 'b':
+		o.top -= rows
+	case CharEnter, CharCtrlJ:
+		o.op.t.KickRead()
+		fallthrough
+	case 'j', CharNext:
+		o.top++
+	case 'k', CharPrev:
+		o.top--
+	case 'g', '<':
+		o.top = 0
+	case 'G', '>':
+		o.top = last
+	case CharInterrupt:
+		o.op.t.KickRead()
+		fallthrough
+	case 'q', 'Q', CharBell, CharEsc:
+		o.ExitPager()
+		return
+	default:
+		o.op.t.Bell()
+		return
+	}
+	if o.top > last {
+		o.top = last
+	}
+	if o.top < 0 {
+		o.top = 0
+	}
+	o.PagerRefresh()
+}
+
+func (o *opPager) ExitPager() {
+	o.inPager = false
+	o.lines = nil
+	io.WriteString(o.w, "\033[?1049l")
+	o.op.buf.Refresh(nil)
+}
+
+func (o *opPager) PagerRefresh() {
+	width := o.op.buf.width
+	rows := o.pagerRows()
+	if rows < 0 {
+		rows = 23
+	}
+	end := o.top + rows
+	if end > len(o.lines) {
+		end = len(o.lines)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("\033[H\033[J")
+	for _, line := range o.lines[o.top:end] {
+		rs := []rune(line)
+		if width > 0 && runes.WidthAll(runes.ColorFilter(rs)) > width {
+			rs = truncateColored(rs, width)
+		}
+		buf.WriteString(string(rs))
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(buf, "\033[7mlines %d-%d/%d (space, b, q)\033[0m", o.top+1, end, len(o.lines))
+	o.w.Write(buf.Bytes())
+}
@@ -0,0 +1,31 @@
+package readline
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPager(t *testing.T) {
+	var cands staticCompleter
+	for i := 0; i < 20; i++ {
+		cands = append(cands, fmt.Sprintf("c%02d", i))
+	}
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Stdout:        out,
+		AutoComplete:  cands,
+		FuncGetWidth:  func() int { return 10 },
+		FuncGetHeight: func() int { return 5 },
+	})
+
+	go w.Write([]byte("c\ty qx\r"))
+	if line, err := rl.Readline(); err != nil || line != "cx" {
+		t.Fatal("result not expect", line, err)
+	}
+	for _, expect := range []string{"Display all 20 possibilities? (y or n)", "\033[?1049h", "lines 1-4/", "lines 5-8/", "\033[?1049l"} {
+		if !strings.Contains(out.String(), expect) {
+			t.Fatalf("expect %q in %q", expect, out.String())
+		}
+	}
+}
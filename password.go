@@ -27,7 +27,8 @@ func (o *opPassword) PasswordConfig() *Config {
 		HistoryLimit:    -1,
 		Painter:         &defaultPainter{},
 
-		Stdout: o.o.cfg.Stdout,
-		Stderr: o.o.cfg.Stderr,
+		Stdout:       o.o.cfg.Stdout,
+		Stderr:       o.o.cfg.Stderr,
+		PromptWriter: o.o.cfg.PromptWriter,
 	}
 }
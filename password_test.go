@@ -0,0 +1,41 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestReadPasswordConfirm(t *testing.T) {
+	for _, c := range []struct {
+		tries  int
+		input  string
+		expect string
+		err    error
+	}{
+		{0, "pw\rpw\r", "pw", nil},
+		{0, "pw\rpv\rpw2\rpw2\r", "pw2", nil},
+		{2, "a\rb\rc\rd\r", "", ErrPasswordMismatch},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			PasswordConfirmTries: c.tries,
+		})
+		go w.Write([]byte(c.input))
+		if pw, err := rl.ReadPasswordConfirm("new: ", "again: "); err != c.err || string(pw) != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, pw, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestEncodeRunes(t *testing.T) {
+	r := []rune("pâss\U0001F511")
+	r = append(r, 0xD800)
+	if b := encodeRunes(r); string(b) != "pâss\U0001F511\uFFFD" {
+		t.Fatalf("result not expect %q", b)
+	}
+	for _, e := range r {
+		if e != 0 {
+			t.Fatal("not zeroed", r)
+		}
+	}
+}
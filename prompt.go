@@ -0,0 +1,164 @@
+package readline
+
+import (
+	"sort"
+	"strconv"
+)
+
+const promptEllipsis = '…'
+
+// PromptSegment is a part of a prompt given by segments, which is laid
+// out to fit the terminal width instead of wrapping.
+type PromptSegment struct {
+	// Text supports ANSI escape sequence just like Config.Prompt
+	Text string
+	// when the prompt is too wide, segments are shortened in ascending
+	// order of priority, the ones of the same priority from right to left
+	Priority int
+	// shorten with an ellipsis rather than dropping the whole segment
+	Truncate bool
+}
+
+// promptLayout is the prompt as displayed at a terminal width, and its
+// display width, see RuneBuffer.layoutPrompt.
+type promptLayout struct {
+	prompt []rune
+	width  int
+}
+
+// maxPromptLayouts bounds the layouts cached while the terminal is
+// resized, they are all dropped when it's reached.
+const maxPromptLayouts = 16
+
+// layoutPrompt joins the segments, shortening them as needed so that the
+// width of the result doesn't exceed avail.
+func layoutPrompt(segs []PromptSegment, avail int) []rune {
+	texts := make([][]rune, len(segs))
+	total := 0
+	for i, seg := range segs {
+		texts[i] = []rune(seg.Text)
+		total += runes.WidthAll(runes.ColorFilter(texts[i]))
+	}
+
+	order := make([]int, len(segs))
+	for i := range order {
+		order[i] = len(segs) - 1 - i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return segs[order[i]].Priority < segs[order[j]].Priority
+	})
+
+	for _, i := range order {
+		if total <= avail {
+			break
+		}
+		width := runes.WidthAll(runes.ColorFilter(texts[i]))
+		keep := width - (total - avail)
+		if segs[i].Truncate && keep > 1 {
+			texts[i] = truncateColored(texts[i], keep)
+		} else {
+			texts[i] = nil
+		}
+		total -= width - runes.WidthAll(runes.ColorFilter(texts[i]))
+	}
+
+	var prompt []rune
+	for _, text := range texts {
+		prompt = append(prompt, text...)
+	}
+	return prompt
+}
+
+// truncateColored shortens rs to the given display width, the last
+// column is an ellipsis. Escape sequences are all kept, so that the
+// colors are still reset properly.
+func truncateColored(rs []rune, width int) []rune {
+	ret := make([]rune, 0, len(rs))
+	used, cut := 0, false
+	for i := 0; i < len(rs); i++ {
+		if rs[i] == '\033' && i+1 < len(rs) && rs[i+1] == '[' {
+			end := runes.Index('m', rs[i:])
+			if end >= 0 {
+				ret = append(ret, rs[i:i+end+1]...)
+				i += end
+				continue
+			}
+		}
+		if cut {
+			continue
+		}
+		w := runes.Width(rs[i])
+		if used+w > width-1 {
+			ret = append(ret, promptEllipsis)
+			cut = true
+			continue
+		}
+		ret = append(ret, rs[i])
+		used += w
+	}
+	return ret
+}
+
+// truncateColoredLeft is like truncateColored, but the ellipsis replaces
+// the beginning of rs instead of its end.
+func truncateColoredLeft(rs []rune, width int) []rune {
+	drop := runes.WidthAll(runes.ColorFilter(rs)) - width
+	if drop <= 0 {
+		return rs
+	}
+	drop++ // for the ellipsis
+
+	ret := make([]rune, 0, len(rs))
+	dropped := 0
+	for i := 0; i < len(rs); i++ {
+		if rs[i] == '\033' && i+1 < len(rs) && rs[i+1] == '[' {
+			end := runes.Index('m', rs[i:])
+			if end >= 0 {
+				ret = append(ret, rs[i:i+end+1]...)
+				i += end
+				continue
+			}
+		}
+		if dropped < drop {
+			dropped += runes.Width(rs[i])
+			if dropped >= drop {
+				ret = append(ret, promptEllipsis)
+			}
+			continue
+		}
+		ret = append(ret, rs[i])
+	}
+	return ret
+}
+
+// SetRightPrompt sets the prompt drawn flush right on the line, see
+// Config.RightPrompt.
+func (r *RuneBuffer) SetRightPrompt(prompt string) {
+	r.Lock()
+	r.rightPrompt = []rune(prompt)
+	r.rightWidth = runes.WidthAll(runes.ColorFilter(r.rightPrompt))
+	r.Unlock()
+}
+
+// rightPromptOutput draws the right prompt from the end of the prompt and
+// moves back there. It's left out unless the line, with its suggestion,
+// fits on a single row and ends at least a column before it, so that the
+// line never runs into it. The last column is kept free, where some
+// terminals wrap.
+func (r *RuneBuffer) rightPromptOutput() string {
+	if len(r.rightPrompt) == 0 || r.width == 0 || runes.Index('\n', r.buf) >= 0 {
+		return ""
+	}
+	used := runes.WidthAll(r.buf)
+	if r.cfg.EnableMask {
+		used = len(r.buf) * runes.Width(r.cfg.MaskRune)
+	}
+	used += runes.WidthAll(r.suggestion())
+	start := r.width - 1 - r.rightWidth
+	if r.promptLen()+used >= start {
+		return ""
+	}
+	gap := start - r.promptLen()
+	return "\033[" + strconv.Itoa(gap) + "C" + string(r.rightPrompt) +
+		"\033[" + strconv.Itoa(gap+r.rightWidth) + "D"
+}
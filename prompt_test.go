@@ -0,0 +1,130 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestLayoutPrompt(t *testing.T) {
+	segs := []PromptSegment{
+		{Text: "user@host", Priority: 3},
+		{Text: ":", Priority: 9},
+		{Text: "\033[34m~/src/project\033[0m", Priority: 2, Truncate: true},
+		{Text: "$ ", Priority: 9},
+	}
+	cases := []struct {
+		avail  int
+		expect string
+	}{
+		{80, "user@host:\033[34m~/src/project\033[0m$ "},
+		{20, "user@host:\033[34m~/src/p…\033[0m$ "},
+		{15, "user@host:\033[34m~/…\033[0m$ "},
+		{4, ":$ "},
+	}
+	for _, c := range cases {
+		if got := string(layoutPrompt(segs, c.avail)); got != c.expect {
+			t.Fatalf("%v: expect %q, got %q", c.avail, c.expect, got)
+		}
+	}
+}
+
+func TestMinEditWidth(t *testing.T) {
+	cfg := &Config{MinEditWidth: 10, FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(nil, "", cfg, 20)
+	rb.SetPrompt("\033[1m/very/long/working/dir\033[0m> ")
+	if got := string(rb.prompt); got != "\033[1m…ing/dir\033[0m> " {
+		t.Fatalf("result not expect %q", got)
+	}
+	rb.OnWidthChange(80)
+	if got := string(rb.prompt); got != "\033[1m/very/long/working/dir\033[0m> " {
+		t.Fatalf("result not expect %q", got)
+	}
+}
+
+func TestPromptLayoutCache(t *testing.T) {
+	cfg := &Config{MinEditWidth: 10, FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(nil, "\033[1m/very/long/working/dir\033[0m> ", cfg, 20)
+	rb.OnWidthChange(80)
+	rb.OnWidthChange(20)
+	if len(rb.layouts) != 2 || rb.PromptLen() != 10 {
+		t.Fatalf("result not expect %v %v", len(rb.layouts), rb.PromptLen())
+	}
+
+	// a new prompt drops the layouts of the old one
+	rb.SetPrompt("> ")
+	if len(rb.layouts) != 1 || string(rb.prompt) != "> " || rb.PromptLen() != 2 {
+		t.Fatalf("result not expect %q", string(rb.prompt))
+	}
+	for w := 21; w < 21+maxPromptLayouts; w++ {
+		rb.OnWidthChange(w)
+	}
+	if len(rb.layouts) > maxPromptLayouts {
+		t.Fatal("the layouts aren't bounded", len(rb.layouts))
+	}
+}
+
+type writeCounter struct {
+	writes int
+	data   []byte
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.writes++
+	w.data = append(w.data, p...)
+	return len(p), nil
+}
+
+func TestBatchedUpdate(t *testing.T) {
+	w := &writeCounter{}
+	cfg := &Config{Painter: &defaultPainter{}, FuncIsTerminal: func() bool { return true }}
+	rb := NewRuneBuffer(w, "> ", cfg, 80)
+	rb.WriteRunes([]rune("ls"))
+
+	w.writes = 0
+	rb.Refresh(nil)
+	if w.writes != 1 {
+		t.Fatalf("a refresh takes %v writes", w.writes)
+	}
+
+	w.writes, w.data = 0, nil
+	rb.BeginUpdate(true)
+	rb.SetPrompt("$ ")
+	rb.Refresh(nil)
+	rb.BeginUpdate(true)
+	rb.WriteRune('a')
+	rb.EndUpdate()
+	if w.writes != 0 {
+		t.Fatalf("written within the batch: %q", w.data)
+	}
+	rb.EndUpdate()
+	if w.writes != 1 || string(w.data) != "\033[J\033[2K\r$ lsa" {
+		t.Fatalf("result not expect %v %q", w.writes, w.data)
+	}
+}
+
+func TestRightPrompt(t *testing.T) {
+	cfg := &Config{FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(nil, "> ", cfg, 20)
+	rb.SetRightPrompt("\033[33m[main]\033[0m")
+	cases := []struct {
+		line   string
+		expect string
+	}{
+		{"", "\033[11C\033[33m[main]\033[0m\033[17D"},
+		{"abcdefghij", "\033[11C\033[33m[main]\033[0m\033[17D"},
+		// it would run into the line
+		{"abcdefghijk", ""},
+		{"ab\ncd", ""},
+	}
+	for _, c := range cases {
+		rb.Set([]rune(c.line))
+		if got := rb.rightPromptOutput(); got != c.expect {
+			t.Fatalf("%q: expect %q, got %q", c.line, c.expect, got)
+		}
+	}
+
+	rb.OnWidthChange(0)
+	rb.Set(nil)
+	if got := rb.rightPromptOutput(); got != "" {
+		t.Fatalf("result not expect %q", got)
+	}
+}
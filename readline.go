@@ -18,29 +18,258 @@
 package readline
 
 import (
+	"context"
 	"io"
+	"os"
+	"time"
 )
 
 type Instance struct {
-	Config    *Config
+	Config *Config
+	// Deprecated: the Terminal and Operation are internals of the
+	// Instance, use its methods instead. They aren't exported by
+	// github.com/chzyer/readline/lineedit.
 	Terminal  *Terminal
 	Operation *Operation
 }
 
+// ClearScreenMode is what Ctrl-L does.
+type ClearScreenMode int
+
+const (
+	// clear the screen and repaint the line at its top
+	ClearScreenClear ClearScreenMode = iota
+	// repaint the line where it is
+	ClearScreenRepaint
+	// scroll the content of the screen into the scrollback, and repaint
+	// the line at the top
+	ClearScreenScroll
+)
+
+// CompleteListMode is when Tab lists the candidates which share no more
+// than the word typed, rather than completing it: the show-all-if-*
+// variables of GNU readline.
+type CompleteListMode int
+
+const (
+	// at the first Tab if it can't complete the word, or else at the next
+	// one, like show-all-if-unmodified
+	CompleteListUnmodified CompleteListMode = iota
+	// at the first Tab, after completing the common part of the
+	// candidates, like show-all-if-ambiguous
+	CompleteListAmbiguous
+	// at the next Tab, the first one completes the common part of the
+	// candidates or rings the bell, like bash by default
+	CompleteListOnSecondTab
+)
+
 type Config struct {
 	// prompt supports ANSI escape sequence, so we can color some characters even in windows
 	Prompt string
+	// if set, it's used instead of Prompt, and the segments of low
+	// priority are shortened or dropped when the terminal is too narrow
+	PromptSegments []PromptSegment
+	// drawn at the beginning of the rows after the newlines of the line,
+	// e.g. "... ", it supports ANSI escape sequences like Prompt
+	ContinuationPrompt string
+	// guarantee at least this many columns for editing, by truncating the
+	// beginning of the displayed prompt if it's too wide
+	MinEditWidth int
+	// drawn flush right on the line, like RPROMPT in zsh, e.g. a clock or
+	// a git branch. It's hidden while the line would run into it
+	RightPrompt string
 
 	// readline will persist historys to file where HistoryFile specified
 	HistoryFile string
 	// specify the max length of historys, it's 500 by default, set it to -1 to disable history
 	HistoryLimit           int
 	DisableAutoSaveHistory bool
+	// save the time and the tag of each line in the HistoryFile, on a line
+	// of its own before it: # and the Unix time like bash writes them with
+	// HISTTIMEFORMAT, then the tag after a space. A ! after the time marks
+	// the pinned lines, which get the time 0 without HistoryTimestamps, see
+	// Instance.PinHistory
+	HistoryTimestamps bool
+	// gives the tag saved with a line in the history, e.g. the working
+	// directory, see GetHistory
+	FuncHistoryTag func(line string) string
+	// don't save the lines starting with a space in the history, like
+	// HISTCONTROL=ignorespace in bash. A line equal to the previous one is
+	// never saved twice, like with ignoredups
+	HistoryIgnoreSpace bool
+	// remove the earlier items equal to the line saved in the history, and
+	// from the HistoryFile on Close, like HISTCONTROL=erasedups
+	HistoryEraseDups bool
+	// share the HistoryFile with the other sessions using it at once: the
+	// lines they save are read from it when the history is recalled or
+	// searched, and before each line is saved
+	HistoryShared bool
+	// tells whether the line is saved in the history, after the options
+	// above, by SaveHistory too
+	HistoryFilter func(line string) bool
 	// enable case-insensitive history searching
 	HistorySearchFold bool
+	// the search matches the lines holding the typed runes in order, not
+	// only next to each other
+	HistorySearchFuzzy bool
+	// maps the runes compared by the history search and the completion
+	// matching, e.g. FoldDiacritics so that "cafe" finds "Café". The
+	// default is FoldCase, in the history search with HistorySearchFold
+	// only
+	FuncNormalize func(r rune) rune
+	// Up at the oldest item goes to the newest one and Down at the newest
+	// goes to the oldest, with a bell, instead of stopping there
+	HistoryWrap bool
 
 	// AutoCompleter will called once user press TAB
 	AutoComplete AutoCompleter
+	// the completion listings are written there instead of beneath the
+	// prompt, e.g. to show them in another pane. Each refresh writes the
+	// whole listing
+	AuxOutput io.Writer
+	// splits the line for Meta-Ctrl-K and Meta-Ctrl-W, which kill a
+	// quoted string or an expansion at once. It's a ShellLexer by default
+	Lexer Lexer
+	// the numeric keypad in application mode types digits and operators,
+	// unless this is set to move the cursor like it does without Num Lock
+	KeypadNavigation bool
+	// the keys of the escape sequences which the terminal sends for the
+	// modified keys, e.g. {"\033Od": MetaBackward}, when they aren't
+	// decoded right. They take precedence over the built-in ones
+	KeySequences map[string]rune
+	// the terminal prefixes the Alt keys with Esc. Otherwise the bytes
+	// which aren't valid UTF-8 are taken for the 8-bit meta of the legacy
+	// terminals (xterm's eightBitInput), which sets the high bit for Alt.
+	// Set it if the terminal sends Latin-1 rather than UTF-8
+	MetaSendsEscape bool
+	// the sequences which the Backspace and Delete keys send, e.g. "\x7f"
+	// and "\033[3~", for the terminals which swap them: the keys sending
+	// them erase backward and forward. They're read from the terminfo
+	// entry of the TERM (kbs and kdch1) if both are empty
+	KeyBackspace string
+	KeyDelete    string
+
+	// rebind the keys per mode, the keys are the Keymap* names.
+	// see Keymap
+	Keymaps map[string]Keymap
+	// bind the chords of keys per mode, like the Keymaps, see Chord
+	Chords map[string][]Chord
+	// how long a chord, or a sequence of BindKey, waits for its next key
+	// before the keys typed are performed as they are, 1s if 0, or never
+	// if -1. The Ctrl-X ones don't time out
+	ChordTimeout time.Duration
+	// an inputrc file of GNU readline, e.g. InputrcPath(), whose key
+	// bindings and editing-mode are applied. The Keymaps and KeySequences
+	// set by the program take precedence
+	InputrcFile string
+
+	// what Ctrl-L does, clearing the screen by default
+	ClearScreenMode ClearScreenMode
+
+	// inserted at the beginning of the line by Meta-#, which saves it to
+	// the history without returning it. it's "#" by default
+	CommentBegin string
+
+	// when Tab lists the candidates, see CompleteListMode. The Tab after
+	// the list selects them in the menu
+	CompleteListMode CompleteListMode
+	// Tab inserts the candidates in turn instead, like the menu-complete
+	// of GNU readline, with the one inserted marked in the list of them.
+	// Shift-Tab goes backward, Esc restores the line and the other keys
+	// keep the candidate
+	MenuComplete bool
+	// how the candidates are matched with the word typed, see
+	// CompletionMatcher. Except for CompletionMatchPrefix, the completer
+	// is asked for all the candidates of the word, which are matched and
+	// ranked here: it works with any AutoCompleter
+	CompletionMatcher CompletionMatcher
+	// ask "Display all N possibilities? (y or n)" before listing this many
+	// candidates or more, like GNU readline. When it's 0, it's only asked
+	// before the listing which doesn't fit beneath the line is paged, and
+	// it's never asked when it's negative
+	CompletionQueryItems int
+	// how long an AsyncCompleter may take to give the candidates, there's
+	// no limit when it's 0
+	CompletionTimeout time.Duration
+
+	// called with the candidates (the whole words) before the completion
+	// menu is shown. it returns a banner to be shown on top of them, which
+	// may be empty, and false to not show the menu at all
+	FuncOnBeforeComplete func(candidates []string) (banner string, show bool)
+	// called after the completion menu has been shown
+	FuncOnAfterComplete func(candidates []string)
+
+	// SGR parameters of the matched text highlighted in the completion
+	// menu and the reverse search, e.g. "1;33" for bold yellow.
+	// it's underline ("4") by default
+	MatchStyle string
+	// SGR parameters of the candidate which is exactly what's been typed,
+	// e.g. `git` among `git` and `gitk`. it isn't marked by default
+	ExactMatchStyle string
+	// SGR parameters of the descriptions of the candidates of a
+	// DescribedCompleter in the completion menu, e.g. "2" for faint. they
+	// aren't styled by default
+	DescriptionStyle string
+
+	// insert the only candidate left instead of listing it, also when the
+	// menu is shown or typing narrows it down to one
+	CompleteSingleImmediately bool
+	// appended to the only candidate when it's inserted, e.g. " ", unless
+	// it ends with it already
+	CompleteSuffix string
+
+	// sort the completion candidates with the collation of the locale (a
+	// BCP 47 tag like "sv-SE"), or with FuncCollate which takes precedence.
+	// They're sorted in byte order if both are empty.
+	Locale      string
+	FuncCollate func(a, b string) int
+
+	// expand $VAR, ${VAR} and ~user in the accepted line before it's
+	// returned, history keeps the line as typed.
+	// the variables are taken from os.Environ unless FuncEnviron is set
+	ExpandEnv   bool
+	FuncEnviron func() []string
+	// expand the events of the history in the accepted line, like !! or
+	// !$, see ExpandHistory. The line is edited again if an event isn't
+	// found. The history keeps the expanded line
+	HistoryExpand bool
+	// called with the expanded line before it's accepted, it returns false
+	// to edit it again, like histverify in bash
+	FuncHistoryExpanded func(line string) bool
+
+	// M-Enter inserts a newline into the line rather than accepting the
+	// text before the cursor. Up and Down move between the rows of a line
+	// holding newlines before going through the history
+	MultiLine bool
+	// called on Enter, a newline is inserted at the cursor instead of
+	// accepting the line while it returns false, e.g. while the brackets
+	// of the line aren't balanced
+	FuncIsComplete func(line []rune) bool
+
+	// called with the time spent on each key, to find out where the lag
+	// of slow terminals comes from
+	FuncOnKeyLatency func(KeyLatency)
+	// draw the latency of the last key at the right of the line
+	ShowLatency bool
+
+	// suggest below the line the key which does at once what a key
+	// pressed over and over did, e.g. M-b after Left, Left, Left, Left.
+	// The keys are named as bound in the Keymaps
+	Trainer bool
+
+	// called by the ioloop whenever the State changes, e.g. to show the
+	// vi mode in the prompt
+	FuncOnStateChange func(EditorState)
+	// called by the ioloop with the EditMode of the State when it changes,
+	// also when the vi mode is entered. e.g. for the cursor shape of zsh:
+	//   cfg.FuncOnModeChange = func(m readline.Mode) {
+	//     if m == readline.ModeViCommand {
+	//       os.Stdout.WriteString("\033[2 q") // block
+	//     } else {
+	//       os.Stdout.WriteString("\033[6 q") // bar
+	//     }
+	//   }
+	FuncOnModeChange func(mode Mode)
 
 	// Any key press will pass to Listener
 	// NOTE: Listener will be triggered by (nil, 0, 0) immediately
@@ -48,22 +277,101 @@ type Config struct {
 
 	Painter Painter
 
+	// marks the ranges of the line it returns, e.g. the errors found by a
+	// validator, it's called on each redraw. It's ignored if the Painter
+	// changes the length of the line
+	FuncDiagnose func(line []rune) []Diagnostic
+	// the SGR parameters of the Diagnostics, it's a red undercurl by
+	// default, or reverse video if the terminal lacks undercurl
+	DiagnosticStyle string
+	// colors the line on each redraw, e.g. the keywords of a language: it
+	// returns the styled ranges of the line, pos is the cursor. The
+	// Diagnostics are drawn over them. Unlike the Painter's, its styles
+	// don't take part in the layout of the line
+	FuncHighlight func(line []rune, pos int) []StyleSpan
+
+	// draw the latest history item which begins with the line dimmed
+	// after it, while typing at its end, like fish. Right or End accepts it
+	AutoSuggest bool
+	// gives the suggestions instead of the history, setting it enables
+	// AutoSuggest
+	Suggester Suggester
+	// the SGR parameters of the suggestion, faint ("2") by default
+	SuggestionStyle string
+
+	// the time the Listener, the Painter, FuncDiagnose, FuncHighlight and
+	// the Suggester may take for a key, the result of the one which
+	// overruns it is dropped and the line is drawn without it until it
+	// returns. Unlimited if 0
+	HookBudget time.Duration
+	// called on its own goroutine when a hook overruns the HookBudget,
+	// with its name
+	FuncOnSlowHook func(hook string, budget time.Duration)
+
+	// experimental: Meta-n adds a cursor at the next occurrence of the
+	// word under the cursor, the characters typed or deleted and the
+	// moves by a character then apply at all the cursors
+	MultiCursor bool
+
 	// If VimMode is true, readline will in vim.insert mode by default
 	VimMode bool
+	// backs the "+ and "* registers of vim mode, it's the clipboard of
+	// windows or an OSC52Clipboard writing to Stdout by default
+	Clipboard Clipboard
+	// copy the killed text (Ctrl-K, Ctrl-U, Ctrl-W...) to the Clipboard
+	// as well, and yank (Ctrl-Y) from it
+	BridgeClipboard bool
 
 	InterruptPrompt string
 	EOFPrompt       string
 
 	FuncGetWidth func() int
+	// the rows of the screen, -1 if unknown, for the pager and the
+	// history browser
+	FuncGetHeight func() int
 
 	Stdin       io.ReadCloser
 	StdinWriter io.Writer
 	Stdout      io.Writer
 	Stderr      io.Writer
+	// where the prompt and the line being edited are drawn, Stdout by
+	// default. Stderr shows the prompts of a program whose Stdout is
+	// piped, e.g. one printing a secret read by ReadPassword
+	PromptWriter io.Writer
+
+	// written to Stdout and Stderr in place of \n, e.g. "\r\n" for the
+	// raw TCP and telnet clients whose terminal doesn't translate it
+	LineEnding string
+	// treat the \r\n and \r\0 (telnet) line endings of the input as a
+	// single Enter, instead of accepting an empty line after each line
+	NormalizeEOL bool
+	// gets a copy of everything written to Stdout, Stderr and the
+	// PromptWriter, e.g. to log an admin console. Its errors are ignored
+	TeeWriter io.Writer
+	// drop the escape sequences and the control characters but \n and \t
+	// from the copy written to TeeWriter
+	TeeStripEscapes bool
 
 	EnableMask bool
 	MaskRune   rune
 
+	// the tries ReadPasswordConfirm gives to type the same password
+	// twice, 3 if 0
+	PasswordConfirmTries int
+
+	// have the terminal bracket the pasted text, which is then inserted as
+	// it is, newlines and tabs included, and undone at once
+	EnableBracketedPaste bool
+	// the keys typed closer than this, or already buffered, are taken for
+	// a paste: the line is drawn without the Painter, FuncDiagnose and
+	// FuncHighlight until it stops. 10ms if 0, set it to -1 to disable
+	PasteBurstGap time.Duration
+
+	// keep the control characters which aren't keys, and the control
+	// strings such as the replies of a terminal, out of the line, for the
+	// servers which echo it. Set by RemoteSvr
+	FilterControls bool
+
 	// erase the editing line after user submited it
 	// it use in IM usually.
 	UniqueEditLine bool
@@ -78,6 +386,23 @@ type Config struct {
 	FuncExitRaw         func() error
 	FuncOnWidthChanged  func(func())
 	ForceUseInteractive bool
+	// never change the terminal modes, for the callers which set up raw
+	// mode themselves (or have no terminal at all, like test rigs). The
+	// input is still edited interactively
+	DisableTermios bool
+
+	// record the decoded keys with their timing for bug reports, the
+	// typed text is reduced to its length (and a salted hash of it if
+	// TranscriptHashText is set), so that it isn't leaked
+	Transcript         io.Writer
+	TranscriptHashText bool
+
+	// called when a panic (e.g. raised by the AutoComplete or Listener)
+	// is recovered, the terminal has been restored already and the
+	// pending Readline returns the same error. The panics of the other
+	// goroutines, e.g. of the handler of ListenRemote or of
+	// FuncOnSlowHook, are reported too: they end the goroutine only.
+	FuncOnPanic func(err *PanicError)
 
 	// private fields
 	inited    bool
@@ -86,7 +411,7 @@ type Config struct {
 }
 
 func (c *Config) useInteractive() bool {
-	if c.ForceUseInteractive {
+	if c.ForceUseInteractive || c.DisableTermios {
 		return true
 	}
 	return c.FuncIsTerminal()
@@ -103,15 +428,45 @@ func (c *Config) Init() error {
 
 	c.Stdin, c.StdinWriter = NewFillableStdin(c.Stdin)
 
+	if c.InputrcFile != "" {
+		if err := c.loadInputrc(c.InputrcFile); err != nil {
+			return err
+		}
+	}
+	if c.KeyBackspace == "" && c.KeyDelete == "" {
+		c.KeyBackspace, c.KeyDelete = terminfoEraseKeys(os.Getenv("TERM"))
+	}
+	c.bindEraseKeys()
+
 	if c.Stdout == nil {
 		c.Stdout = Stdout
 	}
 	if c.Stderr == nil {
 		c.Stderr = Stderr
 	}
+	if c.PromptWriter == nil {
+		c.PromptWriter = c.Stdout
+	}
+	if c.LineEnding != "" {
+		c.Stdout = &eolWriter{c.Stdout, []byte(c.LineEnding)}
+		c.Stderr = &eolWriter{c.Stderr, []byte(c.LineEnding)}
+		c.PromptWriter = &eolWriter{c.PromptWriter, []byte(c.LineEnding)}
+	}
+	if c.TeeWriter != nil {
+		tee := newTeeSink(c.TeeWriter, c.TeeStripEscapes)
+		c.Stdout = &teeWriter{c.Stdout, tee}
+		c.Stderr = &teeWriter{c.Stderr, tee}
+		c.PromptWriter = &teeWriter{c.PromptWriter, tee}
+	}
 	if c.HistoryLimit == 0 {
 		c.HistoryLimit = 500
 	}
+	if c.PasteBurstGap == 0 {
+		c.PasteBurstGap = 10 * time.Millisecond
+	}
+	if c.ChordTimeout == 0 {
+		c.ChordTimeout = time.Second
+	}
 
 	if c.InterruptPrompt == "" {
 		c.InterruptPrompt = "^C"
@@ -127,12 +482,42 @@ func (c *Config) Init() error {
 	if c.AutoComplete == nil {
 		c.AutoComplete = &TabCompleter{}
 	}
+	if c.Lexer == nil {
+		c.Lexer = ShellLexer{}
+	}
+	if c.CommentBegin == "" {
+		c.CommentBegin = "#"
+	}
+	if c.MatchStyle == "" {
+		c.MatchStyle = "4"
+	}
+	if c.SuggestionStyle == "" {
+		c.SuggestionStyle = "2"
+	}
+	if c.DiagnosticStyle == "" {
+		c.DiagnosticStyle = reverseStyle
+		if DetectCapabilities().Undercurl {
+			c.DiagnosticStyle = undercurlStyle
+		}
+	}
 	if c.FuncGetWidth == nil {
 		c.FuncGetWidth = GetScreenWidth
 	}
+	if c.FuncGetHeight == nil {
+		c.FuncGetHeight = GetScreenHeight
+	}
 	if c.FuncIsTerminal == nil {
 		c.FuncIsTerminal = DefaultIsTerminal
 	}
+	if c.DisableTermios {
+		noop := func() error { return nil }
+		if c.FuncMakeRaw == nil {
+			c.FuncMakeRaw = noop
+		}
+		if c.FuncExitRaw == nil {
+			c.FuncExitRaw = noop
+		}
+	}
 	rm := new(RawMode)
 	if c.FuncMakeRaw == nil {
 		c.FuncMakeRaw = rm.Enter
@@ -170,11 +555,13 @@ func NewEx(cfg *Config) (*Instance, error) {
 	if cfg.Painter == nil {
 		cfg.Painter = &defaultPainter{}
 	}
-	return &Instance{
+	i := &Instance{
 		Config:    cfg,
 		Terminal:  t,
 		Operation: rl,
-	}, nil
+	}
+	registerInstance(i)
+	return i, nil
 }
 
 func New(prompt string) (*Instance, error) {
@@ -189,10 +576,34 @@ func (i *Instance) SetPrompt(s string) {
 	i.Operation.SetPrompt(s)
 }
 
+// SetPromptSegments replaces the prompt by one made of segments, see
+// PromptSegment.
+func (i *Instance) SetPromptSegments(segs ...PromptSegment) {
+	i.Operation.SetPromptSegments(segs)
+}
+
+// SetRightPrompt replaces the prompt drawn flush right, see
+// Config.RightPrompt.
+func (i *Instance) SetRightPrompt(s string) {
+	i.Operation.SetRightPrompt(s)
+}
+
+// SetMaskRune changes the mask rune from the next key on, without
+// touching the line or the history.
 func (i *Instance) SetMaskRune(r rune) {
 	i.Operation.SetMaskRune(r)
 }
 
+// SetCompleter changes the completer from the next key on.
+func (i *Instance) SetCompleter(c AutoCompleter) {
+	i.Operation.SetCompleter(c)
+}
+
+// SetListener changes the listener from the next key on.
+func (i *Instance) SetListener(l Listener) {
+	i.Operation.SetListener(l)
+}
+
 // change history persistence in runtime
 func (i *Instance) SetHistoryPath(p string) {
 	i.Operation.SetHistoryPath(p)
@@ -208,11 +619,22 @@ func (i *Instance) Stderr() io.Writer {
 	return i.Operation.Stderr()
 }
 
-// switch VimMode in runtime
+// switch VimMode in runtime, IsVimMode tells the new mode at once
 func (i *Instance) SetVimMode(on bool) {
 	i.Operation.SetVimMode(on)
 }
 
+// PlayMacro replays the keyboard macro recorded with C-x ( and C-x ), as
+// C-x e does.
+func (i *Instance) PlayMacro() {
+	i.Operation.PlayMacro()
+}
+
+// SetTrainer turns Config.Trainer on or off.
+func (i *Instance) SetTrainer(on bool) {
+	i.Operation.SetTrainer(on)
+}
+
 func (i *Instance) IsVimMode() bool {
 	return i.Operation.IsEnableVimMode()
 }
@@ -234,6 +656,13 @@ func (i *Instance) ReadPassword(prompt string) ([]byte, error) {
 	return i.Operation.Password(prompt)
 }
 
+// ReadPasswordConfirm reads a new password, then again after
+// confirmPrompt. It starts over while they don't match, up to
+// Config.PasswordConfirmTries times, then returns ErrPasswordMismatch.
+func (i *Instance) ReadPasswordConfirm(prompt, confirmPrompt string) ([]byte, error) {
+	return i.Operation.PasswordConfirm(prompt, confirmPrompt)
+}
+
 type Result struct {
 	Line  string
 	Error error
@@ -257,6 +686,22 @@ func (i *Instance) Readline() (string, error) {
 	return i.Operation.String()
 }
 
+// ReadlineContext is Readline, but it returns ctx.Err() when ctx is done,
+// e.g. on the shutdown of a server, and the line being edited is
+// abandoned. Unlike Close, the Instance can read the next line.
+func (i *Instance) ReadlineContext(ctx context.Context) (string, error) {
+	r, err := i.Operation.RunesContext(ctx)
+	return string(r), err
+}
+
+// ReadlineNoHistory is Readline, but the line isn't saved in the history
+// and the history can't be recalled while it's edited, for the prompts
+// which aren't for passwords but shouldn't touch it, e.g. of a token.
+func (i *Instance) ReadlineNoHistory() (string, error) {
+	r, err := i.Operation.RunesNoHistory()
+	return string(r), err
+}
+
 func (i *Instance) ReadlineWithDefault(what string) (string, error) {
 	i.Operation.SetBuffer(what)
 	return i.Operation.String()
@@ -266,6 +711,38 @@ func (i *Instance) SaveHistory(content string) error {
 	return i.Operation.SaveHistory(content)
 }
 
+// State returns a snapshot of the line editor as of the last key.
+func (i *Instance) State() EditorState {
+	return i.Operation.State()
+}
+
+// Page shows text in the built-in pager if it's longer than the screen,
+// or above the prompt otherwise. It must be called from the callbacks
+// which run while reading the line, such as the Listener.
+func (i *Instance) Page(text string) {
+	i.Operation.Page(text)
+}
+
+// Origin returns where the line is drawn relative to the cursor, for the
+// Painters which draw around it.
+func (i *Instance) Origin() LineOrigin {
+	return i.Operation.Origin()
+}
+
+// GetHistory returns the lines saved in the history, the oldest first,
+// with their times and tags.
+func (i *Instance) GetHistory() []HistoryEntry {
+	return i.Operation.GetHistory()
+}
+
+// PinHistory pins or unpins the latest history item which is content,
+// so that it survives HistoryLimit and it's found first by the search.
+// The pin is saved in the HistoryFile on Close. It returns false if there
+// isn't.
+func (i *Instance) PinHistory(content string, pinned bool) bool {
+	return i.Operation.PinHistory(content, pinned)
+}
+
 // same as readline
 func (i *Instance) ReadSlice() ([]byte, error) {
 	return i.Operation.Slice()
@@ -275,6 +752,7 @@ func (i *Instance) ReadSlice() ([]byte, error) {
 // if there has a pending reading operation, that reading will be interrupted.
 // so you can capture the signal and call Instance.Close(), it's thread-safe.
 func (i *Instance) Close() error {
+	unregisterInstance(i)
 	i.Config.Stdin.Close()
 	i.Operation.Close()
 	if err := i.Terminal.Close(); err != nil {
@@ -298,6 +776,14 @@ func (i *Instance) Write(b []byte) (int, error) {
 	return i.Stdout().Write(b)
 }
 
+// PrintAbovePrompt prints lines, e.g. a banner, to Stdout with a newline
+// after each. Before the first prompt and between reads they're just
+// written, while Readline is running the line is erased first and drawn
+// again below them.
+func (i *Instance) PrintAbovePrompt(lines ...string) {
+	i.Operation.PrintAbovePrompt(lines...)
+}
+
 // WriteStdin prefill the next Stdin fetch
 // Next time you call ReadLine() this value will be writen before the user input
 // ie :
@@ -316,6 +802,9 @@ func (i *Instance) SetConfig(cfg *Config) *Config {
 	if i.Config == cfg {
 		return cfg
 	}
+	if cfg.Painter == nil {
+		cfg.Painter = &defaultPainter{}
+	}
 	old := i.Config
 	i.Config = cfg
 	i.Operation.SetConfig(cfg)
@@ -327,6 +816,41 @@ func (i *Instance) Refresh() {
 	i.Operation.Refresh()
 }
 
+// BeginUpdate starts a batch of changes, e.g. SetPrompt and Refresh,
+// which are drawn at once by the matching EndUpdate instead of one at a
+// time, so that the line doesn't flash. The batches can be nested.
+func (i *Instance) BeginUpdate() {
+	i.Operation.BeginUpdate()
+}
+
+// EndUpdate ends the batch started by BeginUpdate, and draws the line if
+// it's been changed.
+func (i *Instance) EndUpdate() {
+	i.Operation.EndUpdate()
+}
+
+// BindKey makes the keys of sequence, e.g. {CharCtrlX, 'u'}, run handler
+// while editing the line, which can edit the buffer, accept the line or
+// abandon it. It replaces the handler bound to the same keys. The keys
+// which perform the actions of other keys per mode are bound with
+// Config.Keymaps and Config.Chords instead.
+func (i *Instance) BindKey(sequence []rune, handler KeyHandler) {
+	i.Operation.BindKey(sequence, handler)
+}
+
+// Unbind removes the handler bound to sequence by BindKey.
+func (i *Instance) Unbind(sequence []rune) {
+	i.Operation.Unbind(sequence)
+}
+
+// Redraw repaints the line from scratch on the current line of the
+// cursor, unlike Refresh which erases the lines it supposes the line
+// occupies. It's meant for when the screen has been messed up, and it's
+// done before the next key.
+func (i *Instance) Redraw() {
+	i.Operation.Redraw()
+}
+
 // HistoryDisable the save of the commands into the history
 func (i *Instance) HistoryDisable() {
 	i.Operation.history.Disable()
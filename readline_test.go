@@ -1,10 +1,56 @@
 package readline
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// newTestInstance returns an Instance reading the keys written to w, on a
+// terminal of 80 columns. The fields of cfg which are set are kept, and cfg
+// may be nil. Both are closed when the test ends.
+func newTestInstance(t testing.TB, cfg *Config) (*Instance, *io.PipeWriter) {
+	t.Helper()
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	r, w := io.Pipe()
+	if cfg.Stdin == nil {
+		cfg.Stdin = r
+	}
+	if cfg.Stdout == nil {
+		cfg.Stdout = ioutil.Discard
+	}
+	if cfg.FuncGetWidth == nil {
+		cfg.FuncGetWidth = func() int { return 80 }
+	}
+	if cfg.FuncIsTerminal == nil {
+		cfg.FuncIsTerminal = func() bool { return true }
+	}
+	if cfg.FuncMakeRaw == nil {
+		cfg.FuncMakeRaw = func() error { return nil }
+	}
+	if cfg.FuncExitRaw == nil {
+		cfg.FuncExitRaw = func() error { return nil }
+	}
+	rl, err := NewEx(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		w.Close()
+		rl.Close()
+	})
+	return rl, w
+}
+
 func TestRace(t *testing.T) {
 	rl, err := NewEx(&Config{})
 	if err != nil {
@@ -25,3 +71,338 @@ func TestRace(t *testing.T) {
 
 	rl.Readline()
 }
+
+type panicCompleter struct{}
+
+func (panicCompleter) Do([]rune, int) ([][]rune, int) {
+	panic("boom")
+}
+
+func TestRecoverPanic(t *testing.T) {
+	var recovered *PanicError
+	rl, w := newTestInstance(t, &Config{
+		AutoComplete: panicCompleter{},
+		FuncOnPanic:  func(err *PanicError) { recovered = err },
+	})
+
+	go w.Write([]byte("ab\t"))
+	if _, err := rl.Readline(); err == nil || recovered == nil || recovered.Value != "boom" {
+		t.Fatal("panic is not recovered", err)
+	}
+
+	go w.Write([]byte("cd\r"))
+	if line, err := rl.Readline(); err != nil || line != "cd" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestRecoverPanicRedraw(t *testing.T) {
+	out := new(syncBuffer)
+	var panicked int32
+	rl, w := newTestInstance(t, &Config{
+		Stdout: out,
+		Prompt: "> ",
+		Painter: funcPainter(func(line []rune, pos int) []rune {
+			if string(line) == "ab" && atomic.CompareAndSwapInt32(&panicked, 0, 1) {
+				panic("boom")
+			}
+			return line
+		}),
+		FuncOnPanic: func(*PanicError) {},
+	})
+
+	go w.Write([]byte("ab"))
+	if _, err := rl.Readline(); err == nil {
+		t.Fatal("panic is not recovered")
+	}
+
+	drawn := len(out.String())
+	go w.Write([]byte("cd\r"))
+	if line, err := rl.Readline(); err != nil || line != "cd" {
+		t.Fatal("result not expect", line, err)
+	}
+	// the prompt and the line are drawn again
+	if redrawn := out.String()[drawn:]; !strings.Contains(redrawn, "> cd") {
+		t.Fatalf("result not expect %q", redrawn)
+	}
+}
+
+func TestAcceptBeforeCursor(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+
+	go w.Write([]byte("echo a; echo b\x02\x02\x02\x02\x02\x02\x02\x1b\r"))
+	if line, err := rl.Readline(); err != nil || line != "echo a;" {
+		t.Fatal("result not expect", line, err)
+	}
+	go w.Write([]byte("\r"))
+	if line, err := rl.Readline(); err != nil || line != " echo b" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestPushLine(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+
+	go w.Write([]byte("git commit -m\x1bqgit status\r"))
+	if line, err := rl.Readline(); err != nil || line != "git status" {
+		t.Fatal("result not expect", line, err)
+	}
+	go w.Write([]byte(" x\r"))
+	if line, err := rl.Readline(); err != nil || line != "git commit -m x" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestDisableTermios(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		DisableTermios: true,
+	})
+
+	go w.Write([]byte("ab\x02c\r"))
+	if line, err := rl.Readline(); err != nil || line != "acb" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestInsertComment(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+
+	go w.Write([]byte("rm -rf build\x1b#ls\r"))
+	if line, err := rl.Readline(); err != nil || line != "ls" {
+		t.Fatal("result not expect", line, err)
+	}
+	go w.Write([]byte("\x10\x10\r"))
+	if line, err := rl.Readline(); err != nil || line != "#rm -rf build" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+func TestPromptWriter(t *testing.T) {
+	out, prompts := new(syncBuffer), new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Prompt:       "> ",
+		Stdout:       out,
+		PromptWriter: prompts,
+	})
+
+	go w.Write([]byte("ls\r"))
+	if line, err := rl.Readline(); err != nil || line != "ls" {
+		t.Fatal("result not expect", line, err)
+	}
+	cfg := rl.GenPasswordConfig()
+	cfg.Prompt = "password: "
+	cfg.FuncIsTerminal = func() bool { return true }
+	go w.Write([]byte("secret\r"))
+	if pw, err := rl.ReadPasswordWithConfig(cfg); err != nil || string(pw) != "secret" {
+		t.Fatal("result not expect", string(pw), err)
+	}
+	fmt.Fprint(rl, "printed")
+
+	if got := out.String(); got != "printed" {
+		t.Fatalf("unexpected %q on Stdout", got)
+	}
+	if got := prompts.String(); !strings.Contains(got, "> ls") || !strings.Contains(got, "password: ") || strings.Contains(got, "secret") {
+		t.Fatalf("unexpected %q on the PromptWriter", got)
+	}
+}
+
+type funcPainter func(line []rune, pos int) []rune
+
+func (f funcPainter) Paint(line []rune, pos int) []rune {
+	return f(line, pos)
+}
+
+func TestClearScreenRepaint(t *testing.T) {
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Prompt:          "> ",
+		Stdout:          out,
+		ClearScreenMode: ClearScreenRepaint,
+	})
+
+	go w.Write([]byte("ab\x0c\r"))
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+	if !strings.Contains(out.String(), "\r\033[J> ab") {
+		t.Fatalf("not redrawn: %q", out.String())
+	}
+	if strings.Contains(out.String(), "\033[H") {
+		t.Fatalf("screen is cleared: %q", out.String())
+	}
+}
+
+func TestClearScreenScroll(t *testing.T) {
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Prompt:          "> ",
+		Stdout:          out,
+		ClearScreenMode: ClearScreenScroll,
+		FuncGetHeight:   func() int { return 3 },
+	})
+
+	go w.Write([]byte("ab\x0c\r"))
+	if line, err := rl.Readline(); err != nil || line != "ab" {
+		t.Fatal("result not expect", line, err)
+	}
+	// scrolled by the height of the config
+	if !strings.Contains(out.String(), "\n\n\n") || strings.Contains(out.String(), "\n\n\n\n") {
+		t.Fatalf("not scrolled: %q", out.String())
+	}
+}
+
+func TestAuxOutput(t *testing.T) {
+	out, aux := new(syncBuffer), new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Stdout:       out,
+		AuxOutput:    aux,
+		AutoComplete: staticCompleter{"get", "git"},
+	})
+
+	go w.Write([]byte("g\t\r"))
+	if line, err := rl.Readline(); err != nil || line != "g" {
+		t.Fatal("result not expect", line, err)
+	}
+	// each refresh writes the whole listing
+	if !strings.HasPrefix(aux.String(), "get git \n") || strings.Contains(out.String(), "git") {
+		t.Fatalf("listing not expect: %q %q", aux.String(), out.String())
+	}
+}
+
+func TestReadlineContext(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		w.Write([]byte("abc"))
+		for rl.Operation.buf.Len() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if line, err := rl.ReadlineContext(ctx); err != context.Canceled || line != "" {
+		t.Fatal("result not expect", line, err)
+	}
+
+	// the partial line is gone
+	go w.Write([]byte("x\r"))
+	if line, err := rl.Readline(); err != nil || line != "x" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestReadlineContextAccepted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rl, w := newTestInstance(t, &Config{
+		// the context is done while the line is being accepted
+		FuncFilterInputRune: func(r rune) (rune, bool) {
+			if r == CharEnter && ctx.Err() == nil {
+				cancel()
+				time.Sleep(10 * time.Millisecond)
+			}
+			return r, true
+		},
+	})
+
+	go w.Write([]byte("old\r"))
+	if line, err := rl.ReadlineContext(ctx); err != context.Canceled || line != "" {
+		t.Fatal("result not expect", line, err)
+	}
+	// the line is dropped rather than returned by the next call
+	go w.Write([]byte("x\r"))
+	if line, err := rl.Readline(); err != nil || line != "x" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestSetters(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		AutoComplete: staticCompleter{"alpha"},
+	})
+	rl.SaveHistory("old")
+
+	rl.SetCompleter(staticCompleter{"beta"})
+	rl.SetVimMode(true)
+	go w.Write([]byte("b\t\r"))
+	if line, err := rl.Readline(); err != nil || line != "beta " && line != "beta" {
+		t.Fatal("result not expect", line, err)
+	}
+	if !rl.IsVimMode() {
+		t.Fatal("vim mode is not set")
+	}
+
+	// the history is kept
+	go w.Write([]byte("\x1bk\r"))
+	if line, err := rl.Readline(); err != nil || line != "beta" {
+		t.Fatal("result not expect", line, err)
+	}
+}
+
+func TestPrintAbovePrompt(t *testing.T) {
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Stdout: out,
+		Prompt: "> ",
+	})
+
+	// before the first prompt
+	rl.PrintAbovePrompt("welcome", "motd\n")
+	if out.String() != "welcome\nmotd\n" {
+		t.Fatalf("unexpected %q", out.String())
+	}
+
+	go func() {
+		w.Write([]byte("ab"))
+		for rl.Operation.buf.Len() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		rl.PrintAbovePrompt("news")
+		w.Write([]byte("c\r"))
+	}()
+	if line, err := rl.Readline(); err != nil || line != "abc" {
+		t.Fatal("result not expect", line, err)
+	}
+	// erased before, drawn again after
+	if !strings.Contains(out.String(), "> ab\033[J\033[2K\rnews\n> ab\033[J") {
+		t.Fatalf("unexpected %q", out.String())
+	}
+
+	// between reads
+	n := len(out.String())
+	rl.PrintAbovePrompt("bye")
+	if s := out.String()[n:]; s != "bye\n" {
+		t.Fatalf("unexpected %q", s)
+	}
+}
+
+func TestRefreshAllocs(t *testing.T) {
+	cfg := &Config{ForceUseInteractive: true, Painter: &defaultPainter{}}
+	rb := NewRuneBuffer(ioutil.Discard, "> ", cfg, 20)
+	rb.Set([]rune("a line which wraps on the screen"))
+	rb.MoveToLineStart()
+	// the moves of the cursor draw the line again in the buffers of the
+	// last refresh
+	if n := testing.AllocsPerRun(100, func() {
+		rb.MoveForward()
+		rb.MoveBackward()
+	}); n != 0 {
+		t.Fatal("allocations per refresh", n)
+	}
+}
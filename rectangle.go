@@ -0,0 +1,166 @@
+package readline
+
+// The rectangles span the display rows of a line which wraps, between the
+// columns of the mark and the cursor, e.g. to cut a column out of pasted
+// tabular arguments and put it back elsewhere.
+
+// SetMark sets the mark at the cursor, the other corner of the rectangles.
+func (r *RuneBuffer) SetMark() {
+	r.Lock()
+	r.mark = r.idx
+	r.Unlock()
+}
+
+// cell is where a rune of the line is displayed.
+type cell struct {
+	row, col int
+}
+
+// cells lays out the line like the terminal wraps it, the cell of the
+// end of the line is the last one.
+func (r *RuneBuffer) cells() []cell {
+	width := r.width
+	if width <= 0 {
+		width = 80
+	}
+	ret := make([]cell, 0, len(r.buf)+1)
+	row, col := 0, r.promptLen()%width
+	for _, e := range r.buf {
+		w := runes.Width(e)
+		if col+w > width {
+			row, col = row+1, 0
+		}
+		ret = append(ret, cell{row, col})
+		if e == '\n' {
+			row, col = row+1, 0
+			continue
+		}
+		col += w
+	}
+	return append(ret, cell{row, col})
+}
+
+// KillRectangle cuts the rectangle between the mark and the cursor, which
+// moves to its top left corner.
+func (r *RuneBuffer) KillRectangle() (success bool) {
+	r.Refresh(func() {
+		if r.mark < 0 || r.mark > len(r.buf) || r.mark == r.idx {
+			return
+		}
+		cells := r.cells()
+		a, b := cells[r.mark], cells[r.idx]
+		top, bottom := minInt(a.row, b.row), maxInt(a.row, b.row)
+		left, right := minInt(a.col, b.col), maxInt(a.col, b.col)
+		if left == right {
+			return
+		}
+
+		rect := make([][]rune, bottom-top+1)
+		kept := make([]rune, 0, len(r.buf))
+		newIdx := -1
+		for i, e := range r.buf {
+			c := cells[i]
+			if c.row == top && c.col >= left && newIdx < 0 {
+				newIdx = len(kept)
+			}
+			if c.row >= top && c.row <= bottom && c.col >= left && c.col < right && e != '\n' {
+				rect[c.row-top] = append(rect[c.row-top], e)
+				continue
+			}
+			kept = append(kept, e)
+		}
+		if newIdx < 0 {
+			newIdx = len(kept)
+		}
+		r.buf, r.idx, r.rect = kept, newIdx, rect
+		r.mark = -1
+		success = true
+	})
+	return
+}
+
+// YankRectangle inserts the last killed rectangle with its top left
+// corner at the cursor, the rows which are too short are padded by
+// spaces.
+func (r *RuneBuffer) YankRectangle() (success bool) {
+	r.Refresh(func() {
+		if len(r.rect) == 0 {
+			return
+		}
+		cells := r.cells()
+		start := cells[r.idx]
+
+		// find where the rows go first, then insert the last one first
+		// so that the positions stay valid
+		at := make([]int, len(r.rect))
+		pads := make([]int, len(r.rect))
+		for k := range r.rect {
+			row := start.row + k
+			at[k], pads[k] = r.rectangleCell(cells, row, start.col)
+		}
+		idx := r.idx
+		for k := len(r.rect) - 1; k >= 0; k-- {
+			piece := append(runesOf(' ', pads[k]), r.rect[k]...)
+			tail := append(runes.Copy(piece), r.buf[at[k]:]...)
+			r.buf = append(r.buf[:at[k]], tail...)
+			if k == 0 {
+				idx = at[k] + len(piece)
+			}
+		}
+		r.idx = idx
+		success = true
+	})
+	return
+}
+
+// rectangleCell finds where to insert at col of the row, and how many
+// spaces are missing if the row is too short.
+func (r *RuneBuffer) rectangleCell(cells []cell, row, col int) (at, pad int) {
+	last := -1
+	for i, c := range cells[:len(r.buf)] {
+		if c.row < row {
+			continue
+		} else if c.row > row {
+			break
+		}
+		if c.col >= col {
+			return i, 0
+		}
+		last = i
+	}
+	end := cells[len(r.buf)]
+	switch {
+	case last >= 0 && r.buf[last] == '\n':
+		return last, col - cells[last].col
+	case last >= 0:
+		return last + 1, col - cells[last].col - runes.Width(r.buf[last])
+	case end.row == row:
+		return len(r.buf), col - end.col
+	}
+	return len(r.buf), 0
+}
+
+func runesOf(r rune, n int) []rune {
+	if n <= 0 {
+		return nil
+	}
+	ret := make([]rune, n)
+	for i := range ret {
+		ret[i] = r
+	}
+	return ret
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,42 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestRectangle(t *testing.T) {
+	cfg := &Config{Painter: &defaultPainter{}, FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(nil, "", cfg, 10)
+	if rb.KillRectangle() {
+		t.Fatal("killed without a mark")
+	}
+
+	// abc  12345
+	// def  67890
+	// ghi
+	rb.SetWithIdx(0, []rune("abc  12345def  67890ghi"))
+	rb.SetMark()
+	rb.SetWithIdx(13, rb.Runes())
+	if !rb.KillRectangle() {
+		t.Fatal("kill failed")
+	}
+	if string(rb.buf) != "  12345  67890ghi" || rb.idx != 0 {
+		t.Fatal("result not expect", string(rb.buf), rb.idx)
+	}
+
+	rb.SetWithIdx(7, rb.Runes())
+	if !rb.YankRectangle() {
+		t.Fatal("yank failed")
+	}
+	if string(rb.buf) != "  12345abc  67890ghidef" || rb.idx != 10 {
+		t.Fatal("result not expect", string(rb.buf), rb.idx)
+	}
+
+	// the short rows are padded
+	rb.rect = [][]rune{[]rune("X"), []rune("Y")}
+	rb.SetWithIdx(5, []rune("abcdefghijkl"))
+	rb.YankRectangle()
+	if string(rb.buf) != "abcdeXfghijkl   Y" || rb.idx != 6 {
+		t.Fatal("result not expect", string(rb.buf), rb.idx)
+	}
+}
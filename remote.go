@@ -3,13 +3,17 @@ package readline
 import (
 	"bufio"
 	"bytes"
+	"crypto/rand"
+	"crypto/tls"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type MsgType int16
@@ -22,19 +26,171 @@ const (
 	T_RAW
 	T_ERAW // exit raw
 	T_EOF
+	T_AUTH // the credentials of the client, before the reports
+	// the session the client resumes, or "" for a new one, before the
+	// reports. The server answers with the id of the session
+	T_SESSION
+	T_PING // with the interval of the pings in milliseconds
+	T_PONG
 )
 
+const (
+	// the largest message read, the longer data is sent in several
+	maxMessageSize = 1 << 20
+	// the largest message of the hello, read before the client is
+	// authenticated
+	maxHelloMessageSize = 64 << 10
+	// how long the client has to send its hello by default
+	remoteHelloTimeout = 10 * time.Second
+)
+
+// RemoteOptions secures the remote mode, see ListenRemoteEx and
+// DialRemoteEx.
+type RemoteOptions struct {
+	// the connections use TLS with it: the certificates of the server for
+	// the listener, and the roots to verify them for the client
+	TLSConfig *tls.Config
+	// checks the credentials the client sent, the connection is refused if
+	// it returns an error. conn is a *tls.Conn with TLSConfig, e.g. to
+	// check the certificates of the client
+	FuncAuthenticate func(conn net.Conn, credentials []byte) error
+	// sent by the client to authenticate
+	Credentials []byte
+	// the interval of the pings. The peer which pings or answers them is
+	// expected to send something within 3 intervals, or the connection is
+	// taken for lost. It's 0 to not ping
+	KeepAlive time.Duration
+	// how long the server keeps the session of a lost connection for its
+	// client to reconnect, and how long the client tries to. The line
+	// being edited is drawn again once it has. It's 0 to not reconnect
+	ResumeTimeout time.Duration
+	// how long the server waits for the credentials and the reports of a
+	// new connection, 10s if it's 0
+	HelloTimeout time.Duration
+}
+
+// remoteKeepAlive is the read deadline of a side of the remote mode, once
+// the peer is known to ping or to answer the pings.
+type remoteKeepAlive struct {
+	interval time.Duration
+	timeout  int64
+}
+
+// got extends the timeout for the pings of m, or for the answers to ours.
+func (k *remoteKeepAlive) got(m *Message) {
+	var timeout time.Duration
+	switch {
+	case m.Type == T_PING && len(m.Data) == 4:
+		timeout = 3 * time.Duration(binary.BigEndian.Uint32(m.Data)) * time.Millisecond
+	case m.Type == T_PONG:
+		timeout = 3 * k.interval
+	}
+	if timeout > time.Duration(atomic.LoadInt64(&k.timeout)) {
+		atomic.StoreInt64(&k.timeout, int64(timeout))
+	}
+}
+
+func (k *remoteKeepAlive) deadline(conn net.Conn) {
+	if timeout := time.Duration(atomic.LoadInt64(&k.timeout)); timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+}
+
+func (k *remoteKeepAlive) ping() *Message {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(k.interval/time.Millisecond))
+	return NewMessage(T_PING, data)
+}
+
+// remoteHello is what the client sends before the keys.
+type remoteHello struct {
+	// the client can reconnect, to the session if it isn't ""
+	resume     bool
+	session    string
+	isTerminal []byte
+	width      []byte
+}
+
+// readRemoteHello reads the hello of the client, checking its credentials.
+// The client which doesn't send it in time, or sends larger messages than
+// a hello needs, is refused.
+func readRemoteHello(conn net.Conn, buf *bufio.Reader, opts *RemoteOptions) (*remoteHello, error) {
+	timeout := remoteHelloTimeout
+	if opts != nil && opts.HelloTimeout > 0 {
+		timeout = opts.HelloTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	m, err := readMessage(buf, maxHelloMessageSize)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil && opts.FuncAuthenticate != nil {
+		if m.Type != T_AUTH {
+			err = fmt.Errorf("no credentials")
+		} else {
+			err = opts.FuncAuthenticate(conn, m.Data)
+		}
+		if err != nil {
+			NewMessage(T_DATA, []byte("readline: authentication failed\r\n")).WriteTo(conn)
+			return nil, err
+		}
+	}
+	// the server which doesn't check them ignores the credentials
+	for m.Type == T_AUTH {
+		if m, err = readMessage(buf, maxHelloMessageSize); err != nil {
+			return nil, err
+		}
+	}
+	hello := new(remoteHello)
+	if m.Type == T_SESSION {
+		hello.resume, hello.session = true, string(m.Data)
+		if m, err = readMessage(buf, maxHelloMessageSize); err != nil {
+			return nil, err
+		}
+	}
+	// receive isTerminal
+	if m.Type != T_ISTTY_REPORT || len(m.Data) != 2 {
+		return nil, fmt.Errorf("unexpected init message")
+	}
+	hello.isTerminal = m.Data
+
+	// receive width
+	m, err = readMessage(buf, maxHelloMessageSize)
+	if err != nil {
+		return nil, err
+	}
+	if m.Type != T_WIDTH_REPORT || len(m.Data) != 2 {
+		return nil, fmt.Errorf("unexpected init message")
+	}
+	hello.width = m.Data
+	return hello, nil
+}
+
 type RemoteSvr struct {
 	eof           int32
 	closed        int32
 	width         int32
 	reciveChan    chan struct{}
 	writeChan     chan *writeCtx
-	conn          net.Conn
 	isTerminal    bool
 	funcWidthChan func()
 	stopChan      chan struct{}
 
+	// the first connection, the ones the client of a session reconnects
+	// with are the writeLoop's
+	conn net.Conn
+
+	alive remoteKeepAlive
+	// the session, "" if it can't be resumed, how long it waits for the
+	// client and what draws the line again
+	session    string
+	resume     time.Duration
+	redraw     func()
+	attachChan chan net.Conn
+	lostChan   chan net.Conn
+
 	dataBufM sync.Mutex
 	dataBuf  bytes.Buffer
 }
@@ -57,57 +213,87 @@ func newWriteCtx(msg *Message) *writeCtx {
 }
 
 func NewRemoteSvr(conn net.Conn) (*RemoteSvr, error) {
+	return newRemoteSvr(conn, nil)
+}
+
+func newRemoteSvr(conn net.Conn, opts *RemoteOptions) (*RemoteSvr, error) {
+	buf := bufio.NewReader(conn)
+	hello, err := readRemoteHello(conn, buf, opts)
+	if err != nil {
+		return nil, err
+	}
+	return startRemoteSvr(conn, buf, hello, opts), nil
+}
+
+// startRemoteSvr serves the client of hello. Its session can be resumed
+// if both sides are willing to.
+func startRemoteSvr(conn net.Conn, buf *bufio.Reader, hello *remoteHello, opts *RemoteOptions) *RemoteSvr {
 	rs := &RemoteSvr{
 		width:      -1,
 		conn:       conn,
 		writeChan:  make(chan *writeCtx),
 		reciveChan: make(chan struct{}),
 		stopChan:   make(chan struct{}),
+		attachChan: make(chan net.Conn),
+		lostChan:   make(chan net.Conn),
+	}
+	if opts != nil {
+		rs.alive.interval = opts.KeepAlive
+		if hello.resume && opts.ResumeTimeout > 0 {
+			rs.resume = opts.ResumeTimeout
+			rs.session = newRemoteSession()
+		}
 	}
-	buf := bufio.NewReader(rs.conn)
+	rs.GotIsTerminal(hello.isTerminal)
+	rs.GotReportWidth(hello.width)
 
-	if err := rs.init(buf); err != nil {
-		return nil, err
+	go rs.readLoop(conn, buf)
+	go rs.writeLoop()
+	if rs.session != "" {
+		rs.writeMsg(NewMessage(T_SESSION, []byte(rs.session)))
 	}
+	return rs
+}
 
-	go rs.readLoop(buf)
-	go rs.writeLoop()
-	return rs, nil
+func newRemoteSession() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
 }
 
-func (r *RemoteSvr) init(buf *bufio.Reader) error {
-	m, err := ReadMessage(buf)
-	if err != nil {
-		return err
-	}
-	// receive isTerminal
-	if m.Type != T_ISTTY_REPORT {
-		return fmt.Errorf("unexpected init message")
-	}
-	r.GotIsTerminal(m.Data)
+// Session returns the id of the session, "" if it can't be resumed.
+func (r *RemoteSvr) Session() string {
+	return r.session
+}
 
-	// receive width
-	m, err = ReadMessage(buf)
-	if err != nil {
-		return err
+// attach resumes the session on the connection the client reconnected
+// with: what was written meanwhile is sent, and the line drawn again.
+func (r *RemoteSvr) attach(conn net.Conn, buf *bufio.Reader, hello *remoteHello) {
+	select {
+	case r.attachChan <- conn:
+	case <-r.stopChan:
+		conn.Close()
+		return
 	}
-	if m.Type != T_WIDTH_REPORT {
-		return fmt.Errorf("unexpected init message")
+	r.GotIsTerminal(hello.isTerminal)
+	go r.readLoop(conn, buf)
+	r.GotReportWidth(hello.width)
+	if r.redraw != nil {
+		r.redraw()
 	}
-	r.GotReportWidth(m.Data)
-
-	return nil
 }
 
 func (r *RemoteSvr) HandleConfig(cfg *Config) {
 	cfg.Stderr = r
 	cfg.Stdout = r
+	cfg.PromptWriter = r
 	cfg.Stdin = r
 	cfg.FuncExitRaw = r.ExitRawMode
 	cfg.FuncIsTerminal = r.IsTerminal
 	cfg.FuncMakeRaw = r.EnterRawMode
 	cfg.FuncExitRaw = r.ExitRawMode
 	cfg.FuncGetWidth = r.GetWidth
+	cfg.FilterControls = true
 	cfg.FuncOnWidthChanged = func(f func()) {
 		r.funcWidthChan = f
 	}
@@ -118,7 +304,7 @@ func (r *RemoteSvr) IsTerminal() bool {
 }
 
 func (r *RemoteSvr) checkEOF() error {
-	if atomic.LoadInt32(&r.eof) == 1 {
+	if atomic.LoadInt32(&r.eof) == 1 || atomic.LoadInt32(&r.closed) == 1 {
 		return io.EOF
 	}
 	return nil
@@ -135,7 +321,11 @@ func (r *RemoteSvr) Read(b []byte) (int, error) {
 	}
 
 	if n == 0 && err == io.EOF {
-		<-r.reciveChan
+		// the connection lost for good ends the input too
+		select {
+		case <-r.reciveChan:
+		case <-r.stopChan:
+		}
 		r.dataBufM.Lock()
 		n, err = r.dataBuf.Read(b)
 		r.dataBufM.Unlock()
@@ -150,15 +340,23 @@ func (r *RemoteSvr) Read(b []byte) (int, error) {
 }
 
 func (r *RemoteSvr) writeMsg(m *Message) error {
-	ctx := newWriteCtx(m)
-	r.writeChan <- ctx
-	reply := <-ctx.reply
-	return reply.err
+	_, err := r.write(m)
+	return err
 }
 
 func (r *RemoteSvr) Write(b []byte) (int, error) {
-	ctx := newWriteCtx(NewMessage(T_DATA, b))
-	r.writeChan <- ctx
+	return r.write(NewMessage(T_DATA, b))
+}
+
+// write waits for the writeLoop, unless the connection is closed, e.g.
+// while the Instance is closed after it.
+func (r *RemoteSvr) write(m *Message) (int, error) {
+	ctx := newWriteCtx(m)
+	select {
+	case r.writeChan <- ctx:
+	case <-r.stopChan:
+		return 0, io.ErrClosedPipe
+	}
 	reply := <-ctx.reply
 	return reply.n, reply.err
 }
@@ -171,20 +369,80 @@ func (r *RemoteSvr) ExitRawMode() error {
 	return r.writeMsg(NewMessage(T_ERAW, nil))
 }
 
+// writeLoop sends the messages. While the client of a session is away,
+// they are kept for it until it reconnects, or the session expires.
 func (r *RemoteSvr) writeLoop() {
 	defer r.Close()
 
-loop:
+	conn := r.conn
+	var pending []*Message
+	var expire <-chan time.Time
+	var ping <-chan time.Time
+	if r.alive.interval > 0 {
+		ticker := time.NewTicker(r.alive.interval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	lost := func() {
+		conn.Close()
+		conn = nil
+		expire = time.After(r.resume)
+	}
+	send := func(m *Message) (int, error) {
+		if r.alive.interval > 0 {
+			conn.SetWriteDeadline(time.Now().Add(3 * r.alive.interval))
+		}
+		n, err := m.WriteTo(conn)
+		if err != nil && r.session != "" {
+			lost()
+			pending = append(pending, m.keep())
+			return n, nil
+		}
+		return n, err
+	}
+
 	for {
 		select {
-		case ctx, ok := <-r.writeChan:
-			if !ok {
+		case ctx := <-r.writeChan:
+			if conn == nil {
+				pending = append(pending, ctx.msg.keep())
+				ctx.reply <- &writeReply{len(ctx.msg.Data) + 6, nil}
 				break
 			}
-			n, err := ctx.msg.WriteTo(r.conn)
+			n, err := send(ctx.msg)
 			ctx.reply <- &writeReply{n, err}
+		case <-ping:
+			if conn != nil {
+				send(r.alive.ping())
+			}
+		case c := <-r.lostChan:
+			if c == conn {
+				lost()
+			}
+		case c := <-r.attachChan:
+			if conn != nil {
+				conn.Close()
+			}
+			conn, expire = c, nil
+			msgs := append([]*Message{NewMessage(T_SESSION, []byte(r.session))}, pending...)
+			pending = nil
+			for i, m := range msgs {
+				send(m)
+				if conn == nil {
+					pending = append(pending, msgs[i+1:]...)
+					break
+				}
+			}
+		case <-expire:
+			return
 		case <-r.stopChan:
-			break loop
+			// the client of a session is told it ended, not to reconnect
+			if conn != nil && r.session != "" {
+				conn.SetWriteDeadline(time.Now().Add(time.Second))
+				NewMessage(T_EOF, nil).WriteTo(conn)
+				conn.Close()
+			}
+			return
 		}
 	}
 }
@@ -192,19 +450,36 @@ loop:
 func (r *RemoteSvr) Close() error {
 	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
 		close(r.stopChan)
-		r.conn.Close()
+		if r.session == "" {
+			r.conn.Close()
+		}
 	}
 	return nil
 }
 
-func (r *RemoteSvr) readLoop(buf *bufio.Reader) {
-	defer r.Close()
+// readLoop reads the messages of a connection. The one of a session which
+// is lost waits for the client to reconnect.
+func (r *RemoteSvr) readLoop(conn net.Conn, buf *bufio.Reader) {
+	defer func() {
+		if r.session == "" {
+			r.Close()
+			return
+		}
+		select {
+		case r.lostChan <- conn:
+		case <-r.stopChan:
+		}
+	}()
 	for {
+		r.alive.deadline(conn)
 		m, err := ReadMessage(buf)
 		if err != nil {
 			break
 		}
+		r.alive.got(m)
 		switch m.Type {
+		case T_PING:
+			r.writeMsg(NewMessage(T_PONG, nil))
 		case T_EOF:
 			atomic.StoreInt32(&r.eof, 1)
 			select {
@@ -228,6 +503,9 @@ func (r *RemoteSvr) readLoop(buf *bufio.Reader) {
 }
 
 func (r *RemoteSvr) GotIsTerminal(data []byte) {
+	if len(data) < 2 {
+		return
+	}
 	if binary.BigEndian.Uint16(data) == 0 {
 		r.isTerminal = false
 	} else {
@@ -236,6 +514,9 @@ func (r *RemoteSvr) GotIsTerminal(data []byte) {
 }
 
 func (r *RemoteSvr) GotReportWidth(data []byte) {
+	if len(data) < 2 {
+		return
+	}
 	atomic.StoreInt32(&r.width, int32(binary.BigEndian.Uint16(data)))
 	if r.funcWidthChan != nil {
 		r.funcWidthChan()
@@ -253,12 +534,22 @@ type Message struct {
 	Data []byte
 }
 
+// ReadMessage reads a message, which may be up to 1 MiB long.
 func ReadMessage(r io.Reader) (*Message, error) {
+	return readMessage(r, maxMessageSize)
+}
+
+// readMessage reads a message of up to max bytes of data, the length the
+// peer sent is checked before the data is allocated.
+func readMessage(r io.Reader, max int) (*Message, error) {
 	m := new(Message)
 	var length int32
 	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
 		return nil, err
 	}
+	if length < 2 || int64(length)-2 > int64(max) {
+		return nil, fmt.Errorf("invalid message length %d", length)
+	}
 	if err := binary.Read(r, binary.BigEndian, &m.Type); err != nil {
 		return nil, err
 	}
@@ -273,7 +564,31 @@ func NewMessage(t MsgType, data []byte) *Message {
 	return &Message{t, data}
 }
 
+// keep returns m with a copy of the data, which the writer may reuse once
+// Write returns.
+func (m *Message) keep() *Message {
+	return NewMessage(m.Type, append([]byte(nil), m.Data...))
+}
+
+// WriteTo writes the message, the data longer than ReadMessage reads is
+// written in several messages.
 func (m *Message) WriteTo(w io.Writer) (int, error) {
+	if m.Type == T_DATA && len(m.Data) > maxMessageSize {
+		total := 0
+		for data := m.Data; len(data) > 0; {
+			chunk := data
+			if len(chunk) > maxMessageSize {
+				chunk = chunk[:maxMessageSize]
+			}
+			n, err := NewMessage(T_DATA, chunk).WriteTo(w)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			data = data[len(chunk):]
+		}
+		return total, nil
+	}
 	buf := bytes.NewBuffer(make([]byte, 0, len(m.Data)+2+4))
 	binary.Write(buf, binary.BigEndian, int32(len(m.Data)+2))
 	binary.Write(buf, binary.BigEndian, m.Type)
@@ -286,11 +601,21 @@ func (m *Message) WriteTo(w io.Writer) (int, error) {
 
 type RemoteCli struct {
 	conn        net.Conn
+	credentials []byte
 	raw         RawMode
 	receiveChan chan struct{}
 	inited      int32
+	closed      int32
 	isTerminal  *bool
 
+	alive remoteKeepAlive
+	// how long to try to reconnect with dial, and the session to resume
+	resume  time.Duration
+	dial    func() (net.Conn, error)
+	session string
+	// the keys typed while reconnecting
+	pending []byte
+
 	data  bytes.Buffer
 	dataM sync.Mutex
 }
@@ -307,16 +632,32 @@ func (r *RemoteCli) MarkIsTerminal(is bool) {
 	r.isTerminal = &is
 }
 
+// SetCredentials sets the credentials sent to the server, see
+// RemoteOptions.FuncAuthenticate.
+func (r *RemoteCli) SetCredentials(credentials []byte) {
+	r.credentials = credentials
+}
+
+// SetKeepAlive sets the interval of the pings, see RemoteOptions.KeepAlive.
+func (r *RemoteCli) SetKeepAlive(interval time.Duration) {
+	r.alive.interval = interval
+}
+
+// SetReconnect makes the client reconnect with dial when the connection
+// is lost, trying for timeout, and resume its session on the server.
+func (r *RemoteCli) SetReconnect(timeout time.Duration, dial func() (net.Conn, error)) {
+	r.resume, r.dial = timeout, dial
+}
+
 func (r *RemoteCli) init() error {
 	if !atomic.CompareAndSwapInt32(&r.inited, 0, 1) {
 		return nil
 	}
 
-	if err := r.reportIsTerminal(); err != nil {
-		return err
-	}
-
-	if err := r.reportWidth(); err != nil {
+	r.dataM.Lock()
+	err := r.hello(r.conn)
+	r.dataM.Unlock()
+	if err != nil {
 		return err
 	}
 
@@ -324,37 +665,75 @@ func (r *RemoteCli) init() error {
 	DefaultOnWidthChanged(func() {
 		r.reportWidth()
 	})
+	if r.alive.interval > 0 {
+		go r.pingLoop()
+	}
+	return nil
+}
+
+// hello sends what the server reads before the keys, and the keys typed
+// while reconnecting, it's called under dataM.
+func (r *RemoteCli) hello(conn net.Conn) error {
+	msgs := []*Message{}
+	if r.credentials != nil {
+		msgs = append(msgs, NewMessage(T_AUTH, r.credentials))
+	}
+	if r.dial != nil {
+		msgs = append(msgs, NewMessage(T_SESSION, []byte(r.session)))
+	}
+	msgs = append(msgs, r.isTerminalReport(), r.widthReport())
+	if len(r.pending) > 0 {
+		msgs = append(msgs, NewMessage(T_DATA, r.pending))
+	}
+	for _, m := range msgs {
+		if _, err := m.WriteTo(conn); err != nil {
+			return err
+		}
+	}
+	r.pending = nil
 	return nil
 }
 
 func (r *RemoteCli) writeMsg(m *Message) error {
 	r.dataM.Lock()
+	defer r.dataM.Unlock()
+	if r.conn == nil {
+		return io.ErrClosedPipe
+	}
 	_, err := m.WriteTo(r.conn)
-	r.dataM.Unlock()
 	return err
 }
 
 func (r *RemoteCli) Write(b []byte) (int, error) {
 	m := NewMessage(T_DATA, b)
 	r.dataM.Lock()
+	defer r.dataM.Unlock()
+	if r.conn == nil {
+		r.pending = append(r.pending, b...)
+		return len(b), nil
+	}
 	_, err := m.WriteTo(r.conn)
-	r.dataM.Unlock()
+	if err != nil && r.session != "" {
+		// sent once reconnected
+		r.pending = append(r.pending, b...)
+		r.conn.Close()
+		return len(b), nil
+	}
 	return len(b), err
 }
 
-func (r *RemoteCli) reportWidth() error {
+func (r *RemoteCli) widthReport() *Message {
 	screenWidth := GetScreenWidth()
 	data := make([]byte, 2)
 	binary.BigEndian.PutUint16(data, uint16(screenWidth))
-	msg := NewMessage(T_WIDTH_REPORT, data)
+	return NewMessage(T_WIDTH_REPORT, data)
+}
 
-	if err := r.writeMsg(msg); err != nil {
-		return err
-	}
-	return nil
+func (r *RemoteCli) reportWidth() error {
+	return r.writeMsg(r.widthReport())
 }
 
-func (r *RemoteCli) reportIsTerminal() error {
+func (r *RemoteCli) isTerminalReport() *Message {
 	var isTerminal bool
 	if r.isTerminal != nil {
 		isTerminal = *r.isTerminal
@@ -367,20 +746,29 @@ func (r *RemoteCli) reportIsTerminal() error {
 	} else {
 		binary.BigEndian.PutUint16(data, 0)
 	}
-	msg := NewMessage(T_ISTTY_REPORT, data)
-	if err := r.writeMsg(msg); err != nil {
-		return err
+	return NewMessage(T_ISTTY_REPORT, data)
+}
+
+func (r *RemoteCli) pingLoop() {
+	ticker := time.NewTicker(r.alive.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if atomic.LoadInt32(&r.closed) == 1 {
+			return
+		}
+		r.writeMsg(r.alive.ping())
 	}
-	return nil
 }
 
-func (r *RemoteCli) readLoop() {
-	buf := bufio.NewReader(r.conn)
+func (r *RemoteCli) readLoop(conn net.Conn) {
+	buf := bufio.NewReader(conn)
 	for {
+		r.alive.deadline(conn)
 		msg, err := ReadMessage(buf)
 		if err != nil {
 			break
 		}
+		r.alive.got(msg)
 		switch msg.Type {
 		case T_ERAW:
 			r.raw.Exit()
@@ -388,10 +776,57 @@ func (r *RemoteCli) readLoop() {
 			r.raw.Enter()
 		case T_DATA:
 			os.Stdout.Write(msg.Data)
+		case T_EOF:
+			// the session ended
+			atomic.StoreInt32(&r.closed, 1)
+		case T_SESSION:
+			r.dataM.Lock()
+			r.session = string(msg.Data)
+			r.dataM.Unlock()
+		case T_PING:
+			r.writeMsg(NewMessage(T_PONG, nil))
 		}
 	}
 }
 
+// reconnect dials again after the connection was lost, until the timeout
+// of SetReconnect. It returns the new connection, or nil if the session
+// can't be resumed.
+func (r *RemoteCli) reconnect() net.Conn {
+	r.dataM.Lock()
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+	session := r.session
+	r.dataM.Unlock()
+	if r.dial == nil || session == "" || atomic.LoadInt32(&r.closed) == 1 {
+		return nil
+	}
+
+	deadline := time.Now().Add(r.resume)
+	backoff := 50 * time.Millisecond
+	for time.Now().Before(deadline) && atomic.LoadInt32(&r.closed) == 0 {
+		if conn, err := r.dial(); err == nil {
+			r.dataM.Lock()
+			err = r.hello(conn)
+			if err == nil {
+				r.conn = conn
+			}
+			r.dataM.Unlock()
+			if err == nil {
+				return conn
+			}
+			conn.Close()
+		}
+		time.Sleep(backoff)
+		if backoff < time.Second {
+			backoff *= 2
+		}
+	}
+	return nil
+}
+
 func (r *RemoteCli) ServeBy(source io.Reader) error {
 	if err := r.init(); err != nil {
 		return err
@@ -407,11 +842,14 @@ func (r *RemoteCli) ServeBy(source io.Reader) error {
 		}
 	}()
 	defer r.raw.Exit()
-	r.readLoop()
+	for conn := r.conn; conn != nil; conn = r.reconnect() {
+		r.readLoop(conn)
+	}
 	return nil
 }
 
 func (r *RemoteCli) Close() {
+	atomic.StoreInt32(&r.closed, 1)
 	r.writeMsg(NewMessage(T_EOF, nil))
 }
 
@@ -420,37 +858,105 @@ func (r *RemoteCli) Serve() error {
 }
 
 func ListenRemote(n, addr string, cfg *Config, h func(*Instance), onListen ...func(net.Listener) error) error {
+	return ListenRemoteEx(n, addr, cfg, nil, h, onListen...)
+}
+
+// ListenRemoteEx is ListenRemote with the TLS and the authentication of
+// opts, which may be nil.
+func ListenRemoteEx(n, addr string, cfg *Config, opts *RemoteOptions, h func(*Instance), onListen ...func(net.Listener) error) error {
 	ln, err := net.Listen(n, addr)
 	if err != nil {
 		return err
 	}
+	if opts != nil && opts.TLSConfig != nil {
+		ln = tls.NewListener(ln, opts.TLSConfig)
+	}
 	if len(onListen) > 0 {
 		if err := onListen[0](ln); err != nil {
 			return err
 		}
 	}
+	sessions := &remoteSessions{svrs: make(map[string]*RemoteSvr)}
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
 			break
 		}
 		go func() {
-			defer conn.Close()
-			rl, err := HandleConn(*cfg, conn)
+			// the handler's panic ends its session only
+			defer recoverGoroutine(cfg)
+			buf := bufio.NewReader(conn)
+			hello, err := readRemoteHello(conn, buf, opts)
 			if err != nil {
+				conn.Close()
 				return
 			}
+			if svr := sessions.get(hello.session); svr != nil {
+				svr.attach(conn, buf, hello)
+				return
+			}
+			svr := startRemoteSvr(conn, buf, hello, opts)
+			defer svr.Close()
+			rl, err := svr.newInstance(*cfg)
+			if err != nil {
+				return
+			}
+			if svr.session != "" {
+				svr.redraw = rl.Redraw
+				sessions.add(svr)
+				defer sessions.remove(svr)
+			}
 			h(rl)
 		}()
 	}
 	return nil
 }
 
+// remoteSessions are the sessions of a listener which can be resumed.
+type remoteSessions struct {
+	m    sync.Mutex
+	svrs map[string]*RemoteSvr
+}
+
+func (s *remoteSessions) get(session string) *RemoteSvr {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.svrs[session]
+}
+
+func (s *remoteSessions) add(svr *RemoteSvr) {
+	s.m.Lock()
+	s.svrs[svr.session] = svr
+	s.m.Unlock()
+}
+
+func (s *remoteSessions) remove(svr *RemoteSvr) {
+	s.m.Lock()
+	delete(s.svrs, svr.session)
+	s.m.Unlock()
+}
+
 func HandleConn(cfg Config, conn net.Conn) (*Instance, error) {
-	r, err := NewRemoteSvr(conn)
+	return HandleConnEx(cfg, conn, nil)
+}
+
+// HandleConnEx is HandleConn with the authentication and the keepalive of
+// opts, which may be nil. The TLS of opts is left to the listener, and
+// the sessions can only be resumed with ListenRemoteEx.
+func HandleConnEx(cfg Config, conn net.Conn, opts *RemoteOptions) (*Instance, error) {
+	if opts != nil && opts.ResumeTimeout > 0 {
+		noResume := *opts
+		noResume.ResumeTimeout = 0
+		opts = &noResume
+	}
+	r, err := newRemoteSvr(conn, opts)
 	if err != nil {
 		return nil, err
 	}
+	return r.newInstance(cfg)
+}
+
+func (r *RemoteSvr) newInstance(cfg Config) (*Instance, error) {
 	r.HandleConfig(&cfg)
 
 	rl, err := NewEx(&cfg)
@@ -461,15 +967,41 @@ func HandleConn(cfg Config, conn net.Conn) (*Instance, error) {
 }
 
 func DialRemote(n, addr string) error {
-	conn, err := net.Dial(n, addr)
+	return DialRemoteEx(n, addr, nil)
+}
+
+// DialRemoteEx is DialRemote with the TLS, the credentials, the keepalive
+// and the reconnection of opts, which may be nil.
+func DialRemoteEx(n, addr string, opts *RemoteOptions) error {
+	dial := func() (net.Conn, error) {
+		if opts != nil && opts.TLSConfig != nil {
+			return tls.Dial(n, addr, opts.TLSConfig)
+		}
+		return net.Dial(n, addr)
+	}
+	conn, err := dial()
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 
 	cli, err := NewRemoteCli(conn)
 	if err != nil {
+		conn.Close()
 		return err
 	}
+	defer func() {
+		cli.dataM.Lock()
+		if cli.conn != nil {
+			cli.conn.Close()
+		}
+		cli.dataM.Unlock()
+	}()
+	if opts != nil {
+		cli.SetCredentials(opts.Credentials)
+		cli.SetKeepAlive(opts.KeepAlive)
+		if opts.ResumeTimeout > 0 {
+			cli.SetReconnect(opts.ResumeTimeout, dial)
+		}
+	}
 	return cli.Serve()
 }
@@ -0,0 +1,392 @@
+package readline
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// remoteHandshake sends what RemoteCli sends before the keys.
+func remoteHandshake(w io.Writer, credentials []byte) error {
+	if credentials != nil {
+		if _, err := NewMessage(T_AUTH, credentials).WriteTo(w); err != nil {
+			return err
+		}
+	}
+	report := make([]byte, 2)
+	binary.BigEndian.PutUint16(report, 1)
+	if _, err := NewMessage(T_ISTTY_REPORT, report).WriteTo(w); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(report, 80)
+	_, err := NewMessage(T_WIDTH_REPORT, report).WriteTo(w)
+	return err
+}
+
+func TestRemoteAuth(t *testing.T) {
+	opts := &RemoteOptions{
+		FuncAuthenticate: func(conn net.Conn, credentials []byte) error {
+			if string(credentials) != "secret" {
+				return errors.New("denied")
+			}
+			return nil
+		},
+	}
+	for _, c := range []struct {
+		credentials []byte
+		ok          bool
+	}{
+		{[]byte("secret"), true},
+		{[]byte("guess"), false},
+		{nil, false},
+	} {
+		srv, cli := net.Pipe()
+		go remoteHandshake(cli, c.credentials)
+		replies := make(chan string, 1)
+		go func() {
+			m, err := ReadMessage(cli)
+			if err != nil {
+				replies <- err.Error()
+				return
+			}
+			replies <- string(m.Data)
+			io.Copy(ioutil.Discard, cli)
+		}()
+
+		rl, err := HandleConnEx(Config{}, srv, opts)
+		if (err == nil) != c.ok {
+			t.Fatalf("%q: expect %v, got %v", c.credentials, c.ok, err)
+		}
+		if !c.ok {
+			if reply := <-replies; !strings.Contains(reply, "authentication failed") {
+				t.Fatalf("%q: reply not expect %q", c.credentials, reply)
+			}
+		} else {
+			rl.Close()
+		}
+		srv.Close()
+		cli.Close()
+	}
+}
+
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestRemoteTLS(t *testing.T) {
+	cert, pool := testCertificate(t)
+	lines := make(chan string, 1)
+	listening := make(chan net.Listener, 1)
+	go ListenRemoteEx("tcp", "127.0.0.1:0", &Config{},
+		&RemoteOptions{TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}}},
+		func(rl *Instance) {
+			defer rl.Close()
+			line, _ := rl.Readline()
+			lines <- line
+		},
+		func(ln net.Listener) error {
+			listening <- ln
+			return nil
+		})
+	ln := <-listening
+	defer ln.Close()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go io.Copy(ioutil.Discard, conn)
+	if err := remoteHandshake(conn, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMessage(T_DATA, []byte("hi\r")).WriteTo(conn); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-lines:
+		if line != "hi" {
+			t.Fatal("result not expect", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line read")
+	}
+
+	// a plain connection doesn't get through
+	plain, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	go func() {
+		remoteHandshake(plain, nil)
+		NewMessage(T_DATA, []byte("plain\r")).WriteTo(plain)
+	}()
+	select {
+	case line := <-lines:
+		t.Fatal("plain connection accepted", line)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRemoteResume(t *testing.T) {
+	listen := func(opts *RemoteOptions) (net.Listener, chan string) {
+		lines := make(chan string, 1)
+		listening := make(chan net.Listener, 1)
+		go ListenRemoteEx("tcp", "127.0.0.1:0", &Config{}, opts,
+			func(rl *Instance) {
+				defer rl.Close()
+				line, err := rl.Readline()
+				if err != nil {
+					line = err.Error()
+				}
+				lines <- line
+			},
+			func(ln net.Listener) error {
+				listening <- ln
+				return nil
+			})
+		return <-listening, lines
+	}
+	// dial sends the hello of a client which can resume the session, and
+	// waits for the id of the session
+	dial := func(ln net.Listener, session string) (net.Conn, *bufio.Reader, string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		NewMessage(T_SESSION, []byte(session)).WriteTo(conn)
+		if err := remoteHandshake(conn, nil); err != nil {
+			t.Fatal(err)
+		}
+		buf := bufio.NewReader(conn)
+		for {
+			m, err := ReadMessage(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Type == T_SESSION {
+				return conn, buf, string(m.Data)
+			}
+		}
+	}
+	waitFor := func(buf *bufio.Reader, typ MsgType) {
+		t.Helper()
+		for {
+			m, err := ReadMessage(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Type == typ {
+				return
+			}
+		}
+	}
+
+	ln, lines := listen(&RemoteOptions{KeepAlive: 20 * time.Millisecond, ResumeTimeout: 5 * time.Second})
+	defer ln.Close()
+	conn, buf, session := dial(ln, "")
+	if session == "" {
+		t.Fatal("no session")
+	}
+	waitFor(buf, T_PING)
+	NewMessage(T_PING, []byte{0, 0, 0, 20}).WriteTo(conn)
+	waitFor(buf, T_PONG)
+
+	// the keys of the lost connection are kept
+	NewMessage(T_DATA, []byte("ab")).WriteTo(conn)
+	conn.Close()
+	conn, buf, resumed := dial(ln, session)
+	defer conn.Close()
+	if resumed != session {
+		t.Fatal("session not resumed", session, resumed)
+	}
+	NewMessage(T_DATA, []byte("c\r")).WriteTo(conn)
+	if line := <-lines; line != "abc" {
+		t.Fatal("result not expect", line)
+	}
+	// the client is told the session ended
+	waitFor(buf, T_EOF)
+
+	// the connection which stopped answering is lost, and its session
+	// ends unless it's resumed in time
+	ln, lines = listen(&RemoteOptions{ResumeTimeout: 100 * time.Millisecond})
+	defer ln.Close()
+	conn, _, _ = dial(ln, "")
+	defer conn.Close()
+	NewMessage(T_PING, []byte{0, 0, 0, 10}).WriteTo(conn)
+	select {
+	case line := <-lines:
+		if line != io.EOF.Error() {
+			t.Fatal("result not expect", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not ended")
+	}
+}
+
+func TestRemoteBadHello(t *testing.T) {
+	lines := make(chan string, 1)
+	listening := make(chan net.Listener, 1)
+	go ListenRemoteEx("tcp", "127.0.0.1:0", &Config{},
+		&RemoteOptions{
+			FuncAuthenticate: func(net.Conn, []byte) error { return nil },
+			HelloTimeout:     100 * time.Millisecond,
+		},
+		func(rl *Instance) {
+			defer rl.Close()
+			line, _ := rl.Readline()
+			lines <- line
+		},
+		func(ln net.Listener) error {
+			listening <- ln
+			return nil
+		})
+	ln := <-listening
+	defer ln.Close()
+
+	// refused checks the server closes the connection which sent frame
+	refused := func(frame []byte) {
+		t.Helper()
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write(frame)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.Copy(ioutil.Discard, conn); err != nil {
+			t.Fatalf("%x: connection not closed: %v", frame, err)
+		}
+	}
+	refused([]byte{0, 0, 0, 0, 0, byte(T_AUTH)})
+	refused([]byte{0xff, 0xff, 0xff, 0xff, 0, byte(T_AUTH)})
+	refused([]byte{0x7f, 0xff, 0xff, 0xff, 0, byte(T_AUTH)})
+	// larger than a hello needs
+	refused([]byte{0, 1, 0, 2, 0, byte(T_AUTH)})
+	// a short report
+	refused([]byte{0, 0, 0, 2, 0, byte(T_ISTTY_REPORT)})
+	// the client which sends nothing
+	refused(nil)
+
+	// the server still serves the well behaved clients
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go io.Copy(ioutil.Discard, conn)
+	if err := remoteHandshake(conn, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	NewMessage(T_DATA, []byte("hi\r")).WriteTo(conn)
+	select {
+	case line := <-lines:
+		if line != "hi" {
+			t.Fatal("result not expect", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line read")
+	}
+}
+
+func TestRemoteHandlerPanic(t *testing.T) {
+	panics := make(chan *PanicError, 2)
+	listening := make(chan net.Listener, 1)
+	go ListenRemote("tcp", "127.0.0.1:0",
+		&Config{FuncOnPanic: func(err *PanicError) { panics <- err }},
+		func(rl *Instance) {
+			panic("boom")
+		},
+		func(ln net.Listener) error {
+			listening <- ln
+			return nil
+		})
+	ln := <-listening
+	defer ln.Close()
+
+	// the session ends, the listener goes on
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remoteHandshake(conn, nil); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-panics:
+			if err.Value != "boom" {
+				t.Fatal("result not expect", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("panic not reported")
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.Copy(ioutil.Discard, conn); err != nil {
+			t.Fatal("connection not closed", err)
+		}
+		conn.Close()
+	}
+}
+
+func TestMessageSize(t *testing.T) {
+	var buf bytes.Buffer
+	data := bytes.Repeat([]byte("a"), maxMessageSize+10)
+	if _, err := NewMessage(T_DATA, data).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for buf.Len() > 0 {
+		m, err := ReadMessage(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m.Data...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data not expect", len(got))
+	}
+	if _, err := ReadMessage(bytes.NewReader([]byte{0, 0, 0, 1, 0, 0})); err == nil {
+		t.Fatal("short length accepted")
+	}
+}
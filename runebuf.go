@@ -1,12 +1,12 @@
 package readline
 
 import (
-	"bufio"
 	"bytes"
 	"io"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type runeBufferBck struct {
@@ -14,34 +14,151 @@ type runeBufferBck struct {
 	idx int
 }
 
+// RuneBuffer is the line being edited.
+//
+// Deprecated: it's an internal of the Operation, which isn't exported by
+// github.com/chzyer/readline/lineedit.
 type RuneBuffer struct {
 	buf    []rune
 	idx    int
-	prompt []rune
+	prompt []rune // as displayed, see layoutPrompt
 	w      io.Writer
 
+	origPrompt []rune
+	segments   []PromptSegment
+	// the width of prompt, and its layouts by terminal width, which are
+	// dropped when the prompt or the config changes
+	promptWidth int
+	layouts     map[int]promptLayout
+	// the prompt drawn flush right and its width, see Config.RightPrompt
+	rightPrompt []rune
+	rightWidth  int
+
 	hadClean    bool
 	interactive bool
 	cfg         *Config
 
 	width int
+	// the line is on the screen: it's been printed since the last Reset or
+	// Clean, see PrintAbove
+	drawn bool
+	// where the line was drawn last, see Origin
+	origin     LineOrigin
+	originLock sync.Mutex
 
 	bck *runeBufferBck
 
+	// the snapshots before the edits and the ones undone, see Undo.
+	// insertAt is where the typed characters which make the last edit
+	// end, -1 if it's not typing
+	undo     []*runeBufferBck
+	redo     []*runeBufferBck
+	insertAt int
+	undoing  bool
+
 	offset string
 
-	lastKill []rune
+	// the latest entry of the kill ring and the count of the kills, see
+	// killring.go. yanked is the length of the text inserted by the last
+	// yank, of the entry yankPos, or -1 after another key
+	lastKill   []rune
+	kills      int
+	killRing   [][]rune
+	appendKill bool
+	yanked     int
+	yankPos    int
+
+	// the secondary cursors, see AddCursor
+	cursors []int
+	// the spans highlighted on the line, see SetMarks
+	marks []Diagnostic
+	// the corner of the rectangles, -1 if it's not set, and the last
+	// rectangle killed, by rows
+	mark int
+	rect [][]rune
+
+	meter *latencyMeter
+	// runs the hooks within Config.HookBudget
+	hooks *hookBudget
+	// the line is drawn without the hooks of the Painter during a paste
+	// burst, stale until it's drawn with them again, see burst.go
+	burst bool
+	stale bool
+	// set by Abort, for the KeyHandler being run
+	aborted bool
+	// the whole line suggested, see suggest.go
+	suggested []rune
+
+	// the output of the refreshes is collected into a frame, which is
+	// written at once, at the end of the refresh or of the outermost
+	// BeginUpdate
+	frame      *bytes.Buffer
+	updates    int
+	frameDirty bool
+	// reused by every refresh rather than allocated for each key: the
+	// frame, the output of the line, the erasing of it and its layout
+	frames    bytes.Buffer
+	outputs   bytes.Buffer
+	cleaning  []byte
+	positions []rowCol
+	// the copy of the line before an edit, see edit
+	spare []rune
 
 	sync.Mutex
 }
 
-func (r *RuneBuffer) pushKill(text []rune) {
-	r.lastKill = append([]rune{}, text...)
+// CopyRange puts the runes in [start, end) into the kill buffer without
+// deleting them.
+func (r *RuneBuffer) CopyRange(start, end int) {
+	r.Lock()
+	defer r.Unlock()
+	if start < 0 {
+		start = 0
+	}
+	if end > len(r.buf) {
+		end = len(r.buf)
+	}
+	if start < end {
+		r.pushKill(r.buf[start:end])
+	}
+}
+
+// KillRange deletes the runes in [start, end) into the kill buffer and
+// leaves the cursor at start.
+func (r *RuneBuffer) KillRange(start, end int) {
+	r.Refresh(func() {
+		if start < 0 {
+			start = 0
+		}
+		if end > len(r.buf) {
+			end = len(r.buf)
+		}
+		if start >= end {
+			return
+		}
+		r.pushKill(r.buf[start:end])
+		r.buf = append(r.buf[:start], r.buf[end:]...)
+		r.idx = start
+	})
+}
+
+// SetPos moves the cursor to idx.
+func (r *RuneBuffer) SetPos(idx int) {
+	r.Refresh(func() {
+		if idx < 0 {
+			idx = 0
+		}
+		if idx > len(r.buf) {
+			idx = len(r.buf)
+		}
+		r.idx = idx
+	})
 }
 
 func (r *RuneBuffer) OnWidthChange(newWidth int) {
 	r.Lock()
 	r.width = newWidth
+	r.layoutPrompt()
 	r.Unlock()
 }
 
@@ -67,6 +184,10 @@ func NewRuneBuffer(w io.Writer, prompt string, cfg *Config, width int) *RuneBuff
 		interactive: cfg.useInteractive(),
 		cfg:         cfg,
 		width:       width,
+		mark:        -1,
+		insertAt:    -1,
+		yanked:      -1,
+		hooks:       newHookBudget(),
 	}
 	rb.SetPrompt(prompt)
 	return rb
@@ -76,6 +197,8 @@ func (r *RuneBuffer) SetConfig(cfg *Config) {
 	r.Lock()
 	r.cfg = cfg
 	r.interactive = cfg.useInteractive()
+	r.layouts = nil
+	r.layoutPrompt()
 	r.Unlock()
 }
 
@@ -99,7 +222,7 @@ func (r *RuneBuffer) PromptLen() int {
 }
 
 func (r *RuneBuffer) promptLen() int {
-	return runes.WidthAll(runes.ColorFilter(r.prompt))
+	return r.promptWidth
 }
 
 func (r *RuneBuffer) RuneSlice(i int) []rune {
@@ -124,6 +247,13 @@ func (r *RuneBuffer) Runes() []rune {
 	return newr
 }
 
+// String returns the line.
+func (r *RuneBuffer) String() string {
+	r.Lock()
+	defer r.Unlock()
+	return string(r.buf)
+}
+
 func (r *RuneBuffer) Pos() int {
 	r.Lock()
 	defer r.Unlock()
@@ -170,6 +300,18 @@ func (r *RuneBuffer) WriteRunes(s []rune) {
 	})
 }
 
+// ReplaceBefore replaces the n runes before the cursor with s.
+func (r *RuneBuffer) ReplaceBefore(n int, s []rune) {
+	r.Refresh(func() {
+		if n > r.idx {
+			n = r.idx
+		}
+		tail := append(runes.Copy(s), r.buf[r.idx:]...)
+		r.buf = append(r.buf[:r.idx-n], tail...)
+		r.idx += len(s) - n
+	})
+}
+
 func (r *RuneBuffer) MoveForward() {
 	r.Refresh(func() {
 		if r.idx == len(r.buf) {
@@ -257,7 +399,7 @@ func (r *RuneBuffer) KillFront() {
 		}
 
 		length := len(r.buf) - r.idx
-		r.pushKill(r.buf[:r.idx])
+		r.pushBackKill(r.buf[:r.idx])
 		copy(r.buf[:length], r.buf[r.idx:])
 		r.idx = 0
 		r.buf = r.buf[:length]
@@ -333,14 +475,15 @@ func (r *RuneBuffer) BackEscapeWord() {
 		}
 		for i := r.idx - 1; i > 0; i-- {
 			if !IsWordBreak(r.buf[i]) && IsWordBreak(r.buf[i-1]) {
-				r.pushKill(r.buf[i:r.idx])
+				r.pushBackKill(r.buf[i:r.idx])
 				r.buf = append(r.buf[:i], r.buf[r.idx:]...)
 				r.idx = i
 				return
 			}
 		}
 
-		r.buf = r.buf[:0]
+		r.pushBackKill(r.buf[:r.idx])
+		r.buf = append(r.buf[:0], r.buf[r.idx:]...)
 		r.idx = 0
 	})
 }
@@ -356,6 +499,7 @@ func (r *RuneBuffer) Yank() {
 		buf = append(buf, r.buf[r.idx:]...)
 		r.buf = buf
 		r.idx += len(r.lastKill)
+		r.yanked, r.yankPos = len(r.lastKill), len(r.killRing)-1
 	})
 }
 
@@ -384,8 +528,13 @@ func (r *RuneBuffer) LineCount(width int) int {
 	if width == -1 {
 		width = r.width
 	}
+	r.Lock()
+	defer r.Unlock()
+	if r.multiline() {
+		return r.layout()[len(r.buf)].row + 1
+	}
 	return LineCount(width,
-		runes.WidthAll(r.buf)+r.PromptLen())
+		runes.WidthAll(r.buf)+r.promptLen())
 }
 
 func (r *RuneBuffer) MoveTo(ch rune, prevChar, reverse bool) (success bool) {
@@ -421,12 +570,28 @@ func (r *RuneBuffer) isInLineEdge() bool {
 	if isWindows {
 		return false
 	}
-	sp := r.getSplitByLine(r.buf)
-	return len(sp[len(sp)-1]) == 0
+	if r.multiline() {
+		end := r.layout()[len(r.buf)]
+		return end.col == 0 && r.buf[len(r.buf)-1] != '\n'
+	}
+	_, edge := r.splitRows(r.buf)
+	return edge
 }
 
-func (r *RuneBuffer) getSplitByLine(rs []rune) []string {
-	return SplitByLine(r.promptLen(), r.width, rs)
+// splitRows returns the number of rows rs takes after the prompt, split
+// like SplitByLine does, and whether the last one is empty, without
+// building them.
+func (r *RuneBuffer) splitRows(rs []rune) (rows int, empty bool) {
+	rows, empty = 1, true
+	width := r.promptLen()
+	for _, c := range rs {
+		width += runes.Width(c)
+		empty = false
+		if width >= r.width {
+			rows, width, empty = rows+1, 0, true
+		}
+	}
+	return rows, empty
 }
 
 func (r *RuneBuffer) IdxLine(width int) int {
@@ -439,8 +604,11 @@ func (r *RuneBuffer) idxLine(width int) int {
 	if width == 0 {
 		return 0
 	}
-	sp := r.getSplitByLine(r.buf[:r.idx])
-	return len(sp) - 1
+	if r.multiline() {
+		return r.layout()[r.idx].row
+	}
+	rows, _ := r.splitRows(r.buf[:r.idx])
+	return rows - 1
 }
 
 func (r *RuneBuffer) CursorLineCount() int {
@@ -453,15 +621,107 @@ func (r *RuneBuffer) Refresh(f func()) {
 
 	if !r.interactive {
 		if f != nil {
-			f()
+			r.edit(f)
 		}
 		return
 	}
 
+	batched := r.frame != nil
+	if !batched {
+		r.frame = r.newFrame()
+	}
 	r.clean()
 	if f != nil {
-		f()
+		r.edit(f)
+	}
+	if batched {
+		r.frameDirty = true
+		return
+	}
+	r.print()
+	r.flushFrame()
+}
+
+// BeginUpdate defers the drawing of the refreshes until the matching
+// EndUpdate, so that several changes, e.g. SetPrompt and Refresh, show up
+// in a single frame. The line is erased first if it's visible.
+func (r *RuneBuffer) BeginUpdate(visible bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.updates++
+	if r.updates > 1 {
+		return
+	}
+	r.frame = r.newFrame()
+	r.frameDirty = false
+	if visible && r.interactive {
+		r.clean()
+		r.frameDirty = true
+	}
+}
+
+// EndUpdate draws the line if it's been changed since BeginUpdate.
+func (r *RuneBuffer) EndUpdate() {
+	r.Lock()
+	defer r.Unlock()
+	if r.updates == 0 {
+		return
+	}
+	r.updates--
+	if r.updates > 0 {
+		return
+	}
+	if r.frameDirty {
+		r.print()
+	}
+	r.flushFrame()
+}
+
+// dropFrame discards the frame and the batching of BeginUpdate, which a
+// hook panicking in the middle of a refresh leaves behind: every refresh
+// would be batched, and nothing drawn anymore.
+func (r *RuneBuffer) dropFrame() {
+	r.Lock()
+	r.frame, r.frameDirty, r.updates = nil, false, 0
+	r.Unlock()
+}
+
+// newFrame returns the frame emptied.
+func (r *RuneBuffer) newFrame() *bytes.Buffer {
+	r.frames.Reset()
+	return &r.frames
+}
+
+// out is where the line is drawn, the frame while there's one.
+func (r *RuneBuffer) out() io.Writer {
+	if r.frame != nil {
+		return r.frame
 	}
+	return r.w
+}
+
+func (r *RuneBuffer) flushFrame() {
+	frame := r.frame
+	r.frame, r.frameDirty = nil, false
+	if frame.Len() > 0 {
+		r.w.Write(frame.Bytes())
+	}
+}
+
+// Redraw prints the line again from the beginning of the cursor line,
+// rather than erasing the lines it's supposed to occupy.
+func (r *RuneBuffer) Redraw() {
+	r.Lock()
+	defer r.Unlock()
+	if !r.interactive {
+		return
+	}
+	if r.frame != nil {
+		r.frame.WriteString("\r\033[J")
+		r.hadClean, r.frameDirty = true, true
+		return
+	}
+	r.w.Write([]byte("\r\033[J"))
 	r.print()
 }
 
@@ -472,13 +732,20 @@ func (r *RuneBuffer) SetOffset(offset string) {
 }
 
 func (r *RuneBuffer) print() {
-	r.w.Write(r.output())
+	start := time.Now()
+	output := r.output()
+	r.meter.addRender(start)
+	r.out().Write(output)
 	r.hadClean = false
+	r.drawn = true
+	r.setOrigin(0)
 }
 
 func (r *RuneBuffer) output() []byte {
-	buf := bytes.NewBuffer(nil)
+	buf := &r.outputs
+	buf.Reset()
 	buf.WriteString(string(r.prompt))
+	buf.WriteString(r.rightPromptOutput())
 	if r.cfg.EnableMask && len(r.buf) > 0 {
 		buf.Write([]byte(strings.Repeat(string(r.cfg.MaskRune), len(r.buf)-1)))
 		if r.buf[len(r.buf)-1] == '\n' {
@@ -487,11 +754,20 @@ func (r *RuneBuffer) output() []byte {
 			buf.Write([]byte(string(r.cfg.MaskRune)))
 		}
 		if len(r.buf) > r.idx {
-			buf.Write(r.getBackspaceSequence())
+			r.writeBackspaceSequence(buf)
 		}
 
+	} else if r.multiline() {
+		pos := r.layout()
+		buf.Write(r.rowsOutput(r.paint(), pos))
+		if r.isInLineEdge() {
+			buf.Write([]byte(" \b"))
+		}
+		buf.WriteString(r.suggestionOutput())
+		buf.Write(r.cursorOutput(pos))
+		return buf.Bytes()
 	} else {
-		for _, e := range r.cfg.Painter.Paint(r.buf, r.idx) {
+		for _, e := range r.paint() {
 			if e == '\t' {
 				buf.WriteString(strings.Repeat(" ", TabWidth))
 			} else {
@@ -501,15 +777,53 @@ func (r *RuneBuffer) output() []byte {
 		if r.isInLineEdge() {
 			buf.Write([]byte(" \b"))
 		}
+		buf.WriteString(r.suggestionOutput())
 	}
 	// cursor position
 	if len(r.buf) > r.idx {
-		buf.Write(r.getBackspaceSequence())
+		r.writeBackspaceSequence(buf)
 	}
 	return buf.Bytes()
 }
 
-func (r *RuneBuffer) getBackspaceSequence() []byte {
+// paint runs the Painter and marks the secondary cursors, the spans of
+// SetMarks and the Diagnostics on the line, over its highlights.
+func (r *RuneBuffer) paint() []rune {
+	painted := r.buf
+	r.stale = r.burst && r.hasPaintHooks()
+	if _, ok := r.cfg.Painter.(*defaultPainter); !ok && !r.burst {
+		painter, buf, idx := r.cfg.Painter, runes.Copy(r.buf), r.idx
+		var out []rune
+		if r.hooks.run(r.cfg, "Painter", func() { out = painter.Paint(buf, idx) }) {
+			painted = out
+		}
+	}
+	if len(painted) != len(r.buf) {
+		return painted
+	}
+	diags := append(r.cursorSpans(), r.marks...)
+	if diagnose := r.cfg.FuncDiagnose; diagnose != nil && !r.burst {
+		buf := runes.Copy(r.buf)
+		var found []Diagnostic
+		if r.hooks.run(r.cfg, "FuncDiagnose", func() { found = diagnose(buf) }) {
+			diags = append(diags, found...)
+		}
+	}
+	spans := diagnosticSpans(diags, len(painted), r.cfg.DiagnosticStyle)
+	if highlight := r.cfg.FuncHighlight; highlight != nil && !r.burst {
+		buf, idx := runes.Copy(r.buf), r.idx
+		var found []StyleSpan
+		if r.hooks.run(r.cfg, "FuncHighlight", func() { found = highlight(buf, idx) }) {
+			spans = layerSpans(found, spans, len(painted))
+		}
+	}
+	if len(spans) == 0 {
+		return painted
+	}
+	return applySpans(painted, spans, r.cfg.DiagnosticStyle, "")
+}
+
+func (r *RuneBuffer) writeBackspaceSequence(buf *bytes.Buffer) {
 	var sep = map[int]bool{}
 
 	var i int
@@ -525,24 +839,36 @@ func (r *RuneBuffer) getBackspaceSequence() []byte {
 
 		sep[i] = true
 	}
-	var buf []byte
 	for i := len(r.buf); i > r.idx; i-- {
 		// move input to the left of one
-		buf = append(buf, '\b')
+		buf.WriteByte('\b')
 		if sep[i] {
 			// up one line, go to the start of the line and move cursor right to the end (r.width)
-			buf = append(buf, "\033[A\r"+"\033["+strconv.Itoa(r.width)+"C"...)
+			buf.WriteString("\033[A\r\033[")
+			buf.WriteString(strconv.Itoa(r.width))
+			buf.WriteByte('C')
 		}
 	}
-
-	return buf
-
 }
 
 func (r *RuneBuffer) Reset() []rune {
 	ret := runes.Copy(r.buf)
+	if r.cfg.EnableMask {
+		for i := range r.buf {
+			r.buf[i] = 0
+		}
+		spare := r.spare[:cap(r.spare)]
+		for i := range spare {
+			spare[i] = 0
+		}
+	}
 	r.buf = r.buf[:0]
 	r.idx = 0
+	r.mark = -1
+	r.undo, r.redo, r.insertAt = nil, nil, -1
+	r.burst, r.stale = false, false
+	r.suggested = nil
+	r.drawn = false
 	return ret
 }
 
@@ -553,6 +879,14 @@ func (r *RuneBuffer) calWidth(m int) int {
 	return runes.WidthAll(r.buf[r.idx+m : r.idx])
 }
 
+// SetMarks highlights the spans of the line whenever it's drawn, e.g. the
+// matches of the search, until they're set again.
+func (r *RuneBuffer) SetMarks(marks []Diagnostic) {
+	r.Lock()
+	r.marks = marks
+	r.Unlock()
+}
+
 func (r *RuneBuffer) SetStyle(start, end int, style string) {
 	if end < start {
 		panic("end < start")
@@ -584,38 +918,125 @@ func (r *RuneBuffer) Set(buf []rune) {
 
 func (r *RuneBuffer) SetPrompt(prompt string) {
 	r.Lock()
-	r.prompt = []rune(prompt)
+	r.origPrompt = []rune(prompt)
+	r.segments = nil
+	r.layouts = nil
+	r.layoutPrompt()
 	r.Unlock()
 }
 
+// SetPromptSegments sets a prompt which is shortened by the priorities of
+// its segments whenever it doesn't fit the width of the terminal.
+func (r *RuneBuffer) SetPromptSegments(segs []PromptSegment) {
+	r.Lock()
+	r.segments = append([]PromptSegment(nil), segs...)
+	r.layouts = nil
+	r.layoutPrompt()
+	r.Unlock()
+}
+
+// layoutPrompt sets the displayed prompt for the current width, from the
+// cache if the width was seen since the prompt was set.
+func (r *RuneBuffer) layoutPrompt() {
+	l, ok := r.layouts[r.width]
+	if !ok {
+		prompt := r.computePrompt()
+		l = promptLayout{prompt, runes.WidthAll(runes.ColorFilter(prompt))}
+		if r.layouts == nil || len(r.layouts) >= maxPromptLayouts {
+			r.layouts = make(map[int]promptLayout)
+		}
+		r.layouts[r.width] = l
+	}
+	r.prompt, r.promptWidth = l.prompt, l.width
+}
+
+func (r *RuneBuffer) computePrompt() []rune {
+	if r.width <= 0 {
+		if r.segments != nil {
+			return layoutPrompt(r.segments, int(^uint(0)>>1))
+		}
+		return r.origPrompt
+	}
+
+	avail := r.width - 1
+	if r.cfg.MinEditWidth > 0 {
+		avail = r.width - r.cfg.MinEditWidth
+		if avail < 1 {
+			avail = 1
+		}
+	}
+	if r.segments != nil {
+		return layoutPrompt(r.segments, avail)
+	} else if r.cfg.MinEditWidth > 0 {
+		return truncateColoredLeft(r.origPrompt, avail)
+	}
+	return r.origPrompt
+}
+
 func (r *RuneBuffer) cleanOutput(w io.Writer, idxLine int) {
-	buf := bufio.NewWriter(w)
+	buf := r.cleaning[:0]
 
 	if r.width == 0 {
-		buf.WriteString(strings.Repeat("\r\b", len(r.buf)+r.promptLen()))
-		buf.Write([]byte("\033[J"))
+		for i := len(r.buf) + r.promptLen(); i > 0; i-- {
+			buf = append(buf, "\r\b"...)
+		}
+		buf = append(buf, "\033[J"...)
 	} else {
-		buf.Write([]byte("\033[J")) // just like ^k :)
+		buf = append(buf, "\033[J"...) // just like ^k :)
 		if idxLine == 0 {
-			buf.WriteString("\033[2K")
-			buf.WriteString("\r")
+			buf = append(buf, "\033[2K"...)
+			buf = append(buf, "\r"...)
 		} else {
 			for i := 0; i < idxLine; i++ {
-				io.WriteString(buf, "\033[2K\r\033[A")
+				buf = append(buf, "\033[2K\r\033[A"...)
 			}
-			io.WriteString(buf, "\033[2K\r")
+			buf = append(buf, "\033[2K\r"...)
 		}
 	}
-	buf.Flush()
-	return
+	w.Write(buf)
+	r.cleaning = buf
 }
 
 func (r *RuneBuffer) Clean() {
 	r.Lock()
 	r.clean()
+	if r.frame != nil {
+		// the caller writes right after, the erasing can't wait
+		r.w.Write(r.frame.Bytes())
+		r.frame.Reset()
+	}
+	r.drawn = false
 	r.Unlock()
 }
 
+// PrintAbove writes text to w, above the line if it's on the screen: the
+// line is erased first, and drawn again after text. It returns whether the
+// line was drawn again.
+func (r *RuneBuffer) PrintAbove(w io.Writer, text []byte) (int, bool, error) {
+	r.Lock()
+	defer r.Unlock()
+	if !r.drawn || !r.interactive {
+		n, err := w.Write(text)
+		return n, false, err
+	}
+
+	batched := r.frame != nil
+	if !batched {
+		r.frame = r.newFrame()
+	}
+	r.clean()
+	r.w.Write(r.frame.Bytes())
+	r.frame.Reset()
+	n, err := w.Write(text)
+	if batched {
+		r.frameDirty = true
+		return n, true, err
+	}
+	r.print()
+	r.flushFrame()
+	return n, true, err
+}
+
 func (r *RuneBuffer) clean() {
 	r.cleanWithIdxLine(r.idxLine(r.width))
 }
@@ -625,5 +1046,5 @@ func (r *RuneBuffer) cleanWithIdxLine(idxLine int) {
 		return
 	}
 	r.hadClean = true
-	r.cleanOutput(r.w, idxLine)
+	r.cleanOutput(r.out(), idxLine)
 }
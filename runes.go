@@ -187,6 +187,13 @@ func (Runes) HasPrefix(r, prefix []rune) bool {
 	return runes.Equal(r[:len(prefix)], prefix)
 }
 
+func (Runes) HasSuffix(r, suffix []rune) bool {
+	if len(r) < len(suffix) {
+		return false
+	}
+	return runes.Equal(r[len(r)-len(suffix):], suffix)
+}
+
 func (Runes) Aggregate(candicate [][]rune) (same []rune, size int) {
 	for i := 0; i < len(candicate[0]); i++ {
 		for j := 0; j < len(candicate)-1; j++ {
@@ -221,3 +228,11 @@ func (Runes) TrimSpaceLeft(in []rune) []rune {
 	}
 	return in[firstIndex:]
 }
+
+func (Runes) TrimSpaceRight(in []rune) []rune {
+	end := len(in)
+	for end > 0 && unicode.IsSpace(in[end-1]) {
+		end--
+	}
+	return in[:end]
+}
@@ -0,0 +1,361 @@
+package readline
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Cell is a cell of a Screen, the blank ones hold a space. The second cell
+// of a wide rune has the Rune 0.
+type Cell struct {
+	Rune rune
+	// the SGR parameters it's drawn with, e.g. "1;4", empty by default
+	Style string
+}
+
+// Screen is a grid of cells which interprets the output of the line
+// editor like a terminal does, for drawing it where there isn't one, see
+// Widget. It follows the sequences the line editor writes: the moves of
+// the cursor, the erasing and SGR; the others are ignored. The rows
+// scroll up past the bottom.
+type Screen struct {
+	m             sync.Mutex
+	width, height int
+	cells         [][]Cell
+	row, col      int
+	// the cursor is past the last column, the next rune wraps
+	pending bool
+	style   string
+	saved   [2]int
+	// the escape sequence split across writes
+	partial []byte
+	// called after each write
+	onChange func()
+}
+
+// the largest screen, e.g. for the size the client of the editor protocol
+// asks for
+const (
+	maxScreenWidth  = 1024
+	maxScreenHeight = 512
+)
+
+// NewScreen returns an empty screen of the given size.
+func NewScreen(width, height int) *Screen {
+	s := &Screen{}
+	s.Resize(width, height)
+	return s
+}
+
+// Resize changes the size of the screen, keeping the cells which still
+// fit. It's at most 1024 columns by 512 rows.
+func (s *Screen) Resize(width, height int) {
+	if width < 1 {
+		width = 1
+	} else if width > maxScreenWidth {
+		width = maxScreenWidth
+	}
+	if height < 1 {
+		height = 1
+	} else if height > maxScreenHeight {
+		height = maxScreenHeight
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	cells := make([][]Cell, height)
+	for i := range cells {
+		cells[i] = blankRow(width)
+		if i < len(s.cells) {
+			copy(cells[i], s.cells[i])
+		}
+	}
+	s.width, s.height, s.cells = width, height, cells
+	s.row, s.col = s.clamp(s.row, s.col)
+	s.pending = false
+}
+
+// Size returns the width and the height of the screen.
+func (s *Screen) Size() (width, height int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.width, s.height
+}
+
+// Cells returns a copy of the rows of the screen.
+func (s *Screen) Cells() [][]Cell {
+	s.m.Lock()
+	defer s.m.Unlock()
+	cells := make([][]Cell, len(s.cells))
+	for i, row := range s.cells {
+		cells[i] = append([]Cell(nil), row...)
+	}
+	return cells
+}
+
+// Cursor returns the row and the column of the cursor.
+func (s *Screen) Cursor() (row, col int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.pending {
+		return s.row, s.width - 1
+	}
+	return s.row, s.col
+}
+
+// String returns the text of the screen, its rows without the trailing
+// spaces.
+func (s *Screen) String() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	rows := make([]string, len(s.cells))
+	for i, row := range s.cells {
+		var b strings.Builder
+		for _, c := range row {
+			if c.Rune != 0 {
+				b.WriteRune(c.Rune)
+			}
+		}
+		rows[i] = strings.TrimRight(b.String(), " ")
+	}
+	return strings.Join(rows, "\n")
+}
+
+func (s *Screen) Write(b []byte) (int, error) {
+	s.m.Lock()
+	n := len(b)
+	if len(s.partial) > 0 {
+		b = append(s.partial, b...)
+		s.partial = nil
+	}
+	for len(b) > 0 {
+		if b[0] == '\033' {
+			size, complete := escapeSize(b)
+			if !complete {
+				s.partial = append([]byte(nil), b...)
+				break
+			}
+			s.escape(b[:size])
+			b = b[size:]
+			continue
+		}
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && !utf8.FullRune(b) {
+			s.partial = append([]byte(nil), b...)
+			break
+		}
+		s.put(r)
+		b = b[size:]
+	}
+	onChange := s.onChange
+	s.m.Unlock()
+	if onChange != nil {
+		onChange()
+	}
+	return n, nil
+}
+
+// escapeSize returns the length of the escape sequence at the start of
+// b: a CSI, a string such as an OSC up to BEL or ST, or ESC and a byte.
+func escapeSize(b []byte) (int, bool) {
+	if len(b) < 2 {
+		return len(b), false
+	}
+	switch b[1] {
+	case '[':
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return i + 1, true
+			}
+		}
+		return len(b), false
+	case ']', 'P', 'X', '^', '_':
+		for i := 2; i < len(b); i++ {
+			if b[i] == CharBell {
+				return i + 1, true
+			}
+			if b[i] == '\033' && i+1 < len(b) && b[i+1] == '\\' {
+				return i + 2, true
+			}
+		}
+		return len(b), false
+	}
+	return 2, true
+}
+
+func (s *Screen) clamp(row, col int) (int, int) {
+	if row < 0 {
+		row = 0
+	} else if row >= s.height {
+		row = s.height - 1
+	}
+	if col < 0 {
+		col = 0
+	} else if col >= s.width {
+		col = s.width - 1
+	}
+	return row, col
+}
+
+func (s *Screen) lineFeed() {
+	if s.row < s.height-1 {
+		s.row++
+		return
+	}
+	copy(s.cells, s.cells[1:])
+	s.cells[s.height-1] = blankRow(s.width)
+}
+
+func blankRow(width int) []Cell {
+	row := make([]Cell, width)
+	for i := range row {
+		row[i] = Cell{Rune: ' '}
+	}
+	return row
+}
+
+func (s *Screen) put(r rune) {
+	switch r {
+	case '\n':
+		// like a terminal translating it to \r\n
+		s.lineFeed()
+		s.col, s.pending = 0, false
+		return
+	case '\r':
+		s.col, s.pending = 0, false
+		return
+	case '\b':
+		if s.pending {
+			s.pending = false
+			s.col = s.width - 1
+		}
+		if s.col > 0 {
+			s.col--
+		}
+		return
+	case '\t':
+		for i := 0; i < TabWidth; i++ {
+			s.put(' ')
+		}
+		return
+	}
+	w := runes.Width(r)
+	if w == 0 {
+		return
+	}
+	if s.pending || s.col+w > s.width {
+		s.lineFeed()
+		s.col, s.pending = 0, false
+	}
+	row := s.cells[s.row]
+	row[s.col] = Cell{r, s.style}
+	if w == 2 && s.col+1 < s.width {
+		row[s.col+1] = Cell{0, s.style}
+	}
+	if s.col += w; s.col >= s.width {
+		s.col, s.pending = s.width-1, true
+	}
+}
+
+// csiParams returns the numeric parameters of a CSI, n if one is missing.
+func csiParams(seq string, count, n int) []int {
+	ret := make([]int, count)
+	fields := strings.Split(seq, ";")
+	for i := range ret {
+		ret[i] = n
+		if i < len(fields) {
+			if v, err := strconv.Atoi(fields[i]); err == nil {
+				ret[i] = v
+			}
+		}
+	}
+	return ret
+}
+
+func (s *Screen) escape(seq []byte) {
+	switch seq[1] {
+	case '7':
+		s.saved = [2]int{s.row, s.col}
+		return
+	case '8':
+		s.row, s.col = s.saved[0], s.saved[1]
+		s.pending = false
+		return
+	case '[':
+	default:
+		return
+	}
+	final := seq[len(seq)-1]
+	arg := string(seq[2 : len(seq)-1])
+	if strings.HasPrefix(arg, "?") {
+		return
+	}
+	if final != 'm' {
+		s.pending = false
+	}
+	n := csiParams(arg, 1, 1)[0]
+	if n == 0 && final != 'J' && final != 'K' {
+		n = 1
+	}
+	switch final {
+	case 'A':
+		s.row, s.col = s.clamp(s.row-n, s.col)
+	case 'B':
+		s.row, s.col = s.clamp(s.row+n, s.col)
+	case 'C':
+		s.row, s.col = s.clamp(s.row, s.col+n)
+	case 'D':
+		s.row, s.col = s.clamp(s.row, s.col-n)
+	case 'G':
+		s.row, s.col = s.clamp(s.row, n-1)
+	case 'H', 'f':
+		p := csiParams(arg, 2, 1)
+		s.row, s.col = s.clamp(p[0]-1, p[1]-1)
+	case 'J':
+		s.erase(csiParams(arg, 1, 0)[0], true)
+	case 'K':
+		s.erase(csiParams(arg, 1, 0)[0], false)
+	case 'm':
+		if arg == "" || arg == "0" {
+			s.style = ""
+		} else if s.style == "" {
+			s.style = arg
+		} else {
+			s.style += ";" + arg
+		}
+	}
+}
+
+// erase clears the screen, or the row of the cursor, after the cursor
+// with 0, before it with 1 or all of it with 2.
+func (s *Screen) erase(mode int, screen bool) {
+	blank := func(row, from, to int) {
+		for i := from; i < to; i++ {
+			s.cells[row][i] = Cell{Rune: ' '}
+		}
+	}
+	switch mode {
+	case 0:
+		blank(s.row, s.col, s.width)
+		if screen {
+			for i := s.row + 1; i < s.height; i++ {
+				blank(i, 0, s.width)
+			}
+		}
+	case 1:
+		blank(s.row, 0, s.col+1)
+		if screen {
+			for i := 0; i < s.row; i++ {
+				blank(i, 0, s.width)
+			}
+		}
+	default:
+		blank(s.row, 0, s.width)
+		if screen {
+			for i := 0; i < s.height; i++ {
+				blank(i, 0, s.width)
+			}
+		}
+	}
+}
@@ -3,8 +3,8 @@ package readline
 import (
 	"bytes"
 	"container/list"
-	"fmt"
 	"io"
+	"strconv"
 )
 
 const (
@@ -18,18 +18,20 @@ const (
 )
 
 type opSearch struct {
-	inMode    bool
-	state     int
-	dir       int
-	source    *list.Element
-	w         io.Writer
-	buf       *RuneBuffer
-	data      []rune
-	history   *opHistory
-	cfg       *Config
-	markStart int
-	markEnd   int
-	width     int
+	inMode  bool
+	state   int
+	dir     int
+	source  *list.Element
+	w       io.Writer
+	buf     *RuneBuffer
+	data    []rune
+	history *opHistory
+	cfg     *Config
+	width   int
+	// the items in the order they're searched backward, and their
+	// ranks in it, see sortHistory
+	order []*list.Element
+	rank  map[*list.Element]int
 }
 
 func newOpSearch(w io.Writer, buf *RuneBuffer, history *opHistory, cfg *Config, width int) *opSearch {
@@ -59,18 +61,39 @@ func (o *opSearch) SearchBackspace() {
 
 func (o *opSearch) findHistoryBy(isNewSearch bool) (int, *list.Element) {
 	if o.dir == S_DIR_BCK {
-		return o.history.FindBck(isNewSearch, o.data, o.buf.idx)
+		return o.history.FindBck(isNewSearch, o.data, o.buf.idx, o.step)
 	}
-	return o.history.FindFwd(isNewSearch, o.data, o.buf.idx)
+	return o.history.FindFwd(isNewSearch, o.data, o.buf.idx, o.step)
 }
 
 func (o *opSearch) search(isChange bool) bool {
 	if len(o.data) == 0 {
 		o.state = S_STATE_FOUND
+		o.buf.SetMarks(nil)
+		o.buf.Refresh(nil)
 		o.SearchRefresh(-1)
 		return true
 	}
-	idx, elem := o.findHistoryBy(isChange)
+	var idx int
+	var elem *list.Element
+	var pos []int
+	if o.cfg.HistorySearchFuzzy {
+		elem, pos = o.findFuzzy(isChange)
+		if elem != nil {
+			idx = pos[0]
+			if o.dir == S_DIR_FWD {
+				idx = pos[len(pos)-1] + 1
+			}
+		}
+	} else {
+		idx, elem = o.findHistoryBy(isChange)
+		for i := range o.data {
+			pos = append(pos, idx+i)
+		}
+		if o.dir == S_DIR_FWD {
+			idx += len(o.data)
+		}
+	}
 	if elem == nil {
 		o.SearchRefresh(-2)
 		return false
@@ -78,19 +101,121 @@ func (o *opSearch) search(isChange bool) bool {
 	o.history.current = elem
 
 	item := o.history.showItem(o.history.current.Value)
-	start, end := 0, 0
-	if o.dir == S_DIR_BCK {
-		start, end = idx, idx+len(o.data)
-	} else {
-		start, end = idx, idx+len(o.data)
-		idx += len(o.data)
-	}
+	o.buf.SetMarks(matchMarks(pos, o.cfg.MatchStyle))
 	o.buf.SetWithIdx(idx, item)
-	o.markStart, o.markEnd = start, end
 	o.SearchRefresh(idx)
 	return true
 }
 
+// findFuzzy finds the next line in the direction of the search which
+// holds its runes in order, with their positions, see
+// Config.HistorySearchFuzzy. The current line is skipped unless the
+// search changed.
+func (o *opSearch) findFuzzy(isNewSearch bool) (*list.Element, []int) {
+	for elem := o.history.current; elem != nil; elem = o.step(elem) {
+		if elem == o.history.current && !isNewSearch {
+			continue
+		}
+		if pos := fuzzyIndex(o.history.showItem(elem.Value), o.data, o.cfg.searchNormalizer()); pos != nil {
+			return elem, pos
+		}
+	}
+	return nil, nil
+}
+
+// step returns the item after elem in the direction of the search.
+func (o *opSearch) step(elem *list.Element) *list.Element {
+	i, ok := o.rank[elem]
+	if !ok {
+		return nil
+	}
+	if o.dir == S_DIR_BCK {
+		i++
+	} else {
+		i--
+	}
+	if i < 0 || i >= len(o.order) {
+		return nil
+	}
+	return o.order[i]
+}
+
+// sortHistory orders the items searched backward: the line being edited,
+// then the pinned items and the others, the latest first.
+func (o *opSearch) sortHistory() {
+	o.order = o.order[:0]
+	o.rank = make(map[*list.Element]int, o.history.history.Len())
+	back := o.history.history.Back()
+	if back == nil {
+		return
+	}
+	var others []*list.Element
+	o.order = append(o.order, back)
+	for elem := back.Prev(); elem != nil; elem = elem.Prev() {
+		if elem.Value.(*hisItem).Pinned {
+			o.order = append(o.order, elem)
+		} else {
+			others = append(others, elem)
+		}
+	}
+	o.order = append(o.order, others...)
+	for i, elem := range o.order {
+		o.rank[elem] = i
+	}
+}
+
+// fuzzyIndex returns the earliest positions in line of the runes of sub,
+// in order, or nil if they aren't all there. The runes are compared as
+// normalized by norm, unless it's nil.
+func fuzzyIndex(line, sub []rune, norm func(rune) rune) []int {
+	pos := make([]int, 0, len(sub))
+	for i := 0; i < len(line) && len(pos) < len(sub); i++ {
+		if equalNorm(line[i], sub[len(pos)], norm) {
+			pos = append(pos, i)
+		}
+	}
+	if len(pos) < len(sub) {
+		return nil
+	}
+	return pos
+}
+
+// matchMarks returns the spans of the matched positions, which are sorted.
+func matchMarks(pos []int, style string) []Diagnostic {
+	var marks []Diagnostic
+	for _, p := range pos {
+		if n := len(marks); n > 0 && marks[n-1].End == p {
+			marks[n-1].End++
+		} else {
+			marks = append(marks, Diagnostic{Start: p, End: p + 1, Style: style})
+		}
+	}
+	return marks
+}
+
+// matchIndex returns the rank of the current line among the lines of the
+// history which match the search, in the order they're searched backward,
+// and their number.
+func (o *opSearch) matchIndex() (at, total int) {
+	norm := o.cfg.searchNormalizer()
+	for _, elem := range o.order {
+		line := o.history.showItem(elem.Value)
+		var match bool
+		if o.cfg.HistorySearchFuzzy {
+			match = fuzzyIndex(line, o.data, norm) != nil
+		} else {
+			match = indexNorm(line, o.data, norm) >= 0
+		}
+		if match {
+			total++
+			if elem == o.history.current {
+				at = total
+			}
+		}
+	}
+	return at, total
+}
+
 func (o *opSearch) SearchChar(r rune) {
 	o.data = append(o.data, r)
 	o.search(true)
@@ -101,6 +226,10 @@ func (o *opSearch) SearchMode(dir int) bool {
 		return false
 	}
 	alreadyInMode := o.inMode
+	if !alreadyInMode {
+		o.history.Sync()
+		o.sortHistory()
+	}
 	o.inMode = true
 	o.dir = dir
 	o.source = o.history.current
@@ -113,11 +242,11 @@ func (o *opSearch) SearchMode(dir int) bool {
 }
 
 func (o *opSearch) ExitSearchMode(revert bool) {
+	o.buf.SetMarks(nil)
 	if revert {
 		o.history.current = o.source
 		o.buf.Set(o.history.showItem(o.history.current.Value))
 	}
-	o.markStart, o.markEnd = 0, 0
 	o.state = S_STATE_FOUND
 	o.inMode = false
 	o.source = nil
@@ -130,21 +259,7 @@ func (o *opSearch) SearchRefresh(x int) {
 	} else if x >= 0 {
 		o.state = S_STATE_FOUND
 	}
-	if x < 0 {
-		x = o.buf.idx
-	}
-	x = o.buf.CurrentWidth(x)
-	x += o.buf.PromptLen()
-	x = x % o.width
-
-	if o.markStart > 0 {
-		o.buf.SetStyle(o.markStart, o.markEnd, "4")
-	}
-
-	lineCnt := o.buf.CursorLineCount()
 	buf := bytes.NewBuffer(nil)
-	buf.Write(bytes.Repeat([]byte("\n"), lineCnt))
-	buf.WriteString("\033[J")
 	if o.state == S_STATE_FAILING {
 		buf.WriteString("failing ")
 	}
@@ -153,12 +268,13 @@ func (o *opSearch) SearchRefresh(x int) {
 	} else if o.dir == S_DIR_FWD {
 		buf.WriteString("fwd")
 	}
-	buf.WriteString("-i-search: ")
-	buf.WriteString(string(o.data))         // keyword
-	buf.WriteString("\033[4m \033[0m")      // _
-	fmt.Fprintf(buf, "\r\033[%dA", lineCnt) // move prev
-	if x > 0 {
-		fmt.Fprintf(buf, "\033[%dC", x) // move forward
+	buf.WriteString("-i-search")
+	if len(o.data) > 0 {
+		at, total := o.matchIndex()
+		buf.WriteString(" " + strconv.Itoa(at) + "/" + strconv.Itoa(total))
 	}
-	o.w.Write(buf.Bytes())
+	buf.WriteString(": ")
+	buf.WriteString(string(o.data))    // keyword
+	buf.WriteString("\033[4m \033[0m") // _
+	o.w.Write(o.buf.BelowOutput(buf.Bytes()))
 }
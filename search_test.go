@@ -0,0 +1,94 @@
+package readline
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFuzzyIndex(t *testing.T) {
+	cases := []struct {
+		line, sub string
+		norm      func(rune) rune
+		expect    []int
+	}{
+		{"git commit -m", "gcm", nil, []int{0, 4, 6}},
+		{"git commit", "GC", FoldCase, []int{0, 4}},
+		{"git commit", "GC", nil, nil},
+		{"status", "uts", nil, nil},
+		{"Café crème", "ce", FoldCase, []int{0, 9}},
+		{"Café crème", "ece", FoldDiacritics, []int{3, 5, 7}},
+	}
+	for _, c := range cases {
+		if got := fuzzyIndex([]rune(c.line), []rune(c.sub), c.norm); !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("%q %q: expect %v, got %v", c.line, c.sub, c.expect, got)
+		}
+	}
+	marks := matchMarks([]int{1, 2, 3, 6}, "4")
+	if len(marks) != 2 || marks[0].Start != 1 || marks[0].End != 4 || marks[1].Start != 6 {
+		t.Fatal("result not expect", marks)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	for _, fuzzy := range []bool{false, true} {
+		out := new(syncBuffer)
+		rl, w := newTestInstance(t, &Config{
+			Stdout:             out,
+			HistorySearchFuzzy: fuzzy,
+		})
+		for _, s := range []string{"git commit -m fix", "go test", "git status"} {
+			rl.SaveHistory(s)
+		}
+
+		query, expect, status := "it", "git commit -m fix", "bck-i-search 2/2: it"
+		if fuzzy {
+			query, expect, status = "gcm", "git commit -m fix", "bck-i-search 1/1: gcm"
+		}
+		keys := "\x12" + query
+		if !fuzzy {
+			keys += "\x12"
+		}
+		go w.Write([]byte(keys + "\r"))
+		if line, err := rl.Readline(); err != nil || line != expect {
+			t.Fatal("result not expect", line, err)
+		}
+		if !strings.Contains(out.String(), status) {
+			t.Fatalf("%q not in %q", status, out.String())
+		}
+		// the match is highlighted
+		if !strings.Contains(out.String(), "\033[4mg\033[0mit") && !strings.Contains(out.String(), "g\033[4mit\033[0m") {
+			t.Fatalf("no highlight in %q", out.String())
+		}
+		rl.Close()
+		w.Close()
+	}
+}
+
+func TestSearchNormalize(t *testing.T) {
+	for _, c := range []struct {
+		fold   bool
+		norm   func(rune) rune
+		query  string
+		expect string
+	}{
+		// the case of the letters out of ASCII is folded too
+		{true, nil, "ÉCOLE", "école"},
+		{false, nil, "ÉCOLE", ""},
+		{false, FoldDiacritics, "cafe", "Café au lait"},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			HistorySearchFold: c.fold,
+			FuncNormalize:     c.norm,
+		})
+		for _, s := range []string{"Café au lait", "école"} {
+			rl.SaveHistory(s)
+		}
+		go w.Write([]byte("\x12" + c.query + "\r"))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: expect %q, got %q %v", c.query, c.expect, line, err)
+		}
+		rl.Close()
+		w.Close()
+	}
+}
@@ -0,0 +1,157 @@
+package readline
+
+import (
+	"fmt"
+)
+
+// Mode is a mode of the line editor.
+type Mode int
+
+const (
+	ModeEmacs Mode = iota
+	ModeViInsert
+	ModeViCommand
+	// the incremental search of Ctrl-R and Ctrl-S
+	ModeSearch
+	// the candidates of the completion are listed
+	ModeComplete
+	// a candidate is being selected in the completion menu
+	ModeMenu
+	// the history browser of MetaBrowseHistory
+	ModeBrowser
+	// the pager of the output longer than the screen
+	ModePager
+)
+
+var modeNames = []string{
+	ModeEmacs:     KeymapEmacs,
+	ModeViInsert:  KeymapViInsert,
+	ModeViCommand: KeymapViCommand,
+	ModeSearch:    KeymapSearch,
+	ModeComplete:  "complete",
+	ModeMenu:      KeymapMenu,
+	ModeBrowser:   KeymapBrowser,
+	ModePager:     KeymapPager,
+}
+
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+	return modeNames[m]
+}
+
+// EditorState is a snapshot of the line editor, for tests, debugging
+// overlays and prompts which tell the mode.
+type EditorState struct {
+	// the innermost mode, e.g. ModeSearch while searching in vi insert
+	// mode
+	Mode Mode
+	// ModeEmacs, ModeViInsert or ModeViCommand
+	EditMode Mode
+	// the keys of the vi command being typed, e.g. `d` or `"a`
+	Pending string
+	// what's being searched for in ModeSearch
+	Query string
+	Line  string
+	Pos   int
+}
+
+func (s EditorState) String() string {
+	ret := s.Mode.String()
+	if s.Mode != s.EditMode {
+		ret += "/" + s.EditMode.String()
+	}
+	if s.Pending != "" {
+		ret += fmt.Sprintf(" pending=%q", s.Pending)
+	}
+	if s.Mode == ModeSearch {
+		ret += fmt.Sprintf(" query=%q", s.Query)
+	}
+	return ret + fmt.Sprintf(" line=%q pos=%d", s.Line, s.Pos)
+}
+
+// editMode tells how the keys edit the line.
+func (o *Operation) editMode() Mode {
+	if !o.IsEnableVimMode() {
+		return ModeEmacs
+	}
+	if o.vimMode == VIM_NORMAL {
+		return ModeViCommand
+	}
+	return ModeViInsert
+}
+
+// mode is the innermost active mode.
+func (o *Operation) mode() Mode {
+	switch {
+	case o.IsPagerMode():
+		return ModePager
+	case o.IsHistoryBrowserMode():
+		return ModeBrowser
+	case o.IsInCompleteSelectMode():
+		return ModeMenu
+	case o.IsInCompleteMode():
+		return ModeComplete
+	case o.IsSearchMode():
+		return ModeSearch
+	}
+	return o.editMode()
+}
+
+// updateState takes a snapshot of the state, it's only called by the
+// ioloop, between the keys or while a vi command waits for its next key.
+func (o *Operation) updateState(pending []rune) {
+	s := EditorState{
+		Pending: string(pending),
+		Line:    o.buf.String(),
+		Pos:     o.buf.Pos(),
+	}
+
+	// under the lock, since SetConfig (e.g. for ReadPassword) replaces
+	// the modes from the goroutine of the caller
+	o.m.Lock()
+	s.Mode, s.EditMode = o.mode(), o.editMode()
+	if s.Mode == ModeSearch {
+		s.Query = string(o.opSearch.data)
+	}
+	changed := s != o.state
+	modeChanged := s.EditMode != o.state.EditMode
+	o.state = s
+	onChange, onModeChange := o.cfg.FuncOnStateChange, o.cfg.FuncOnModeChange
+	o.m.Unlock()
+	if modeChanged && onModeChange != nil {
+		onModeChange(s.EditMode)
+	}
+	if changed && onChange != nil {
+		onChange(s)
+	}
+}
+
+// vimReader reads the rest of the vi command started by r, which is
+// published as EditorState.Pending while waiting.
+func (o *Operation) vimReader(r rune) func() rune {
+	pending := []rune{r}
+	return func() rune {
+		o.updateState(pending)
+		// the keys replayed, e.g. by a macro, go on with the command
+		next, replayed := o.nextKey()
+		if next == keyCancel {
+			// abandons the command, the ioloop reads it again for the line
+			o.t.Cancel()
+			return CharEsc
+		}
+		if !replayed {
+			o.macro.record(next)
+		}
+		pending = append(pending, next)
+		return next
+	}
+}
+
+// State returns the state of the line editor as of the last key.
+func (o *Operation) State() EditorState {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.state
+}
@@ -0,0 +1,72 @@
+package readline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEditorState(t *testing.T) {
+	states := make(chan EditorState, 100)
+	rl, w := newTestInstance(t, &Config{
+		VimMode:           true,
+		FuncOnStateChange: func(s EditorState) { states <- s },
+	})
+	wait := func(expect string) {
+		for {
+			select {
+			case s := <-states:
+				if s.String() == expect {
+					if rl.State() != s {
+						t.Fatal("state not expect", rl.State())
+					}
+					return
+				}
+			case <-time.After(time.Second):
+				t.Fatal("state not reached", expect)
+			}
+		}
+	}
+
+	result := make(chan string)
+	go func() {
+		line, _ := rl.Readline()
+		result <- line
+	}()
+
+	go w.Write([]byte("abc\x1b"))
+	wait(`vi-command line="abc" pos=3`)
+	go w.Write([]byte("F"))
+	wait(`vi-command pending="F" line="abc" pos=3`)
+	go w.Write([]byte("a"))
+	wait(`vi-command line="abc" pos=0`)
+	go w.Write([]byte("i\x12b"))
+	wait(`isearch/vi-insert query="b" line="abc" pos=0`)
+	go w.Write([]byte("\r"))
+	if line := <-result; line != "abc" {
+		t.Fatal("result not expect", line)
+	}
+}
+
+func TestModeChange(t *testing.T) {
+	modes := make(chan Mode, 10)
+	rl, w := newTestInstance(t, &Config{
+		VimMode:          true,
+		FuncOnModeChange: func(m Mode) { modes <- m },
+	})
+
+	go w.Write([]byte("ab\x1bia\x1b\r"))
+	if line, err := rl.Readline(); err != nil || line != "aba" {
+		t.Fatal("result not expect", line, err)
+	}
+	// the next line starts in the insert mode
+	for _, expect := range []Mode{ModeViInsert, ModeViCommand, ModeViInsert, ModeViCommand, ModeViInsert} {
+		select {
+		case m := <-modes:
+			if m != expect {
+				t.Fatalf("expect %v, got %v", expect, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("mode change not notified", expect)
+		}
+	}
+}
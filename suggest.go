@@ -0,0 +1,127 @@
+package readline
+
+import "strconv"
+
+// The suggestion is drawn dimmed after the cursor at the end of the line,
+// like in fish: it's the rest of a line which begins with the one being
+// edited, but isn't part of it until Right or End accepts it. The ioloop
+// looks it up after each key, the RuneBuffer keeps the whole line
+// suggested, so that typing through it doesn't have to redraw the line.
+
+// Suggester gives the suggestion for the line, see Config.Suggester.
+type Suggester interface {
+	// Suggest returns the text to append to line, or nil.
+	Suggest(line []rune) []rune
+}
+
+type funcSuggester func(line []rune) []rune
+
+func (f funcSuggester) Suggest(line []rune) []rune {
+	return f(line)
+}
+
+// FuncSuggester turns f into a Suggester.
+func FuncSuggester(f func(line []rune) []rune) Suggester {
+	return funcSuggester(f)
+}
+
+// Suggest returns the latest saved item which begins with line and is
+// longer than it, nil if there isn't.
+func (o *opHistory) Suggest(line []rune) []rune {
+	for elem := o.history.Back(); elem != nil; elem = elem.Prev() {
+		source := elem.Value.(*hisItem).Source
+		if len(source) > len(line) && runes.HasPrefix(source, line) {
+			return runes.Copy(source)
+		}
+	}
+	return nil
+}
+
+// updateSuggestion looks up the suggestion of the line after a key, it's
+// only shown while typing at the end of the line.
+func (o *Operation) updateSuggestion() {
+	cfg := o.keyConfig()
+	if !cfg.AutoSuggest && cfg.Suggester == nil {
+		return
+	}
+	var suggested []rune
+	line := o.buf.Runes()
+	switch o.mode() {
+	case ModeEmacs, ModeViInsert:
+		if len(line) == 0 || cfg.EnableMask || !o.buf.IsCursorInEnd() {
+			break
+		}
+		if cfg.Suggester == nil {
+			suggested = o.history.Suggest(line)
+			break
+		}
+		var text []rune
+		suggester := cfg.Suggester
+		if o.buf.hooks.run(cfg, "Suggester", func() { text = suggester.Suggest(runes.Copy(line)) }) && len(text) > 0 {
+			suggested = append(line, text...)
+		}
+	}
+	o.buf.SetSuggestion(suggested)
+}
+
+// SetSuggestion sets the line suggested, the line is redrawn if that
+// changes the suggestion shown.
+func (r *RuneBuffer) SetSuggestion(line []rune) {
+	r.Lock()
+	old := r.suggestion()
+	r.suggested = line
+	changed := !runes.Equal(old, r.suggestion())
+	r.Unlock()
+	if changed {
+		r.Refresh(nil)
+	}
+}
+
+// AcceptSuggestion appends the suggestion shown to the line, it returns
+// false if there isn't any.
+func (r *RuneBuffer) AcceptSuggestion() (success bool) {
+	r.Refresh(func() {
+		if s := r.suggestion(); len(s) > 0 {
+			r.buf = append(r.buf, s...)
+			r.idx = len(r.buf)
+			success = true
+		}
+	})
+	return
+}
+
+// suggestion returns the rest of the line suggested, up to its first
+// control character, if the cursor is at the end of the line.
+func (r *RuneBuffer) suggestion() []rune {
+	if r.idx < len(r.buf) || len(r.suggested) <= len(r.buf) ||
+		r.cfg.EnableMask || !runes.HasPrefix(r.suggested, r.buf) {
+		return nil
+	}
+	s := r.suggested[len(r.buf):]
+	for i, c := range s {
+		if isControl(c) {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// suggestionOutput draws the suggestion after the cursor, as much of it
+// as fits on the row of the cursor, so that it's erased with the line.
+func (r *RuneBuffer) suggestionOutput() string {
+	s := r.suggestion()
+	if len(s) == 0 || r.width == 0 {
+		return ""
+	}
+	col := r.layout()[len(r.buf)].col
+	avail, n := r.width-col-1, 0
+	for n < len(s) && avail >= runes.Width(s[n]) {
+		avail -= runes.Width(s[n])
+		n++
+	}
+	if n == 0 {
+		return ""
+	}
+	return "\033[" + r.cfg.SuggestionStyle + "m" + string(s[:n]) + "\033[0m" +
+		"\033[" + strconv.Itoa(runes.WidthAll(s[:n])) + "D"
+}
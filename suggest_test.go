@@ -0,0 +1,48 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAutoSuggest(t *testing.T) {
+	out := new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{
+		Stdout:      out,
+		AutoSuggest: true,
+	})
+
+	for _, c := range []struct {
+		input  string
+		expect string
+	}{
+		{"git status\r", "git status"},
+		{"git log\r", "git log"},
+		// the latest item, but not part of the line until it's accepted
+		{"gi\r", "gi"},
+		{"gi\033[C\r", "git log"},
+		{"git s\x05\r", "git status"},
+		// only at the end of the line
+		{"gi\x02\033[C\r", "gi"},
+		{"gi\x02\033[C\033[C\r", "git status"},
+	} {
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+	}
+	if !strings.Contains(out.String(), "gi\033[2mt log\033[0m\033[5D") {
+		t.Fatalf("suggestion not drawn: %q", out.String())
+	}
+
+	rl2, w2 := newTestInstance(t, &Config{
+		Stdout: out,
+		Suggester: FuncSuggester(func(line []rune) []rune {
+			return []rune("!")
+		}),
+	})
+	go w2.Write([]byte("hi\033[C\r"))
+	if line, err := rl2.Readline(); err != nil || line != "hi!" {
+		t.Fatalf("result not expect %q %v", line, err)
+	}
+}
@@ -0,0 +1,109 @@
+package readline
+
+import (
+	"io"
+	"sync"
+)
+
+// teeSink is the Config.TeeWriter shared by the teeWriters of Stdout,
+// Stderr and the PromptWriter, which may be written at once.
+type teeSink struct {
+	m     sync.Mutex
+	w     io.Writer
+	strip bool
+	state teeState
+}
+
+// teeState is where the stripping is in an escape sequence, which may be
+// split across writes.
+type teeState int
+
+const (
+	teeText teeState = iota
+	teeEscape
+	teeCSI
+	// a string, e.g. an OSC, up to BEL or ST (ESC \)
+	teeString
+	teeStringEscape
+)
+
+func newTeeSink(w io.Writer, strip bool) *teeSink {
+	return &teeSink{w: w, strip: strip}
+}
+
+// write copies b to the TeeWriter, its errors are ignored so that the
+// logging never breaks the terminal.
+func (t *teeSink) write(b []byte) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.strip {
+		b = t.stripEscapes(b)
+		if len(b) == 0 {
+			return
+		}
+	}
+	t.w.Write(b)
+}
+
+// stripEscapes drops the escape sequences and the control characters
+// other than \n and \t from b.
+func (t *teeSink) stripEscapes(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for _, c := range b {
+		switch t.state {
+		case teeText:
+			switch {
+			case c == '\033':
+				t.state = teeEscape
+			case c == '\n' || c == '\t':
+				out = append(out, c)
+			case c < 0x20 || c == 0x7f:
+			default:
+				out = append(out, c)
+			}
+		case teeEscape:
+			switch {
+			case c == '[':
+				t.state = teeCSI
+			case c == ']' || c == 'P' || c == 'X' || c == '^' || c == '_':
+				t.state = teeString
+			case c >= 0x20 && c <= 0x2f:
+				// an intermediate, e.g. of ESC ( B
+			default:
+				t.state = teeText
+			}
+		case teeCSI:
+			if c >= 0x40 && c <= 0x7e {
+				t.state = teeText
+			}
+		case teeString:
+			switch c {
+			case CharBell:
+				t.state = teeText
+			case '\033':
+				t.state = teeStringEscape
+			}
+		case teeStringEscape:
+			if c == '\\' {
+				t.state = teeText
+			} else {
+				t.state = teeString
+			}
+		}
+	}
+	return out
+}
+
+// teeWriter writes to w and copies what's written to the teeSink.
+type teeWriter struct {
+	w   io.Writer
+	tee *teeSink
+}
+
+func (t *teeWriter) Write(b []byte) (int, error) {
+	n, err := t.w.Write(b)
+	if n > 0 {
+		t.tee.write(b[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,51 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTeeStripEscapes(t *testing.T) {
+	tee := newTeeSink(nil, true)
+	var out []byte
+	// split within the sequences
+	for _, b := range []string{
+		"\033[J\033[2K\r> a\033", "[1;3", "1mb\033[0m\033]0;tit", "le\033", "\\c\b\x7f\td\033(Be\007\n",
+	} {
+		out = append(out, tee.stripEscapes([]byte(b))...)
+	}
+	if string(out) != "> abc\tde\n" {
+		t.Fatalf("result not expect %q", out)
+	}
+}
+
+func TestTeeWriter(t *testing.T) {
+	for _, strip := range []bool{false, true} {
+		out := new(syncBuffer)
+		tee := new(syncBuffer)
+		rl, w := newTestInstance(t, &Config{
+			Stdout:          out,
+			Prompt:          "> ",
+			TeeWriter:       tee,
+			TeeStripEscapes: strip,
+		})
+		go w.Write([]byte("abc\r"))
+		if line, err := rl.Readline(); err != nil || line != "abc" {
+			t.Fatal("result not expect", line, err)
+		}
+		rl.Stdout().Write([]byte("\033[1mdone\033[0m\n"))
+		w.Close()
+		rl.Close()
+
+		if !strip {
+			if tee.String() != out.String() {
+				t.Fatalf("tee not expect %q, output %q", tee.String(), out.String())
+			}
+			continue
+		}
+		if strings.ContainsAny(tee.String(), "\033\r") ||
+			!strings.HasSuffix(tee.String(), "> abc\ndone\n") {
+			t.Fatalf("tee not expect %q", tee.String())
+		}
+	}
+}
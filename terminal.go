@@ -4,15 +4,22 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
+// Terminal decodes the keys from Config.Stdin.
+//
+// Deprecated: it's an internal of the Instance, which isn't exported by
+// github.com/chzyer/readline/lineedit.
 type Terminal struct {
 	m         sync.Mutex
 	cfg       *Config
-	outchan   chan rune
+	outchan   chan termKey
 	closed    int32
 	stopChan  chan struct{}
 	kickChan  chan struct{}
@@ -21,6 +28,36 @@ type Terminal struct {
 	sleeping  int32
 
 	sizeChan chan string
+	// makes ReadRune return keyCancel, see Cancel
+	cancelChan chan struct{}
+	// makes ReadRune return keyWake, see wake
+	wakeChan chan struct{}
+	// makes ReadRune return keyRedraw, see redraw
+	redrawChan chan struct{}
+	// the TERM, for the sequences of the modified keys
+	term string
+
+	// the decoding time of the key last read, and the time spent on
+	// rendering and writing, for Config.FuncOnKeyLatency
+	lastDecode time.Duration
+	latency    latencyMeter
+	// the text of the MetaPaste last read
+	lastPaste []rune
+	// whether the key last read is part of a paste burst
+	lastBurst bool
+	// Esc is a key of its own when nothing follows it, see setPlainEsc
+	plainEsc int32
+	// Esc is always a key of its own, in the vim mode, see setVimMode
+	vimEsc int32
+}
+
+// termKey is a decoded key.
+type termKey struct {
+	r      rune
+	decode time.Duration
+	paste  []rune
+	// more input followed right away, see Config.PasteBurstGap
+	burst bool
 }
 
 func NewTerminal(cfg *Config) (*Terminal, error) {
@@ -28,13 +65,19 @@ func NewTerminal(cfg *Config) (*Terminal, error) {
 		return nil, err
 	}
 	t := &Terminal{
-		cfg:      cfg,
-		kickChan: make(chan struct{}, 1),
-		outchan:  make(chan rune),
-		stopChan: make(chan struct{}, 1),
-		sizeChan: make(chan string, 1),
+		cfg:        cfg,
+		kickChan:   make(chan struct{}, 1),
+		outchan:    make(chan termKey),
+		stopChan:   make(chan struct{}, 1),
+		sizeChan:   make(chan string, 1),
+		cancelChan: make(chan struct{}, 1),
+		wakeChan:   make(chan struct{}, 1),
+		redrawChan: make(chan struct{}, 1),
+		term:       os.Getenv("TERM"),
 	}
+	t.setVimMode(cfg.VimMode)
 
+	t.wg.Add(1)
 	go t.ioloop()
 	return t, nil
 }
@@ -54,15 +97,31 @@ func (t *Terminal) SleepToResume() {
 }
 
 func (t *Terminal) EnterRawMode() (err error) {
-	return t.cfg.FuncMakeRaw()
+	if err = t.cfg.FuncMakeRaw(); err == nil && t.bracketedPaste() {
+		t.Write([]byte("\033[?2004h"))
+	}
+	return
 }
 
 func (t *Terminal) ExitRawMode() (err error) {
+	if t.bracketedPaste() {
+		t.Write([]byte("\033[?2004l"))
+	}
 	return t.cfg.FuncExitRaw()
 }
 
+func (t *Terminal) bracketedPaste() bool {
+	return t.cfg.EnableBracketedPaste && t.cfg.useInteractive()
+}
+
+// Paste returns the text of the MetaPaste last read.
+func (t *Terminal) Paste() []rune {
+	return t.lastPaste
+}
+
 func (t *Terminal) Write(b []byte) (int, error) {
-	return t.cfg.Stdout.Write(b)
+	defer t.latency.addWrite(time.Now())
+	return t.cfg.PromptWriter.Write(b)
 }
 
 // WriteStdin prefill the next Stdin fetch
@@ -78,17 +137,18 @@ type termSize struct {
 
 func (t *Terminal) GetOffset(f func(offset string)) {
 	go func() {
+		defer recoverGoroutine(t.cfg)
 		f(<-t.sizeChan)
 	}()
 	t.Write([]byte("\033[6n"))
 }
 
 func (t *Terminal) Print(s string) {
-	fmt.Fprintf(t.cfg.Stdout, "%s", s)
+	fmt.Fprintf(t.cfg.PromptWriter, "%s", s)
 }
 
 func (t *Terminal) PrintRune(r rune) {
-	fmt.Fprintf(t.cfg.Stdout, "%c", r)
+	fmt.Fprintf(t.cfg.PromptWriter, "%c", r)
 }
 
 func (t *Terminal) Readline() *Operation {
@@ -96,18 +156,106 @@ func (t *Terminal) Readline() *Operation {
 }
 
 // return rune(0) if meet EOF
+// keyCancel is read after Cancel, it isn't a key of the terminal.
+const keyCancel = utf8.MaxRune + 1
+
+// keyWake is read after wake, it isn't a key of the terminal either.
+const keyWake = keyCancel + 1
+
+// keyRedraw is read after redraw, it isn't a key of the terminal either.
+const keyRedraw = keyWake + 1
+
 func (t *Terminal) ReadRune() rune {
-	ch, ok := <-t.outchan
-	if !ok {
-		return rune(0)
+	r, _ := t.readRuneWithin(nil)
+	return r
+}
+
+// readRuneWithin is ReadRune, it returns false if timeout fires before a
+// key is read.
+func (t *Terminal) readRuneWithin(timeout <-chan time.Time) (rune, bool) {
+	select {
+	case key, ok := <-t.outchan:
+		if !ok {
+			return rune(0), true
+		}
+		t.lastDecode, t.lastPaste, t.lastBurst = key.decode, key.paste, key.burst
+		return key.r, true
+	case <-t.cancelChan:
+		return keyCancel, true
+	case <-t.wakeChan:
+		return keyWake, true
+	case <-t.redrawChan:
+		return keyRedraw, true
+	case <-timeout:
+		return 0, false
+	}
+}
+
+// Burst tells whether the key last read is part of a paste burst.
+func (t *Terminal) Burst() bool {
+	return t.lastBurst
+}
+
+// Cancel makes the next ReadRune return keyCancel, so that the line
+// being edited is abandoned.
+func (t *Terminal) Cancel() {
+	select {
+	case t.cancelChan <- struct{}{}:
+	default:
+	}
+}
+
+// wake makes the next ReadRune return keyWake, for the ioloop to take
+// what was done on another goroutine, e.g. by an AsyncCompleter.
+func (t *Terminal) wake() {
+	select {
+	case t.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+// redraw makes the next ReadRune return keyRedraw, for the ioloop to draw
+// the line again, e.g. for the new width of the screen.
+func (t *Terminal) redraw() {
+	select {
+	case t.redrawChan <- struct{}{}:
+	default:
+	}
+}
+
+// unwake drops the keyWake which wasn't read yet.
+func (t *Terminal) unwake() {
+	select {
+	case <-t.wakeChan:
+	default:
 	}
-	return ch
 }
 
 func (t *Terminal) IsReading() bool {
 	return atomic.LoadInt32(&t.isReading) == 1
 }
 
+// setPlainEsc makes an Esc which nothing follows in the input a key of its
+// own, rather than the prefix of the next key, e.g. to cancel the
+// completion menu. The keys sending escape sequences send them at once.
+func (t *Terminal) setPlainEsc(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&t.plainEsc, v)
+}
+
+// setVimMode makes Esc a key of its own, which switches to the normal
+// mode, rather than the prefix of the next key, see Config.VimMode.
+func (t *Terminal) setVimMode(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&t.vimEsc, v)
+}
+
 func (t *Terminal) KickRead() {
 	select {
 	case t.kickChan <- struct{}{}:
@@ -116,7 +264,6 @@ func (t *Terminal) KickRead() {
 }
 
 func (t *Terminal) ioloop() {
-	t.wg.Add(1)
 	defer func() {
 		t.wg.Done()
 		close(t.outchan)
@@ -127,9 +274,23 @@ func (t *Terminal) ioloop() {
 		isEscapeEx     bool
 		isEscapeSS3    bool
 		expectNextChar bool
+		keyStart       time.Time
+		lastKey        time.Time
+		eol            eolFilter
+		// the escape sequence being decoded, reused from key to key
+		key escapeKeyPair
+		seq []byte
 	)
 
 	buf := bufio.NewReader(t.getStdin())
+	send := func(r rune, paste []rune) {
+		// the keys of a paste are already buffered, or follow at once
+		gap := t.cfg.PasteBurstGap
+		burst := gap > 0 && (buf.Buffered() > 0 || keyStart.Sub(lastKey) < gap)
+		t.outchan <- termKey{r, time.Since(keyStart), paste, burst}
+		lastKey = time.Now()
+	}
+
 	for {
 		if !expectNextChar {
 			atomic.StoreInt32(&t.isReading, 0)
@@ -141,7 +302,7 @@ func (t *Terminal) ioloop() {
 			}
 		}
 		expectNextChar = false
-		r, _, err := buf.ReadRune()
+		r, size, err := buf.ReadRune()
 		if err != nil {
 			if strings.Contains(err.Error(), "interrupted system call") {
 				expectNextChar = true
@@ -149,9 +310,45 @@ func (t *Terminal) ioloop() {
 			}
 			break
 		}
+		if !isEscape && !isEscapeEx && !isEscapeSS3 {
+			if t.cfg.NormalizeEOL && eol.skip(r) {
+				expectNextChar = true
+				continue
+			}
+			keyStart = time.Now()
+			if r == utf8.RuneError && size == 1 && !t.cfg.MetaSendsEscape {
+				// the 8-bit meta of the legacy terminals, e.g. 0xE2 for
+				// Alt-b, isn't valid UTF-8: it's decoded like Esc b
+				buf.UnreadRune()
+				if b, _ := buf.ReadByte(); b >= 0xA0 {
+					r, isEscape = rune(b&^0x80), true
+				}
+			}
+			if r == CharBackspace || r == CharCtrlH {
+				r = t.cfg.eraseKey(r)
+			}
+			if t.cfg.FilterControls && isC1(r) {
+				expectNextChar = true
+				switch {
+				case r == charCSI:
+					isEscapeEx = true
+				case r == charSS3:
+					isEscapeSS3 = true
+				case isStringIntroducer(r):
+					skipControlString(buf)
+				}
+				continue
+			}
+		}
 
 		if isEscape {
 			isEscape = false
+			if t.cfg.FilterControls && isStringIntroducer(r+0x40) && buf.Buffered() > 0 {
+				// ESC ], ESC P...
+				expectNextChar = true
+				skipControlString(buf)
+				continue
+			}
 			if r == CharEscapeEx {
 				// ^][
 				expectNextChar = true
@@ -166,19 +363,27 @@ func (t *Terminal) ioloop() {
 			r = escapeKey(r, buf)
 		} else if isEscapeEx {
 			isEscapeEx = false
-			if key := readEscKey(r, buf); key != nil {
-				r = escapeExKey(key)
-				// offset
-				if key.typ == 'R' {
-					if _, _, ok := key.Get2(); ok {
-						select {
-						case t.sizeChan <- key.attr:
-						default:
-						}
+			key.read(r, buf)
+			if key.typ == '~' && string(key.attr) == "200" {
+				send(MetaPaste, readPaste(buf))
+				expectNextChar = true
+				continue
+			}
+			seq = key.appendSeq(seq[:0], "\033[")
+			var ok bool
+			if r, ok = t.keySequence(seq); !ok {
+				r = escapeExKey(&key)
+			}
+			// offset
+			if key.typ == 'R' {
+				if _, _, ok := key.Get2(); ok {
+					select {
+					case t.sizeChan <- string(key.attr):
+					default:
 					}
-					expectNextChar = true
-					continue
 				}
+				expectNextChar = true
+				continue
 			}
 			if r == 0 {
 				expectNextChar = true
@@ -186,8 +391,11 @@ func (t *Terminal) ioloop() {
 			}
 		} else if isEscapeSS3 {
 			isEscapeSS3 = false
-			if key := readEscKey(r, buf); key != nil {
-				r = escapeSS3Key(key)
+			key.read(r, buf)
+			seq = key.appendSeq(seq[:0], "\033O")
+			var ok bool
+			if r, ok = t.keySequence(seq); !ok {
+				r = escapeSS3Key(&key, t.cfg.KeypadNavigation)
 			}
 			if r == 0 {
 				expectNextChar = true
@@ -198,8 +406,8 @@ func (t *Terminal) ioloop() {
 		expectNextChar = true
 		switch r {
 		case CharEsc:
-			if t.cfg.VimMode {
-				t.outchan <- r
+			if atomic.LoadInt32(&t.vimEsc) == 1 || atomic.LoadInt32(&t.plainEsc) == 1 && buf.Buffered() == 0 {
+				send(r, nil)
 				break
 			}
 			isEscape = true
@@ -207,7 +415,7 @@ func (t *Terminal) ioloop() {
 			expectNextChar = false
 			fallthrough
 		default:
-			t.outchan <- r
+			send(r, nil)
 		}
 	}
 
@@ -250,5 +458,6 @@ func (t *Terminal) SetConfig(c *Config) error {
 	t.m.Lock()
 	t.cfg = c
 	t.m.Unlock()
+	t.setVimMode(c.VimMode)
 	return nil
 }
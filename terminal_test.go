@@ -0,0 +1,158 @@
+package readline
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// repeatReader reads its keys over and over, until it's closed.
+type repeatReader struct {
+	keys   []byte
+	i      int
+	closed int32
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&r.closed) == 1 {
+		return 0, io.EOF
+	}
+	for i := range p {
+		p[i] = r.keys[r.i]
+		r.i = (r.i + 1) % len(r.keys)
+	}
+	return len(p), nil
+}
+
+func (r *repeatReader) Close() error {
+	atomic.StoreInt32(&r.closed, 1)
+	return nil
+}
+
+var decodeKeys = []struct {
+	name string
+	keys string
+}{
+	{"ASCII", "abcd"},
+	{"UTF8", "é€"},
+	{"Control", "\x01\x05\x17"},
+	{"Meta", "\033b\033f"},
+	{"CSI", "\033[D\033[C"},
+	{"Modified", "\033[1;5D\033[3;5~"},
+	{"SS3", "\033OA\033OB"},
+	{"Delete", "\033[3~"},
+}
+
+// newDecoder returns the function reading the next of the keys, read over
+// and over by a Terminal, and the one closing it.
+func newDecoder(keys string) (next func() rune, close func()) {
+	stdin := &repeatReader{keys: []byte(keys)}
+	cfg := &Config{
+		Stdin:          stdin,
+		FuncIsTerminal: func() bool { return true },
+		// the sequences of the rxvt keys are looked up too
+		KeySequences: map[string]rune{"\033Od": MetaBackward},
+	}
+	t, err := NewTerminal(cfg)
+	if err != nil {
+		panic(err)
+	}
+	next = func() rune {
+		// Delete, like Enter, waits for the next read
+		t.KickRead()
+		return t.ReadRune()
+	}
+	close = func() {
+		// the Config.Stdin of the Terminal doesn't close it, and the keys
+		// buffered are dropped
+		stdin.Close()
+		go func() {
+			for range t.outchan {
+			}
+		}()
+		t.Close()
+	}
+	return next, close
+}
+
+func TestDecodeAllocs(t *testing.T) {
+	for _, c := range decodeKeys {
+		next, close := newDecoder(c.keys)
+		for i := 0; i < 10; i++ {
+			next()
+		}
+		if n := testing.AllocsPerRun(100, func() { next() }); n != 0 {
+			t.Errorf("%s: allocations per key %v", c.name, n)
+		}
+		close()
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, c := range decodeKeys {
+		c := c
+		b.Run(c.name, func(b *testing.B) {
+			next, close := newDecoder(c.keys)
+			defer close()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				next()
+			}
+		})
+	}
+}
+
+func TestBracketedPaste(t *testing.T) {
+	out := new(syncBuffer)
+	var pasted int32
+	rl, w := newTestInstance(t, &Config{
+		Stdout:               out,
+		EnableBracketedPaste: true,
+		AutoComplete:         NewPrefixCompleter(PcItem("foo")),
+		Listener: FuncListener(func(line []rune, pos int, key rune) ([]rune, int, bool) {
+			if key == MetaPaste {
+				atomic.AddInt32(&pasted, 1)
+			}
+			return nil, 0, false
+		}),
+	})
+
+	// neither completed nor accepted
+	go w.Write([]byte("ls \033[200~f\tb\r\nc\033[201~\r"))
+	if line, err := rl.Readline(); err != nil || line != "ls f\tb\nc" {
+		t.Fatalf("result not expect %q %v", line, err)
+	}
+	// undone at once
+	go w.Write([]byte("ls \033[200~a b c\033[201~\x1f\r"))
+	if line, err := rl.Readline(); err != nil || line != "ls " {
+		t.Fatalf("result not expect %q %v", line, err)
+	}
+	if n := atomic.LoadInt32(&pasted); n != 2 {
+		t.Fatal("the Listener got the pastes", n)
+	}
+	if o := out.String(); !strings.Contains(o, "\033[?2004h") || !strings.Contains(o, "\033[?2004l") {
+		t.Fatalf("bracketed paste mode not set %q", o)
+	}
+}
+
+func TestEightBitMeta(t *testing.T) {
+	for _, escape := range []bool{false, true} {
+		rl, w := newTestInstance(t, &Config{
+			MetaSendsEscape: escape,
+		})
+
+		// 0xE2 is Alt-b
+		go w.Write([]byte("ls foo\xe2x\r"))
+		expect := "ls xfoo"
+		if escape {
+			expect = "ls foo\ufffdx"
+		}
+		if line, err := rl.Readline(); err != nil || line != expect {
+			t.Fatal("result not expect", line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
@@ -0,0 +1,106 @@
+package readline
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the indexes of the string capabilities in a compiled terminfo entry
+const (
+	terminfoKeyBackspace = 55 // kbs
+	terminfoKeyDelete    = 59 // kdch1
+)
+
+// terminfoDirs returns the directories of the terminfo database, in the
+// order ncurses searches them.
+func terminfoDirs() []string {
+	var dirs []string
+	if dir := os.Getenv("TERMINFO"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".terminfo"))
+	}
+	for _, dir := range strings.Split(os.Getenv("TERMINFO_DIRS"), ":") {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, "/etc/terminfo", "/lib/terminfo", "/usr/share/terminfo")
+}
+
+// readTerminfo reads the compiled terminfo entry of term.
+func readTerminfo(term string) ([]byte, error) {
+	if term == "" || strings.ContainsAny(term, `/\`) {
+		return nil, fmt.Errorf("terminfo: invalid TERM %q", term)
+	}
+	for _, dir := range terminfoDirs() {
+		// by the first letter, or its hex code on macOS
+		for _, sub := range []string{term[:1], fmt.Sprintf("%x", term[0])} {
+			if data, err := ioutil.ReadFile(filepath.Join(dir, sub, term)); err == nil {
+				return data, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("terminfo: no entry for %q", term)
+}
+
+// terminfoString returns the string capability at index of the compiled
+// terminfo entry data, false if it's missing.
+func terminfoString(data []byte, index int) (string, bool) {
+	if len(data) < 12 {
+		return "", false
+	}
+	header := make([]int, 6)
+	for i := range header {
+		header[i] = int(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	numSize := 2
+	switch header[0] {
+	case 0432:
+	case 01036:
+		// the extended format, with 32-bit numbers
+		numSize = 4
+	default:
+		return "", false
+	}
+	names, bools, nums, strs, table := header[1], header[2], header[3], header[4], header[5]
+	if index >= strs {
+		return "", false
+	}
+	offsets := 12 + names + bools
+	if offsets%2 != 0 {
+		offsets++
+	}
+	offsets += nums * numSize
+	tableStart := offsets + strs*2
+	if len(data) < tableStart+table {
+		return "", false
+	}
+	off := binary.LittleEndian.Uint16(data[offsets+index*2:])
+	if off >= 0xfffe || int(off) >= table {
+		// absent or cancelled
+		return "", false
+	}
+	s := data[tableStart+int(off) : tableStart+table]
+	if end := strings.IndexByte(string(s), 0); end >= 0 {
+		s = s[:end]
+	}
+	return string(s), true
+}
+
+// terminfoEraseKeys returns the sequences the Backspace and Delete keys
+// send according to the terminfo entry of term, empty if it doesn't tell.
+func terminfoEraseKeys(term string) (backspace, del string) {
+	data, err := readTerminfo(term)
+	if err != nil {
+		return "", ""
+	}
+	backspace, _ = terminfoString(data, terminfoKeyBackspace)
+	del, _ = terminfoString(data, terminfoKeyDelete)
+	return
+}
@@ -0,0 +1,93 @@
+package readline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// compileTerminfo encodes a legacy terminfo entry with the string
+// capabilities caps.
+func compileTerminfo(names string, caps map[int]string) []byte {
+	var table []byte
+	offsets := make([]uint16, 60)
+	for i := range offsets {
+		if s, ok := caps[i]; ok {
+			offsets[i] = uint16(len(table))
+			table = append(table, s+"\x00"...)
+		} else {
+			offsets[i] = 0xffff
+		}
+	}
+	names += "\x00"
+	var data []byte
+	for _, n := range []int{0432, len(names), 0, 0, len(offsets), len(table)} {
+		data = append(data, byte(n), byte(n>>8))
+	}
+	data = append(data, names...)
+	if len(names)%2 != 0 {
+		data = append(data, 0)
+	}
+	for _, off := range offsets {
+		data = append(data, byte(off), byte(off>>8))
+	}
+	return append(data, table...)
+}
+
+func TestTerminfoEraseKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terminfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "s"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	entry := compileTerminfo("swapped|test entry", map[int]string{
+		terminfoKeyBackspace: "\b",
+		terminfoKeyDelete:    "\x7f",
+	})
+	if err := ioutil.WriteFile(filepath.Join(dir, "s", "swapped"), entry, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	old, had := os.LookupEnv("TERMINFO")
+	os.Setenv("TERMINFO", dir)
+	defer func() {
+		if had {
+			os.Setenv("TERMINFO", old)
+		} else {
+			os.Unsetenv("TERMINFO")
+		}
+	}()
+	if bs, del := terminfoEraseKeys("swapped"); bs != "\b" || del != "\x7f" {
+		t.Fatalf("result not expect %q %q", bs, del)
+	}
+	if bs, del := terminfoEraseKeys("no-such-term"); bs != "" || del != "" {
+		t.Fatalf("result not expect %q %q", bs, del)
+	}
+}
+
+func TestEraseKeys(t *testing.T) {
+	for _, c := range []struct {
+		backspace, del string
+		input          string
+		expect         string
+	}{
+		{"\x7f", "\033[3~", "abc\x02\x02\x7f\033[3~\r", "c"},
+		{"\b", "\x7f", "abc\x02\x02\x7f\b\r", "c"},
+		{"\033[3~", "\x7f", "abc\x02\x02\033[3~\x7f\r", "c"},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			KeyBackspace: c.backspace,
+			KeyDelete:    c.del,
+		})
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
@@ -0,0 +1,83 @@
+package readline
+
+// trainerRepeats is how many times in a row a key is pressed before
+// Config.Trainer suggests a faster one.
+const trainerRepeats = 4
+
+// opTrainer counts the keys pressed in a row, for Config.Trainer.
+type opTrainer struct {
+	key   rune
+	count int
+}
+
+// trainerTip is the action of the key which does at once what a key
+// pressed over and over did.
+type trainerTip struct {
+	action rune
+	does   string
+}
+
+// tip counts r and returns the tip for it if it was pressed over and
+// over, with the cursor at pos in a line of n runes after it.
+func (o *opTrainer) tip(r rune, pos, n int) (trainerTip, bool) {
+	if r != o.key {
+		o.key, o.count = r, 0
+	}
+	o.count++
+	if o.count < trainerRepeats {
+		return trainerTip{}, false
+	}
+	switch r {
+	case CharBackward:
+		if pos == 0 {
+			return trainerTip{CharLineStart, "moves to the start of the line"}, true
+		}
+		return trainerTip{MetaBackward, "moves back a word"}, true
+	case CharForward:
+		if pos == n {
+			return trainerTip{CharLineEnd, "moves to the end of the line"}, true
+		}
+		return trainerTip{MetaForward, "moves forward a word"}, true
+	case CharBackspace:
+		if pos == 0 {
+			return trainerTip{CharCtrlU, "cuts the line before the cursor"}, true
+		}
+		return trainerTip{CharCtrlW, "cuts the word before the cursor"}, true
+	case CharDelete:
+		if pos == n {
+			return trainerTip{CharKill, "cuts the line after the cursor"}, true
+		}
+		return trainerTip{MetaDelete, "cuts the word after the cursor"}, true
+	}
+	return trainerTip{}, false
+}
+
+func (o *opTrainer) reset() {
+	o.key, o.count = 0, 0
+}
+
+// showTip draws below the line the key which does at once what r, pressed
+// over and over, did, see Config.Trainer. It's drawn until the next
+// refresh.
+func (o *Operation) showTip(r rune) {
+	if !o.keyConfig().Trainer || o.mode() != o.editMode() || o.waiting {
+		o.trainer.reset()
+		return
+	}
+	tip, ok := o.trainer.tip(r, o.buf.Pos(), o.buf.Len())
+	if !ok {
+		return
+	}
+	key, ok := o.keyFor(tip.action)
+	if !ok {
+		return
+	}
+	o.w.Write(o.buf.BelowOutput([]byte("tip: " + KeyName(key) + " " + tip.does)))
+}
+
+// SetTrainer turns Config.Trainer on or off from the next key on.
+func (o *Operation) SetTrainer(on bool) {
+	o.updateConfig(func(cfg *Config) {
+		cfg.Trainer = on
+	})
+}
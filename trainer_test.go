@@ -0,0 +1,78 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestTrainerTip(t *testing.T) {
+	for _, c := range []struct {
+		key    rune
+		pos, n int
+		expect rune
+	}{
+		{CharBackward, 3, 10, MetaBackward},
+		{CharBackward, 0, 10, CharLineStart},
+		{CharForward, 3, 10, MetaForward},
+		{CharForward, 10, 10, CharLineEnd},
+		{CharBackspace, 3, 10, CharCtrlW},
+		{CharBackspace, 0, 6, CharCtrlU},
+		{CharDelete, 3, 10, MetaDelete},
+		{CharDelete, 3, 3, CharKill},
+		{'a', 3, 3, 0},
+	} {
+		var o opTrainer
+		for i := 1; i < trainerRepeats; i++ {
+			if _, ok := o.tip(c.key, c.pos, c.n); ok {
+				t.Fatalf("%v: tip after %d keys", KeyName(c.key), i)
+			}
+		}
+		tip, _ := o.tip(c.key, c.pos, c.n)
+		if tip.action != c.expect {
+			t.Fatalf("%v: expect %v, got %v", KeyName(c.key), KeyName(c.expect), KeyName(tip.action))
+		}
+	}
+}
+
+func TestTrainer(t *testing.T) {
+	d, err := NewDriver(&Config{
+		Prompt:  "> ",
+		Trainer: true,
+		// the tip names the key bound to the action, C-o
+		Keymaps: map[string]Keymap{KeymapEmacs: {0x0f: MetaBackward}},
+	}, 40, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := d.Readline()
+		lines <- line
+	}()
+
+	d.Type("git commit -m fix")
+	for i := 0; i < trainerRepeats; i++ {
+		d.Press("left")
+	}
+	if _, err := d.Expect(`^tip: C-o moves back a word$`); err != nil {
+		t.Fatal(err)
+	}
+	// gone on the next key
+	d.Type("x")
+	if _, err := d.Expect(`^> git commit -mx fix\n\n`); err != nil {
+		t.Fatal(err)
+	}
+
+	d.SetTrainer(false)
+	d.Press("end")
+	for i := 0; i < trainerRepeats; i++ {
+		d.Press("backspace")
+	}
+	if _, err := d.Expect(`^> git commit -mx\n\n`); err != nil {
+		t.Fatal(err)
+	}
+	d.Press("enter")
+	if line := <-lines; line != "git commit -mx" {
+		t.Fatal("result not expect", line)
+	}
+}
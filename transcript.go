@@ -0,0 +1,154 @@
+package readline
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// transcript records the decoded keys for Config.Transcript. Runs of
+// printable characters are collapsed into a single insert event which
+// only tells their length, and optionally a salted hash so that repeated
+// inputs can be recognized without being revealed.
+type transcript struct {
+	m     sync.Mutex
+	w     io.Writer
+	hash  bool
+	salt  []byte
+	start time.Time
+	last  time.Time
+
+	pending      int
+	pendingHash  []rune
+	pendingStart time.Time
+}
+
+func newTranscript(w io.Writer, hash bool) *transcript {
+	t := &transcript{w: w, hash: hash, salt: make([]byte, 16)}
+	rand.Read(t.salt)
+	t.start = time.Now()
+	t.last = t.start
+	return t
+}
+
+func (t *transcript) Key(r rune) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	now := time.Now()
+	if IsPrintable(r) {
+		if t.pending == 0 {
+			t.pendingStart = now
+		}
+		t.pending++
+		if t.hash {
+			t.pendingHash = append(t.pendingHash, r)
+		}
+		return
+	}
+	t.flush()
+	t.write(now, KeyName(r))
+}
+
+// Flush writes the pending insert event, e.g. when the Instance is closed.
+func (t *transcript) Flush() {
+	t.m.Lock()
+	t.flush()
+	t.m.Unlock()
+}
+
+func (t *transcript) flush() {
+	if t.pending == 0 {
+		return
+	}
+	event := fmt.Sprintf("insert n=%d", t.pending)
+	if t.hash {
+		h := sha256.New()
+		h.Write(t.salt)
+		h.Write([]byte(string(t.pendingHash)))
+		event += " hash=" + hex.EncodeToString(h.Sum(nil)[:6])
+	}
+	t.write(t.pendingStart, event)
+	t.pending = 0
+	t.pendingHash = t.pendingHash[:0]
+}
+
+func (t *transcript) write(at time.Time, event string) {
+	fmt.Fprintf(t.w, "%9.3f %+8.1fms %s\n",
+		at.Sub(t.start).Seconds(),
+		float64(at.Sub(t.last))/float64(time.Millisecond),
+		event)
+	t.last = at
+}
+
+var keyNames = map[rune]string{
+	0:                 "EOF",
+	CharTab:           "Tab",
+	CharCtrlJ:         "C-j",
+	CharEnter:         "Enter",
+	CharEsc:           "Esc",
+	CharBackspace:     "Backspace",
+	MetaBackward:      "M-b",
+	MetaForward:       "M-f",
+	MetaDelete:        "M-d",
+	MetaBackspace:     "M-Backspace",
+	MetaTranspose:     "M-C-t",
+	MetaEnter:         "M-Enter",
+	MetaPushLine:      "M-q",
+	MetaRevertLine:    "M-r",
+	MetaYankLastArg:   "M-.",
+	MetaYankNthArg:    "M-C-y",
+	MetaInsertComment: "M-#",
+	MetaTogglePin:     "M-p",
+	MetaBrowseHistory: "browse-history",
+	MetaAddCursor:     "M-n",
+	MetaSetMark:       "M-SPC",
+	MetaKillRectangle: "kill-rectangle",
+	MetaYankRectangle: "yank-rectangle",
+	MetaKillToken:     "M-C-k",
+	MetaBackKillToken: "M-C-w",
+	MetaRedo:          "redo",
+	MetaYankPop:       "M-y",
+	MetaPaste:         "paste",
+	MetaPageUp:        "PageUp",
+	MetaPageDown:      "PageDown",
+	CharUndo:          "C-_",
+
+	MetaMenuComplete:         "menu-complete",
+	MetaMenuCompleteBackward: "S-Tab",
+	MetaStartMacro:           "C-x (",
+	MetaEndMacro:             "C-x )",
+	MetaPlayMacro:            "C-x e",
+	MetaUniversalArgument:    "universal-argument",
+	MetaNegativeArgument:     "M--",
+	MetaDigit0:               "M-0",
+	MetaDigit1:               "M-1",
+	MetaDigit2:               "M-2",
+	MetaDigit3:               "M-3",
+	MetaDigit4:               "M-4",
+	MetaDigit5:               "M-5",
+	MetaDigit6:               "M-6",
+	MetaDigit7:               "M-7",
+	MetaDigit8:               "M-8",
+	MetaDigit9:               "M-9",
+
+	MetaHistorySearchBackward: "history-search-backward",
+	MetaHistorySearchForward:  "history-search-forward",
+}
+
+// KeyName describes a decoded key, e.g. "C-a" or "M-b".
+func KeyName(r rune) string {
+	if name, ok := keyNames[r]; ok {
+		return name
+	}
+	if r > 0 && r < 32 {
+		return "C-" + string(r+'a'-1)
+	}
+	if IsPrintable(r) {
+		return string(r)
+	}
+	return fmt.Sprintf("key(%d)", r)
+}
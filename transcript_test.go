@@ -0,0 +1,73 @@
+package readline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTranscript(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	tr := newTranscript(buf, true)
+	for _, r := range "secret" {
+		tr.Key(r)
+	}
+	tr.Key(CharLineStart)
+	tr.Key(MetaForward)
+	for _, r := range "secret" {
+		tr.Key(r)
+	}
+	tr.Key(CharEnter)
+
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Fatal("typed text is leaked", out)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	expect := []string{"insert n=6 hash=", "C-a", "M-f", "insert n=6 hash=", "Enter"}
+	if len(lines) != len(expect) {
+		t.Fatal("result not expect", out)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, expect[i]) {
+			t.Fatal("result not expect", line, expect[i])
+		}
+	}
+	if lines[0][strings.Index(lines[0], "hash="):] != lines[3][strings.Index(lines[3], "hash="):] {
+		t.Fatal("same input should have the same hash", out)
+	}
+}
+
+func TestTranscriptFlush(t *testing.T) {
+	first, second := new(syncBuffer), new(syncBuffer)
+	rl, w := newTestInstance(t, &Config{Transcript: first})
+	go rl.Readline()
+	typed := func(line string) {
+		for i := 0; rl.State().Line != line; i++ {
+			if i > 500 {
+				t.Fatal("not typed", line)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	go w.Write([]byte("ab"))
+	typed("ab")
+	// the characters typed before the writer is swapped go to the first
+	cfg := *rl.Config
+	cfg.Transcript = second
+	rl.SetConfig(&cfg)
+	go w.Write([]byte("c"))
+	typed("abc")
+	if !strings.Contains(first.String(), "insert n=2") {
+		t.Fatalf("result not expect %q", first.String())
+	}
+
+	// and the ones typed before the Instance is closed
+	w.Close()
+	rl.Close()
+	if !strings.Contains(second.String(), "insert n=1") {
+		t.Fatalf("result not expect %q", second.String())
+	}
+}
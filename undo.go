@@ -0,0 +1,92 @@
+package readline
+
+// The edits of the line are recorded as the snapshots of the line before
+// them, by the refreshes which change it: CharUndo steps back through
+// them and MetaRedo forward again. The characters typed in a row make a
+// single edit per word, with the spaces after it, like in GNU readline.
+
+// maxUndo bounds the edits recorded for a line.
+const maxUndo = 256
+
+// recordUndo records the edit which turned old into the line, with the
+// cursor at oldIdx before it. It returns whether old is kept.
+func (r *RuneBuffer) recordUndo(old []rune, oldIdx int) bool {
+	if r.undoing {
+		r.undoing = false
+		r.insertAt = -1
+		return false
+	}
+	if runes.Equal(old, r.buf) || r.cfg.EnableMask {
+		// the moves of the cursor aren't edits, and the passwords
+		// aren't copied
+		return false
+	}
+	r.redo = nil
+
+	inserted := len(r.buf) == len(old)+1 && r.idx == oldIdx+1 &&
+		runes.Equal(r.buf[:oldIdx], old[:oldIdx]) && runes.Equal(r.buf[r.idx:], old[oldIdx:])
+	if inserted && oldIdx == r.insertAt && !startsWord(r.buf, oldIdx) {
+		r.insertAt = r.idx
+		return false
+	}
+	r.insertAt = -1
+	if inserted {
+		r.insertAt = r.idx
+	}
+	r.undo = append(r.undo, &runeBufferBck{old, oldIdx})
+	if len(r.undo) > maxUndo {
+		r.undo = r.undo[1:]
+	}
+	return true
+}
+
+// Undo reverts the last edit, it returns false if there isn't any.
+func (r *RuneBuffer) Undo() (success bool) {
+	r.Refresh(func() {
+		if len(r.undo) == 0 {
+			return
+		}
+		bck := r.undo[len(r.undo)-1]
+		r.undo = r.undo[:len(r.undo)-1]
+		r.redo = append(r.redo, &runeBufferBck{runes.Copy(r.buf), r.idx})
+		r.buf, r.idx = bck.buf, bck.idx
+		r.undoing = true
+		success = true
+	})
+	return
+}
+
+// Redo performs the last edit reverted by Undo again, it returns false if
+// there isn't any.
+func (r *RuneBuffer) Redo() (success bool) {
+	r.Refresh(func() {
+		if len(r.redo) == 0 {
+			return
+		}
+		bck := r.redo[len(r.redo)-1]
+		r.redo = r.redo[:len(r.redo)-1]
+		r.undo = append(r.undo, &runeBufferBck{runes.Copy(r.buf), r.idx})
+		r.buf, r.idx = bck.buf, bck.idx
+		r.undoing = true
+		success = true
+	})
+	return
+}
+
+// startsWord tells whether the rune at i begins a word.
+func startsWord(rs []rune, i int) bool {
+	return i > 0 && IsWordBreak(rs[i-1]) && !IsWordBreak(rs[i])
+}
+
+// edit runs f, the change of a refresh, and records it.
+func (r *RuneBuffer) edit(f func()) {
+	// the line before is copied into the spare slice, unless it was kept
+	// by the last edit
+	old, oldIdx := append(r.spare[:0], r.buf...), r.idx
+	f()
+	if r.recordUndo(old, oldIdx) {
+		r.spare = nil
+	} else {
+		r.spare = old
+	}
+}
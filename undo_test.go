@@ -0,0 +1,63 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestUndoEdits(t *testing.T) {
+	cfg := &Config{Painter: &defaultPainter{}, FuncIsTerminal: func() bool { return false }}
+	rb := NewRuneBuffer(nil, "", cfg, 80)
+	for _, r := range "git log" {
+		rb.WriteRune(r)
+	}
+	rb.MoveToLineStart()
+	rb.Kill()
+	if rb.Len() != 0 {
+		t.Fatal("result not expect", string(rb.buf))
+	}
+
+	// the kill, then the words typed
+	for _, expect := range []string{"git log", "git ", ""} {
+		if !rb.Undo() || string(rb.buf) != expect {
+			t.Fatalf("expect %q, got %q", expect, string(rb.buf))
+		}
+	}
+	if rb.Undo() {
+		t.Fatal("nothing left to undo")
+	}
+	if !rb.Redo() || string(rb.buf) != "git " || rb.idx != 4 {
+		t.Fatal("result not expect", string(rb.buf), rb.idx)
+	}
+
+	// a new edit drops the redos
+	rb.WriteRune('x')
+	if rb.Redo() {
+		t.Fatal("redo after an edit")
+	}
+	rb.Reset()
+	if rb.Undo() {
+		t.Fatal("undo across lines")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	for _, c := range []struct {
+		vim    bool
+		input  string
+		expect string
+	}{
+		{false, "ls foo\x17bar\x1f\x1f\r", "ls foo"},
+		{false, "ls\x15\x18\x15 x\r", "ls x"},
+		{true, "ls foo\x1bbdwuuu\x12\r", "ls "},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			VimMode: c.vim,
+		})
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Fatalf("%q: result not expect %q %v", c.input, line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
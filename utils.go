@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"container/list"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -13,6 +14,7 @@ import (
 	"syscall"
 	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -40,11 +42,13 @@ const (
 	CharTranspose = 20
 	CharCtrlU     = 21
 	CharCtrlW     = 23
+	CharCtrlX     = 24
 	CharCtrlY     = 25
 	CharCtrlZ     = 26
 	CharEsc       = 27
 	CharO         = 79
 	CharEscapeEx  = 91
+	CharUndo      = 31
 	CharBackspace = 127
 )
 
@@ -54,6 +58,64 @@ const (
 	MetaDelete
 	MetaBackspace
 	MetaTranspose
+	MetaEnter
+	MetaPushLine
+	MetaRevertLine
+	MetaYankLastArg
+	MetaYankNthArg
+	MetaInsertComment
+	MetaTogglePin
+	// opens the history browser, it isn't bound to a key by default
+	MetaBrowseHistory
+	MetaAddCursor
+	MetaSetMark
+	// cut and paste the rectangle between the mark and the cursor, they
+	// aren't bound to keys by default
+	MetaKillRectangle
+	MetaYankRectangle
+	MetaKillToken
+	MetaBackKillToken
+	// performs the edit reverted by CharUndo again, it's Ctrl-R in vi
+	// command mode and isn't bound to a key in emacs mode
+	MetaRedo
+	MetaYankPop
+	// the text pasted in the bracketed paste mode, it's inserted as it
+	// is and the Listener gets it as the key
+	MetaPaste
+	// move the selection of the completion menu by a screen, they're
+	// ignored elsewhere
+	MetaPageUp
+	MetaPageDown
+	// insert the next or the previous completion candidate in turn, see
+	// Config.MenuComplete. The latter is Shift-Tab
+	MetaMenuComplete
+	MetaMenuCompleteBackward
+	// start and end the recording of the keyboard macro, and replay it.
+	// They're C-x (, C-x ) and C-x e
+	MetaStartMacro
+	MetaEndMacro
+	MetaPlayMacro
+	// the numeric argument of the next key, which repeats it or makes it
+	// go the other way: M-0 to M-9 and M-- type it. universal-argument
+	// isn't bound to a key by default, Ctrl-U cuts the line like in GNU
+	// readline
+	MetaUniversalArgument
+	MetaNegativeArgument
+	MetaDigit0
+	MetaDigit1
+	MetaDigit2
+	MetaDigit3
+	MetaDigit4
+	MetaDigit5
+	MetaDigit6
+	MetaDigit7
+	MetaDigit8
+	MetaDigit9
+	// recall the previous or the next line of the history which starts
+	// with the text before the cursor, which stays there. They aren't
+	// bound to keys by default
+	MetaHistorySearchBackward
+	MetaHistorySearchForward
 )
 
 // WaitForResume need to call before current process got suspend.
@@ -101,6 +163,9 @@ func IsPrintable(key rune) bool {
 
 // translate Esc[X
 func escapeExKey(key *escapeKeyPair) rune {
+	if r := modifiedKey(key); r != 0 {
+		return r
+	}
 	var r rune
 	switch key.typ {
 	case 'D':
@@ -116,16 +181,41 @@ func escapeExKey(key *escapeKeyPair) rune {
 	case 'F':
 		r = CharLineEnd
 	case '~':
-		if key.attr == "3" {
+		switch string(key.attr) {
+		case "3":
 			r = CharDelete
+		case "5":
+			r = MetaPageUp
+		case "6":
+			r = MetaPageDown
 		}
+	case 'Z':
+		r = MetaMenuCompleteBackward
 	default:
 	}
 	return r
 }
 
+// the keys of the numeric keypad in application mode
+var keypadKeys = map[rune]rune{
+	'p': '0', 'q': '1', 'r': '2', 's': '3', 't': '4',
+	'u': '5', 'v': '6', 'w': '7', 'x': '8', 'y': '9',
+	'j': '*', 'k': '+', 'l': ',', 'm': '-', 'n': '.', 'o': '/',
+	'X': '=', ' ': ' ', 'I': CharTab, 'M': CharEnter,
+}
+
+// the keypad keys as printed below the digits, for Config.KeypadNavigation
+var keypadNavigation = map[rune]rune{
+	'p': 0, 'q': CharLineEnd, 'r': CharNext, 's': 0, 't': CharBackward,
+	'u': 0, 'v': CharForward, 'w': CharLineStart, 'x': CharPrev, 'y': 0,
+	'n': CharDelete,
+}
+
 // translate EscOX SS3 codes for up/down/etc.
-func escapeSS3Key(key *escapeKeyPair) rune {
+func escapeSS3Key(key *escapeKeyPair, navigation bool) rune {
+	if r := modifiedKey(key); r != 0 {
+		return r
+	}
 	var r rune
 	switch key.typ {
 	case 'D':
@@ -141,17 +231,24 @@ func escapeSS3Key(key *escapeKeyPair) rune {
 	case 'F':
 		r = CharLineEnd
 	default:
+		if nav, ok := keypadNavigation[key.typ]; ok && navigation {
+			return nav
+		}
+		r = keypadKeys[key.typ]
 	}
 	return r
 }
 
+// escapeKeyPair is the parameters and the final character of an escape
+// sequence. The ioloop of the Terminal reads every sequence into the same
+// one, so that the keys are decoded without allocating.
 type escapeKeyPair struct {
-	attr string
+	attr []byte
 	typ  rune
 }
 
 func (e *escapeKeyPair) Get2() (int, int, bool) {
-	sp := strings.Split(e.attr, ";")
+	sp := strings.Split(string(e.attr), ";")
 	if len(sp) < 2 {
 		return -1, -1, false
 	}
@@ -166,21 +263,72 @@ func (e *escapeKeyPair) Get2() (int, int, bool) {
 	return s1, s2, true
 }
 
-func readEscKey(r rune, reader *bufio.Reader) *escapeKeyPair {
-	p := escapeKeyPair{}
-	buf := bytes.NewBuffer(nil)
+// read reads the rest of the escape sequence whose first rune after the
+// introducer is r.
+func (e *escapeKeyPair) read(r rune, reader *bufio.Reader) {
+	e.attr = e.attr[:0]
+	for r == ';' || unicode.IsNumber(r) {
+		var enc [utf8.UTFMax]byte
+		e.attr = append(e.attr, enc[:utf8.EncodeRune(enc[:], r)]...)
+		r, _, _ = reader.ReadRune()
+	}
+	e.typ = r
+}
+
+// appendSeq appends the sequence to b, after its introducer, e.g.
+// "\033[1;5D" for the introducer "\033[".
+func (e *escapeKeyPair) appendSeq(b []byte, intro string) []byte {
+	b = append(append(b, intro...), e.attr...)
+	var enc [utf8.UTFMax]byte
+	return append(b, enc[:utf8.EncodeRune(enc[:], e.typ)]...)
+}
+
+// pasteEnd ends the text pasted in the bracketed paste mode.
+var pasteEnd = []rune("\033[201~")
+
+// readPaste reads the pasted text up to pasteEnd, the \r\n and \r line
+// endings become \n.
+func readPaste(reader *bufio.Reader) []rune {
+	var text []rune
 	for {
-		if r == ';' {
-		} else if unicode.IsNumber(r) {
-		} else {
-			p.typ = r
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			break
+		}
+		text = append(text, r)
+		if runes.HasSuffix(text, pasteEnd) {
+			text = text[:len(text)-len(pasteEnd)]
 			break
 		}
-		buf.WriteRune(r)
-		r, _, _ = reader.ReadRune()
 	}
-	p.attr = buf.String()
-	return &p
+
+	ret := text[:0]
+	for i, r := range text {
+		if r == '\r' {
+			if i+1 < len(text) && text[i+1] == '\n' {
+				continue
+			}
+			r = '\n'
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// translate the Ctrl-X chords which aren't bound by Config.Chords, the
+// unknown ones cancel like Ctrl-G
+func ctrlXKey(r rune) rune {
+	switch r {
+	case CharCtrlU:
+		return CharUndo
+	case '(':
+		return MetaStartMacro
+	case ')':
+		return MetaEndMacro
+	case 'e':
+		return MetaPlayMacro
+	}
+	return CharBell
 }
 
 // translate EscX to Meta+X
@@ -196,6 +344,34 @@ func escapeKey(r rune, reader *bufio.Reader) rune {
 		r = MetaTranspose
 	case CharBackspace:
 		r = MetaBackspace
+	case CharEnter:
+		r = MetaEnter
+	case 'q':
+		r = MetaPushLine
+	case 'r':
+		r = MetaRevertLine
+	case '.':
+		r = MetaYankLastArg
+	case CharCtrlY:
+		r = MetaYankNthArg
+	case '#':
+		r = MetaInsertComment
+	case 'p':
+		r = MetaTogglePin
+	case 'n':
+		r = MetaAddCursor
+	case ' ':
+		r = MetaSetMark
+	case CharKill:
+		r = MetaKillToken
+	case CharCtrlW:
+		r = MetaBackKillToken
+	case 'y':
+		r = MetaYankPop
+	case '-':
+		r = MetaNegativeArgument
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		r = MetaDigit0 - (r - '0')
 	case 'O':
 		d, _, _ := reader.ReadRune()
 		switch d {
@@ -277,6 +453,34 @@ func (r *RawMode) Exit() error {
 	return Restore(GetStdin(), r.state)
 }
 
+// TerminalState is an opaque snapshot of the modes of the terminal
+// (termios on unix, console modes on windows).
+type TerminalState struct {
+	fd    int
+	state *State
+}
+
+// GetTerminalState saves the current modes of the terminal attached to
+// stdin, so that applications which share the terminal with other
+// libraries (pagers, spinners...) can put it back by SetTerminalState.
+func GetTerminalState() (*TerminalState, error) {
+	fd := GetStdin()
+	state, err := GetState(fd)
+	if err != nil {
+		return nil, err
+	}
+	return &TerminalState{fd: fd, state: state}, nil
+}
+
+// SetTerminalState restores the modes saved by GetTerminalState. It
+// returns an error for a nil state, e.g. when GetTerminalState failed.
+func SetTerminalState(s *TerminalState) error {
+	if s == nil || s.state == nil {
+		return errors.New("readline: no terminal state to restore")
+	}
+	return Restore(s.fd, s.state)
+}
+
 // -----------------------------------------------------------------------------
 
 func sleep(n int) {
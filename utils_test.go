@@ -1 +1,35 @@
 package readline
+
+import "testing"
+
+func TestEscapeSS3Key(t *testing.T) {
+	for _, c := range []struct {
+		typ        rune
+		navigation bool
+		expect     rune
+	}{
+		{'A', false, CharPrev},
+		{'q', false, '1'},
+		{'y', false, '9'},
+		{'k', false, '+'},
+		{'M', false, CharEnter},
+		{'q', true, CharLineEnd},
+		{'x', true, CharPrev},
+		{'u', true, 0},
+		{'k', true, '+'},
+		{'Z', false, 0},
+	} {
+		if r := escapeSS3Key(&escapeKeyPair{typ: c.typ}, c.navigation); r != c.expect {
+			t.Fatalf("%q (navigation %v): expect %q, got %q", c.typ, c.navigation, c.expect, r)
+		}
+	}
+}
+
+func TestSetTerminalStateNil(t *testing.T) {
+	if err := SetTerminalState(nil); err == nil {
+		t.Fatal("no error for a nil state")
+	}
+	if err := SetTerminalState(&TerminalState{}); err == nil {
+		t.Fatal("no error for an empty state")
+	}
+}
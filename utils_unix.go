@@ -44,6 +44,16 @@ func GetScreenWidth() int {
 	return w
 }
 
+// GetScreenHeight returns the rows of the terminal, -1 if unknown.
+func GetScreenHeight() int {
+	for _, fd := range []int{syscall.Stdout, syscall.Stderr} {
+		if _, rows, err := GetSize(fd); err == nil {
+			return rows
+		}
+	}
+	return -1
+}
+
 // ClearScreen clears the console screen
 func ClearScreen(w io.Writer) (int, error) {
 	return w.Write([]byte("\033[H"))
@@ -1,5 +1,10 @@
 package readline
 
+import (
+	"sync/atomic"
+	"unicode"
+)
+
 const (
 	VIM_NORMAL = iota
 	VIM_INSERT
@@ -7,98 +12,538 @@ const (
 )
 
 type opVim struct {
-	cfg     *Config
-	op      *Operation
+	op *Operation
+	// Config.VimMode, which any goroutine reads, see IsEnableVimMode
+	enabled int32
 	vimMode int
+
+	// the named registers "a to "z, the unnamed one is the kill buffer
+	registers map[rune][]rune
+	// the last f, F, t or T and its character, for ; and ,
+	find     rune
+	findChar rune
+	// the last change, for `.`, the text typed in the insert mode it
+	// entered is recorded until Esc
+	change    vimChange
+	recording bool
+	repeating bool
+}
+
+// vimChange is a command which changed the line, as repeated by `.`.
+type vimChange struct {
+	// the keys of the command, after the register and the count
+	keys   []rune
+	reg    rune
+	count  int
+	insert []rune
 }
 
 func newVimMode(op *Operation) *opVim {
 	ov := &opVim{
-		cfg: op.cfg,
-		op:  op,
+		op:        op,
+		registers: make(map[rune][]rune),
 	}
-	ov.SetVimMode(ov.cfg.VimMode)
+	ov.setEnabled(op.cfg.VimMode)
+	ov.vimMode = VIM_INSERT
 	return ov
 }
 
-func (o *opVim) SetVimMode(on bool) {
-	if o.cfg.VimMode && !on { // turn off
-		o.ExitVimMode()
+func (o *opVim) setEnabled(on bool) {
+	var v int32
+	if on {
+		v = 1
 	}
-	o.cfg.VimMode = on
-	o.vimMode = VIM_INSERT
+	atomic.StoreInt32(&o.enabled, v)
 }
 
 func (o *opVim) ExitVimMode() {
 	o.vimMode = VIM_INSERT
+	o.recording = false
 }
 
 func (o *opVim) IsEnableVimMode() bool {
-	return o.cfg.VimMode
+	return atomic.LoadInt32(&o.enabled) == 1
 }
 
-func (o *opVim) handleVimNormalMovement(r rune, readNext func() rune) (t rune, handled bool) {
-	rb := o.op.buf
-	handled = true
+// vim's classes of the runes: the words are runs of the same class,
+// except for the blanks. For the WORDs, there are only the blanks and the
+// others.
+const (
+	vimBlank = iota
+	vimKeyword
+	vimPunct
+)
+
+func vimClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return vimBlank
+	case big || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return vimKeyword
+	}
+	return vimPunct
+}
+
+// nextWordStart returns the start of the word after the one at i, or the
+// end of the line.
+func nextWordStart(buf []rune, i int, big bool) int {
+	if i >= len(buf) {
+		return len(buf)
+	}
+	if c := vimClass(buf[i], big); c != vimBlank {
+		for i < len(buf) && vimClass(buf[i], big) == c {
+			i++
+		}
+	}
+	for i < len(buf) && vimClass(buf[i], big) == vimBlank {
+		i++
+	}
+	return i
+}
+
+// prevWordStart returns the start of the word before i.
+func prevWordStart(buf []rune, i int, big bool) int {
+	i--
+	for i > 0 && vimClass(buf[i], big) == vimBlank {
+		i--
+	}
+	if i <= 0 {
+		return 0
+	}
+	c := vimClass(buf[i], big)
+	for i > 0 && vimClass(buf[i-1], big) == c {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the last rune of the word after i.
+func wordEnd(buf []rune, i int, big bool) int {
+	i++
+	for i < len(buf) && vimClass(buf[i], big) == vimBlank {
+		i++
+	}
+	if i >= len(buf) {
+		return len(buf) - 1
+	}
+	c := vimClass(buf[i], big)
+	for i+1 < len(buf) && vimClass(buf[i+1], big) == c {
+		i++
+	}
+	return i
+}
+
+// findRune returns the position of the count-th ch from pos for the f, F,
+// t or T command, again skips the ch right next to the cursor for ; and
+// , after t and T.
+func findRune(buf []rune, pos int, cmd, ch rune, count int, again bool) (int, bool) {
+	step := 1
+	if cmd == 'F' || cmd == 'T' {
+		step = -1
+	}
+	till := cmd == 't' || cmd == 'T'
+	i := pos + step
+	if till && again {
+		i += step
+	}
+	for ; i >= 0 && i < len(buf); i += step {
+		if buf[i] != ch {
+			continue
+		}
+		if count--; count == 0 {
+			if till {
+				i -= step
+			}
+			return i, true
+		}
+	}
+	return pos, false
+}
+
+// motion returns where the motion r moves the cursor from pos, and
+// whether the rune there is covered by an operator.
+func (o *opVim) motion(buf []rune, pos int, r rune, count int, readNext func() rune) (target int, inclusive, ok bool) {
+	target = pos
 	switch r {
-	case 'h':
-		t = CharBackward
-	case 'j':
-		t = CharNext
-	case 'k':
-		t = CharPrev
-	case 'l':
-		t = CharForward
-	case '0', '^':
-		rb.MoveToLineStart()
-	case '$':
-		rb.MoveToLineEnd()
-	case 'x':
-		rb.Delete()
-		if rb.IsCursorInEnd() {
-			rb.MoveBackward()
+	case 'h', CharBackspace, CharCtrlH:
+		target -= count
+		if target < 0 {
+			target = 0
 		}
-	case 'r':
-		rb.Replace(readNext())
-	case 'd':
-		next := readNext()
-		switch next {
-		case 'd':
-			rb.Erase()
-		case 'w':
-			rb.DeleteWord()
-		case 'h':
-			rb.Backspace()
-		case 'l':
-			rb.Delete()
+	case 'l', ' ':
+		target += count
+		if target > len(buf) {
+			target = len(buf)
 		}
-	case 'p':
-		rb.Yank()
-	case 'b', 'B':
-		rb.MoveToPrevWord()
+	case '0':
+		target = 0
+	case '^':
+		target = 0
+		for target < len(buf) && vimClass(buf[target], false) == vimBlank {
+			target++
+		}
+	case '$':
+		target = len(buf)
 	case 'w', 'W':
-		rb.MoveToNextWord()
+		for ; count > 0; count-- {
+			target = nextWordStart(buf, target, r == 'W')
+		}
+	case 'b', 'B':
+		for ; count > 0; count-- {
+			target = prevWordStart(buf, target, r == 'B')
+		}
 	case 'e', 'E':
-		rb.MoveToEndWord()
+		for ; count > 0; count-- {
+			target = wordEnd(buf, target, r == 'E')
+		}
+		return target, true, target >= 0
 	case 'f', 'F', 't', 'T':
-		next := readNext()
-		prevChar := r == 't' || r == 'T'
-		reverse := r == 'F' || r == 'T'
-		switch next {
-		case CharEsc:
-		default:
-			rb.MoveTo(next, prevChar, reverse)
+		ch := readNext()
+		if ch == CharEsc {
+			return pos, false, false
+		}
+		o.find, o.findChar = r, ch
+		target, ok = findRune(buf, pos, r, ch, count, false)
+		return target, r == 'f' || r == 't', ok
+	case ';', ',':
+		cmd := o.find
+		if cmd == 0 {
+			return pos, false, false
+		}
+		if r == ',' {
+			cmd = map[rune]rune{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}[cmd]
+		}
+		target, ok = findRune(buf, pos, cmd, o.findChar, count, true)
+		return target, cmd == 'f' || cmd == 't', ok
+	default:
+		return pos, false, false
+	}
+	return target, false, true
+}
+
+// textObject returns the range of the text object of obj around pos, the
+// inner one or the one with the surrounding quotes, brackets or blanks.
+func textObject(buf []rune, pos int, around bool, obj rune) (start, end int, ok bool) {
+	if len(buf) == 0 {
+		return 0, 0, false
+	}
+	if pos >= len(buf) {
+		pos = len(buf) - 1
+	}
+	switch obj {
+	case 'w', 'W':
+		start, end = wordObject(buf, pos, around, obj == 'W')
+		return start, end, true
+	case '"', '\'', '`':
+		return quoteObject(buf, pos, around, obj)
+	case '(', ')', 'b':
+		return bracketObject(buf, pos, around, '(', ')')
+	case '[', ']':
+		return bracketObject(buf, pos, around, '[', ']')
+	case '{', '}', 'B':
+		return bracketObject(buf, pos, around, '{', '}')
+	case '<', '>':
+		return bracketObject(buf, pos, around, '<', '>')
+	}
+	return 0, 0, false
+}
+
+// wordObject returns the word, or the blanks, at pos. Around it, the
+// blanks after the word are taken too, or else the ones before it, and the
+// word after the blanks.
+func wordObject(buf []rune, pos int, around, big bool) (start, end int) {
+	c := vimClass(buf[pos], big)
+	start, end = pos, pos+1
+	for start > 0 && vimClass(buf[start-1], big) == c {
+		start--
+	}
+	for end < len(buf) && vimClass(buf[end], big) == c {
+		end++
+	}
+	if !around {
+		return start, end
+	}
+	if c == vimBlank {
+		if end < len(buf) {
+			next := vimClass(buf[end], big)
+			for end < len(buf) && vimClass(buf[end], big) == next {
+				end++
+			}
+		}
+		return start, end
+	}
+	blanks := end
+	for blanks < len(buf) && vimClass(buf[blanks], big) == vimBlank {
+		blanks++
+	}
+	if blanks > end {
+		return start, blanks
+	}
+	for start > 0 && vimClass(buf[start-1], big) == vimBlank {
+		start--
+	}
+	return start, end
+}
+
+// quoteObject returns the quoted text around pos, or else the next one on
+// the line. The quotes escaped by a backslash don't count.
+func quoteObject(buf []rune, pos int, around bool, q rune) (start, end int, ok bool) {
+	var quotes []int
+	for i, c := range buf {
+		if c == q && (i == 0 || buf[i-1] != '\\') {
+			quotes = append(quotes, i)
+		}
+	}
+	for i := 0; i+1 < len(quotes); i += 2 {
+		open, close := quotes[i], quotes[i+1]
+		if pos > close {
+			continue
 		}
+		if !around {
+			return open + 1, close, true
+		}
+		end = close + 1
+		for end < len(buf) && vimClass(buf[end], false) == vimBlank {
+			end++
+		}
+		return open, end, true
+	}
+	return 0, 0, false
+}
+
+// bracketObject returns the text within the innermost pair of brackets
+// around pos.
+func bracketObject(buf []rune, pos int, around bool, open, close rune) (start, end int, ok bool) {
+	start = -1
+	depth := 0
+	for i := pos; i >= 0 && start < 0; i-- {
+		switch {
+		case buf[i] == close && i != pos:
+			depth++
+		case buf[i] == open && depth == 0:
+			start = i
+		case buf[i] == open:
+			depth--
+		}
+	}
+	if start < 0 {
+		return 0, 0, false
+	}
+	for i := start + 1; i < len(buf); i++ {
+		switch {
+		case buf[i] == open:
+			depth++
+		case buf[i] == close && depth == 0:
+			if around {
+				return start, i + 1, true
+			}
+			return start + 1, i, true
+		case buf[i] == close:
+			depth--
+		}
+	}
+	return 0, 0, false
+}
+
+// operand reads the motion or the text object of the operator op and
+// returns the range it covers. The count typed after the operator
+// multiplies the one before it.
+func (o *opVim) operand(op rune, count int, readNext func() rune) (start, end int, ok bool) {
+	next := readNext()
+	if next >= '1' && next <= '9' {
+		n := 0
+		for next >= '0' && next <= '9' {
+			n = n*10 + int(next-'0')
+			next = readNext()
+		}
+		count *= n
+	}
+
+	rb := o.op.buf
+	buf, pos := rb.Runes(), rb.Pos()
+	switch {
+	case next == op:
+		return 0, len(buf), true
+	case next == 'i' || next == 'a':
+		return textObject(buf, pos, next == 'a', readNext())
+	case op == 'c' && (next == 'w' || next == 'W') && pos < len(buf) && vimClass(buf[pos], false) != vimBlank:
+		// cw changes up to the end of the word, like ce
+		next += 'e' - 'w'
+	}
+	target, inclusive, ok := o.motion(buf, pos, next, count, readNext)
+	if !ok {
+		return 0, 0, false
+	}
+	start, end = pos, target
+	if end < start {
+		start, end = end, start
+	} else if inclusive {
+		end++
+	}
+	if end > len(buf) {
+		end = len(buf)
+	}
+	return start, end, true
+}
+
+// apply runs the operator op on the range [start, end), the text is put
+// into the register reg as well as into the kill buffer, unless reg is the
+// black hole register "_.
+func (o *opVim) apply(op, reg rune, start, end int) {
+	rb := o.op.buf
+	buf := rb.Runes()
+	if end > len(buf) {
+		end = len(buf)
+	}
+	if start > end {
+		start = end
+	}
+	// each command is a kill of its own
+	rb.SetAppendKill(false)
+	text := append([]rune(nil), buf[start:end]...)
+	switch {
+	case op == 'y':
+		rb.CopyRange(start, end)
+		rb.SetPos(start)
+	case reg == '_':
+		// the black hole register keeps the kill buffer as it is
+		rb.SetWithIdx(start, append(buf[:start], buf[end:]...))
 	default:
-		return r, false
+		rb.KillRange(start, end)
+	}
+	o.setRegister(reg, text)
+	if op == 'c' {
+		o.EnterVimInsertMode()
+	}
+}
+
+func isClipboardRegister(r rune) bool {
+	return r == '+' || r == '*'
+}
+
+// setRegister puts text into the register reg, an uppercase letter
+// appends it to the register of the lowercase one.
+func (o *opVim) setRegister(reg rune, text []rune) {
+	switch {
+	case isClipboardRegister(reg):
+		o.op.getClipboard().Write(string(text))
+	case reg >= 'a' && reg <= 'z':
+		o.registers[reg] = append([]rune(nil), text...)
+	case reg >= 'A' && reg <= 'Z':
+		reg = unicode.ToLower(reg)
+		o.registers[reg] = append(o.registers[reg], text...)
+	}
+}
+
+// register returns the text of the register reg, the kill buffer if it's
+// the unnamed one.
+func (o *opVim) register(reg rune) ([]rune, bool) {
+	switch {
+	case reg == 0 || reg == '"':
+		return o.op.buf.lastKill, true
+	case isClipboardRegister(reg):
+		text, err := o.op.getClipboard().Read()
+		return []rune(text), err == nil
+	case unicode.IsLetter(reg):
+		text, ok := o.registers[unicode.ToLower(reg)]
+		return text, ok
+	}
+	return nil, false
+}
+
+// put pastes the register reg count times, after the cursor for p and
+// before it for P. The cursor is left on the last rune pasted.
+func (o *opVim) put(cmd, reg rune, count int) {
+	text, ok := o.register(reg)
+	if !ok || len(text) == 0 {
+		o.op.t.Bell()
+		return
+	}
+	rb := o.op.buf
+	var pasted []rune
+	for ; count > 0; count-- {
+		pasted = append(pasted, text...)
+	}
+	if cmd == 'p' && !rb.IsCursorInEnd() {
+		rb.MoveForward()
 	}
-	return t, true
+	rb.WriteRunes(pasted)
+	rb.MoveBackward()
 }
 
-func (o *opVim) handleVimNormalEnterInsert(r rune, readNext func() rune) (t rune, handled bool) {
+// normal runs the command r of the normal mode, with the register reg and
+// the count, which is 0 if none was typed. It returns the key for the
+// ioloop to handle, and whether the command changed the line.
+func (o *opVim) normal(r, reg rune, count int, readNext func() rune) (t rune, changed bool) {
 	rb := o.op.buf
-	handled = true
+	n := count
+	if n == 0 {
+		n = 1
+	}
 	switch r {
+	case 'j', '+':
+		return CharNext, false
+	case 'k', '-':
+		return CharPrev, false
+	case 'd', 'c', 'y':
+		start, end, ok := o.operand(r, n, readNext)
+		if !ok {
+			o.op.t.Bell()
+			return 0, false
+		}
+		o.apply(r, reg, start, end)
+		return 0, r != 'y'
+	case 'D', 'C':
+		o.apply(unicode.ToLower(r), reg, rb.Pos(), rb.Len())
+		return 0, true
+	case 'Y':
+		o.apply('y', reg, 0, rb.Len())
+		return 0, false
+	case 'x':
+		o.apply('d', reg, rb.Pos(), rb.Pos()+n)
+		if rb.IsCursorInEnd() {
+			rb.MoveBackward()
+		}
+		return 0, true
+	case 'X':
+		if pos := rb.Pos(); pos > 0 {
+			o.apply('d', reg, pos-n, pos)
+		}
+		return 0, true
+	case 's':
+		o.apply('c', reg, rb.Pos(), rb.Pos()+n)
+		return 0, true
+	case 'S':
+		o.apply('c', reg, 0, rb.Len())
+		return 0, true
+	case 'p', 'P':
+		o.put(r, reg, n)
+		return 0, true
+	case 'r':
+		ch := readNext()
+		buf, pos := rb.Runes(), rb.Pos()
+		if ch == CharEsc || pos+n > len(buf) {
+			return 0, false
+		}
+		for i := pos; i < pos+n; i++ {
+			buf[i] = ch
+		}
+		rb.SetWithIdx(pos+n-1, buf)
+		return 0, true
+	case '~':
+		buf, pos := rb.Runes(), rb.Pos()
+		if pos+n > len(buf) {
+			n = len(buf) - pos
+		}
+		for i := pos; i < pos+n; i++ {
+			if unicode.IsUpper(buf[i]) {
+				buf[i] = unicode.ToLower(buf[i])
+			} else {
+				buf[i] = unicode.ToUpper(buf[i])
+			}
+		}
+		rb.SetWithIdx(pos+n, buf)
+		return 0, true
 	case 'i':
 	case 'I':
 		rb.MoveToLineStart()
@@ -106,48 +551,104 @@ func (o *opVim) handleVimNormalEnterInsert(r rune, readNext func() rune) (t rune
 		rb.MoveForward()
 	case 'A':
 		rb.MoveToLineEnd()
-	case 's':
-		rb.Delete()
-	case 'S':
-		rb.Erase()
-	case 'c':
-		next := readNext()
-		switch next {
-		case 'c':
-			rb.Erase()
-		case 'w':
-			rb.DeleteWord()
-		case 'h':
-			rb.Backspace()
-		case 'l':
-			rb.Delete()
-		}
 	default:
-		return r, false
+		target, _, ok := o.motion(rb.Runes(), rb.Pos(), r, n, readNext)
+		if !ok {
+			// invalid operation
+			o.op.t.Bell()
+			return 0, false
+		}
+		rb.SetPos(target)
+		return 0, false
 	}
-
 	o.EnterVimInsertMode()
-	return
+	return 0, true
 }
 
+// HandleVimNormal handles a command of the normal mode, which may begin
+// with a register, "a to "z, "A to "Z to append to it or "+ and "* for the
+// clipboard, and with a count, e.g. `"a3dw`.
 func (o *opVim) HandleVimNormal(r rune, readNext func() rune) (t rune) {
 	switch r {
 	case CharEnter, CharInterrupt:
 		o.ExitVimMode()
 		return r
+	case 'u':
+		return CharUndo
+	case CharBckSearch:
+		return MetaRedo
 	}
 
-	if r, handled := o.handleVimNormalMovement(r, readNext); handled {
-		return r
+	var reg rune
+	count := 0
+	for {
+		if r == '"' {
+			reg = readNext()
+			r = readNext()
+			continue
+		}
+		if r >= '1' && r <= '9' || r == '0' && count > 0 {
+			count = count*10 + int(r-'0')
+			r = readNext()
+			continue
+		}
+		break
+	}
+	if r == '.' {
+		o.repeat(count)
+		return 0
 	}
 
-	if r, handled := o.handleVimNormalEnterInsert(r, readNext); handled {
-		return r
+	keys := []rune{r}
+	t, changed := o.normal(r, reg, count, func() rune {
+		next := readNext()
+		keys = append(keys, next)
+		return next
+	})
+	if changed && !o.repeating {
+		o.change = vimChange{keys: keys, reg: reg, count: count}
+		o.recording = o.vimMode == VIM_INSERT
+	}
+	return t
+}
+
+// repeat runs the last change again, with count instead of its own if
+// one was typed, and inserts the text typed after it again.
+func (o *opVim) repeat(count int) {
+	c := o.change
+	if len(c.keys) == 0 {
+		o.op.t.Bell()
+		return
+	}
+	if count == 0 {
+		count = c.count
 	}
+	keys := c.keys[1:]
+	o.repeating = true
+	o.normal(c.keys[0], c.reg, count, func() rune {
+		if len(keys) == 0 {
+			return CharEsc
+		}
+		next := keys[0]
+		keys = keys[1:]
+		return next
+	})
+	o.repeating = false
+	o.change.count = count
 
-	// invalid operation
-	o.op.t.Bell()
-	return 0
+	if o.vimMode != VIM_INSERT {
+		return
+	}
+	rb := o.op.buf
+	for _, r := range c.insert {
+		switch {
+		case r == CharBackspace || r == CharCtrlH:
+			rb.Backspace()
+		case unicode.IsPrint(r):
+			rb.WriteRune(r)
+		}
+	}
+	o.ExitVimInsertMode()
 }
 
 func (o *opVim) EnterVimInsertMode() {
@@ -156,6 +657,7 @@ func (o *opVim) EnterVimInsertMode() {
 
 func (o *opVim) ExitVimInsertMode() {
 	o.vimMode = VIM_NORMAL
+	o.recording = false
 }
 
 func (o *opVim) HandleVim(r rune, readNext func() rune) rune {
@@ -166,6 +668,9 @@ func (o *opVim) HandleVim(r rune, readNext func() rune) rune {
 		o.ExitVimInsertMode()
 		return 0
 	}
+	if o.recording {
+		o.change.insert = append(o.change.insert, r)
+	}
 
 	switch o.vimMode {
 	case VIM_INSERT:
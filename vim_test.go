@@ -0,0 +1,77 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestVimMode(t *testing.T) {
+	for _, c := range []struct {
+		input  string
+		expect string
+	}{
+		// counts
+		{"one two three four\x1b03dw\r", "four"},
+		{"one two three four\x1b0d2w\r", "three four"},
+		{"one two three four\x1b02d2w\r", ""},
+		{"abcdef\x1b03x\r", "def"},
+		{"abc def\x1b0cwxyz\x1b\r", "xyz def"},
+		// f, t and the repeats of them
+		{"a,b,c,d\x1b0f,;D\r", "a,b"},
+		{"a,b,c,d\x1b$F,,x\r", "a,b,cd"},
+		{"a,b,c,d\x1b0dt,\r", ",b,c,d"},
+		{"a,b,c,d\x1b0d2f,\r", "c,d"},
+		// text objects
+		{"foo bar baz\x1b0wciwqux\x1b\r", "foo qux baz"},
+		{"foo bar baz\x1b0wdaw\r", "foo baz"},
+		{`echo "hello world" x` + "\x1b0di\"\r", `echo "" x`},
+		{`echo "hello world" x` + "\x1b0da\"\r", "echo x"},
+		{"f(a, (b), c)\x1b0fbci(x\x1b\r", "f(a, (x), c)"},
+		{"f(a, (b), c)\x1b0fadi)\r", "f()"},
+		{"x [1, 2] y\x1b0f1da[\r", "x  y"},
+		// registers
+		{"foo bar\x1b0\"ayiw$\"ap\r", "foo barfoo"},
+		{"foo bar\x1b0\"ayw\"Ayw\"aP\r", "foo foo foo bar"},
+		{"foo bar\x1b0dw\"_x$p\r", "arfoo "},
+		// repeat
+		{"a b c d\x1b0dw.\r", "c d"},
+		{"a b c d\x1b0dw2.\r", "d"},
+		{"foo foo foo\x1b0cwbar\x1bw.w.\r", "bar bar bar"},
+		{"abcdef\x1b02x.\r", "ef"},
+		{"ab\x1b0ix\x1bl.\r", "xaxb"},
+		// other commands
+		{"hello\x1b03~\r", "HELlo"},
+		{"hello\x1b02rx\r", "xxllo"},
+		{"one two\x1b0wD\r", "one "},
+		{"one two\x1b0wC2\x1b\r", "one 2"},
+		{"one two\x1bddafoo\x1b\r", "foo"},
+		{"one two\x1b0yyP\r", "one twoone two"},
+	} {
+		rl, w := newTestInstance(t, &Config{
+			VimMode: true,
+		})
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.expect {
+			t.Errorf("%q: result not expect %q %v", c.input, line, err)
+		}
+		w.Close()
+		rl.Close()
+	}
+}
+
+func TestSetVimMode(t *testing.T) {
+	rl, w := newTestInstance(t, nil)
+
+	// the mode is switched at once, Esc is read as a key of its own
+	rl.SetVimMode(true)
+	if !rl.IsVimMode() {
+		t.Fatal("vim mode not set")
+	}
+	go w.Write([]byte("abc\x1b0ix\r"))
+	if line, err := rl.Readline(); err != nil || line != "xabc" {
+		t.Fatal("result not expect", line, err)
+	}
+	rl.SetVimMode(false)
+	if rl.IsVimMode() {
+		t.Fatal("vim mode not unset")
+	}
+}
@@ -0,0 +1,223 @@
+package readline
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Widget runs an Instance on a Screen rather than on a terminal, to embed
+// the line editor in the applications which draw their own screen, e.g.
+// with tview or Bubble Tea: they give it the keys they read, and draw the
+// cells of its Screen where the input goes. The editing is the one of the
+// terminal, with the keymap, the history and the completion of the
+// Config. Readline blocks as usual, it's called from a goroutine of its
+// own.
+type Widget struct {
+	*Instance
+	screen *Screen
+	input  *widgetInput
+	resize func()
+}
+
+// NewWidget returns a Widget of the given size. The Stdin, the outputs and
+// the functions of the terminal of cfg are replaced. onChange is called
+// after each change of the Screen, from the goroutine of the line editor,
+// e.g. to send a message to the application to draw it again.
+func NewWidget(cfg *Config, width, height int, onChange func()) (*Widget, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	w := &Widget{
+		screen: NewScreen(width, height),
+		input:  newWidgetInput(),
+	}
+	w.screen.onChange = onChange
+	noop := func() error { return nil }
+	cfg.Stdin = w.input
+	cfg.Stdout, cfg.Stderr, cfg.PromptWriter = w.screen, w.screen, w.screen
+	cfg.FuncIsTerminal = func() bool { return true }
+	cfg.FuncMakeRaw, cfg.FuncExitRaw = noop, noop
+	cfg.FuncGetWidth = func() int {
+		width, _ := w.screen.Size()
+		return width
+	}
+	cfg.FuncGetHeight = func() int {
+		_, height := w.screen.Size()
+		return height
+	}
+	cfg.FuncOnWidthChanged = func(f func()) {
+		w.resize = f
+	}
+	rl, err := NewEx(cfg)
+	if err != nil {
+		return nil, err
+	}
+	w.Instance = rl
+	return w, nil
+}
+
+// Screen returns where the line editor is drawn.
+func (w *Widget) Screen() *Screen {
+	return w.screen
+}
+
+// Feed passes the bytes a terminal sends for the keys, e.g. "\033[A" for
+// Up, it never blocks.
+func (w *Widget) Feed(b []byte) {
+	w.input.feed(b)
+}
+
+// FeedKey passes the key of the given name, see KeyBytes, or else the
+// name as the text typed. It returns false if it's neither.
+func (w *Widget) FeedKey(name string) bool {
+	if b, ok := KeyBytes(name); ok {
+		w.Feed(b)
+		return true
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		w.Feed([]byte(name))
+		return true
+	}
+	return false
+}
+
+// Close closes the Instance and its input.
+func (w *Widget) Close() error {
+	w.input.Close()
+	return w.Instance.Close()
+}
+
+// Resize changes the size of the Screen and draws the line again for it,
+// at the top of the cleared Screen: unlike a terminal, the Screen doesn't
+// wrap again the rows it holds. The line editor draws it, it's safe to
+// call while the keys are fed.
+func (w *Widget) Resize(width, height int) {
+	w.screen.Resize(width, height)
+	if w.resize != nil {
+		w.resize()
+	}
+	w.screen.Write([]byte("\033[H\033[2J"))
+	w.Instance.Redraw()
+}
+
+// widgetInput is the Stdin of a Widget, fed without blocking.
+type widgetInput struct {
+	m      sync.Mutex
+	cond   *sync.Cond
+	buf    []byte
+	closed bool
+}
+
+func newWidgetInput() *widgetInput {
+	in := &widgetInput{}
+	in.cond = sync.NewCond(&in.m)
+	return in
+}
+
+func (in *widgetInput) feed(b []byte) {
+	in.m.Lock()
+	in.buf = append(in.buf, b...)
+	in.m.Unlock()
+	in.cond.Broadcast()
+}
+
+func (in *widgetInput) Read(b []byte) (int, error) {
+	in.m.Lock()
+	defer in.m.Unlock()
+	for len(in.buf) == 0 && !in.closed {
+		in.cond.Wait()
+	}
+	if len(in.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, in.buf)
+	in.buf = in.buf[n:]
+	return n, nil
+}
+
+func (in *widgetInput) Close() error {
+	in.m.Lock()
+	in.closed = true
+	in.m.Unlock()
+	in.cond.Broadcast()
+	return nil
+}
+
+var widgetKeys = map[string]string{
+	"enter":     "\r",
+	"tab":       "\t",
+	"shift+tab": "\033[Z",
+	"backtab":   "\033[Z",
+	"backspace": "\x7f",
+	"delete":    "\033[3~",
+	"esc":       "\033",
+	"escape":    "\033",
+	"space":     " ",
+	"insert":    "\033[2~",
+	"pgup":      "\033[5~",
+	"pgdown":    "\033[6~",
+	"pgdn":      "\033[6~",
+}
+
+// the keys which take the xterm modifier parameter
+var widgetCursorKeys = map[string]byte{
+	"up": 'A', "down": 'B', "right": 'C', "left": 'D', "home": 'H', "end": 'F',
+}
+
+// KeyBytes returns the bytes a terminal sends for the key of the given
+// name, as Bubble Tea's KeyMsg.String or tcell's EventKey.Name spell it,
+// in any case: "enter", "up", "ctrl+a", "alt+b", "ctrl+left",
+// "shift+tab", "pgdown" or "Alt+Rune[x]". It returns false for the
+// unknown names and the text, which is fed as is.
+func KeyBytes(name string) ([]byte, bool) {
+	key := strings.ToLower(name)
+	if strings.HasPrefix(key, "rune[") && strings.HasSuffix(name, "]") {
+		return []byte(name[5 : len(name)-1]), true
+	}
+	if seq, ok := widgetKeys[key]; ok {
+		return []byte(seq), true
+	}
+	if c, ok := widgetCursorKeys[key]; ok {
+		return []byte{'\033', '[', c}, true
+	}
+	i := strings.IndexByte(key, '+')
+	if i <= 0 || i == len(key)-1 {
+		return nil, false
+	}
+	mod, rest := key[:i], name[i+1:]
+	lower := strings.ToLower(rest)
+	if c, ok := widgetCursorKeys[lower]; ok {
+		param := map[string]byte{"shift": '2', "alt": '3', "ctrl": '5'}[mod]
+		if param == 0 {
+			return nil, false
+		}
+		return []byte{'\033', '[', '1', ';', param, c}, true
+	}
+	switch mod {
+	case "alt":
+		if seq, ok := KeyBytes(rest); ok {
+			return append([]byte{'\033'}, seq...), true
+		}
+		if utf8.RuneCountInString(rest) == 1 {
+			return append([]byte{'\033'}, rest...), true
+		}
+	case "ctrl":
+		if len(lower) != 1 {
+			if lower == "space" {
+				return []byte{0}, true
+			}
+			return nil, false
+		}
+		switch c := lower[0]; {
+		case c >= 'a' && c <= 'z':
+			return []byte{c - 'a' + 1}, true
+		case c == '@' || c == ' ':
+			return []byte{0}, true
+		case c >= '[' && c <= '_':
+			return []byte{c - '@'}, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,137 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScreen(t *testing.T) {
+	s := NewScreen(5, 2)
+	s.Write([]byte("abcde"))
+	if row, col := s.Cursor(); row != 0 || col != 4 {
+		t.Fatal("cursor not expect", row, col)
+	}
+	// the full row wraps with the next rune and scrolls at the bottom
+	s.Write([]byte("f\n\033[1mg\033[0m\033[2D\033[K"))
+	if got := s.String(); got != "f\n" {
+		t.Fatalf("result not expect %q", got)
+	}
+	s.Write([]byte("中\033["))
+	s.Write([]byte("4mx"))
+	cells := s.Cells()
+	if cells[1][0].Rune != '中' || cells[1][1].Rune != 0 || cells[1][2] != (Cell{'x', "4"}) {
+		t.Fatal("cells not expect", cells[1])
+	}
+}
+
+func TestKeyBytes(t *testing.T) {
+	for name, expect := range map[string]string{
+		"enter":       "\r",
+		"ctrl+a":      "\x01",
+		"Ctrl+W":      "\x17",
+		"alt+b":       "\033b",
+		"Alt+Rune[f]": "\033f",
+		"ctrl+left":   "\033[1;5D",
+		"shift+tab":   "\033[Z",
+		"PgDn":        "\033[6~",
+		"alt+enter":   "\033\r",
+	} {
+		if got, ok := KeyBytes(name); !ok || string(got) != expect {
+			t.Fatalf("%s: expect %q, got %q", name, expect, got)
+		}
+	}
+	if _, ok := KeyBytes("x"); ok {
+		t.Fatal("text is not a key")
+	}
+}
+
+func TestWidget(t *testing.T) {
+	changed := make(chan struct{}, 1000)
+	w, err := NewWidget(&Config{Prompt: "> "}, 10, 3, func() {
+		changed <- struct{}{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.SaveHistory("earlier")
+
+	wait := func(expect string) {
+		deadline := time.After(time.Second)
+		for w.Screen().String() != expect {
+			select {
+			case <-changed:
+			case <-deadline:
+				t.Fatalf("expect %q, got %q", expect, w.Screen().String())
+			}
+		}
+	}
+	result := make(chan string)
+	go func() {
+		line, _ := w.Readline()
+		result <- line
+	}()
+	for _, key := range []string{"h", "i", "left", "ctrl+a", "x", "end", "!"} {
+		if !w.FeedKey(key) {
+			t.Fatal("unknown key", key)
+		}
+	}
+	wait("> xhi!\n\n")
+	if row, col := w.Screen().Cursor(); row != 0 || col != 6 {
+		t.Fatal("cursor not expect", row, col)
+	}
+	w.Feed([]byte("\x15"))
+	w.FeedKey("up")
+	wait("> earlier\n\n")
+
+	// the line wraps at the width of the Screen
+	w.Resize(6, 3)
+	wait("> earl\nier\n")
+	w.FeedKey("enter")
+	if line := <-result; line != "earlier" {
+		t.Fatal("result not expect", line)
+	}
+	if !strings.HasPrefix(w.Screen().String(), "> earl\nier") {
+		t.Fatalf("result not expect %q", w.Screen().String())
+	}
+}
+
+func TestWidgetResizeRace(t *testing.T) {
+	w, err := NewWidget(&Config{
+		Prompt:       "> ",
+		AutoComplete: NewPrefixCompleter(PcItem("alpha"), PcItem("alps"), PcItem("beta")),
+	}, 20, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	result := make(chan string)
+	go func() {
+		line, _ := w.Readline()
+		result <- line
+	}()
+
+	// the UI resizes the Widget while the line editor handles the keys,
+	// e.g. opens the menu: run with -race
+	for i := 0; i < 50; i++ {
+		w.FeedKey("a")
+		w.FeedKey("tab")
+		w.FeedKey("tab")
+		w.Resize(10+i%10, 3+i%3)
+		w.Redraw()
+		time.Sleep(time.Millisecond)
+		w.FeedKey("ctrl+g")
+		w.FeedKey("ctrl+u")
+	}
+	w.FeedKey("b")
+	w.FeedKey("enter")
+	select {
+	case line := <-result:
+		if line != "b" {
+			t.Fatal("result not expect", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line read")
+	}
+}
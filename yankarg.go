@@ -0,0 +1,86 @@
+package readline
+
+// opYankArg inserts the arguments of the previous commands, like
+// yank-last-arg (Meta-.) and yank-nth-arg (Meta-Ctrl-Y) of GNU readline.
+// Repeating the key replaces the inserted argument: Meta-. goes on with
+// the last argument of the commands before, Meta-Ctrl-Y with the next
+// argument of the same command.
+type opYankArg struct {
+	key      rune
+	depth    int // the history item, 1 for the previous one
+	nth      int // the argument, 0 is the command itself
+	inserted int // the length of the inserted argument
+}
+
+func (o *opYankArg) reset() {
+	o.key = 0
+}
+
+func (o *Operation) yankArg(r rune) {
+	y := &o.yankArgs
+	depth, nth := 1, 1
+	if y.key == r {
+		depth, nth = y.depth, y.nth
+		if r == MetaYankLastArg {
+			depth++
+		} else {
+			nth++
+		}
+	} else {
+		y.inserted = 0
+	}
+
+	line := o.history.Recent(depth)
+	if line == nil {
+		o.t.Bell()
+		return
+	}
+	args := splitArgs(line)
+	var arg []rune
+	if r == MetaYankLastArg {
+		if len(args) > 0 {
+			arg = args[len(args)-1]
+		}
+	} else if nth < len(args) {
+		arg = args[nth]
+	} else {
+		o.t.Bell()
+		return
+	}
+
+	o.buf.ReplaceBefore(y.inserted, arg)
+	y.key, y.depth, y.nth, y.inserted = r, depth, nth, len(arg)
+}
+
+// splitArgs splits line by the spaces out of quotes, the words are kept
+// as they are typed, quotes and escapes included.
+func splitArgs(line []rune) [][]rune {
+	var args [][]rune
+	start := -1
+	var quote rune
+	for i := 0; i < len(line); i++ {
+		r := line[i]
+		if quote == 0 && (r == ' ' || r == '\t') {
+			if start >= 0 {
+				args = append(args, line[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		switch {
+		case r == '\\' && quote != '\'':
+			i++
+		case r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+		}
+	}
+	if start >= 0 {
+		args = append(args, line[start:])
+	}
+	return args
+}
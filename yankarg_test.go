@@ -0,0 +1,27 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestYankArg(t *testing.T) {
+	rl, w := newTestInstance(t, &Config{
+		DisableAutoSaveHistory: true,
+	})
+	rl.SaveHistory("cp a.txt 'my file'")
+	rl.SaveHistory("ls dir")
+
+	for _, c := range []struct {
+		input, line string
+	}{
+		{"vi \x1b.\r", "vi dir"},
+		{"vi \x1b.\x1b.\x1b.\r", "vi 'my file'"},
+		{"vi \x1b\x19\x1b\x19\r", "vi dir"},
+		{"x\x1b\x19\r", "xdir"},
+	} {
+		go w.Write([]byte(c.input))
+		if line, err := rl.Readline(); err != nil || line != c.line {
+			t.Fatalf("result not expect %q: %q %v", c.input, line, err)
+		}
+	}
+}